@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// altScreen switches to the terminal's alternate screen, which the
+	// animation is drawn on so the stage printed after it is left on the
+	// normal one, and mainScreen switches back
+	altScreen  = "\x1b[?1049h"
+	mainScreen = "\x1b[?1049l"
+	// beginFrame and endFrame have terminals that support synchronized
+	// output hold off painting until the whole frame has arrived, so it is
+	// never shown half drawn; others ignore them
+	beginFrame = "\x1b[?2026h"
+	endFrame   = "\x1b[?2026l"
+)
+
+// drawChanges writes the next frame of the animation to w. The first frame
+// clears the terminal and draws as much of the stage as fits, around its
+// middle; after that only the cells whose glyphs changed since are redrawn,
+// by moving the cursor to each. In a terminal, the keys pressed since the
+// last frame are taken after it is drawn.
+func (s *Stage) drawChanges(w io.Writer) error {
+	if s.drawn == nil {
+		s.drawn = make([]rune, len(s.cell))
+		glyph := s.glyphs(true)
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				s.drawn[(y-1)*s.width+x-1] = glyph(x, y)
+			}
+		}
+		if rows, _ := terminalOf(w); rows > 0 && s.controls == nil {
+			s.controls = newAnimationControls()
+		}
+		return s.redraw(w)
+	}
+
+	// a wall's glyph joins up with its neighbors, so check around every cell
+	// that was set as well
+	var frame []cellChange
+	for _, i := range s.dirty {
+		x, y := i%s.width+1, i/s.width+1
+		for _, c := range [][2]int{{x, y}, {x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if !s.cellExists(c[0], c[1]) {
+				continue
+			}
+			j := (c[1]-1)*s.width + c[0] - 1
+			if r := s.glyph(c[0], c[1], true); r != s.drawn[j] {
+				frame = append(frame, cellChange{j, s.drawn[j], r})
+				s.drawn[j] = r
+			}
+		}
+	}
+	s.dirty = s.dirty[:0]
+	if len(frame) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, c := range frame {
+		s.drawCell(&b, c.i, c.now)
+	}
+	if c := s.controls; c != nil {
+		c.frames = append(c.frames, frame)
+		if len(c.frames) > rewindFrames {
+			c.frames = c.frames[1:]
+		}
+	}
+	if b.Len() != 0 {
+		// leave the cursor below the stage
+		fmt.Fprintf(&b, "\x1b[%d;1H", s.shown.Dy()+1)
+		if _, err := io.WriteString(w, beginFrame+b.String()+endFrame); err != nil {
+			return err
+		}
+	}
+	return s.takeKeys(w)
+}
+
+// redraw clears the terminal and draws as much of the stage as fits on it
+// again, as it stands in the frame being shown
+func (s *Stage) redraw(w io.Writer) error {
+	// the cursor is left on the line below the stage
+	rows, cols := terminalOf(w)
+	s.shown = s.view(rows-1, cols, s.width/2+1, s.height/2+1)
+	shown := s.drawn
+	if c := s.controls; c != nil && c.back > 0 {
+		shown = append([]rune(nil), s.drawn...)
+		for i := len(c.frames) - 1; i >= len(c.frames)-c.back; i-- {
+			for _, change := range c.frames[i] {
+				shown[change.i] = change.was
+			}
+		}
+	}
+	var b strings.Builder
+	b.WriteString(altScreen + beginFrame + clearScreen)
+	for y := s.shown.Min.Y; y < s.shown.Max.Y; y++ {
+		for x := s.shown.Min.X; x < s.shown.Max.X; x++ {
+			b.WriteRune(shown[(y-1)*s.width+x-1])
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(endFrame)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// drawCell writes r to w where cell i is on the terminal, if it's shown
+func (s *Stage) drawCell(w io.Writer, i int, r rune) {
+	x, y := i%s.width+1, i/s.width+1
+	if image.Pt(x, y).In(s.shown) {
+		fmt.Fprintf(w, "\x1b[%d;%dH%c", y-s.shown.Min.Y+1, x-s.shown.Min.X+1, r)
+	}
+}
+
+// rewindFrames is how many of the last frames of the animation can be
+// rewound
+const rewindFrames = 500
+
+// animationControls let whoever is watching the animation in a terminal
+// pause it with space, step it a frame at a time with '.', and rewind it a
+// frame at a time with ','. frames are the cells each of the last frames
+// drew, oldest first, and back how many of them are rewound.
+type animationControls struct {
+	keys    *keyboard
+	restore func()
+	paused  bool
+	frames  [][]cellChange
+	back    int
+}
+
+// cellChange is a cell a frame of the animation drew, with its glyph before
+// and after
+type cellChange struct {
+	i        int
+	was, now rune
+}
+
+// newAnimationControls starts taking keys from the terminal, a key at a time
+// but otherwise leaving it as it was, so the animation still draws the same
+func newAnimationControls() *animationControls {
+	return &animationControls{
+		restore: setTerminal("-icanon", "-echo", "min", "1"),
+		keys:    newKeyboard(os.Stdin),
+	}
+}
+
+// takeKeys does what the keys pressed since the last frame ask, and while
+// the animation is paused waits for more, returning when it should go on to
+// the next frame
+func (s *Stage) takeKeys(w io.Writer) error {
+	c := s.controls
+	if c == nil {
+		return nil
+	}
+	for {
+		var key string
+		var err error
+		if c.paused {
+			key, err = c.keys.read()
+		} else {
+			var ok bool
+			if key, ok, err = c.keys.poll(); !ok && err == nil {
+				return nil
+			}
+		}
+		// with no more keys coming, there'd be no going on later
+		done := err != nil
+		if done {
+			if !c.paused {
+				return nil
+			}
+			key = " "
+		}
+
+		var b strings.Builder
+		switch key {
+		case " ":
+			c.paused = !c.paused
+			// going on means catching back up to the last frame drawn
+			for ; !c.paused && c.back > 0; c.back-- {
+				for _, change := range c.frames[len(c.frames)-c.back] {
+					s.drawCell(&b, change.i, change.now)
+				}
+			}
+		case ".":
+			if !c.paused || c.back == 0 {
+				c.paused = true
+				return s.drawStatus(w)
+			}
+			for _, change := range c.frames[len(c.frames)-c.back] {
+				s.drawCell(&b, change.i, change.now)
+			}
+			c.back--
+		case ",":
+			c.paused = true
+			if c.back < len(c.frames) {
+				c.back++
+				frame := c.frames[len(c.frames)-c.back]
+				for i := len(frame) - 1; i >= 0; i-- {
+					s.drawCell(&b, frame[i].i, frame[i].was)
+				}
+			}
+		case resizeKey:
+			if err := s.redraw(w); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, beginFrame+b.String()+endFrame); err != nil {
+			return err
+		}
+		if err := s.drawStatus(w); err != nil || done {
+			return err
+		}
+	}
+}
+
+// drawStatus writes a line below the stage saying the animation is paused
+// and what the keys do, or clears it when it isn't
+func (s *Stage) drawStatus(w io.Writer) error {
+	status := ""
+	if c := s.controls; c.paused {
+		status = fmt.Sprintf("paused, %d frames back. space: go on. .: step. ,: rewind", c.back)
+	}
+	_, err := fmt.Fprintf(w, "\x1b[%d;1H\x1b[K%s", s.shown.Dy()+1, status)
+	return err
+}
+
+// endAnimation switches back from the screen the animation was drawn on, if
+// it was drawn at all, and stops tracking what it drew and taking keys
+func (s *Stage) endAnimation(w io.Writer) error {
+	drawn := s.drawn != nil
+	s.drawn, s.dirty = nil, nil
+	if c := s.controls; c != nil {
+		c.keys.close()
+		c.restore()
+		s.controls = nil
+	}
+	if !drawn {
+		return nil
+	}
+	_, err := io.WriteString(w, mainScreen)
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnimationControls(t *testing.T) {
+	src, _ := NewSource("go", 1)
+	s := NewStage(9, 9, src)
+	var b bytes.Buffer
+	if err := s.drawChanges(&b); err != nil {
+		t.Fatal(err)
+	}
+	keys := &keyboard{keys: make(chan string, 10), stop: func() {}, done: make(chan struct{})}
+	s.controls = &animationControls{keys: keys, restore: func() {}}
+
+	// two frames, then rewind past both, step forward one, and go on
+	s.setKind(2, 2, Floor)
+	s.drawChanges(&b)
+	for _, key := range []string{",", ",", ",", "."} {
+		keys.keys <- key
+	}
+	close(keys.keys)
+	s.setKind(3, 2, Floor)
+	b.Reset()
+	if err := s.drawChanges(&b); err != nil {
+		t.Fatal(err)
+	}
+	c := s.controls
+	if c.back != 0 {
+		t.Errorf("%d frames back, want to have caught up", c.back)
+	}
+	if c.paused {
+		t.Error("still paused with no more keys coming")
+	}
+	if !strings.Contains(b.String(), "paused, 2 frames back") {
+		t.Errorf("never showed it paused two frames back: %q", b.String())
+	}
+	if len(c.frames) != 2 {
+		t.Errorf("%d frames kept, want 2", len(c.frames))
+	}
+
+	s.endAnimation(&b)
+	if s.controls != nil {
+		t.Error("controls kept after the animation")
+	}
+}
+
+func TestFrameSkip(t *testing.T) {
+	frames := func(skip int) int {
+		var b bytes.Buffer
+		if _, err := New(WithSeed(1), WithAnimation(&b), WithFrameRate(0, skip)); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(b.String(), beginFrame)
+	}
+	every, tenth := frames(1), frames(10)
+	if tenth == 0 || tenth*5 > every {
+		t.Errorf("%d frames drawing every tenth carve, against %d drawing every one", tenth, every)
+	}
+	if _, err := New(WithFrameRate(-time.Millisecond, 1)); err == nil {
+		t.Error("animated with a negative delay")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WriteBatch generates n mazes with opts from the seeds start through
+// start+n-1 and writes each one to dir in the given format, named for its
+// seed like dungeon_42.txt. Up to workers mazes are written at once. It gives
+// up once ctx is cancelled.
+func WriteBatch(ctx context.Context, opts Options, dir, format string, start int64, n, workers int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	seeds := make(chan int64)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seed := range seeds {
+				errs <- writeSeed(ctx, opts, dir, format, seed)
+			}
+		}()
+	}
+	for seed := start; seed < start+int64(n); seed++ {
+		seeds <- seed
+	}
+	close(seeds)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSeed generates the maze for seed with opts and writes it to dir,
+// unless ctx is cancelled first
+func writeSeed(ctx context.Context, opts Options, dir, format string, seed int64) error {
+	s, _, err := GenerateStage(ctx, opts.seeded(seed))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("dungeon_%d.%s", seed, formatExt(format))))
+	if err != nil {
+		return err
+	}
+	err = s.Write(f, format)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
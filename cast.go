@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// CastWriter records the animation written to it as an asciinema v2 cast,
+// so the maze being carved can be replayed in a web page at any speed. Time
+// in the cast only passes as frames are waited on, so it plays back at the
+// animation's own pace however long generating took.
+type CastWriter struct {
+	w             io.Writer
+	tee           io.Writer
+	width, height int
+	elapsed       time.Duration
+	started       bool
+}
+
+// NewCastWriter returns a CastWriter writing a width by height cast to w,
+// and passing what it records on to tee as well unless tee is nil
+func NewCastWriter(w, tee io.Writer, width, height int) *CastWriter {
+	return &CastWriter{w: w, tee: tee, width: width, height: height}
+}
+
+// Write records p as output at the current time in the cast
+func (c *CastWriter) Write(p []byte) (int, error) {
+	if !c.started {
+		c.started = true
+		if _, err := fmt.Fprintf(c.w, `{"version": 2, "width": %d, "height": %d}`+"\n", c.width, c.height); err != nil {
+			return 0, err
+		}
+	}
+	// a terminal turns newlines into carriage returns and newlines on the
+	// way out, so a player needs them turned too
+	data, err := json.Marshal(strings.ReplaceAll(string(p), "\n", "\r\n"))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := fmt.Fprintf(c.w, "[%.6f, \"o\", %s]\n", c.elapsed.Seconds(), data); err != nil {
+		return 0, err
+	}
+	if c.tee != nil {
+		return c.tee.Write(p)
+	}
+	return len(p), nil
+}
+
+// Sleep moves the cast's time on by d, waiting it out too only when the
+// animation is being watched as it's recorded
+func (c *CastWriter) Sleep(d time.Duration) {
+	c.elapsed += d
+	if c.tee != nil {
+		time.Sleep(d)
+	}
+}
+
+// terminalOf returns the size of the terminal the animation is drawn on
+// through w, or 0, 0 when it isn't drawn on one
+func terminalOf(w io.Writer) (rows, cols int) {
+	if c, ok := w.(*CastWriter); ok {
+		w = c.tee
+	}
+	if w != os.Stdout {
+		return 0, 0
+	}
+	return terminalSize()
+}
+
+// waitFrame waits d after a frame of the animation drawn to w
+func waitFrame(w io.Writer, d time.Duration) {
+	if c, ok := w.(*CastWriter); ok {
+		c.Sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
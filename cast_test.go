@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCastWriter(t *testing.T) {
+	var b, tee bytes.Buffer
+	c := NewCastWriter(&b, &tee, 31, 16)
+	c.Write([]byte("ab\n"))
+	c.Sleep(time.Millisecond)
+	c.Write([]byte("\x1b[2;1Hc"))
+	if tee.String() != "ab\n\x1b[2;1Hc" {
+		t.Errorf("passed on %q", tee.String())
+	}
+	want := `{"version": 2, "width": 31, "height": 16}
+[0.000000, "o", "ab\r\n"]
+[0.001000, "o", "\u001b[2;1Hc"]
+`
+	if b.String() != want {
+		t.Errorf("cast is\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestCastAnimation(t *testing.T) {
+	var b bytes.Buffer
+	c := NewCastWriter(&b, nil, 79, 22)
+	start := time.Now()
+	if _, err := New(WithSeed(1), WithAnimation(c), WithFrameRate(time.Second, 10)); err != nil {
+		t.Fatal(err)
+	}
+	// time in the cast is only waited out when it's watched too
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("recording took %v", time.Since(start))
+	}
+
+	lines := bufio.NewScanner(&b)
+	lines.Scan()
+	var header map[string]int
+	if err := json.Unmarshal(lines.Bytes(), &header); err != nil || header["version"] != 2 {
+		t.Fatalf("header %s: %v", lines.Text(), err)
+	}
+	last, events := -1.0, 0
+	for lines.Scan() {
+		var event []interface{}
+		if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+			t.Fatalf("event %s: %v", lines.Text(), err)
+		}
+		at := event[0].(float64)
+		if at < last || event[1] != "o" {
+			t.Fatalf("event %s after %v", lines.Text(), last)
+		}
+		if events == 0 && !strings.Contains(event[2].(string), "\r\n") {
+			t.Errorf("first frame %q has no line breaks", event[2])
+		}
+		last = at
+		events++
+	}
+	if events < 10 || last < 10 {
+		t.Errorf("%d events over %vs", events, last)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// minChunkSize is the smallest chunk a stage can be split into
+const minChunkSize = 8
+
+// Chunks splits the stage into Size by Size chunks and scatters rooms and
+// grows a maze in each at the same time, on a worker per processor. Chunks
+// share the walls along their seams, so nothing crosses from one to the next
+// until Seams opens them up. Each chunk draws from its own seed, drawn from
+// rng in order, so the stage comes out the same however the work is shared.
+type Chunks struct {
+	Size int
+}
+
+// Seams opens passages through the walls between the Size by Size chunks
+// Chunks carved, one or two along every chunk's side
+type Seams struct {
+	Size int
+}
+
+// chunk is the part of a stage one worker carves, with its top left corner
+// at x+1, y+1
+type chunk struct {
+	x, y          int
+	width, height int
+	seed          int64
+	stage         *Stage
+}
+
+// chunks returns the size by size chunks the stage is split into, in rows.
+// Neighbors overlap by the wall they share, and slivers too thin to carve
+// anything in are left off the right and bottom.
+func (s *Stage) chunks(size int) []*chunk {
+	var out []*chunk
+	for y := 0; y+3 <= s.height; y += size {
+		for x := 0; x+3 <= s.width; x += size {
+			c := &chunk{x: x, y: y, width: size + 1, height: size + 1}
+			if x+c.width > s.width {
+				c.width = s.width - x
+			}
+			if y+c.height > s.height {
+				c.height = s.height - y
+			}
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (g Chunks) Carve(s *Stage, rng *rand.Rand) error {
+	chunks := s.chunks(g.Size)
+	for _, c := range chunks {
+		c.seed = rng.Int63()
+	}
+
+	work := make(chan *chunk)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				c.stage = s.carveChunk(c)
+			}
+		}()
+	}
+	for _, c := range chunks {
+		work <- c
+	}
+	close(work)
+	wg.Wait()
+	if s.cancelled() {
+		return nil
+	}
+
+	// copy the chunks in one at a time, in order, so hooks see the same
+	// stage take shape every time
+	for _, c := range chunks {
+		for y := 1; y <= c.height; y++ {
+			for x := 1; x <= c.width; x++ {
+				if kind := c.stage.at(x, y).kind; kind != Wall {
+					s.setKind(c.x+x, c.y+y, kind)
+				}
+			}
+		}
+		for _, door := range c.stage.doors {
+			s.doors = append(s.doors, s.at(c.x+door.x, c.y+door.y))
+		}
+		for _, room := range c.stage.rooms {
+			room.x += c.x
+			room.y += c.y
+			s.rooms = append(s.rooms, room)
+			s.roomPlaced(room)
+		}
+	}
+	return nil
+}
+
+// carveChunk scatters rooms and grows a maze in a stage the size of c, drawn
+// from c's seed
+func (s *Stage) carveChunk(c *chunk) *Stage {
+	opts := s.opts
+	opts.Width, opts.Height = c.width, c.height
+	opts.Source, _ = NewSource(opts.RNG, c.seed)
+	opts.Pipeline, opts.Hooks, opts.Animate = nil, Hooks{}, nil
+	sub := newStage(s.ctx, opts, s.difficulty)
+	sub.chunk = true
+	if s.outside != nil {
+		sub.outside = make([]bool, len(sub.cell))
+		for y := 1; y <= c.height; y++ {
+			for x := 1; x <= c.width; x++ {
+				sub.outside[(y-1)*c.width+x-1] = s.outside[(c.y+y-1)*s.width+c.x+x-1]
+			}
+		}
+	}
+	sub.useStream(roomStream)
+	sub.AddRooms()
+	sub.useStream(mazeStream)
+	sub.FillMaze()
+	sub.joinPockets()
+	return sub
+}
+
+func (g Seams) Carve(s *Stage, rng *rand.Rand) error {
+	for _, c := range s.chunks(g.Size) {
+		// the wall along the chunk's left side
+		if c.x > 0 {
+			var spots [][2]int
+			for y := c.y + 2; y < c.y+c.height; y += 2 {
+				spots = append(spots, [2]int{c.x + 1, y})
+			}
+			s.openSeam(rng, spots, 1, 0)
+		}
+		// and along its top
+		if c.y > 0 {
+			var spots [][2]int
+			for x := c.x + 2; x < c.x+c.width; x += 2 {
+				spots = append(spots, [2]int{x, c.y + 1})
+			}
+			s.openSeam(rng, spots, 0, 1)
+		}
+	}
+	return nil
+}
+
+// openSeam opens one or two of the wall cells at spots that have open cells
+// on both sides, dx, dy away. A cell opened next to a room is a door.
+func (s *Stage) openSeam(rng *rand.Rand, spots [][2]int, dx, dy int) {
+	var open [][2]int
+	for _, p := range spots {
+		x, y := p[0], p[1]
+		if !s.isEdge(x, y) && s.at(x, y).kind == Wall && s.at(x-dx, y-dy).kind != Wall && s.at(x+dx, y+dy).kind != Wall {
+			open = append(open, p)
+		}
+	}
+	for i := rng.Intn(2) + 1; i > 0 && len(open) > 0; i-- {
+		j := rng.Intn(len(open))
+		x, y := open[j][0], open[j][1]
+		open = append(open[:j], open[j+1:]...)
+
+		_, roomBefore := s.roomAt(x-dx, y-dy)
+		_, roomAfter := s.roomAt(x+dx, y+dy)
+		if roomBefore || roomAfter {
+			s.setKind(x, y, Door)
+			s.doors = append(s.doors, s.at(x, y))
+		} else {
+			s.setKind(x, y, Floor)
+		}
+		s.regionsJoined(x, y)
+	}
+}
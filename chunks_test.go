@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestChunkedStagesAreValid(t *testing.T) {
+	for _, size := range []int{25, 33, 41} {
+		for seed := int64(1); seed <= 5; seed++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			s, err := NewContext(ctx, WithSize(size, size), WithSeed(seed), WithChunks(8))
+			cancel()
+			if err != nil {
+				t.Fatalf("%dx%d seed %d: %v", size, size, seed, err)
+			}
+			if report := s.Validate(); !report.Valid {
+				t.Errorf("%dx%d seed %d: %v", size, size, seed, report.Failures)
+			}
+		}
+	}
+}
+
+func TestChunkedStagesDontDependOnWorkers(t *testing.T) {
+	want, err := New(WithSize(81, 41), WithSeed(9), WithChunks(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	got, err := New(WithSize(81, 41), WithSeed(9), WithChunks(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("stage changed with one worker:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	playerHP     = 20
+	playerAttack = 4
+)
+
+type Player struct {
+	x, y          int
+	hp, maxHP     int
+	attack        int
+	inventory     []*Item
+	weapon, armor *Item
+}
+
+// NewPlayer returns a fresh player standing at x, y
+func NewPlayer(x, y int) *Player {
+	return &Player{x: x, y: y, hp: playerHP, maxHP: playerHP, attack: playerAttack}
+}
+
+// rollDamage returns 0 for a miss (one in four), otherwise 1 through max
+func rollDamage(rng *rand.Rand, max int) int {
+	if max <= 0 || rng.Intn(4) == 0 {
+		return 0
+	}
+	return rng.Intn(max) + 1
+}
+
+// PlayerAttack resolves the player bumping into a monster
+func (s *Stage) PlayerAttack(p *Player, m *Monster) string {
+	damage := rollDamage(s.rng, p.attack)
+	if damage == 0 {
+		return fmt.Sprintf("You miss the %s. ", m.Name)
+	}
+	m.hp -= damage
+	if m.hp > 0 {
+		return fmt.Sprintf("You hit the %s for %d. ", m.Name, damage)
+	}
+	return fmt.Sprintf("You kill the %s! ", m.Name) + s.killMonster(m)
+}
+
+// MonsterAttack resolves a monster bumping into the player
+func (s *Stage) MonsterAttack(m *Monster, p *Player) string {
+	damage := rollDamage(s.rng, m.Attack)
+	if damage == 0 {
+		return fmt.Sprintf("The %s misses. ", m.Name)
+	}
+	p.hp -= damage
+	return fmt.Sprintf("The %s hits you for %d. ", m.Name, damage)
+}
+
+// killMonster removes m from the stage. Half the time it drops an item
+// suited to how deep it lives.
+func (s *Stage) killMonster(m *Monster) string {
+	s.removeMonster(m)
+	if s.rng.Intn(2) == 0 || s.itemAt(m.x, m.y) != nil {
+		return ""
+	}
+	item := &Item{ItemKind: s.pickItemKind(m.Depth), x: m.x, y: m.y}
+	s.items = append(s.items, item)
+	return fmt.Sprintf("It drops the %s. ", item.Name)
+}
+
+// removeMonster takes m off the stage without it dropping anything
+func (s *Stage) removeMonster(m *Monster) {
+	for i, other := range s.monsters {
+		if other == m {
+			s.monsters = append(s.monsters[:i], s.monsters[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// regionColors are the ANSI 256 background colors regions are painted with,
+// reused in order once there are more regions than colors
+var regionColors = []int{19, 22, 52, 54, 58, 23, 88, 90, 94, 24, 28, 53, 96, 30, 130, 61}
+
+// PrintRegions writes the stage to w with every region painted its own color
+// and marked with the last digit of its ID in base 36, followed by a line per
+// region. Walls, doorways, and cells nothing can stand on are drawn as usual.
+// A region with no doors has been left cut off from the rest. With
+// throughDoors set, regions joined by a doorway are painted as one area,
+// doorway included, so anything still cut off stands out in its own color.
+// Without colors regions are only marked.
+func (s *Stage) PrintRegions(w io.Writer, throughDoors bool) error {
+	var b strings.Builder
+	regions := s.Regions()
+	label := s.RegionAt
+	var areas []int
+	if throughDoors {
+		areas = s.areas()
+		label = func(x, y int) int { return areas[(y-1)*s.width+x-1] }
+	}
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			id := label(x, y)
+			if id == 0 {
+				b.WriteRune(s.unicodeRune(x, y))
+				continue
+			}
+			mark := strconv.FormatInt(int64(id%36), 36)
+			if s.opts.NoColor {
+				b.WriteString(mark)
+				continue
+			}
+			fmt.Fprintf(&b, "\x1b[97;48;5;%dm%s\x1b[0m", regionColors[(id-1)%len(regionColors)], mark)
+		}
+		b.WriteString("\n")
+	}
+	for _, r := range regions {
+		doors := fmt.Sprintf("%d doors", r.Doors)
+		switch r.Doors {
+		case 0:
+			doors = "cut off"
+		case 1:
+			doors = "1 door"
+		}
+		id := r.ID
+		if throughDoors {
+			x, y, _ := s.regionCell(r.ID)
+			id = label(x, y)
+		}
+		swatch := fmt.Sprintf("\x1b[48;5;%dm  \x1b[0m", regionColors[(id-1)%len(regionColors)])
+		if s.opts.NoColor {
+			swatch = " " + strconv.FormatInt(int64(id%36), 36)
+		}
+		fmt.Fprintf(&b, "%s %d: %s, %d cells from (%d, %d) to (%d, %d), %s\n",
+			swatch, r.ID, r.Kind, r.Size, r.MinX, r.MinY, r.MaxX, r.MaxY, doors)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// areas labels every walkable cell, doorways included, with the ID of the
+// connected area it is in, starting at 1, in a slice laid out like the
+// stage's cells. Cells nothing can stand on are left 0.
+func (s *Stage) areas() []int {
+	label := make([]int, len(s.cell))
+	id := 0
+	for i := range s.cell {
+		x, y := i%s.width+1, i/s.width+1
+		if label[i] != 0 || !s.IsWalkable(x, y) {
+			continue
+		}
+		id++
+		label[i] = id
+		queue := []int{i}
+		for len(queue) > 0 {
+			j := queue[0]
+			queue = queue[1:]
+			x, y := j%s.width+1, j/s.width+1
+			for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+				nx, ny := x+d[0], y+d[1]
+				if !s.cellExists(nx, ny) || !s.IsWalkable(nx, ny) {
+					continue
+				}
+				if k := (ny-1)*s.width + nx - 1; label[k] == 0 {
+					label[k] = id
+					queue = append(queue, k)
+				}
+			}
+		}
+	}
+	return label
+}
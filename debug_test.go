@@ -0,0 +1,38 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNoColor(t *testing.T) {
+	s, err := New(WithSize(31, 15), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var colored strings.Builder
+	if err := s.PrintRegions(&colored, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(colored.String(), "\x1b[") {
+		t.Error("regions aren't colored")
+	}
+
+	s.opts.NoColor = true
+	var plain strings.Builder
+	if err := s.PrintRegions(&plain, true); err != nil {
+		t.Fatal(err)
+	}
+	s.printCell(&plain, s.entranceX, s.entranceY, 'x')
+	if strings.Contains(plain.String(), "\x1b[") {
+		t.Errorf("drawn in color without colors:\n%s", plain.String())
+	}
+	// the same regions are marked either way
+	uncolored := regexp.MustCompile("\x1b\\[[0-9;]*m").ReplaceAllString(colored.String(), "")
+	for i, want := range strings.SplitN(uncolored, "\n", s.height+1)[:s.height] {
+		if got := strings.Split(plain.String(), "\n")[i]; got != want {
+			t.Errorf("row %d is %s without colors, want %s", i+1, got, want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	roomMoods   = []string{"damp", "dusty", "cold", "musty", "echoing", "silent", "smoky", "drafty"}
+	roomDetails = []string{
+		"Rubble is heaped in one corner.",
+		"Water drips somewhere out of sight.",
+		"Old bones are scattered across the floor.",
+		"Faded scratches cover the walls.",
+		"Cobwebs hang thick from the ceiling.",
+		"A broken barrel lies on its side.",
+		"",
+		"",
+	}
+)
+
+// Describe returns a few sentences describing room for a game master: its
+// size and shape, what is in it, and where its exits lead. The flavor is
+// picked from the room's position, so a room is always described the same way.
+func (s *Stage) Describe(room Room) string {
+	// rooms span x through x+width inclusive
+	w, h := room.width+1, room.height+1
+	pick := room.x*31 + room.y*17
+
+	size := "small"
+	switch area := w * h; {
+	case area >= 120:
+		size = "vast"
+	case area >= 60:
+		size = "large"
+	case area <= 15:
+		size = "cramped"
+	}
+	shape, noun := "rectangular", "chamber"
+	switch {
+	case w == h:
+		shape = "square"
+	case w >= 2*h || h >= 2*w:
+		shape, noun = "long", "hall"
+	}
+
+	mood := capitalize(withArticle(roomMoods[pick%len(roomMoods)]))
+	sentences := []string{fmt.Sprintf("%s, %s %s %s (%dx%d).", mood, size, shape, noun, w, h)}
+	if detail := roomDetails[pick%len(roomDetails)]; detail != "" {
+		sentences = append(sentences, detail)
+	}
+
+	monsters := map[string]int{}
+	items := map[string]int{}
+	decorations := map[string]int{}
+	traps := 0
+	for x := room.x; x <= room.x+room.width; x++ {
+		for y := room.y; y <= room.y+room.height; y++ {
+			if m := s.monsterAt(x, y); m != nil {
+				monsters[m.Name]++
+			}
+			if item := s.itemAt(x, y); item != nil {
+				items[item.Name]++
+			}
+			if s.trapAt(x, y) != nil {
+				traps++
+			}
+			if d := s.decorationAt(x, y); d != nil {
+				decorations[d.Name]++
+			}
+		}
+	}
+	if len(monsters) > 0 {
+		list, many := countNames(monsters)
+		sentences = append(sentences, capitalize(list)+pick2(many, " lurk", " lurks")+" here.")
+	}
+	if len(items) > 0 {
+		list, many := countNames(items)
+		sentences = append(sentences, capitalize(list)+pick2(many, " lie", " lies")+" on the floor.")
+	}
+	features := s.featureCounts(room)
+	if features[Column] > 0 {
+		sentences = append(sentences, fmt.Sprintf("%d columns stand in rows across the floor.", features[Column]))
+	}
+	if features[Altar] > 0 {
+		sentences = append(sentences, "An altar stands in the middle.")
+	}
+	if features[Rubble] > 0 {
+		sentences = append(sentences, "Rubble lies along the walls.")
+	}
+	if s.tiered(room) {
+		sentences = append(sentences, "The floor rises in tiers, joined by a ramp.")
+	}
+	if names := s.terrainNames(room); len(names) > 0 {
+		sentences = append(sentences, "Patches of "+joinList(names)+" break up the floor.")
+	}
+	if len(decorations) > 0 {
+		list, many := countNames(decorations)
+		sentences = append(sentences, capitalize(list)+pick2(many, " are", " is")+" scattered about.")
+	}
+	if traps > 0 {
+		sentences = append(sentences, "The floor is trapped.")
+	}
+
+	exits := make([]string, 0)
+	for _, d := range s.roomDoors(room) {
+		kind := "a doorway"
+		if s.at(d.x, d.y).kind == LockedDoor {
+			kind = "a locked door"
+		}
+		exits = append(exits, kind+" to the "+doorDirection(room, d))
+	}
+	if len(exits) == 0 {
+		sentences = append(sentences, "There is no way out.")
+	} else {
+		sentences = append(sentences, "Exits: "+joinList(exits)+".")
+	}
+
+	return strings.Join(sentences, " ")
+}
+
+// doorDirection returns which side of room the door is on
+func doorDirection(room Room, d Tile) string {
+	switch {
+	case d.y < room.y:
+		return "north"
+	case d.x > room.x+room.width:
+		return "east"
+	case d.y > room.y+room.height:
+		return "south"
+	}
+	return "west"
+}
+
+// withArticle puts "a", "an", or "some" in front of name
+func withArticle(name string) string {
+	switch {
+	case strings.HasSuffix(name, "s"):
+		return "some " + name
+	case strings.ContainsRune("aeiou", rune(name[0])):
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// joinList joins words as "a", "a and b", or "a, b, and c"
+func joinList(words []string) string {
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	case 2:
+		return words[0] + " and " + words[1]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + ", and " + words[len(words)-1]
+}
+
+// countNames turns a count of each name into a sorted list such as
+// "a goblin and 2 rats", and reports if the list reads as plural
+func countNames(counts map[string]int) (list string, many bool) {
+	names := make([]string, 0, len(counts))
+	many = len(counts) > 1
+	for name, n := range counts {
+		switch {
+		case strings.HasSuffix(name, "s"):
+			names = append(names, "some "+name)
+			many = true
+		case n == 1:
+			names = append(names, withArticle(name))
+		default:
+			names = append(names, fmt.Sprintf("%d %s", n, pluralize(name)))
+			many = true
+		}
+	}
+	sort.Strings(names)
+	return joinList(names), many
+}
+
+// pluralize returns the plural of an item or monster name
+func pluralize(name string) string {
+	if i := strings.Index(name, " of "); i >= 0 {
+		return pluralize(name[:i]) + name[i:]
+	}
+	if strings.HasSuffix(name, "armor") {
+		return "suits of " + name
+	}
+	return name + "s"
+}
+
+// pick2 returns a if cond is set, otherwise b
+func pick2(cond bool, a, b string) string {
+	if cond {
+		return a
+	}
+	return b
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// The bits of a cell in a donjon dungeon. A room's cells have its ID, from
+// 1, in the roomID bits, which only go up to donjonMaxRoomID.
+const (
+	donjonBlocked   = 0x1
+	donjonRoom      = 0x2
+	donjonCorridor  = 0x4
+	donjonPerimeter = 0x10
+	donjonArch      = 0x10000
+	donjonLocked    = 0x40000
+	donjonTrapped   = 0x80000
+	donjonStairDown = 0x400000
+	donjonStairUp   = 0x800000
+
+	donjonRoomIDShift = 6
+	donjonMaxRoomID   = 0x3ff
+)
+
+// DonjonJSON is the stage in the JSON the donjon dungeon generator writes.
+// Cells are its rows of cells, each a set of donjon bits: rooms, corridors,
+// the perimeter walls of rooms, doorways as arches, locked doors, and
+// stairs, with the cells outside the stage's mask blocked. Rooms are in the
+// stage's order after a null, so each is at its ID, and rows and columns
+// count from 0.
+type DonjonJSON struct {
+	Settings DonjonSettings `json:"settings"`
+	Cells    [][]int        `json:"cells"`
+	Rooms    []*DonjonRoom  `json:"rooms"`
+	Stairs   []DonjonStair  `json:"stairs"`
+}
+
+type DonjonSettings struct {
+	Seed  int64 `json:"seed"`
+	NRows int   `json:"n_rows"`
+	NCols int   `json:"n_cols"`
+}
+
+type DonjonRoom struct {
+	ID     int                     `json:"id"`
+	Row    int                     `json:"row"`
+	Col    int                     `json:"col"`
+	North  int                     `json:"north"`
+	South  int                     `json:"south"`
+	West   int                     `json:"west"`
+	East   int                     `json:"east"`
+	Height int                     `json:"height"`
+	Width  int                     `json:"width"`
+	Area   int                     `json:"area"`
+	Doors  map[string][]DonjonDoor `json:"doors"`
+}
+
+// DonjonDoor is a way out of a room, into the room OutID if it leads into one
+type DonjonDoor struct {
+	Row   int    `json:"row"`
+	Col   int    `json:"col"`
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	OutID int    `json:"out_id,omitempty"`
+}
+
+type DonjonStair struct {
+	Row int    `json:"row"`
+	Col int    `json:"col"`
+	Key string `json:"key"`
+}
+
+// Donjon returns the stage in the form the donjon dungeon generator writes.
+// The stage's regions are labeled as Regions labels them.
+func (s *Stage) Donjon() DonjonJSON {
+	out := DonjonJSON{
+		Settings: DonjonSettings{Seed: s.opts.Seed, NRows: s.height, NCols: s.width},
+		Cells:    make([][]int, s.height),
+		Rooms:    []*DonjonRoom{nil},
+		Stairs:   make([]DonjonStair, 0, 2),
+	}
+	s.indexRooms()
+	for y := 1; y <= s.height; y++ {
+		out.Cells[y-1] = make([]int, s.width)
+		for x := 1; x <= s.width; x++ {
+			out.Cells[y-1][x-1] = s.donjonCell(x, y)
+		}
+	}
+	for _, t := range s.traps {
+		if s.isDoor(t.x, t.y) {
+			out.Cells[t.y-1][t.x-1] |= donjonTrapped
+		}
+	}
+	if s.upX != 0 {
+		out.Cells[s.upY-1][s.upX-1] |= donjonStairUp
+		out.Stairs = append(out.Stairs, DonjonStair{Row: s.upY - 1, Col: s.upX - 1, Key: "up"})
+	}
+	if s.downX != 0 {
+		out.Cells[s.downY-1][s.downX-1] |= donjonStairDown
+		out.Stairs = append(out.Stairs, DonjonStair{Row: s.downY - 1, Col: s.downX - 1, Key: "down"})
+	}
+	s.Regions()
+	for i, room := range s.rooms {
+		// rooms span x through x+width inclusive
+		r := &DonjonRoom{
+			ID:     i + 1,
+			Row:    room.y - 1,
+			Col:    room.x - 1,
+			North:  room.y - 1,
+			South:  room.y + room.height - 1,
+			West:   room.x - 1,
+			East:   room.x + room.width - 1,
+			Height: room.height + 1,
+			Width:  room.width + 1,
+			Area:   (room.height + 1) * (room.width + 1),
+			Doors:  make(map[string][]DonjonDoor),
+		}
+		for _, e := range s.exits(room) {
+			d := DonjonDoor{Row: e.Y - 1, Col: e.X - 1, Key: "arch", Type: "Archway", OutID: e.Room}
+			if e.Locked {
+				d.Key, d.Type = "locked", "Locked Door"
+			}
+			r.Doors[e.Side] = append(r.Doors[e.Side], d)
+		}
+		out.Rooms = append(out.Rooms, r)
+	}
+	return out
+}
+
+// donjonCell returns the donjon bits for the cell at x, y itself, without
+// what's on it
+func (s *Stage) donjonCell(x, y int) int {
+	cell := s.at(x, y)
+	switch {
+	case s.outside != nil && s.outside[(y-1)*s.width+x-1]:
+		return donjonBlocked
+	case cell.kind == LockedDoor:
+		return donjonLocked
+	case s.isDoor(x, y):
+		return donjonArch
+	case cell.kind == Wall:
+		for _, d := range [][2]int{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}} {
+			if _, ok := s.roomAt(x+d[0], y+d[1]); ok {
+				return donjonPerimeter
+			}
+		}
+		return 0
+	}
+	if n := int(s.roomIndex[(y-1)*s.width+x-1]); n != 0 {
+		if n > donjonMaxRoomID {
+			return donjonRoom
+		}
+		return donjonRoom | n<<donjonRoomIDShift
+	}
+	return donjonCorridor
+}
+
+// WriteDonjon writes the stage as donjon dungeon JSON
+func (s *Stage) WriteDonjon(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s.Donjon())
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDonjon(t *testing.T) {
+	s, err := New(WithSize(41, 21), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := s.doors[0]
+	locked.kind = LockedDoor
+	s.set(locked.x, locked.y, locked)
+
+	var b strings.Builder
+	if err := s.Write(&b, "donjon"); err != nil {
+		t.Fatal(err)
+	}
+	var d DonjonJSON
+	if err := json.Unmarshal([]byte(b.String()), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Settings.NRows != 21 || d.Settings.NCols != 41 || len(d.Cells) != 21 || len(d.Cells[0]) != 41 {
+		t.Fatalf("cells are %d by %d, settings %+v", len(d.Cells), len(d.Cells[0]), d.Settings)
+	}
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			cell := d.Cells[y-1][x-1]
+			room, inRoom := s.roomAt(x, y)
+			switch {
+			case x == locked.x && y == locked.y:
+				if cell&donjonLocked == 0 {
+					t.Errorf("locked door at %d, %d is %#x", x, y, cell)
+				}
+			case s.isDoor(x, y):
+				if cell&donjonArch == 0 {
+					t.Errorf("doorway at %d, %d is %#x", x, y, cell)
+				}
+			case s.at(x, y).kind == Wall:
+				if cell&(donjonRoom|donjonCorridor) != 0 {
+					t.Errorf("wall at %d, %d is %#x", x, y, cell)
+				}
+			case inRoom:
+				if id := cell >> donjonRoomIDShift & donjonMaxRoomID; cell&donjonRoom == 0 || d.Rooms[id] == nil || d.Rooms[id].Row != room.y-1 || d.Rooms[id].Col != room.x-1 {
+					t.Errorf("room cell at %d, %d is %#x", x, y, cell)
+				}
+			default:
+				if cell&donjonCorridor == 0 {
+					t.Errorf("corridor at %d, %d is %#x", x, y, cell)
+				}
+			}
+		}
+	}
+
+	if d.Rooms[0] != nil || len(d.Rooms) != len(s.rooms)+1 {
+		t.Fatalf("%d rooms after the null, want %d", len(d.Rooms)-1, len(s.rooms))
+	}
+	doors, lockedDoors := 0, 0
+	for i, r := range d.Rooms[1:] {
+		if r.ID != i+1 || r.Area != r.Width*r.Height || r.East-r.West+1 != r.Width || r.South-r.North+1 != r.Height {
+			t.Errorf("room %+v doesn't add up", r)
+		}
+		for side, list := range r.Doors {
+			for _, door := range list {
+				doors++
+				if door.Key == "locked" {
+					lockedDoors++
+				}
+				if _, ok := sideSteps[side]; !ok || !s.isDoor(door.Col+1, door.Row+1) {
+					t.Errorf("room %d door %+v isn't a door on its %s side", r.ID, door, side)
+				}
+			}
+		}
+	}
+	if doors == 0 || lockedDoors == 0 {
+		t.Errorf("rooms have %d doors, %d locked", doors, lockedDoors)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the stage's Graph for Graphviz: a node for each region,
+// with the rooms in it numbered as WriteMarkdown numbers them, and an edge
+// for each door between two regions, labeled with where it is and dashed if
+// it's locked. The entrance's node is drawn doubled.
+func (s *Stage) WriteDOT(w io.Writer) error {
+	g := s.Graph()
+	var b strings.Builder
+	b.WriteString("graph dungeon {\n\tnode [shape=box];\n")
+	for _, n := range g.Nodes {
+		rooms := make([]string, len(n.Rooms))
+		for i, room := range n.Rooms {
+			rooms[i] = fmt.Sprint(room)
+		}
+		var label string
+		switch {
+		case len(rooms) == 0:
+			label = n.Kind
+		case len(rooms) == 1:
+			label = "room " + rooms[0]
+		default:
+			label = "rooms " + strings.Join(rooms, ", ")
+		}
+		if len(rooms) > 0 && n.Kind == "mixed" {
+			label += " and corridors"
+		}
+		label += fmt.Sprintf("\\n%d cells, (%d, %d) to (%d, %d)", n.Size, n.MinX, n.MinY, n.MaxX, n.MaxY)
+		if n.Entrance {
+			label += "\\nentrance"
+		}
+		if n.StairsUp {
+			label += "\\n" + tileKinds[StairsUp].Name
+		}
+		if n.StairsDown {
+			label += "\\n" + tileKinds[StairsDown].Name
+		}
+		attrs := fmt.Sprintf("label=\"%s\"", label)
+		if n.Kind == "corridors" {
+			attrs += ", shape=ellipse"
+		}
+		if n.Entrance {
+			attrs += ", peripheries=2"
+		}
+		fmt.Fprintf(&b, "\tr%d [%s];\n", n.ID, attrs)
+	}
+	for _, e := range g.Edges {
+		attrs := fmt.Sprintf("label=\"(%d, %d)\"", e.X, e.Y)
+		if e.Locked {
+			attrs += ", style=dashed, color=red"
+		}
+		fmt.Fprintf(&b, "\tr%d -- r%d [%s];\n", e.From, e.To, attrs)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
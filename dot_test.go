@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	s, err := New(WithSize(41, 21), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := s.doors[0]
+	locked.kind = LockedDoor
+	s.set(locked.x, locked.y, locked)
+
+	var b strings.Builder
+	if err := s.Write(&b, "dot"); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	if !strings.HasPrefix(got, "graph dungeon {\n") || !strings.HasSuffix(got, "}\n") {
+		t.Fatalf("not a graph:\n%s", got)
+	}
+	regions := s.Regions()
+	for _, r := range regions {
+		if !strings.Contains(got, fmt.Sprintf("\tr%d [label=", r.ID)) {
+			t.Errorf("no node for region %d in\n%s", r.ID, got)
+		}
+	}
+	for i := range s.rooms {
+		if !strings.Contains(got, fmt.Sprintf("room %d\\n", i+1)) {
+			t.Errorf("no node for room %d in\n%s", i+1, got)
+		}
+	}
+	entrance := fmt.Sprintf("\tr%d [", s.RegionAt(s.entranceX, s.entranceY))
+	if !strings.Contains(got, "\\nentrance\", peripheries=2];") || !strings.Contains(got, entrance) {
+		t.Errorf("entrance isn't marked in\n%s", got)
+	}
+
+	edges := 0
+	for _, d := range s.doors {
+		ids := s.doorRegions(d.x, d.y)
+		if len(ids) < 2 {
+			continue
+		}
+		edges++
+		edge := fmt.Sprintf("\tr%d -- r%d [label=\"(%d, %d)\"", ids[0], ids[1], d.x, d.y)
+		if !strings.Contains(got, edge) {
+			t.Errorf("no edge %s in\n%s", edge, got)
+		}
+	}
+	if edges == 0 || strings.Count(got, " -- ") != edges {
+		t.Errorf("%d edges, want %d:\n%s", strings.Count(got, " -- "), edges, got)
+	}
+	if want := fmt.Sprintf("(%d, %d)\", style=dashed, color=red];", locked.x, locked.y); !strings.Contains(got, want) {
+		t.Errorf("locked door isn't dashed in\n%s", got)
+	}
+}
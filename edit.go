@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"image"
+)
+
+// SetTile makes the cell at x, y kind, for tools that edit a generated
+// stage. The doorways and stairs follow: a Door or LockedDoor is added to the
+// stage's doorways and anything else taken out of them, and StairsUp or
+// StairsDown moves that staircase here, leaving floor where it was. Walling
+// up a cell takes away whatever is on it, but not the entrance, the stairs,
+// or a key, which must be moved first. The stage's edge stays wall. If
+// Regions has labeled the stage, the regions around the cell are labeled
+// again.
+func (s *Stage) SetTile(x, y int, kind TileType) error {
+	if !s.cellExists(x, y) {
+		return fmt.Errorf("(%d, %d) is off the %dx%d stage", x, y, s.width, s.height)
+	}
+	if int(kind) >= len(tileKinds) {
+		return fmt.Errorf("no tile type %d", kind)
+	}
+	if s.isEdge(x, y) && kind != Wall {
+		return fmt.Errorf("(%d, %d) is on the stage's edge", x, y)
+	}
+	rect := image.Rect(x, y, x+1, y+1)
+	if kind == Wall {
+		if err := s.buries(rect); err != nil {
+			return err
+		}
+		s.wallUp(rect)
+	}
+
+	switch {
+	case kind == StairsUp:
+		if s.upX != 0 && (s.upX != x || s.upY != y) {
+			s.setKind(s.upX, s.upY, Floor)
+		}
+		s.upX, s.upY = x, y
+	case kind == StairsDown:
+		if s.downX != 0 && (s.downX != x || s.downY != y) {
+			s.setKind(s.downX, s.downY, Floor)
+		}
+		s.downX, s.downY = x, y
+	case x == s.upX && y == s.upY:
+		s.upX, s.upY = 0, 0
+	case x == s.downX && y == s.downY:
+		s.downX, s.downY = 0, 0
+	}
+	s.setKind(x, y, kind)
+
+	door := kind == Door || kind == LockedDoor
+	if i, ok := s.doorAt(x, y); ok && !door {
+		s.doors = append(s.doors[:i], s.doors[i+1:]...)
+		s.doorIndex, s.doorsIndexed = nil, 0
+	} else if ok {
+		s.doors[i] = s.at(x, y)
+	} else if door {
+		s.doors = append(s.doors, s.at(x, y))
+	}
+	s.relabelAround(rect)
+	return nil
+}
+
+// CarveRect opens the wall inside rect up into floor, in the stage's own
+// coordinates with Max left out, like Crop. Cells already open are left as
+// they are. rect must keep off the stage's edge. If Regions has labeled the
+// stage, whatever the carving joins up is labeled as one region.
+func (s *Stage) CarveRect(rect image.Rectangle) error {
+	if err := s.editable(rect); err != nil {
+		return err
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if s.isEdge(x, y) {
+				return fmt.Errorf("(%d, %d) is on the stage's edge", x, y)
+			}
+		}
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if s.at(x, y).kind == Wall {
+				s.setKind(x, y, Floor)
+			}
+		}
+	}
+	s.relabelAround(rect)
+	return nil
+}
+
+// FillRect walls up everything inside rect, in the stage's own coordinates
+// with Max left out, like Crop. Whatever is on it goes with it: rooms are cut
+// down to the strips of them left uncovered, as Paste does, and doorways,
+// monsters, items, traps, decorations, and bridges on it are taken away. The
+// entrance, the stairs, and keys aren't, and must be moved first. If Regions
+// has labeled the stage, whatever the wall cuts apart is labeled as regions
+// of their own.
+func (s *Stage) FillRect(rect image.Rectangle) error {
+	if err := s.editable(rect); err != nil {
+		return err
+	}
+	if err := s.buries(rect); err != nil {
+		return err
+	}
+	s.cutRooms(rect)
+	s.roomsMoved()
+	s.wallUp(rect)
+	s.relabelAround(rect)
+	return nil
+}
+
+// PlaceDoor puts a doorway at x, y, locked or not. The cell must be between
+// two open cells on opposite sides, with wall on the other two, so the
+// doorway leads somewhere. If Regions has labeled the stage, the regions on
+// either side are labeled again, since a doorway is in none of them.
+func (s *Stage) PlaceDoor(x, y int, locked bool) error {
+	if !s.cellExists(x, y) || s.isEdge(x, y) {
+		return fmt.Errorf("(%d, %d) is off the %dx%d stage or on its edge", x, y, s.width, s.height)
+	}
+	if s.isStairs(x, y) || (x == s.entranceX && y == s.entranceY) {
+		return fmt.Errorf("(%d, %d) is the entrance or stairs", x, y)
+	}
+	across := s.isOpen(x-1, y) && s.isOpen(x+1, y) && !s.isOpen(x, y-1) && !s.isOpen(x, y+1)
+	down := s.isOpen(x, y-1) && s.isOpen(x, y+1) && !s.isOpen(x-1, y) && !s.isOpen(x+1, y)
+	if !across && !down {
+		return fmt.Errorf("(%d, %d) isn't between two open cells", x, y)
+	}
+	wall := s.at(x, y).kind == Wall
+	kind := Door
+	if locked {
+		kind = LockedDoor
+	}
+	if err := s.SetTile(x, y, kind); err != nil {
+		return err
+	}
+	if wall {
+		s.regionsJoined(x, y)
+	}
+	return nil
+}
+
+// SetFeature puts f on the cell at x, y, which must be floor, not stairs;
+// NoFeature takes away whatever was there. If Regions has labeled the stage,
+// the regions around the cell are labeled again, since a column, say, can't
+// be walked through.
+func (s *Stage) SetFeature(x, y int, f Feature) error {
+	if !s.cellExists(x, y) || s.at(x, y).kind != Floor {
+		return fmt.Errorf("(%d, %d) isn't floor", x, y)
+	}
+	if int(f) >= len(featureKinds) {
+		return fmt.Errorf("no feature %d", f)
+	}
+	s.setFeature(x, y, f)
+	s.relabelAround(image.Rect(x, y, x+1, y+1))
+	return nil
+}
+
+// editable reports if rect is a nonempty part of the stage
+func (s *Stage) editable(rect image.Rectangle) error {
+	if rect.Empty() || !rect.In(image.Rect(1, 1, s.width+1, s.height+1)) {
+		return fmt.Errorf("%v isn't inside the %dx%d stage", rect, s.width, s.height)
+	}
+	return nil
+}
+
+// buries reports an error if walling up rect would bury the entrance, the
+// stairs, or a key
+func (s *Stage) buries(rect image.Rectangle) error {
+	for _, p := range [][2]int{{s.entranceX, s.entranceY}, {s.upX, s.upY}, {s.downX, s.downY}} {
+		if p[0] != 0 && image.Pt(p[0], p[1]).In(rect) {
+			return fmt.Errorf("(%d, %d) is the entrance or stairs", p[0], p[1])
+		}
+	}
+	for _, it := range s.items {
+		if it.ItemKind == keyKind && image.Pt(it.x, it.y).In(rect) {
+			return fmt.Errorf("(%d, %d) has a key on it", it.x, it.y)
+		}
+	}
+	return nil
+}
+
+// wallUp fills rect with wall and takes away the doorways and whatever else
+// is on it
+func (s *Stage) wallUp(rect image.Rectangle) {
+	in := func(x, y int) bool { return image.Pt(x, y).In(rect) }
+	var doors []Tile
+	for _, d := range s.doors {
+		if !in(d.x, d.y) {
+			doors = append(doors, d)
+		}
+	}
+	s.doors, s.doorIndex, s.doorsIndexed = doors, nil, 0
+	s.clear(in)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			tmpTile := s.at(x, y)
+			tmpTile.ramp, tmpTile.ledge = false, false
+			s.set(x, y, tmpTile)
+		}
+	}
+}
+
+// relabelAround labels the regions on and beside rect again after an edit,
+// if Regions has labeled the stage: each region touching it is taken apart
+// and flooded again from its cells, so pieces an edit joined become one
+// region and pieces it cut off become new ones. The lowest IDs are reused
+// first, then IDs past the highest.
+func (s *Stage) relabelAround(rect image.Rectangle) {
+	next := s.highestRegion() + 1
+	if next == 1 {
+		return
+	}
+	near := rect.Inset(-1)
+	touched := map[int]bool{}
+	for y := near.Min.Y; y < near.Max.Y; y++ {
+		for x := near.Min.X; x < near.Max.X; x++ {
+			if id := s.RegionAt(x, y); id != 0 {
+				touched[id] = true
+			}
+		}
+	}
+	// the cells to flood again from, in stage order
+	redo := make([]bool, len(s.cell))
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if touched[s.RegionAt(x, y)] || image.Pt(x, y).In(near) {
+				redo[(y-1)*s.width+x-1] = true
+			}
+		}
+	}
+	var free []int
+	for id := 1; id < next; id++ {
+		if touched[id] {
+			free = append(free, id)
+		}
+	}
+	s.relabel(free...)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if !redo[(y-1)*s.width+x-1] || !s.inRegion(x, y) || s.RegionAt(x, y) != 0 {
+				continue
+			}
+			id := next
+			if len(free) > 0 {
+				id, free = free[0], free[1:]
+			} else {
+				next++
+			}
+			s.fillRegion(x, y, id)
+		}
+	}
+}
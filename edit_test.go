@@ -0,0 +1,196 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+// checkLabels fails unless the stage's region labels group its cells the
+// same way labeling it from scratch does
+func checkLabels(t *testing.T, s *Stage) {
+	t.Helper()
+	fresh, _ := s.Crop(image.Rect(1, 1, s.width+1, s.height+1))
+	fresh.Regions()
+	toFresh, fromFresh := map[int]int{}, map[int]int{}
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if !s.inRegion(x, y) {
+				continue
+			}
+			id, want := s.RegionAt(x, y), fresh.RegionAt(x, y)
+			if id == 0 {
+				t.Fatalf("(%d, %d) is in no region", x, y)
+			}
+			if got, ok := toFresh[id]; ok && got != want {
+				t.Fatalf("region %d at (%d, %d) should be two regions", id, x, y)
+			}
+			if got, ok := fromFresh[want]; ok && got != id {
+				t.Fatalf("regions %d and %d at (%d, %d) should be one", got, id, x, y)
+			}
+			toFresh[id], fromFresh[want] = want, id
+		}
+	}
+}
+
+func TestCarveRect(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(s.Regions())
+	rect := image.Rect(4, 4, 20, 9)
+	if err := s.CarveRect(rect); err != nil {
+		t.Fatal(err)
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if s.at(x, y).kind == Wall {
+				t.Fatalf("(%d, %d) is still wall", x, y)
+			}
+		}
+	}
+	checkLabels(t, s)
+	if after := s.highestRegion(); after > before {
+		t.Errorf("carving made region %d, past the %d there were", after, before)
+	}
+
+	for _, bad := range []image.Rectangle{image.Rect(1, 4, 6, 6), image.Rect(4, 4, 4, 6), image.Rect(4, 4, s.width+2, 6)} {
+		if err := s.CarveRect(bad); err == nil {
+			t.Errorf("carved %v", bad)
+		}
+	}
+}
+
+func TestFillRect(t *testing.T) {
+	s, err := New(WithSeed(2), WithStocking(5, 5, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Regions()
+	// fill the first room that has nothing that can't be buried in it, with
+	// some of the wall around it
+	var rect image.Rectangle
+	for _, room := range s.rooms {
+		r := image.Rect(room.x-1, room.y+1, room.x+room.width, room.y+room.height)
+		if s.buries(r) == nil {
+			rect = r
+			break
+		}
+	}
+	if rect.Empty() {
+		t.Fatal("every room has the entrance, stairs, or a key in it")
+	}
+	if err := s.FillRect(rect); err != nil {
+		t.Fatal(err)
+	}
+	in := func(x, y int) bool { return image.Pt(x, y).In(rect) }
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if s.at(x, y).kind != Wall || s.at(x, y).feature != NoFeature {
+				t.Fatalf("(%d, %d) isn't bare wall", x, y)
+			}
+			if s.isDoor(x, y) || s.monsterAt(x, y) != nil || s.itemAt(x, y) != nil || s.trapAt(x, y) != nil || s.decorationAt(x, y) != nil {
+				t.Fatalf("something is left at (%d, %d)", x, y)
+			}
+		}
+	}
+	for _, room := range s.rooms {
+		if image.Rect(room.x, room.y, room.x+room.width+1, room.y+room.height+1).Overlaps(rect) {
+			t.Errorf("room %+v is still in %v", room, rect)
+		}
+	}
+	for _, b := range s.bridges {
+		if in(b.x, b.y) || in(b.x+(b.length-1)*b.dx, b.y+(b.length-1)*b.dy) {
+			t.Errorf("bridge at (%d, %d) still reaches into %v", b.x, b.y, rect)
+		}
+	}
+	checkLabels(t, s)
+
+	entrance := image.Rect(s.entranceX, s.entranceY, s.entranceX+1, s.entranceY+1)
+	if err := s.FillRect(entrance); err == nil {
+		t.Error("walled up the entrance")
+	}
+}
+
+func TestSetTile(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Regions()
+
+	// a doorway set anywhere is one of the stage's, until it's set back
+	room := s.rooms[0]
+	x, y := room.x+1, room.y+1
+	if err := s.SetTile(x, y, Door); err != nil {
+		t.Fatal(err)
+	}
+	if !s.isDoor(x, y) {
+		t.Errorf("(%d, %d) isn't a doorway", x, y)
+	}
+	checkLabels(t, s)
+	if err := s.SetTile(x, y, Floor); err != nil {
+		t.Fatal(err)
+	}
+	if s.isDoor(x, y) {
+		t.Errorf("(%d, %d) is still a doorway", x, y)
+	}
+	checkLabels(t, s)
+
+	// setting the stairs moves them
+	oldX, oldY := s.downX, s.downY
+	if err := s.SetTile(x, y, StairsDown); err != nil {
+		t.Fatal(err)
+	}
+	if s.downX != x || s.downY != y {
+		t.Errorf("stairs down at (%d, %d), want (%d, %d)", s.downX, s.downY, x, y)
+	}
+	if oldX != 0 && s.at(oldX, oldY).kind != Floor {
+		t.Errorf("old stairs at (%d, %d) are %v, want floor", oldX, oldY, s.at(oldX, oldY).kind)
+	}
+	if err := s.SetTile(x, y, Wall); err == nil {
+		t.Error("walled up the stairs")
+	}
+
+	if err := s.SetTile(1, 1, Floor); err == nil {
+		t.Error("opened the stage's edge")
+	}
+	if err := s.SetTile(0, 1, Wall); err == nil {
+		t.Error("set a cell off the stage")
+	}
+}
+
+func TestPlaceDoor(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Regions()
+	for y := 2; y < s.height; y++ {
+		for x := 2; x < s.width; x++ {
+			if s.at(x, y).kind != Wall || s.PlaceDoor(x, y, true) != nil {
+				continue
+			}
+			if s.at(x, y).kind != LockedDoor || !s.isDoor(x, y) {
+				t.Fatalf("(%d, %d) is %v, want a locked doorway", x, y, s.at(x, y).kind)
+			}
+			checkLabels(t, s)
+			return
+		}
+	}
+	t.Fatal("no wall between two open cells")
+}
+
+func TestPlaceDoorErrors(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := s.rooms[0]
+	if err := s.PlaceDoor(room.x+room.width/2, room.y+room.height/2, false); err == nil {
+		t.Error("placed a doorway in the middle of a room")
+	}
+	if err := s.PlaceDoor(1, 2, false); err == nil {
+		t.Error("placed a doorway on the stage's edge")
+	}
+}
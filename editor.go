@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+)
+
+// Prefab is a room the editor can stamp onto the stage, drawn the way -in
+// reads a map: '#' is wall and '.' floor. It is stamped with its top left
+// corner on the cursor, and the floor it lays becomes a room.
+type Prefab struct {
+	Name string
+	Rows []string
+}
+
+var prefabs = []Prefab{
+	{Name: "small room", Rows: []string{
+		".....",
+		".....",
+		".....",
+		".....",
+		".....",
+	}},
+	{Name: "hall", Rows: []string{
+		".........",
+		".........",
+		".........",
+		".........",
+		".........",
+	}},
+	{Name: "pillared hall", Rows: []string{
+		".........",
+		".#.#.#.#.",
+		".........",
+		".#.#.#.#.",
+		".........",
+	}},
+	{Name: "round room", Rows: []string{
+		"##...##",
+		"#.....#",
+		".......",
+		".......",
+		".......",
+		"#.....#",
+		"##...##",
+	}},
+}
+
+// Edit opens the stage in an editor in the terminal: a cursor is moved over
+// it to carve and fill cells, place doorways and features, and stamp rooms
+// from the prefabs. Edits can be undone and redone and written to -patch,
+// and the stage can be saved to and loaded from -save_file.
+func Edit(s *Stage) {
+	restore := rawTerminal()
+	defer restore()
+	os.Stdout.WriteString(altScreen)
+	defer os.Stdout.WriteString(mainScreen)
+
+	e := newEditor(s)
+	message := ""
+	keys := newKeyboard(os.Stdin)
+	defer keys.close()
+	for {
+		var frame strings.Builder
+		frame.WriteString(beginFrame + clearScreen)
+		// the status, help, and message lines go under the stage
+		rows, cols := terminalSize()
+		e.print(&frame, e.s.view(rows-3, cols, e.x, e.y))
+		fmt.Fprintf(&frame, "(%d, %d) %s  prefab: %s\r\n", e.x, e.y, e.s.at(e.x, e.y).kind.Kind().Name, prefabs[e.prefab].Name)
+		frame.WriteString("move: arrows or hjkl. mark: v. carve: c. fill: x. toggle: space. door: d, locked: D. feature: f. prefab: p, stamp: r. undo: u, redo: U. patch: P. map: m. save: S. load: L. quit: q\r\n")
+		frame.WriteString(message + "\r\n")
+		if e.minimap {
+			e.s.overlayMinimap(&frame, rows, cols, e.x, e.y)
+		}
+		frame.WriteString(endFrame)
+		os.Stdout.WriteString(frame.String())
+
+		key, err := keys.read()
+		if err != nil {
+			return
+		}
+		var quit bool
+		if message, quit = e.key(key); quit {
+			return
+		}
+	}
+}
+
+// editor is where the cursor is on the stage being edited, the corner marked
+// to carve or fill a rectangle from, and the prefab picked to stamp, with the
+// edits made so far, and whether the minimap is shown
+type editor struct {
+	s            *Stage
+	history      *History
+	x, y         int
+	markX, markY int
+	prefab       int
+	minimap      bool
+}
+
+// newEditor starts editing s with the cursor on the entrance
+func newEditor(s *Stage) *editor {
+	e := &editor{s: s, history: NewHistory(s), x: s.entranceX, y: s.entranceY}
+	if !s.cellExists(e.x, e.y) {
+		e.x, e.y = 1, 1
+	}
+	return e
+}
+
+// key does what key asks and returns a message saying how it went, and
+// whether to quit
+func (e *editor) key(key string) (string, bool) {
+	s := e.s
+	dx, dy := 0, 0
+	switch key {
+	case "q":
+		return "", true
+	case "k", "\x1b[A":
+		dy = -1
+	case "l", "\x1b[C":
+		dx = 1
+	case "j", "\x1b[B":
+		dy = 1
+	case "h", "\x1b[D":
+		dx = -1
+	case "v":
+		if e.markX != 0 {
+			e.markX, e.markY = 0, 0
+			return "Mark cleared. ", false
+		}
+		e.markX, e.markY = e.x, e.y
+		return "Marked. Move to the other corner, then carve or fill. ", false
+	case "c", "x":
+		rect := e.selection()
+		e.markX, e.markY = 0, 0
+		op := EditOp{Op: "carve", X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()}
+		if key == "x" {
+			op.Op = "fill"
+		}
+		return e.do(op), false
+	case " ":
+		kind := Wall
+		if s.at(e.x, e.y).kind == Wall {
+			kind = Floor
+		}
+		return e.do(EditOp{Op: "tile", X: e.x, Y: e.y, Name: kind.Kind().Name}), false
+	case "d", "D":
+		return e.do(EditOp{Op: "door", X: e.x, Y: e.y, Locked: key == "D"}), false
+	case "f":
+		f := (s.at(e.x, e.y).feature + 1) % Feature(len(featureKinds))
+		return e.do(EditOp{Op: "feature", X: e.x, Y: e.y, Name: f.Kind().Name}), false
+	case "m":
+		e.minimap = !e.minimap
+	case "p":
+		e.prefab = (e.prefab + 1) % len(prefabs)
+	case "r":
+		return e.do(EditOp{Op: "stamp", X: e.x, Y: e.y, Name: prefabs[e.prefab].Name}), false
+	case "u":
+		if !e.history.Undo() {
+			return "Nothing to undo. ", false
+		}
+	case "U", "\x12":
+		if !e.history.Redo() {
+			return "Nothing to redo. ", false
+		}
+	case "P":
+		f, err := os.Create(PatchFile)
+		if err != nil {
+			return fmt.Sprintf("Could not write the patch: %v ", err), false
+		}
+		defer f.Close()
+		if err := e.history.WritePatch(f); err != nil {
+			return fmt.Sprintf("Could not write the patch: %v ", err), false
+		}
+		return fmt.Sprintf("Wrote %d edits to %s. ", len(e.history.Ops()), PatchFile), false
+	case "S":
+		return s.saveSession(nil), false
+	case "L":
+		f, err := os.Open(SaveFile)
+		if err != nil {
+			return fmt.Sprintf("Could not load: %v ", err), false
+		}
+		defer f.Close()
+		loaded, _, err := Load(f)
+		if err != nil {
+			return fmt.Sprintf("Could not load: %v ", err), false
+		}
+		*e = *newEditor(loaded)
+		return fmt.Sprintf("Loaded %s. ", SaveFile), false
+	}
+	if s.cellExists(e.x+dx, e.y+dy) {
+		e.x, e.y = e.x+dx, e.y+dy
+	}
+	return "", false
+}
+
+// do makes the edit op, returning why it couldn't if it couldn't
+func (e *editor) do(op EditOp) string {
+	if err := e.history.Do(op); err != nil {
+		return fmt.Sprintf("Can't: %v. ", err)
+	}
+	return ""
+}
+
+// selection returns the rectangle from the mark to the cursor, or just the
+// cursor's cell with nothing marked
+func (e *editor) selection() image.Rectangle {
+	rect := image.Rect(e.x, e.y, e.x+1, e.y+1)
+	if e.markX != 0 {
+		rect = rect.Union(image.Rect(e.markX, e.markY, e.markX+1, e.markY+1))
+	}
+	return rect
+}
+
+// print writes the cells of the stage in view to w with the cursor, or the
+// rectangle from the mark to it, in reverse video
+func (e *editor) print(w io.Writer, view image.Rectangle) {
+	s := e.s
+	glyph := s.glyphs(false)
+	sel := e.selection()
+	for y := view.Min.Y; y < view.Max.Y; y++ {
+		for x := view.Min.X; x < view.Max.X; x++ {
+			if image.Pt(x, y).In(sel) {
+				io.WriteString(w, "\x1b[7m")
+				s.printCell(w, x, y, glyph(x, y))
+				io.WriteString(w, "\x1b[0m")
+				continue
+			}
+			s.printCell(w, x, y, glyph(x, y))
+		}
+		fmt.Fprintf(w, "\r\n")
+	}
+}
+
+// stamp lays prefab p over the stage with its top left corner at x, y and
+// makes the floor it lays a room, cutting down any room it lands on
+func (s *Stage) stamp(p Prefab, x, y int) error {
+	var floor image.Rectangle
+	for dy, row := range p.Rows {
+		for dx, c := range row {
+			if c == '.' {
+				floor = floor.Union(image.Rect(x+dx, y+dy, x+dx+1, y+dy+1))
+			}
+		}
+	}
+	rect := image.Rect(x, y, x+len(p.Rows[0]), y+len(p.Rows))
+	if err := s.editable(rect); err != nil {
+		return err
+	}
+	for py := floor.Min.Y; py < floor.Max.Y; py++ {
+		for px := floor.Min.X; px < floor.Max.X; px++ {
+			if s.isEdge(px, py) {
+				return fmt.Errorf("(%d, %d) is on the stage's edge", px, py)
+			}
+		}
+	}
+	for dy, row := range p.Rows {
+		for dx, c := range row {
+			if c == '#' {
+				if err := s.buries(image.Rect(x+dx, y+dy, x+dx+1, y+dy+1)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// floor is only carved out of wall, so water and stairs stay put
+	s.cutRooms(floor)
+	for dy, row := range p.Rows {
+		for dx, c := range row {
+			kind := Floor
+			if c == '#' {
+				kind = Wall
+			}
+			if (kind == Floor) == (s.at(x+dx, y+dy).kind != Wall) {
+				continue
+			}
+			if err := s.SetTile(x+dx, y+dy, kind); err != nil {
+				return err
+			}
+		}
+	}
+	room := Room{x: floor.Min.X, y: floor.Min.Y, width: floor.Dx() - 1, height: floor.Dy() - 1}
+	s.rooms = append(s.rooms, room)
+	s.roomsMoved()
+	s.roomPlaced(room)
+	return nil
+}
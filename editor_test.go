@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestEditorKeys(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Regions()
+	e := newEditor(s)
+	e.x, e.y = 3, 3
+	for _, key := range []string{"v", "l", "l", "j", "c"} {
+		e.key(key)
+	}
+	for y := 3; y <= 4; y++ {
+		for x := 3; x <= 5; x++ {
+			if s.at(x, y).kind == Wall {
+				t.Errorf("(%d, %d) wasn't carved", x, y)
+			}
+		}
+	}
+	if e.markX != 0 {
+		t.Error("mark kept after carving")
+	}
+	checkLabels(t, s)
+	if _, quit := e.key("q"); !quit {
+		t.Error("q didn't quit")
+	}
+}
+
+func TestStamp(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rooms := len(s.rooms)
+	p := prefabs[2]
+	if err := s.stamp(p, 3, 3); err != nil {
+		t.Fatal(err)
+	}
+	for dy, row := range p.Rows {
+		for dx, c := range row {
+			if wall := s.at(3+dx, 3+dy).kind == Wall; wall != (c == '#') {
+				t.Errorf("(%d, %d) is %v, want %q", 3+dx, 3+dy, s.at(3+dx, 3+dy).kind, c)
+			}
+		}
+	}
+	room := s.rooms[len(s.rooms)-1]
+	if room != (Room{x: 3, y: 3, width: len(p.Rows[0]) - 1, height: len(p.Rows) - 1}) {
+		t.Errorf("stamped room is %+v", room)
+	}
+	rect := image.Rect(3, 3, 3+len(p.Rows[0]), 3+len(p.Rows))
+	for _, r := range s.rooms[:len(s.rooms)-1] {
+		if image.Rect(r.x, r.y, r.x+r.width+1, r.y+r.height+1).Overlaps(rect) {
+			t.Errorf("room %+v overlaps the stamped one", r)
+		}
+	}
+	if len(s.rooms) < rooms+1 {
+		t.Errorf("%d rooms, want at least %d", len(s.rooms), rooms+1)
+	}
+
+	if err := s.stamp(p, 1, 1); err == nil {
+		t.Error("stamped over the stage's edge")
+	}
+	if err := s.stamp(p, s.width-2, 3); err == nil {
+		t.Error("stamped off the stage")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import "math"
+
+const (
+	rampGlyph = '/'
+
+	// elevationScale is how many cells apart the random heights the
+	// elevation map is smoothed between are
+	elevationScale = 8
+)
+
+// AddElevation gives every cell one of the ElevationLevels option's heights
+// from smoothed random noise. Cells that can be walked between never differ
+// by more than one level. Where the ground steps up, the lower cell is a ramp in
+// corridors; in rooms it is a ledge, except for one ramp per room and level
+// so every tier can be walked onto.
+func (s *Stage) AddElevation() {
+	if s.opts.ElevationLevels < 2 {
+		return
+	}
+	s.elevationLevels = s.opts.ElevationLevels
+
+	gw, gh := s.width/elevationScale+2, s.height/elevationScale+2
+	lattice := make([][]float64, gh)
+	for gy := range lattice {
+		lattice[gy] = make([]float64, gw)
+		for gx := range lattice[gy] {
+			lattice[gy][gx] = s.rng.Float64()
+		}
+	}
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			level := int(valueNoise(lattice, float64(x-1)/elevationScale, float64(y-1)/elevationScale) * float64(s.elevationLevels))
+			if level >= s.elevationLevels {
+				level = s.elevationLevels - 1
+			}
+			tmpTile := s.at(x, y)
+			tmpTile.elevation = int8(level)
+			s.set(x, y, tmpTile)
+		}
+	}
+
+	// wear down anything that would be a cliff between walkable cells
+	for changed := true; changed; {
+		changed = false
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				if !s.IsWalkable(x, y) {
+					continue
+				}
+				for _, n := range s.openNeighbors(x, y) {
+					if s.at(x, y).elevation > n.elevation+1 {
+						tmpTile := s.at(x, y)
+						tmpTile.elevation--
+						s.set(x, y, tmpTile)
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	type tier struct {
+		room  Room
+		level int
+	}
+	ramped := map[tier]bool{}
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if !s.IsWalkable(x, y) || !s.stepsUp(x, y) {
+				continue
+			}
+			tmpTile := s.at(x, y)
+			room, inRoom := s.roomAt(x, y)
+			t := tier{room, int(tmpTile.elevation)}
+			switch {
+			case !inRoom:
+				tmpTile.ramp = true
+			case !ramped[t]:
+				tmpTile.ramp = true
+				ramped[t] = true
+			default:
+				tmpTile.ledge = true
+			}
+			s.set(x, y, tmpTile)
+		}
+	}
+}
+
+// stepsUp reports if a walkable neighbor of x, y is a level higher
+func (s *Stage) stepsUp(x, y int) bool {
+	for _, n := range s.openNeighbors(x, y) {
+		if n.elevation > s.at(x, y).elevation {
+			return true
+		}
+	}
+	return false
+}
+
+// valueNoise blends the four lattice values around x, y
+func valueNoise(lattice [][]float64, x, y float64) float64 {
+	gx, gy := int(x), int(y)
+	fx, fy := smoothstep(x-math.Floor(x)), smoothstep(y-math.Floor(y))
+	top := lattice[gy][gx]*(1-fx) + lattice[gy][gx+1]*fx
+	bottom := lattice[gy+1][gx]*(1-fx) + lattice[gy+1][gx+1]*fx
+	return top*(1-fy) + bottom*fy
+}
+
+func smoothstep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+// Elevation returns the height of the cell at x, y
+func (s *Stage) Elevation(x, y int) int {
+	return int(s.at(x, y).elevation)
+}
+
+// elevationRows returns the elevation map as one string of digits per row,
+// or nil if the stage is flat
+func (s *Stage) elevationRows() []string {
+	if s.elevationLevels < 2 {
+		return nil
+	}
+	rows := make([]string, 0, s.height)
+	for y := 1; y <= s.height; y++ {
+		row := make([]byte, 0, s.width)
+		for x := 1; x <= s.width; x++ {
+			row = append(row, byte('0'+s.at(x, y).elevation))
+		}
+		rows = append(rows, string(row))
+	}
+	return rows
+}
+
+// tiered reports if the floor of room has ledges in it
+func (s *Stage) tiered(room Room) bool {
+	for x := room.x; x <= room.x+room.width; x++ {
+		for y := room.y; y <= room.y+room.height; y++ {
+			if s.at(x, y).ledge {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// The emoji -format emoji draws things as. Every one is a single code point
+// drawn two columns wide without a variation selector, and everything else
+// is padded out to two columns, so rows line up in terminals and chats.
+var (
+	tileEmoji = map[TileType]string{
+		Wall:       "🧱",
+		Door:       "🚪",
+		LockedDoor: "🔒",
+		StairsUp:   "🔼",
+		StairsDown: "🔽",
+		Water:      "🌊",
+		Lava:       "🔥",
+		Chasm:      "⬛",
+		DeepWater:  "🟦",
+		BridgeDeck: "🟫",
+	}
+	featureEmoji = map[Feature]string{
+		Column: "⚪",
+		Altar:  "🛐",
+		Rubble: "🪨",
+	}
+	// monsters without one of their own are dragons
+	monsterEmoji = map[string]string{
+		"rat":             "🐀",
+		"giant rat":       "🐀",
+		"goblin":          "👺",
+		"orc":             "👹",
+		"skeleton":        "💀",
+		"zombie":          "🧟",
+		"ghost":           "👻",
+		"lich":            "🧙",
+		"slime":           "🦠",
+		"crocodile":       "🐊",
+		"kobold":          "🦎",
+		"dwarf":           "🧔",
+		"earth elemental": "🗿",
+		"ice bat":         "🦇",
+		"frost wolf":      "🐺",
+		"yeti":            "🦍",
+	}
+	// items without one of their own are drawn for their class, or else as
+	// a present
+	itemEmoji = map[string]string{
+		"gemstone":      "💎",
+		"silver amulet": "📿",
+		"dagger":        "🔪",
+		"sword":         "🔪",
+		"pickaxe":       "🔨",
+		"gold nugget":   "💰",
+		"fur cloak":     "🧥",
+	}
+	itemClassEmoji = map[string]string{
+		"treasure":  "💰",
+		"potion":    "🧪",
+		"equipment": "🦺",
+		"key":       "🔑",
+	}
+	decorationEmoji = map[string]string{
+		"bones":        "🦴",
+		"puddle":       "💧",
+		"support beam": "🪵",
+		"ore cart":     "🛒",
+		"icicles":      "🧊",
+		"snowdrift":    "⛄",
+	}
+)
+
+const (
+	monsterEmojiDefault = "🐉"
+	itemEmojiDefault    = "🎁"
+	trapEmoji           = "🪤"
+	floorEmoji          = "  "
+)
+
+// widen pads a glyph drawn one column wide out to an emoji's two
+func widen(r rune) string {
+	return string(r) + " "
+}
+
+// emoji returns a function drawing the stage in emoji, in the same order
+// glyphs draws it: monsters over items over stairs over traps (only found
+// ones unless showHidden is set) over locked doors over decorations, over
+// the cell itself
+func (s *Stage) emoji(showHidden bool) func(x, y int) string {
+	over := make(map[int]string)
+	at := func(x, y int, e string) { over[(y-1)*s.width+x-1] = e }
+	for i := len(s.decorations) - 1; i >= 0; i-- {
+		d := s.decorations[i]
+		if s.at(d.x, d.y).kind == LockedDoor {
+			continue
+		}
+		e, ok := decorationEmoji[d.Name]
+		if !ok {
+			e = widen(d.Glyph)
+		}
+		at(d.x, d.y, e)
+	}
+	trapped := make(map[int]bool)
+	for _, t := range s.traps {
+		if i := (t.y-1)*s.width + t.x - 1; !trapped[i] && (t.found || showHidden) {
+			at(t.x, t.y, trapEmoji)
+		}
+		trapped[(t.y-1)*s.width+t.x-1] = true
+	}
+	if s.upX != 0 {
+		at(s.upX, s.upY, tileEmoji[StairsUp])
+	}
+	if s.downX != 0 {
+		at(s.downX, s.downY, tileEmoji[StairsDown])
+	}
+	for i := len(s.items) - 1; i >= 0; i-- {
+		item := s.items[i]
+		e, ok := itemEmoji[item.Name]
+		if !ok {
+			if e, ok = itemClassEmoji[item.Class]; !ok {
+				e = itemEmojiDefault
+			}
+		}
+		at(item.x, item.y, e)
+	}
+	for i := len(s.monsters) - 1; i >= 0; i-- {
+		m := s.monsters[i]
+		e, ok := monsterEmoji[m.Name]
+		if !ok {
+			e = monsterEmojiDefault
+		}
+		at(m.x, m.y, e)
+	}
+	return func(x, y int) string {
+		if e, ok := over[(y-1)*s.width+x-1]; ok {
+			return e
+		}
+		cell := s.at(x, y)
+		switch {
+		case cell.kind == Wall || cell.kind == LockedDoor:
+			return tileEmoji[cell.kind]
+		case cell.feature != NoFeature:
+			if e, ok := featureEmoji[cell.feature]; ok {
+				return e
+			}
+			return widen(cell.feature.Kind().Glyph)
+		case cell.kind.Kind().Terrain:
+			return tileEmoji[cell.kind]
+		case cell.ramp:
+			return widen(rampGlyph)
+		case cell.kind == Door:
+			return tileEmoji[Door]
+		}
+		return floorEmoji
+	}
+}
+
+// WriteEmoji writes the stage to w drawn in emoji, a row at a time
+func (s *Stage) WriteEmoji(w io.Writer) error {
+	b := bufio.NewWriterSize(w, 64<<10)
+	emoji := s.emoji(true)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			b.WriteString(emoji(x, y))
+		}
+		b.WriteByte('\n')
+	}
+	return b.Flush()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWriteEmoji(t *testing.T) {
+	s, err := New(WithSize(31, 15), WithSeed(7), WithStocking(10, 10, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := s.Write(&b, "emoji"); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(rows) != s.height {
+		t.Fatalf("%d rows, want %d", len(rows), s.height)
+	}
+	// every cell is two columns: an emoji, or a glyph and a space
+	for y, row := range rows {
+		cells := 0
+		for row != "" {
+			r, n := utf8.DecodeRuneInString(row)
+			if isEmoji(r) {
+				row = row[n:]
+			} else if len(row) > n && row[n] == ' ' {
+				row = row[n+1:]
+			} else {
+				t.Fatalf("row %d has %q drawn one column wide", y+1, r)
+			}
+			cells++
+		}
+		if cells != s.width {
+			t.Errorf("row %d is %d cells, want %d", y+1, cells, s.width)
+		}
+	}
+	if !strings.HasPrefix(b.String(), tileEmoji[Wall]) {
+		t.Errorf("the corner is drawn as %q", []rune(b.String())[0])
+	}
+	for _, want := range []string{tileEmoji[Door], trapEmoji} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("no %s drawn", want)
+		}
+	}
+}
+
+// isEmoji reports if r is one of the emoji the emoji format uses
+func isEmoji(r rune) bool {
+	all := monsterEmojiDefault + itemEmojiDefault + trapEmoji
+	for _, e := range tileEmoji {
+		all += e
+	}
+	for _, e := range featureEmoji {
+		all += e
+	}
+	for _, m := range []map[string]string{monsterEmoji, itemEmoji, itemClassEmoji, decorationEmoji} {
+		for _, e := range m {
+			all += e
+		}
+	}
+	return strings.ContainsRune(all, r)
+}
+
+func TestEmojiAreOneCodePoint(t *testing.T) {
+	check := func(what, e string) {
+		if utf8.RuneCountInString(e) != 1 {
+			t.Errorf("%s is drawn as %q, %d code points", what, e, utf8.RuneCountInString(e))
+		}
+	}
+	for k, e := range tileEmoji {
+		check(k.Kind().Name, e)
+	}
+	for f, e := range featureEmoji {
+		check(f.Kind().Name, e)
+	}
+	for _, m := range []map[string]string{monsterEmoji, itemEmoji, itemClassEmoji, decorationEmoji} {
+		for name, e := range m {
+			check(name, e)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Endless is a dungeon that goes on forever in every direction, made of
+// Size by Size chunks generated the first time they are asked for. Chunk
+// cx, cy is drawn from a seed made from the master seed and cx, cy alone, so
+// it comes out the same whatever order chunks are visited in. Neighboring
+// chunks share the wall between them, and the passages through it are picked
+// from the seed and that wall alone, so both sides open the same ones.
+type Endless struct {
+	Size int
+
+	opts   Options
+	mu     sync.Mutex
+	chunks map[[2]int]*Stage
+}
+
+// NewEndless returns an endless dungeon of size by size chunks, each
+// generated with the default options changed by opts. The size must be even
+// and at least minChunkSize; the options' own size and chunk size are ignored.
+func NewEndless(size int, opts ...Option) (*Endless, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if size < minChunkSize || size%2 != 0 {
+		return nil, fmt.Errorf("chunk size must be even and at least %d, got %d", minChunkSize, size)
+	}
+	// a pruned dead end could be the one a border passage opens onto
+	o.Width, o.Height, o.ChunkSize, o.Prune = size+1, size+1, 0, 0
+	if err := o.check(); err != nil {
+		return nil, err
+	}
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	if o.Pipeline == nil {
+		o.Pipeline = DefaultPipeline(o)
+	}
+	p, err := o.Pipeline.InsertAfter("connectors", Pass{Name: "borders", Layout: true, Generator: borders{}})
+	if err != nil {
+		return nil, err
+	}
+	o.Pipeline, o.Source = p, nil
+	return &Endless{Size: size, opts: o, chunks: make(map[[2]int]*Stage)}, nil
+}
+
+// Chunk returns chunk cx, cy, generating it if it hasn't been yet. Its cell
+// x, y is at x+cx*Size, y+cy*Size in the whole dungeon, so its last row and
+// column are the first of the chunks below and to the right.
+func (e *Endless) Chunk(cx, cy int) (*Stage, error) {
+	return e.ChunkContext(context.Background(), cx, cy)
+}
+
+// ChunkContext is Chunk, giving up with ctx's error once ctx is cancelled
+func (e *Endless) ChunkContext(ctx context.Context, cx, cy int) (*Stage, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s, ok := e.chunks[[2]int{cx, cy}]; ok {
+		return s, nil
+	}
+	o := e.opts.seeded(mixSeed(e.opts.Seed, 0, int64(cx), int64(cy)))
+	o.Pipeline = o.Pipeline.withBorders(e, cx, cy)
+	s, _, err := GenerateStage(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	e.chunks[[2]int{cx, cy}] = s
+	return s, nil
+}
+
+// Forget drops chunk cx, cy, so a game scrolling away from it doesn't keep
+// it around. Asking for it again generates it over, the same as before.
+func (e *Endless) Forget(cx, cy int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.chunks, [2]int{cx, cy})
+}
+
+// borders opens the passages through each side of an endless chunk
+type borders struct {
+	e      *Endless
+	cx, cy int
+}
+
+// withBorders returns a copy of the pipeline with its borders pass opening
+// the sides of chunk cx, cy
+func (p Pipeline) withBorders(e *Endless, cx, cy int) Pipeline {
+	out := append(Pipeline{}, p...)
+	for i := range out {
+		if _, ok := out[i].Generator.(borders); ok {
+			out[i].Generator = borders{e: e, cx: cx, cy: cy}
+		}
+	}
+	return out
+}
+
+func (g borders) Carve(s *Stage, _ *rand.Rand) error {
+	size := g.e.Size
+	// a side is named by the chunk it is the left or top of
+	for _, side := range []struct {
+		cx, cy, dir int
+		at          int // the column or row its wall runs along
+	}{
+		{g.cx, g.cy, 1, 1},
+		{g.cx + 1, g.cy, 1, size + 1},
+		{g.cx, g.cy, 2, 1},
+		{g.cx, g.cy + 1, 2, size + 1},
+	} {
+		rng := rand.New(rand.NewSource(mixSeed(g.e.opts.Seed, int64(side.dir), int64(side.cx), int64(side.cy))))
+		for i := rng.Intn(2) + 1; i > 0; i-- {
+			// an even cell along the side, which has a maze cell or a room
+			// on both sides of it. Both chunks see it as floor, even where
+			// it opens into a room, so they draw it the same.
+			x, y := side.at, 2+2*rng.Intn(size/2)
+			if side.dir == 2 {
+				x, y = y, x
+			}
+			s.setKind(x, y, Floor)
+			s.regionsJoined(x, y)
+		}
+	}
+	return nil
+}
+
+// mixSeed returns a seed made from seed and keys, spread so that nearby keys
+// give unrelated seeds
+func mixSeed(seed int64, keys ...int64) int64 {
+	h := uint64(seed)
+	for _, k := range keys {
+		h ^= uint64(k) + 0x9e3779b97f4a7c15 + h<<6 + h>>2
+		// splitmix64's finalizer
+		h ^= h >> 30
+		h *= 0xbf58476d1ce4e5b9
+		h ^= h >> 27
+		h *= 0x94d049bb133111eb
+		h ^= h >> 31
+	}
+	return int64(h)
+}
@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+func TestEndlessBordersLineUp(t *testing.T) {
+	e, err := NewEndless(16, WithSeed(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cy := -1; cy <= 1; cy++ {
+		for cx := -1; cx <= 1; cx++ {
+			s, err := e.Chunk(cx, cy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			right, err := e.Chunk(cx+1, cy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			below, err := e.Chunk(cx, cy+1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rightOpen, belowOpen := 0, 0
+			for i := 1; i <= e.Size+1; i++ {
+				if a, b := s.at(e.Size+1, i).kind != Wall, right.at(1, i).kind != Wall; a != b {
+					t.Errorf("chunk %d,%d and the one right of it disagree at row %d", cx, cy, i)
+				} else if a {
+					rightOpen++
+				}
+				if a, b := s.at(i, e.Size+1).kind != Wall, below.at(i, 1).kind != Wall; a != b {
+					t.Errorf("chunk %d,%d and the one below it disagree at column %d", cx, cy, i)
+				} else if a {
+					belowOpen++
+				}
+			}
+			if rightOpen == 0 || belowOpen == 0 {
+				t.Errorf("chunk %d,%d has a closed side: %d open right, %d below", cx, cy, rightOpen, belowOpen)
+			}
+		}
+	}
+}
+
+func TestEndlessChunksDontDependOnOrder(t *testing.T) {
+	a, err := NewEndless(16, WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewEndless(16, WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range [][2]int{{3, -2}, {0, 0}, {-5, 1}} {
+		if _, err := a.Chunk(c[0], c[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, _ := a.Chunk(-5, 1)
+	a.Forget(-5, 1)
+	again, _ := a.Chunk(-5, 1)
+	got, _ := b.Chunk(-5, 1)
+	if got.String() != want.String() || again.String() != want.String() {
+		t.Errorf("chunk -5,1 changed:\n%s\nwant:\n%s", got, want)
+	}
+	if other, _ := b.Chunk(-4, 1); other.String() == want.String() {
+		t.Errorf("neighboring chunks came out the same")
+	}
+}
+
+func TestNewEndlessRejects(t *testing.T) {
+	for _, size := range []int{0, 6, 17} {
+		if _, err := NewEndless(size); err == nil {
+			t.Errorf("NewEndless(%d) gave no error", size)
+		}
+	}
+	if _, err := NewEndless(16, WithPipeline(Pipeline{{Name: "rooms", Layout: true, Generator: Rooms{}}})); err == nil {
+		t.Errorf("NewEndless with no connectors pass gave no error")
+	}
+}
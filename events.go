@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Event is a step in generating a stage, as EventWriter writes it. Stage
+// numbers the stages generated from 1, since more than one can be tried
+// before one is picked; each starts with a "stage" event giving its size.
+// The rest are "room_placed" with the cells the room spans, "cell_carved"
+// with what the cell was carved into, "regions_joined" with the cell where
+// two regions meet, and "pass_complete" with the pass that finished. Served
+// over HTTP, a last "done" event gives the stage picked.
+type Event struct {
+	Event  string `json:"event"`
+	Stage  int    `json:"stage"`
+	X      int    `json:"x,omitempty"`
+	Y      int    `json:"y,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Tile   string `json:"tile,omitempty"`
+	Pass   string `json:"pass,omitempty"`
+}
+
+// EventWriter returns hooks that write every step in generating a stage to
+// w as an Event, a line of JSON each, for renderers of their own to animate
+// it from. The func returned reports the first error writing any of them.
+func EventWriter(w io.Writer) (Hooks, func() error) {
+	enc := json.NewEncoder(w)
+	l := newEventLog(func(e Event) error { return enc.Encode(e) })
+	return l.hooks(), l.err
+}
+
+// eventLog numbers the stages generated as it passes the steps in
+// generating them on to emit, keeping the first error emit returns
+type eventLog struct {
+	mu       sync.Mutex
+	emit     func(Event) error
+	stages   map[*Stage]int
+	firstErr error
+}
+
+// newEventLog returns an eventLog passing events on to emit
+func newEventLog(emit func(Event) error) *eventLog {
+	return &eventLog{emit: emit, stages: make(map[*Stage]int)}
+}
+
+// write passes e on for s, after a "stage" event if s is new
+func (l *eventLog) write(s *Stage, e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stages[s] == 0 {
+		l.stages[s] = len(l.stages) + 1
+		l.check(l.emit(Event{Event: "stage", Stage: l.stages[s], Width: s.width, Height: s.height}))
+	}
+	e.Stage = l.stages[s]
+	l.check(l.emit(e))
+}
+
+// check keeps err if it's the first
+func (l *eventLog) check(err error) {
+	if err != nil && l.firstErr == nil {
+		l.firstErr = err
+	}
+}
+
+// err returns the first error emitting any event
+func (l *eventLog) err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.firstErr
+}
+
+// hooks returns hooks writing the steps they're called with
+func (l *eventLog) hooks() Hooks {
+	return Hooks{
+		OnRoomPlaced: func(s *Stage, x, y, width, height int) {
+			l.write(s, Event{Event: "room_placed", X: x, Y: y, Width: width, Height: height})
+		},
+		OnCellCarved: func(s *Stage, x, y int) {
+			l.write(s, Event{Event: "cell_carved", X: x, Y: y, Tile: s.at(x, y).kind.Kind().Name})
+		},
+		OnRegionsJoined: func(s *Stage, x, y int) {
+			l.write(s, Event{Event: "regions_joined", X: x, Y: y})
+		},
+		OnPassComplete: func(s *Stage, pass string) {
+			l.write(s, Event{Event: "pass_complete", Pass: pass})
+		},
+	}
+}
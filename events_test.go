@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestEventWriter(t *testing.T) {
+	var b bytes.Buffer
+	hooks, written := EventWriter(&b)
+	s, err := New(WithSeed(1), WithHooks(hooks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := written(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := make(map[string]int)
+	lines := bufio.NewScanner(&b)
+	for lines.Scan() {
+		var e Event
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			t.Fatalf("event %s: %v", lines.Text(), err)
+		}
+		if len(count) == 0 && (e.Event != "stage" || e.Width != 79 || e.Height != 21) {
+			t.Errorf("first event is %s", lines.Text())
+		}
+		if e.Stage != 1 {
+			t.Errorf("event %s isn't for stage 1", lines.Text())
+		}
+		switch e.Event {
+		case "cell_carved", "regions_joined", "room_placed":
+			if !s.cellExists(e.X, e.Y) {
+				t.Errorf("event %s is off the stage", lines.Text())
+			}
+		}
+		if e.Event == "cell_carved" && e.Tile == "" {
+			t.Errorf("event %s doesn't say what was carved", lines.Text())
+		}
+		count[e.Event]++
+	}
+	if count["stage"] != 1 || count["room_placed"] != len(s.rooms) || count["pass_complete"] != 12 || count["regions_joined"] == 0 {
+		t.Errorf("events written: %v", count)
+	}
+}
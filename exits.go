@@ -0,0 +1,55 @@
+package main
+
+import "image"
+
+// Exit is a door out of a room, at X, Y in its Side: north, east, south, or
+// west. Region is the region the door opens onto, and Room, when that's
+// inside a room, is which one, numbered from 1 in the stage's order, or 0
+// when it's corridors.
+type Exit struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Side   string `json:"side"`
+	Locked bool   `json:"locked"`
+	Region int    `json:"region"`
+	Room   int    `json:"room"`
+}
+
+// sideSteps is the way out through a door in each side of a room
+var sideSteps = map[string][2]int{"north": {0, -1}, "east": {1, 0}, "south": {0, 1}, "west": {-1, 0}}
+
+// Bounds returns the cells room spans
+func (r Room) Bounds() image.Rectangle {
+	// rooms span x through x+width inclusive
+	return image.Rect(r.x, r.y, r.x+r.width+1, r.y+r.height+1)
+}
+
+// RoomAt returns the room x, y is in, if it's in one
+func (s *Stage) RoomAt(x, y int) (Room, bool) {
+	return s.roomAt(x, y)
+}
+
+// Exits returns the doors out of room in the order they were carved, and
+// where each leads. The stage's regions are labeled as Regions labels them.
+func (s *Stage) Exits(room Room) []Exit {
+	s.Regions()
+	return s.exits(room)
+}
+
+// exits returns the doors out of room as Exits does, with the regions as
+// they were last labeled
+func (s *Stage) exits(room Room) []Exit {
+	s.indexRooms()
+	doors := s.roomDoors(room)
+	exits := make([]Exit, 0, len(doors))
+	for _, d := range doors {
+		e := Exit{X: d.x, Y: d.y, Side: doorDirection(room, d), Locked: s.at(d.x, d.y).kind == LockedDoor}
+		step := sideSteps[e.Side]
+		if x, y := s.step(d.x, d.y, step[0], step[1]); s.cellExists(x, y) {
+			e.Region = s.RegionAt(x, y)
+			e.Room = int(s.roomIndex[(y-1)*s.width+x-1])
+		}
+		exits = append(exits, e)
+	}
+	return exits
+}
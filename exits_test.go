@@ -0,0 +1,46 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestExits(t *testing.T) {
+	s, err := New(WithSize(41, 21), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toRooms := 0
+	for i, room := range s.rooms {
+		b := room.Bounds()
+		if got, ok := s.RoomAt(b.Min.X, b.Min.Y); !ok || got != room {
+			t.Errorf("room %d isn't at its corner %v", i+1, b.Min)
+		}
+		if got, ok := s.RoomAt(b.Max.X-1, b.Max.Y-1); !ok || got != room {
+			t.Errorf("room %d isn't at its far corner %v", i+1, b.Max.Sub(image.Pt(1, 1)))
+		}
+
+		exits := s.Exits(room)
+		if len(exits) != len(s.roomDoors(room)) || len(exits) == 0 {
+			t.Errorf("room %d has %d exits, want one for each of its %d doors", i+1, len(exits), len(s.roomDoors(room)))
+		}
+		for _, e := range exits {
+			inside := image.Pt(e.X, e.Y).Sub(image.Pt(sideSteps[e.Side][0], sideSteps[e.Side][1]))
+			if !s.isDoor(e.X, e.Y) || !inside.In(b) || image.Pt(e.X, e.Y).In(b) {
+				t.Errorf("room %d exit %+v isn't a door in its %s side", i+1, e, e.Side)
+			}
+			if e.Room == i+1 || e.Region == 0 {
+				t.Errorf("room %d exit %+v leads nowhere", i+1, e)
+			}
+			if e.Room != 0 {
+				toRooms++
+			}
+		}
+	}
+	if toRooms == 0 {
+		t.Error("no exit leads into another room")
+	}
+	if _, ok := s.RoomAt(0, 0); ok {
+		t.Error("there's a room off the stage")
+	}
+}
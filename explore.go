@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// ExploreReport is what the autoexplore bot found. Coverage is the percent
+// of open tiles the bot stood on; Unreachable lists open tiles it could never
+// get to from the entrance (walled off areas or the far side of locked doors).
+// Terrain and features nothing can cross don't count as open.
+type ExploreReport struct {
+	OpenTiles    int         `json:"open_tiles"`
+	VisitedTiles int         `json:"visited_tiles"`
+	Steps        int         `json:"steps"`
+	Coverage     float64     `json:"coverage"`
+	Unreachable  []PointJSON `json:"unreachable"`
+}
+
+// Autoexplore sends a bot from the entrance to explore the stage the way a
+// player would. The bot sees the cells around it (and the whole room it is
+// in), and keeps walking to the nearest open cell it has seen but not stood
+// on until there are none left it can get to.
+func (s *Stage) Autoexplore() ExploreReport {
+	seen := make([]bool, len(s.cell))
+	visited := make([]bool, len(s.cell))
+	mark := func(m []bool, x, y int) {
+		if s.cellExists(x, y) {
+			m[(y-1)*s.width+x-1] = true
+		}
+	}
+	look := func(x, y int) {
+		mark(visited, x, y)
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				mark(seen, x+dx, y+dy)
+			}
+		}
+		if room, ok := s.roomAt(x, y); ok {
+			for rx := room.x; rx <= room.x+room.width; rx++ {
+				for ry := room.y; ry <= room.y+room.height; ry++ {
+					mark(seen, rx, ry)
+				}
+			}
+		}
+	}
+
+	report := ExploreReport{Unreachable: make([]PointJSON, 0)}
+	x, y := s.entranceX, s.entranceY
+	look(x, y)
+	for {
+		// the frontier is every open cell we've seen but not stood on.
+		// head for whichever one is the fewest steps away, the topmost then
+		// leftmost of those.
+		dist := s.DistanceMap(x, y)
+		targetX, targetY, best := 0, 0, -1
+		for i := range seen {
+			fx, fy := i%s.width+1, i/s.width+1
+			d, ok := dist.At(fx, fy)
+			if !ok || !seen[i] || visited[i] || !s.isOpen(fx, fy) {
+				continue
+			}
+			if best == -1 || d < best {
+				targetX, targetY, best = fx, fy, d
+			}
+		}
+		if best == -1 {
+			break
+		}
+
+		toTarget := s.DistanceMap(targetX, targetY)
+		for x != targetX || y != targetY {
+			x, y, _ = s.StepToward(x, y, toTarget)
+			report.Steps++
+			look(x, y)
+		}
+	}
+
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if !s.isOpen(x, y) || (!s.IsWalkable(x, y) && s.at(x, y).kind != LockedDoor) {
+				continue
+			}
+			report.OpenTiles++
+			if visited[(y-1)*s.width+x-1] {
+				report.VisitedTiles++
+			} else {
+				report.Unreachable = append(report.Unreachable, PointJSON{X: x, Y: y})
+			}
+		}
+	}
+	if report.OpenTiles > 0 {
+		report.Coverage = 100 * float64(report.VisitedTiles) / float64(report.OpenTiles)
+	}
+	return report
+}
+
+// WriteJSON writes the report as indented JSON
+func (r ExploreReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StageJSON is the structured form of a stage written by WriteJSON.
+// Rows holds the map with '#' for walls and ' ' for open cells, and Terrain
+// lists the open cells covered by water, lava, or chasms. Features lists the
+// columns, altars, and rubble rooms are furnished with. If the stage has
+// elevation, Elevation holds each cell's height as a digit, row by row, and
+// Ramps and Ledges list the cells where the floor steps up. All coordinates
+// are 1 based, matching the rows.
+type StageJSON struct {
+	Theme      string        `json:"theme"`
+	Width      int           `json:"width"`
+	Height     int           `json:"height"`
+	Rows       []string      `json:"rows"`
+	Entrance   PointJSON     `json:"entrance"`
+	StairsUp   *PointJSON    `json:"stairs_up,omitempty"`
+	StairsDown *PointJSON    `json:"stairs_down,omitempty"`
+	Rooms      []RoomJSON    `json:"rooms"`
+	Monsters   []EntityJSON  `json:"monsters"`
+	Items      []EntityJSON  `json:"items"`
+	Doors      []DoorJSON    `json:"doors"`
+	Traps      []TrapJSON    `json:"traps"`
+	Terrain    []TerrainJSON `json:"terrain"`
+	Bridges    []BridgeJSON  `json:"bridges"`
+	Elevation  []string      `json:"elevation,omitempty"`
+	Ramps      []PointJSON   `json:"ramps,omitempty"`
+	Ledges     []PointJSON   `json:"ledges,omitempty"`
+	Features   []FeatureJSON `json:"features"`
+
+	Decorations []EntityJSON `json:"decorations"`
+}
+
+type PointJSON struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type RoomJSON struct {
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Description string `json:"description"`
+}
+
+type DoorJSON struct {
+	X      int  `json:"x"`
+	Y      int  `json:"y"`
+	Locked bool `json:"locked"`
+}
+
+type TrapJSON struct {
+	Name    string `json:"name"`
+	Trigger string `json:"trigger"`
+	Effect  string `json:"effect"`
+	Damage  int    `json:"damage"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+}
+
+type TerrainJSON struct {
+	Name      string `json:"name"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	Passable  bool   `json:"passable"`
+	Hazardous bool   `json:"hazardous"`
+}
+
+type FeatureJSON struct {
+	Name     string `json:"name"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Passable bool   `json:"passable"`
+}
+
+// BridgeJSON is a bridge or ford from one end to the other, over the
+// terrain it crosses
+type BridgeJSON struct {
+	Kind   string    `json:"kind"`
+	Over   string    `json:"over"`
+	From   PointJSON `json:"from"`
+	To     PointJSON `json:"to"`
+	Length int       `json:"length"`
+}
+
+type EntityJSON struct {
+	Name  string `json:"name"`
+	Class string `json:"class,omitempty"`
+	Glyph string `json:"glyph"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+}
+
+// JSON collects the stage and everything stocked in it into a StageJSON
+func (s *Stage) JSON() StageJSON {
+	out := StageJSON{
+		Theme:    s.theme.Name,
+		Width:    s.width,
+		Height:   s.height,
+		Entrance: PointJSON{X: s.entranceX, Y: s.entranceY},
+		Rooms:    make([]RoomJSON, 0, len(s.rooms)),
+		Monsters: make([]EntityJSON, 0, len(s.monsters)),
+		Items:    make([]EntityJSON, 0, len(s.items)),
+		Doors:    make([]DoorJSON, 0, len(s.doors)),
+		Traps:    make([]TrapJSON, 0, len(s.traps)),
+		Terrain:  make([]TerrainJSON, 0),
+		Bridges:  make([]BridgeJSON, 0, len(s.bridges)),
+		Features: make([]FeatureJSON, 0),
+
+		Decorations: make([]EntityJSON, 0, len(s.decorations)),
+	}
+	for y := 1; y <= s.height; y++ {
+		row := make([]byte, 0, s.width)
+		for x := 1; x <= s.width; x++ {
+			if s.at(x, y).kind != Wall {
+				row = append(row, ' ')
+			} else {
+				row = append(row, '#')
+			}
+			if t := s.at(x, y).kind; t.Kind().Terrain {
+				k := t.Kind()
+				out.Terrain = append(out.Terrain, TerrainJSON{Name: k.Name, X: x, Y: y, Passable: k.Flags.Has(Walkable), Hazardous: k.Flags.Has(Hazardous)})
+			}
+			if f := s.at(x, y).feature; f != NoFeature {
+				out.Features = append(out.Features, FeatureJSON{Name: f.Kind().Name, X: x, Y: y, Passable: f.Kind().Flags.Has(Walkable)})
+			}
+			if s.at(x, y).ramp {
+				out.Ramps = append(out.Ramps, PointJSON{X: x, Y: y})
+			}
+			if s.at(x, y).ledge {
+				out.Ledges = append(out.Ledges, PointJSON{X: x, Y: y})
+			}
+		}
+		out.Rows = append(out.Rows, string(row))
+	}
+	out.Elevation = s.elevationRows()
+	// rooms span x through x+width inclusive
+	for _, room := range s.rooms {
+		out.Rooms = append(out.Rooms, RoomJSON{X: room.x, Y: room.y, Width: room.width + 1, Height: room.height + 1, Description: s.Describe(room)})
+	}
+	for _, m := range s.monsters {
+		out.Monsters = append(out.Monsters, EntityJSON{Name: m.Name, Glyph: string(m.Glyph), X: m.x, Y: m.y})
+	}
+	for _, item := range s.items {
+		out.Items = append(out.Items, EntityJSON{Name: item.Name, Class: item.Class, Glyph: string(item.Glyph), X: item.x, Y: item.y})
+	}
+	if s.upX != 0 {
+		out.StairsUp = &PointJSON{X: s.upX, Y: s.upY}
+	}
+	if s.downX != 0 {
+		out.StairsDown = &PointJSON{X: s.downX, Y: s.downY}
+	}
+	for _, d := range s.doors {
+		out.Doors = append(out.Doors, DoorJSON{X: d.x, Y: d.y, Locked: s.at(d.x, d.y).kind == LockedDoor})
+	}
+	for _, t := range s.traps {
+		out.Traps = append(out.Traps, TrapJSON{Name: t.Name, Trigger: t.Trigger, Effect: t.Effect, Damage: t.Damage, X: t.x, Y: t.y})
+	}
+	for _, b := range s.bridges {
+		out.Bridges = append(out.Bridges, b.JSON())
+	}
+	for _, d := range s.decorations {
+		out.Decorations = append(out.Decorations, EntityJSON{Name: d.Name, Glyph: string(d.Glyph), X: d.x, Y: d.y})
+	}
+	return out
+}
+
+// WriteJSON writes the stage as indented JSON
+func (s *Stage) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.JSON())
+}
+
+// WriteMarkdown writes a game master's handout: the map, a keyed
+// description of every room, and a list of the traps
+func (s *Stage) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Dungeon\n\n```\n" + s.String() + "```\n\n")
+	fmt.Fprintf(&b, "Theme: %s. The entrance is at (%d, %d).\n\n## Rooms\n\n", s.theme.Name, s.entranceX, s.entranceY)
+	for i, room := range s.rooms {
+		fmt.Fprintf(&b, "### %d. Room at (%d, %d)\n\n%s\n\n", i+1, room.x, room.y, s.Describe(room))
+	}
+	if len(s.bridges) > 0 {
+		b.WriteString("## Crossings\n\n")
+		for _, br := range s.bridges {
+			j := br.JSON()
+			fmt.Fprintf(&b, "- A %s over the %s from (%d, %d) to (%d, %d)\n", j.Kind, j.Over, j.From.X, j.From.Y, j.To.X, j.To.Y)
+		}
+		b.WriteString("\n")
+	}
+	if len(s.traps) > 0 {
+		b.WriteString("## Traps\n\n| Trap | Location | Trigger | Effect | Damage |\n| --- | --- | --- | --- | --- |\n")
+		for _, t := range s.traps {
+			fmt.Fprintf(&b, "| %s | (%d, %d) | %s | %s | %d |\n", t.Name, t.x, t.y, t.Trigger, t.Effect, t.Damage)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
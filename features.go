@@ -0,0 +1,102 @@
+package main
+
+// Feature is something built or fallen in a room that sits on the floor
+type Feature uint8
+
+const (
+	NoFeature Feature = iota
+	Column
+	Altar
+	Rubble
+)
+
+// FeatureKind describes a feature. ASCII is drawn in place of Glyph where
+// only ASCII will do. Flags are what the feature leaves of the flags of the
+// cell it stands on; Cost is added to the cell's movement cost.
+type FeatureKind struct {
+	Name  string
+	Glyph rune
+	ASCII byte
+	Flags TileFlags
+	Cost  int
+}
+
+var featureKinds = [...]FeatureKind{
+	NoFeature: {Name: "floor", Flags: Walkable | Transparent},
+	Column:    {Name: "column", Glyph: '●', ASCII: 'O'},
+	Altar:     {Name: "altar", Glyph: 'Π', ASCII: '_', Flags: Transparent},
+	Rubble:    {Name: "rubble", Glyph: '∷', ASCII: ',', Flags: Walkable | Transparent, Cost: 1},
+}
+
+// minFurnishedArea is the fewest cells a room needs to be furnished
+const minFurnishedArea = 40
+
+// Kind returns the description of the feature
+func (f Feature) Kind() FeatureKind {
+	return featureKinds[f]
+}
+
+// AddFeatures furnishes the large rooms. A third get a grid of columns, a
+// third an altar in the middle, and the rest nothing but rubble; any of them
+// may have rubble along the walls. Columns are set one cell in from the
+// walls and a cell apart, so a room can always be walked through.
+func (s *Stage) AddFeatures() {
+	for _, room := range s.rooms {
+		// rooms span x through x+width inclusive
+		if (room.width+1)*(room.height+1) < minFurnishedArea {
+			continue
+		}
+		switch s.rng.Intn(3) {
+		case 0:
+			if room.width >= 4 && room.height >= 4 {
+				for y := room.y + 1; y < room.y+room.height; y += 2 {
+					for x := room.x + 1; x < room.x+room.width; x += 2 {
+						s.addFeature(x, y, Column)
+					}
+				}
+			}
+		case 1:
+			s.addFeature(room.x+room.width/2, room.y+room.height/2, Altar)
+		}
+		for y := room.y; y <= room.y+room.height; y++ {
+			for x := room.x; x <= room.x+room.width; x++ {
+				alongWall := x == room.x || x == room.x+room.width || y == room.y || y == room.y+room.height
+				if alongWall && s.rng.Intn(10) == 0 {
+					s.addFeature(x, y, Rubble)
+				}
+			}
+		}
+	}
+}
+
+// addFeature puts a feature on x, y unless something is already there or
+// it is the entrance or stairs. One that blocks the way isn't set beside
+// terrain nothing can cross, where the two could wall a cell in.
+func (s *Stage) addFeature(x, y int, f Feature) {
+	if !s.onGround(x, y) || s.isStairs(x, y) || (x == s.entranceX && y == s.entranceY) {
+		return
+	}
+	if !f.Kind().Flags.Has(Walkable) {
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if t := s.at(x+dx, y+dy).kind.Kind(); t.Terrain && !t.Flags.Has(Walkable) {
+					return
+				}
+			}
+		}
+	}
+	s.setFeature(x, y, f)
+}
+
+// featureCounts returns how many of each feature are in room
+func (s *Stage) featureCounts(room Room) map[Feature]int {
+	counts := map[Feature]int{}
+	for x := room.x; x <= room.x+room.width; x++ {
+		for y := room.y; y <= room.y+room.height; y++ {
+			if f := s.at(x, y).feature; f != NoFeature {
+				counts[f]++
+			}
+		}
+	}
+	return counts
+}
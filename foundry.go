@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// FoundryScene is a scene for the Foundry virtual tabletop, the stage on a
+// grid of Grid.Size pixel squares over a background image of it, with walls
+// along every edge between wall and floor, for lighting and vision, and a
+// door across every doorway.
+type FoundryScene struct {
+	Name        string            `json:"name"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Padding     float64           `json:"padding"`
+	Background  FoundryBackground `json:"background"`
+	Grid        FoundryGrid       `json:"grid"`
+	TokenVision bool              `json:"tokenVision"`
+	Walls       []FoundryWall     `json:"walls"`
+}
+
+type FoundryBackground struct {
+	Src string `json:"src"`
+}
+
+type FoundryGrid struct {
+	Type     int     `json:"type"`
+	Size     int     `json:"size"`
+	Distance float64 `json:"distance"`
+	Units    string  `json:"units"`
+}
+
+// FoundryWall is a wall from C[0], C[1] to C[2], C[3] in pixels. Door is 1
+// for a door, and DS its state, 2 when it's locked.
+type FoundryWall struct {
+	C    [4]int `json:"c"`
+	Door int    `json:"door"`
+	DS   int    `json:"ds"`
+}
+
+// Foundry walls and doors, from Foundry's CONST.WALL_DOOR_TYPES and
+// CONST.WALL_DOOR_STATES
+const (
+	foundryDoor       = 1
+	foundryDoorLocked = 2
+)
+
+// Foundry returns the stage as a Foundry scene, each cell size pixels
+// across, over the image at background, which is what WritePNG draws at
+// that scale
+func (s *Stage) Foundry(size int, background string) FoundryScene {
+	scene := FoundryScene{
+		Name:        fmt.Sprintf("%s dungeon", capitalize(s.theme.Name)),
+		Width:       s.width * size,
+		Height:      s.height * size,
+		Background:  FoundryBackground{Src: background},
+		Grid:        FoundryGrid{Type: 1, Size: size, Distance: 5, Units: "ft"},
+		TokenVision: true,
+		Walls:       make([]FoundryWall, 0),
+	}
+	for _, run := range s.wallRuns() {
+		scene.Walls = append(scene.Walls, FoundryWall{C: [4]int{run[0] * size, run[1] * size, run[2] * size, run[3] * size}})
+	}
+	for _, d := range s.doors {
+		line := s.doorway(d.x, d.y)
+		door := FoundryWall{Door: foundryDoor}
+		for i, v := range line {
+			door.C[i] = int(v * float64(size))
+		}
+		if s.at(d.x, d.y).kind == LockedDoor {
+			door.DS = foundryDoorLocked
+		}
+		scene.Walls = append(scene.Walls, door)
+	}
+	return scene
+}
+
+// WriteFoundry writes the stage as a Foundry scene as indented JSON
+func (s *Stage) WriteFoundry(w io.Writer, size int, background string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.Foundry(size, background))
+}
+
+// wallRuns returns the runs of edges between wall and anything else, each
+// from x0, y0 to x1, y1 in cells counted from the stage's top left corner,
+// along each line between rows and then each between columns
+func (s *Stage) wallRuns() [][4]int {
+	solid := func(x, y int) bool { return !s.cellExists(x, y) || s.at(x, y).kind == Wall }
+	runs := make([][4]int, 0)
+	for y := 0; y <= s.height; y++ {
+		start := 0
+		for x := 1; x <= s.width+1; x++ {
+			edge := x <= s.width && solid(x, y) != solid(x, y+1)
+			switch {
+			case edge && start == 0:
+				start = x
+			case !edge && start != 0:
+				runs = append(runs, [4]int{start - 1, y, x - 1, y})
+				start = 0
+			}
+		}
+	}
+	for x := 0; x <= s.width; x++ {
+		start := 0
+		for y := 1; y <= s.height+1; y++ {
+			edge := y <= s.height && solid(x, y) != solid(x+1, y)
+			switch {
+			case edge && start == 0:
+				start = y
+			case !edge && start != 0:
+				runs = append(runs, [4]int{x, start - 1, x, y - 1})
+				start = 0
+			}
+		}
+	}
+	return runs
+}
+
+// doorway returns the line across the middle of the doorway at x, y from
+// one of its walls to the other, in cells as wallRuns counts them
+func (s *Stage) doorway(x, y int) [4]float64 {
+	left, top := float64(x-1), float64(y-1)
+	if s.at(x-1, y).kind == Wall && s.at(x+1, y).kind == Wall {
+		return [4]float64{left, top + 0.5, left + 1, top + 0.5}
+	}
+	return [4]float64{left + 0.5, top, left + 0.5, top + 1}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFoundry(t *testing.T) {
+	s, err := New(WithSize(41, 21), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := s.doors[0]
+	locked.kind = LockedDoor
+	s.set(locked.x, locked.y, locked)
+
+	var b strings.Builder
+	if err := s.WriteFoundry(&b, 50, "dungeon.png"); err != nil {
+		t.Fatal(err)
+	}
+	var scene FoundryScene
+	if err := json.Unmarshal([]byte(b.String()), &scene); err != nil {
+		t.Fatal(err)
+	}
+	if scene.Width != 41*50 || scene.Height != 21*50 || scene.Grid.Size != 50 || scene.Background.Src != "dungeon.png" {
+		t.Errorf("scene is %d by %d on a %d pixel grid over %q", scene.Width, scene.Height, scene.Grid.Size, scene.Background.Src)
+	}
+
+	// every edge between wall and floor is walled, once
+	edges := make(map[[4]int]int)
+	doors, lockedDoors := 0, 0
+	for _, w := range scene.Walls {
+		if w.Door == foundryDoor {
+			doors++
+			if w.DS == foundryDoorLocked {
+				lockedDoors++
+			}
+			continue
+		}
+		x0, y0, x1, y1 := w.C[0]/50, w.C[1]/50, w.C[2]/50, w.C[3]/50
+		if (x0 != x1 && y0 != y1) || x0 > x1 || y0 > y1 || (x0 == x1 && y0 == y1) {
+			t.Fatalf("wall %v isn't a line along the grid", w.C)
+		}
+		for x := x0; x < x1; x++ {
+			edges[[4]int{x, y0, x + 1, y0}]++
+		}
+		for y := y0; y < y1; y++ {
+			edges[[4]int{x0, y, x0, y + 1}]++
+		}
+	}
+	want := 0
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			open := s.at(x, y).kind != Wall
+			if x < s.width && open != (s.at(x+1, y).kind != Wall) {
+				want++
+				if edges[[4]int{x, y - 1, x, y}] != 1 {
+					t.Errorf("edge right of %d, %d is walled %d times", x, y, edges[[4]int{x, y - 1, x, y}])
+				}
+			}
+			if y < s.height && open != (s.at(x, y+1).kind != Wall) {
+				want++
+				if edges[[4]int{x - 1, y, x, y}] != 1 {
+					t.Errorf("edge below %d, %d is walled %d times", x, y, edges[[4]int{x - 1, y, x, y}])
+				}
+			}
+		}
+	}
+	if len(edges) != want {
+		t.Errorf("%d edges walled, want %d", len(edges), want)
+	}
+	if doors != len(s.doors) || lockedDoors != 1 {
+		t.Errorf("%d doors, %d locked, want %d and 1", doors, lockedDoors, len(s.doors))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FrameWriter returns hooks that write frames of a stage to dir as it is
+// generated, without touching the terminal, so they can be put together into
+// a video after: one every skip cells carved, and one more as each pass
+// finishes. They are numbered from frame-00001 on, and are PNG images scale
+// pixels to a cell or, with format "txt", the stage drawn as text. The func
+// returned reports the first error writing any of them.
+func FrameWriter(dir, format string, skip, scale int) (Hooks, func() error, error) {
+	if format != "png" && format != "txt" {
+		return Hooks{}, nil, fmt.Errorf("unknown frame format %q, want png or txt", format)
+	}
+	if skip < 1 || scale < 1 {
+		return Hooks{}, nil, fmt.Errorf("frame skip and scale must be at least 1, got %d and %d", skip, scale)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Hooks{}, nil, err
+	}
+
+	var mu sync.Mutex
+	frames, carved := 0, 0
+	var firstErr error
+	write := func(s *Stage) {
+		frames++
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("frame-%05d.%s", frames, format)))
+		if err == nil {
+			if format == "png" {
+				err = s.WritePNG(f, scale)
+			} else {
+				err = s.writeRows(f, s.glyphs(true))
+			}
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	hooks := Hooks{
+		OnCellCarved: func(s *Stage, x, y int) {
+			mu.Lock()
+			defer mu.Unlock()
+			if carved++; carved%skip == 0 {
+				write(s)
+			}
+		},
+		OnPassComplete: func(s *Stage, pass string) {
+			mu.Lock()
+			defer mu.Unlock()
+			write(s)
+		},
+	}
+	return hooks, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr
+	}, nil
+}
+
+// WritePNG draws the stage as a PNG image, each cell a square scale pixels
+// across, with what's on it left out
+func (s *Stage) WritePNG(w io.Writer, scale int) error {
+	img := image.NewRGBA(image.Rect(0, 0, s.width*scale, s.height*scale))
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			c := s.cellColor(x, y)
+			for py := (y - 1) * scale; py < y*scale; py++ {
+				for px := (x - 1) * scale; px < x*scale; px++ {
+					img.SetRGBA(px, py, c)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// ansiColors are the RGB colors of the terminal colors tiles are drawn in
+var ansiColors = map[int]color.RGBA{
+	31: {205, 49, 49, 255},
+	33: {229, 229, 16, 255},
+	34: {36, 114, 200, 255},
+	90: {102, 102, 102, 255},
+	94: {59, 142, 234, 255},
+}
+
+// cellColor returns the color the cell at x, y is drawn in as an image
+func (s *Stage) cellColor(x, y int) color.RGBA {
+	t := s.at(x, y)
+	switch {
+	case t.kind == Wall:
+		return color.RGBA{40, 40, 40, 255}
+	case t.feature != NoFeature && !t.flags.Has(Walkable):
+		return color.RGBA{120, 120, 120, 255}
+	case t.kind == Door:
+		return color.RGBA{160, 110, 60, 255}
+	case t.kind == LockedDoor:
+		return color.RGBA{200, 160, 0, 255}
+	case t.kind == StairsUp || t.kind == StairsDown:
+		return color.RGBA{80, 170, 80, 255}
+	}
+	if c, ok := ansiColors[t.kind.Kind().Color]; ok {
+		return c
+	}
+	return color.RGBA{225, 225, 225, 255}
+}
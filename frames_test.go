@@ -0,0 +1,76 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFrameWriter(t *testing.T) {
+	dir := t.TempDir()
+	hooks, written, err := FrameWriter(dir, "txt", 25, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(WithSeed(1), WithHooks(hooks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := written(); err != nil {
+		t.Fatal(err)
+	}
+	frames, _ := filepath.Glob(filepath.Join(dir, "frame-*.txt"))
+	if len(frames) < 2 {
+		t.Fatalf("%d frames written", len(frames))
+	}
+	// the last pass to finish leaves the stage as it ends up
+	last, err := os.ReadFile(frames[len(frames)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(last) != s.String() {
+		t.Errorf("last frame is\n%s\nwant\n%s", last, s)
+	}
+}
+
+func TestFrameWriterPNG(t *testing.T) {
+	dir := t.TempDir()
+	hooks, written, err := FrameWriter(dir, "png", 1000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(WithSeed(1), WithHooks(hooks)); err != nil {
+		t.Fatal(err)
+	}
+	if err := written(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(dir, "frame-00001.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 79*3 || b.Dy() != 21*3 {
+		t.Errorf("frame is %dx%d, want %dx%d", b.Dx(), b.Dy(), 79*3, 21*3)
+	}
+}
+
+func TestFrameWriterErrors(t *testing.T) {
+	for _, c := range []struct {
+		format      string
+		skip, scale int
+	}{
+		{"gif", 1, 1},
+		{"png", 0, 1},
+		{"png", 1, 0},
+	} {
+		if _, _, err := FrameWriter(t.TempDir(), c.format, c.skip, c.scale); err == nil {
+			t.Errorf("FrameWriter(%q, %d, %d) got no error", c.format, c.skip, c.scale)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import "math/bits"
+
+// fenwick is a Fenwick tree over a list of counts, 1-based with an unused
+// zero slot first. It adds to a count, appends one, and finds where a running
+// total is passed, all in log time.
+type fenwick []int
+
+// newFenwick returns a tree over counts
+func newFenwick(counts []int) fenwick {
+	f := make(fenwick, len(counts)+1)
+	for i, c := range counts {
+		f[i+1] += c
+		if j := i + 1 + (i+1)&-(i+1); j < len(f) {
+			f[j] += f[i+1]
+		}
+	}
+	return f
+}
+
+// push appends count to the end of the list
+func (f *fenwick) push(count int) {
+	if len(*f) == 0 {
+		*f = append(*f, 0)
+	}
+	k := len(*f)
+	sum := count
+	for j := k - 1; j > k-k&-k; j -= j & -j {
+		sum += (*f)[j]
+	}
+	*f = append(*f, sum)
+}
+
+// add adds delta to the count at i
+func (f fenwick) add(i, delta int) {
+	for i++; i < len(f); i += i & -i {
+		f[i] += delta
+	}
+}
+
+// find returns the first index whose running total is more than n
+func (f fenwick) find(n int) int {
+	pos := 0
+	for step := 1 << (bits.Len(uint(len(f)-1)) - 1); step > 0; step >>= 1 {
+		if pos+step < len(f) && f[pos+step] <= n {
+			pos += step
+			n -= f[pos]
+		}
+	}
+	return pos
+}
+
+// frontier is the cells a maze is growing from, as cell indexes in the order
+// they were added. A cell taken out is only marked gone, and the nth one still
+// in is found in log time, so even a frontier of millions of cells is never
+// shifted down.
+type frontier struct {
+	cells []int
+	in    fenwick
+	count int
+}
+
+// push adds cell i to the end
+func (f *frontier) push(i int) {
+	f.cells = append(f.cells, i)
+	f.in.push(1)
+	f.count++
+}
+
+// nth returns the position in cells of the nth cell still in, from 0
+func (f *frontier) nth(n int) int {
+	return f.in.find(n)
+}
+
+// remove takes the cell at position pos out
+func (f *frontier) remove(pos int) {
+	f.in.add(pos, -1)
+	f.count--
+}
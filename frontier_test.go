@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestWeightedBag(t *testing.T) {
+	weights := []int{5, 1, 0, 12, 7, 3, 3, 9}
+	a, b := rand.New(rand.NewSource(1)), rand.New(rand.NewSource(1))
+	bag := newWeightedBag(weights)
+	left := append([]int(nil), weights...)
+	index := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	for bag.left > 1 {
+		// the slow way: pick from what is left and cut it out
+		i := pickWeighted(b, left)
+		want := index[i]
+		left = append(left[:i], left[i+1:]...)
+		index = append(index[:i], index[i+1:]...)
+		if got := bag.pick(a); got != want {
+			t.Fatalf("pick = %d, want %d", got, want)
+		}
+	}
+}
+
+func TestFrontier(t *testing.T) {
+	var f frontier
+	for i := 10; i < 15; i++ {
+		f.push(i)
+	}
+	f.remove(1)
+	f.remove(3)
+	var got []int
+	for i := 0; i < f.count; i++ {
+		got = append(got, f.cells[f.nth(i)])
+	}
+	want := []int{10, 12, 14}
+	if len(got) != len(want) {
+		t.Fatalf("frontier holds %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("frontier holds %v, want %v", got, want)
+		}
+	}
+}
+
+func TestGlyphs(t *testing.T) {
+	s, err := New(WithSeed(3), WithStocking(10, 10, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hidden := range []bool{true, false} {
+		glyph := s.glyphs(hidden)
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				if got, want := glyph(x, y), s.glyph(x, y, hidden); got != want {
+					t.Fatalf("glyphs(%v) at %d,%d = %q, glyph = %q", hidden, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestBias(t *testing.T) {
+	// passages carved east-west and north-south through the maze alone
+	passages := func(bias float64) (across, down int) {
+		s, err := New(WithSize(61, 41), WithSeed(8), WithAlgorithm("newest"), WithBias(bias), WithPipeline(Pipeline{{Name: "maze", Layout: true, Generator: Maze{}}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				switch {
+				case !s.isOpen(x, y) || x%2 == y%2:
+				case x%2 == 1:
+					across++
+				default:
+					down++
+				}
+			}
+		}
+		if report := s.Validate(); !report.Valid {
+			t.Errorf("bias %g: %v", bias, report.Failures)
+		}
+		return across, down
+	}
+	if across, down := passages(0.9); across < 2*down {
+		t.Errorf("bias 0.9 carved %d passages across and %d down", across, down)
+	}
+	if across, down := passages(-0.9); down < 2*across {
+		t.Errorf("bias -0.9 carved %d passages across and %d down", across, down)
+	}
+	if _, err := New(WithBias(2)); err == nil {
+		t.Error("bias 2 should fail")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import "math/rand"
+
+// A Generator carves one phase of a stage, making every random choice with
+// rng. Each pass of a Pipeline has one; custom generators can be added to the
+// built in ones or replace them.
+type Generator interface {
+	Carve(s *Stage, rng *rand.Rand) error
+}
+
+// Rooms scatters rooms over the stage
+type Rooms struct{}
+
+// Maze grows a maze through the rock between the rooms
+type Maze struct{}
+
+// Connectors opens doorways from the rooms into the maze
+type Connectors struct{}
+
+// Prune trims Steps cells off the end of every dead end corridor
+type Prune struct {
+	Steps int
+}
+
+// GeneratorFunc lets a plain function be used as a Generator
+type GeneratorFunc func(s *Stage, rng *rand.Rand) error
+
+func (f GeneratorFunc) Carve(s *Stage, rng *rand.Rand) error {
+	return f(s, rng)
+}
+
+// stagePass turns a stage method that draws from the stage's own rng into a
+// Generator
+func stagePass(method func(*Stage)) Generator {
+	return GeneratorFunc(func(s *Stage, rng *rand.Rand) error {
+		s.rng = rng
+		method(s)
+		return nil
+	})
+}
+
+// checkedPass is stagePass for a stage method that can fail
+func checkedPass(method func(*Stage) error) Generator {
+	return GeneratorFunc(func(s *Stage, rng *rand.Rand) error {
+		s.rng = rng
+		return method(s)
+	})
+}
+
+func (Rooms) Carve(s *Stage, rng *rand.Rand) error {
+	s.rng = rng
+	s.AddRooms()
+	return nil
+}
+
+func (Maze) Carve(s *Stage, rng *rand.Rand) error {
+	s.rng = rng
+	s.FillMaze()
+	return nil
+}
+
+func (Connectors) Carve(s *Stage, rng *rand.Rand) error {
+	s.rng = rng
+	s.ConnectRooms()
+	return nil
+}
+
+func (p Prune) Carve(s *Stage, rng *rand.Rand) error {
+	for step := 0; step < p.Steps; step++ {
+		ends := make([]Tile, 0)
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				if s.isCorridor(x, y) && len(s.openNeighbors(x, y)) <= 1 {
+					ends = append(ends, s.at(x, y))
+				}
+			}
+		}
+		if len(ends) == 0 {
+			break
+		}
+		for _, t := range ends {
+			s.setKind(t.x, t.y, Wall)
+		}
+	}
+	return nil
+}
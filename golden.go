@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// goldenHeader starts every golden file, followed by how many flag lines come
+// after it
+const goldenHeader = "dungeon_maze golden"
+
+// WriteGolden writes a golden file: a header recording the value of every
+// flag (so the seed and all the settings that shaped the maze are kept),
+// then the maze output itself
+func WriteGolden(w io.Writer, output string) error {
+	lines := make([]string, 0)
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "record" && f.Name != "verify" {
+			lines = append(lines, f.Name+"="+f.Value.String())
+		}
+	})
+	_, err := fmt.Fprintf(w, "%s %d\n%s\n%s", goldenHeader, len(lines), strings.Join(lines, "\n"), output)
+	return err
+}
+
+// ReadGolden reads a golden file written by WriteGolden, setting every flag
+// recorded in its header, and returns the output it holds
+func ReadGolden(r io.Reader) (string, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("reading golden header: %v", err)
+	}
+	count, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(header), goldenHeader+" "))
+	if !strings.HasPrefix(header, goldenHeader+" ") || err != nil {
+		return "", fmt.Errorf("not a golden file: %q", strings.TrimSpace(header))
+	}
+	for i := 0; i < count; i++ {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("reading golden flags: %v", err)
+		}
+		parts := strings.SplitN(strings.TrimSuffix(line, "\n"), "=", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("bad golden flag line %q", line)
+		}
+		if err := flag.Set(parts[0], parts[1]); err != nil {
+			return "", fmt.Errorf("golden flag %s: %v", parts[0], err)
+		}
+	}
+	output, err := io.ReadAll(br)
+	return string(output), err
+}
+
+// firstDifference returns the first line number where got and want differ
+// along with both lines, or 0 if they are the same
+func firstDifference(got, want string) (line int, gotLine, wantLine string) {
+	if got == want {
+		return 0, "", ""
+	}
+	g, w := strings.Split(got, "\n"), strings.Split(want, "\n")
+	for i := 0; ; i++ {
+		if i >= len(g) || i >= len(w) || g[i] != w[i] {
+			if i < len(g) {
+				gotLine = g[i]
+			}
+			if i < len(w) {
+				wantLine = w[i]
+			}
+			return i + 1, gotLine, wantLine
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// goldenOutput generates the maze the flags ask for, as -record and -verify do
+func goldenOutput(t *testing.T) string {
+	t.Helper()
+	theme, err := LookupTheme(ThemeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _, err := GenerateStage(context.Background(), flagOptions(theme).seeded(Seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := s.Write(&b, Format); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestGoldenVerify(t *testing.T) {
+	for _, name := range []string{"seed", "width", "theme"} {
+		value := flag.Lookup(name).Value.String()
+		t.Cleanup(func() { flag.Set(name, value) })
+	}
+	flag.Set("seed", "5")
+	flag.Set("width", "31")
+	flag.Set("theme", "sewer")
+	want := goldenOutput(t)
+	var golden strings.Builder
+	if err := WriteGolden(&golden, want); err != nil {
+		t.Fatal(err)
+	}
+
+	// go test's own flags are recorded too, but not all of them can be set
+	// back from how they print, so leave them out
+	lines := strings.Split(golden.String(), "\n")
+	count, err := strconv.Atoi(strings.TrimPrefix(lines[0], goldenHeader+" "))
+	if err != nil {
+		t.Fatalf("golden header %q", lines[0])
+	}
+	var kept []string
+	for _, line := range lines[1 : count+1] {
+		if !strings.HasPrefix(line, "test.") {
+			kept = append(kept, line)
+		}
+	}
+	if strings.Join(lines[count+1:], "\n") != want {
+		t.Fatal("golden file doesn't end with the output")
+	}
+
+	// the golden file brings back the flags that made it
+	flag.Set("seed", "9")
+	flag.Set("width", "41")
+	flag.Set("theme", "classic")
+	recorded, err := ReadGolden(strings.NewReader(fmt.Sprintf("%s %d\n%s\n%s", goldenHeader, len(kept), strings.Join(kept, "\n"), want)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded != want {
+		t.Fatal("golden file didn't keep the output")
+	}
+	if Seed != 5 || Width != 31 || ThemeName != "sewer" {
+		t.Fatalf("golden file restored seed %d, width %d, theme %s", Seed, Width, ThemeName)
+	}
+	if line, got, want := firstDifference(goldenOutput(t), recorded); line != 0 {
+		t.Fatalf("regenerated maze differs at line %d:\n got: %s\nwant: %s", line, got, want)
+	}
+
+	// and a maze that comes out different is caught on the line it changes
+	lines = strings.Split(recorded, "\n")
+	lines[3] = strings.Repeat("#", len(lines[3]))
+	if line, _, _ := firstDifference(goldenOutput(t), strings.Join(lines, "\n")); line != 4 {
+		t.Errorf("changed line 4, first difference found at line %d", line)
+	}
+}
+
+func TestReadGoldenRejects(t *testing.T) {
+	for _, tt := range []struct {
+		name, golden string
+	}{
+		{"no header", "┏━━┓\n"},
+		{"bad count", goldenHeader + " x\n"},
+		{"missing flags", goldenHeader + " 2\nseed=1\n"},
+		{"bad flag line", goldenHeader + " 1\nseed\n"},
+		{"unknown flag", goldenHeader + " 1\nno_such_flag=1\n"},
+	} {
+		if _, err := ReadGolden(strings.NewReader(tt.golden)); err == nil {
+			t.Errorf("%s: read", tt.name)
+		}
+	}
+}
+
+func TestFirstDifference(t *testing.T) {
+	for _, tt := range []struct {
+		got, want string
+		line      int
+	}{
+		{"a\nb\n", "a\nb\n", 0},
+		{"a\nb\n", "a\nc\n", 2},
+		{"a\n", "a\nb\n", 2},
+		{"x", "a", 1},
+	} {
+		if line, _, _ := firstDifference(tt.got, tt.want); line != tt.line {
+			t.Errorf("firstDifference(%q, %q) = %d, want %d", tt.got, tt.want, line, tt.line)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import "sort"
+
+// Graph is how a stage fits together: a node for each region, and an edge
+// for each door joining two of them. Node IDs are region IDs, so nodes are
+// in ID order, and edges are in the order of the stage's doors.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a region of the stage, with the rooms in it numbered from 1
+// in the order the stage has them, and what stairs or the entrance are in it
+type GraphNode struct {
+	Region
+	Rooms      []int `json:"rooms,omitempty"`
+	Entrance   bool  `json:"entrance,omitempty"`
+	StairsUp   bool  `json:"stairs_up,omitempty"`
+	StairsDown bool  `json:"stairs_down,omitempty"`
+}
+
+// GraphEdge is a door at X, Y between the regions From and To, From being
+// the lower ID
+type GraphEdge struct {
+	From   int  `json:"from"`
+	To     int  `json:"to"`
+	X      int  `json:"x"`
+	Y      int  `json:"y"`
+	Locked bool `json:"locked"`
+}
+
+// Graph labels the stage's regions as Regions does and returns how they're
+// joined by its doors
+func (s *Stage) Graph() Graph {
+	regions := s.Regions()
+	g := Graph{Nodes: make([]GraphNode, len(regions)), Edges: make([]GraphEdge, 0, len(s.doors))}
+	for i, r := range regions {
+		g.Nodes[i].Region = r
+	}
+	node := func(x, y int) *GraphNode {
+		if id := s.RegionAt(x, y); id != 0 {
+			return &g.Nodes[id-1]
+		}
+		return nil
+	}
+	for i, room := range s.rooms {
+		if id := s.roomRegion(room); id != 0 {
+			g.Nodes[id-1].Rooms = append(g.Nodes[id-1].Rooms, i+1)
+		}
+	}
+	if n := node(s.entranceX, s.entranceY); n != nil {
+		n.Entrance = true
+	}
+	if n := node(s.upX, s.upY); n != nil {
+		n.StairsUp = true
+	}
+	if n := node(s.downX, s.downY); n != nil {
+		n.StairsDown = true
+	}
+	for _, d := range s.doors {
+		ids := s.doorRegions(d.x, d.y)
+		for i := 1; i < len(ids); i++ {
+			g.Edges = append(g.Edges, GraphEdge{From: ids[0], To: ids[i], X: d.x, Y: d.y, Locked: s.at(d.x, d.y).kind == LockedDoor})
+		}
+	}
+	return g
+}
+
+// Node returns the node with id, or nil if there isn't one
+func (g Graph) Node(id int) *GraphNode {
+	if id < 1 || id > len(g.Nodes) {
+		return nil
+	}
+	return &g.Nodes[id-1]
+}
+
+// Neighbors returns the IDs of the nodes a door leads to from id, in order
+func (g Graph) Neighbors(id int) []int {
+	seen := make(map[int]bool)
+	var ids []int
+	for _, e := range g.Edges {
+		other := 0
+		switch id {
+		case e.From:
+			other = e.To
+		case e.To:
+			other = e.From
+		}
+		if other != 0 && !seen[other] {
+			seen[other] = true
+			ids = append(ids, other)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// roomRegion returns the region the first cell in room that's in one is in,
+// or 0 if none are. Regions must have been labeled.
+func (s *Stage) roomRegion(room Room) int {
+	for y := room.y; y <= room.y+room.height; y++ {
+		for x := room.x; x <= room.x+room.width; x++ {
+			if id := s.RegionAt(x, y); id != 0 {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// doorRegions returns the regions next to the door at x, y, in ID order
+func (s *Stage) doorRegions(x, y int) []int {
+	seen := make(map[int]bool)
+	var ids []int
+	for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+		nx, ny := s.step(x, y, d[0], d[1])
+		if id := s.RegionAt(nx, ny); id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestGraph(t *testing.T) {
+	s, err := New(WithSize(41, 21), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := s.Graph()
+	regions := s.Regions()
+	if len(g.Nodes) != len(regions) {
+		t.Fatalf("%d nodes, want one for each of %d regions", len(g.Nodes), len(regions))
+	}
+	rooms := 0
+	for i, n := range g.Nodes {
+		if n.Region != regions[i] {
+			t.Errorf("node %d is %+v, want %+v", i+1, n.Region, regions[i])
+		}
+		rooms += len(n.Rooms)
+		if n.Entrance != (s.RegionAt(s.entranceX, s.entranceY) == n.ID) {
+			t.Errorf("node %d entrance is %v", n.ID, n.Entrance)
+		}
+		if n.StairsDown != (s.downX != 0 && s.RegionAt(s.downX, s.downY) == n.ID) {
+			t.Errorf("node %d stairs down is %v", n.ID, n.StairsDown)
+		}
+	}
+	if rooms != len(s.rooms) {
+		t.Errorf("%d rooms in the nodes, want %d", rooms, len(s.rooms))
+	}
+	if len(g.Edges) == 0 {
+		t.Fatal("no edges")
+	}
+	for _, e := range g.Edges {
+		if !s.isDoor(e.X, e.Y) || e.From >= e.To || g.Node(e.From) == nil || g.Node(e.To) == nil {
+			t.Errorf("edge %+v isn't a door between two nodes", e)
+		}
+		if !containsInt(g.Neighbors(e.From), e.To) || !containsInt(g.Neighbors(e.To), e.From) {
+			t.Errorf("%d and %d aren't neighbors", e.From, e.To)
+		}
+	}
+	if len(g.Neighbors(0)) != 0 || g.Node(0) != nil || g.Node(len(g.Nodes)+1) != nil {
+		t.Error("there's a node 0 or past the end")
+	}
+}
+
+func containsInt(list []int, v int) bool {
+	for _, w := range list {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
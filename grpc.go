@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// gRPC status codes sent back in the grpc-status trailer
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+)
+
+// NewGRPCServer returns a handler serving the Dungeon service described in
+// proto/dungeon.proto over gRPC, generating stages from opts changed by each
+// request like /dungeon does. gRPC needs HTTP/2, so it has to be served over
+// TLS.
+func NewGRPCServer(opts Options) http.Handler {
+	opts.Hooks, opts.Animate = Hooks{}, nil
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveGRPC(w, r, opts)
+	})
+}
+
+// serveGRPC answers a single gRPC call
+func serveGRPC(w http.ResponseWriter, r *http.Request, opts Options) {
+	if r.ProtoMajor != 2 || r.Method != http.MethodPost {
+		http.Error(w, "gRPC needs POST over HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	status := func(code int, message string) {
+		w.Header().Set("Grpc-Status", strconv.Itoa(code))
+		w.Header().Set("Grpc-Message", url.PathEscape(message))
+	}
+	if r.URL.Path != "/dungeon_maze.Dungeon/Generate" {
+		status(grpcUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	req, err := readGRPCMessage(r.Body)
+	if err != nil {
+		status(grpcInvalidArgument, err.Error())
+		return
+	}
+	q := url.Values{}
+	for _, f := range []struct {
+		name  string
+		field int
+	}{{"width", 1}, {"height", 2}, {"seed", 3}} {
+		if v := req.varint(f.field); v != 0 {
+			q.Set(f.name, strconv.FormatInt(v, 10))
+		}
+	}
+	opts, _, err = dungeonOptions(opts, q)
+	if err != nil {
+		status(grpcInvalidArgument, err.Error())
+		return
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	s, err := served.generate(r.Context(), opts.seeded(opts.Seed), "grpc")
+	if err != nil {
+		status(grpcInternal, err.Error())
+		return
+	}
+	msg := s.protoStage(opts.Seed)
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	if _, err := w.Write(append(frame, msg...)); err != nil {
+		log.Printf("serving %s: %v", r.URL, err)
+	}
+	status(grpcOK, "")
+}
+
+// readGRPCMessage reads the one length prefixed, uncompressed message of a
+// gRPC request
+func readGRPCMessage(r io.Reader) (protoMessage, error) {
+	var head [5]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, fmt.Errorf("reading request: %v", err)
+	}
+	if head[0] != 0 {
+		return nil, errors.New("compressed requests aren't supported")
+	}
+	n := binary.BigEndian.Uint32(head[1:])
+	if n > maxWebSocketMessage {
+		return nil, fmt.Errorf("request over %d bytes", maxWebSocketMessage)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading request: %v", err)
+	}
+	return parseProto(data)
+}
+
+// protoStage encodes the stage as a Stage message
+func (s *Stage) protoStage(seed int64) []byte {
+	j := s.JSON()
+	var b protoBuffer
+	b.string(1, j.Theme)
+	b.varint(2, int64(j.Width))
+	b.varint(3, int64(j.Height))
+	b.varint(4, seed)
+	for _, row := range j.Rows {
+		b.string(5, row)
+	}
+	point := func(field int, p *PointJSON) {
+		if p != nil {
+			b.message(field, func(m *protoBuffer) {
+				m.varint(1, int64(p.X))
+				m.varint(2, int64(p.Y))
+			})
+		}
+	}
+	point(6, &j.Entrance)
+	point(7, j.StairsUp)
+	point(8, j.StairsDown)
+	for _, room := range j.Rooms {
+		b.message(9, func(m *protoBuffer) {
+			m.varint(1, int64(room.X))
+			m.varint(2, int64(room.Y))
+			m.varint(3, int64(room.Width))
+			m.varint(4, int64(room.Height))
+			m.string(5, room.Description)
+		})
+	}
+	for _, d := range j.Doors {
+		b.message(10, func(m *protoBuffer) {
+			m.varint(1, int64(d.X))
+			m.varint(2, int64(d.Y))
+			if d.Locked {
+				m.varint(3, 1)
+			}
+		})
+	}
+	for _, list := range []struct {
+		field    int
+		entities []EntityJSON
+	}{{11, j.Monsters}, {12, j.Items}} {
+		for _, e := range list.entities {
+			b.message(list.field, func(m *protoBuffer) {
+				m.string(1, e.Name)
+				m.string(2, e.Class)
+				m.string(3, e.Glyph)
+				m.varint(4, int64(e.X))
+				m.varint(5, int64(e.Y))
+			})
+		}
+	}
+	return b
+}
+
+// protoBuffer is a protobuf message being encoded. Like proto3, fields set
+// to their zero value are left out.
+type protoBuffer []byte
+
+// varint appends an integer or bool field
+func (b *protoBuffer) varint(field int, v int64) {
+	if v != 0 {
+		*b = binary.AppendUvarint(binary.AppendUvarint(*b, uint64(field)<<3), uint64(v))
+	}
+}
+
+// string appends a string field
+func (b *protoBuffer) string(field int, s string) {
+	if s != "" {
+		b.bytes(field, []byte(s))
+	}
+}
+
+// message appends an embedded message field, encoded by encode
+func (b *protoBuffer) message(field int, encode func(m *protoBuffer)) {
+	var m protoBuffer
+	encode(&m)
+	b.bytes(field, m)
+}
+
+// bytes appends a length delimited field
+func (b *protoBuffer) bytes(field int, data []byte) {
+	*b = binary.AppendUvarint(binary.AppendUvarint(*b, uint64(field)<<3|2), uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+// protoMessage is a decoded protobuf message: the last value of each
+// varint field, and every value of each length delimited one
+type protoMessage map[int][]protoValue
+
+// protoValue is a field's value, n for varints and data otherwise
+type protoValue struct {
+	n    uint64
+	data []byte
+}
+
+// parseProto decodes a protobuf message, skipping fixed width fields
+func parseProto(data []byte) (protoMessage, error) {
+	m := make(protoMessage)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("malformed protobuf field")
+		}
+		data = data[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errors.New("malformed protobuf varint")
+			}
+			m[field], data = append(m[field], protoValue{n: v}), data[n:]
+		case 1:
+			if len(data) < 8 {
+				return nil, errors.New("truncated protobuf field")
+			}
+			data = data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return nil, errors.New("truncated protobuf field")
+			}
+			m[field] = append(m[field], protoValue{data: data[n : n+int(size)]})
+			data = data[n+int(size):]
+		case 5:
+			if len(data) < 4 {
+				return nil, errors.New("truncated protobuf field")
+			}
+			data = data[4:]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+	}
+	return m, nil
+}
+
+// varint returns the last value of a varint field as a signed integer, or 0
+// if it isn't set
+func (m protoMessage) varint(field int) int64 {
+	if values := m[field]; len(values) > 0 {
+		return int64(values[len(values)-1].n)
+	}
+	return 0
+}
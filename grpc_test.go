@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+// callGenerate calls Generate on srv with req, returning the response
+// message and the grpc-status trailer
+func callGenerate(t *testing.T, srv *httptest.Server, path string, req protoBuffer) (protoMessage, string) {
+	t.Helper()
+	body := make([]byte, 5)
+	binary.BigEndian.PutUint32(body[1:], uint32(len(req)))
+	res, err := srv.Client().Post(srv.URL+path, "application/grpc", bytes.NewReader(append(body, req...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ProtoMajor != 2 {
+		t.Fatalf("served over HTTP/%d", res.ProtoMajor)
+	}
+	if len(data) == 0 {
+		return nil, res.Trailer.Get("Grpc-Status")
+	}
+	if len(data) < 5 || int(binary.BigEndian.Uint32(data[1:5])) != len(data)-5 {
+		t.Fatalf("malformed response % x", data)
+	}
+	m, err := parseProto(data[5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, res.Trailer.Get("Grpc-Status")
+}
+
+func TestGRPCGenerate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(NewGRPCServer(DefaultOptions()))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	var req protoBuffer
+	req.varint(1, 31)
+	req.varint(2, 15)
+	req.varint(3, 7)
+	m, status := callGenerate(t, srv, "/dungeon_maze.Dungeon/Generate", req)
+	if status != "0" {
+		t.Fatalf("grpc-status %q", status)
+	}
+	want, err := New(WithSize(31, 15), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := want.JSON()
+	if m.varint(2) != 31 || m.varint(3) != 15 || m.varint(4) != 7 {
+		t.Errorf("got a %dx%d stage seeded %d", m.varint(2), m.varint(3), m.varint(4))
+	}
+	if len(m[5]) != len(j.Rows) || string(m[5][0].data) != j.Rows[0] {
+		t.Errorf("rows don't match -format json's")
+	}
+	if len(m[9]) != len(j.Rooms) || len(m[10]) != len(j.Doors) || len(m[11]) != len(j.Monsters) {
+		t.Errorf("%d rooms, %d doors, %d monsters, want %d, %d, %d", len(m[9]), len(m[10]), len(m[11]), len(j.Rooms), len(j.Doors), len(j.Monsters))
+	}
+	entrance, err := parseProto(m[6][0].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(entrance.varint(1)) != j.Entrance.X || int(entrance.varint(2)) != j.Entrance.Y {
+		t.Errorf("entrance %d, %d, want %d, %d", entrance.varint(1), entrance.varint(2), j.Entrance.X, j.Entrance.Y)
+	}
+
+	var bad protoBuffer
+	bad.varint(1, 1)
+	if _, status := callGenerate(t, srv, "/dungeon_maze.Dungeon/Generate", bad); status != "3" {
+		t.Errorf("a stage too small got grpc-status %q, want 3", status)
+	}
+	if _, status := callGenerate(t, srv, "/dungeon_maze.Dungeon/Destroy", req); status != "12" {
+		t.Errorf("an unknown method got grpc-status %q, want 12", status)
+	}
+}
+
+func TestProto(t *testing.T) {
+	var b protoBuffer
+	b.varint(1, -3)
+	b.varint(2, 0)
+	b.string(3, "hall")
+	b.string(3, "cave")
+	b.message(4, func(m *protoBuffer) { m.varint(1, 300) })
+	m, err := parseProto(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.varint(1) != -3 || m.varint(2) != 0 || len(m[2]) != 0 {
+		t.Errorf("varints %d, %d", m.varint(1), m.varint(2))
+	}
+	if len(m[3]) != 2 || string(m[3][1].data) != "cave" {
+		t.Errorf("strings %v", m[3])
+	}
+	if inner, err := parseProto(m[4][0].data); err != nil || inner.varint(1) != 300 {
+		t.Errorf("message %v, %v", inner, err)
+	}
+	if _, err := parseProto([]byte{0x0a, 5, 'a'}); err == nil {
+		t.Error("a truncated string parsed")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// Directions out of a hex cell, counterclockwise from east. The opposite of
+// direction d is (d+3)%6.
+const (
+	hexEast = iota
+	hexNorthEast
+	hexNorthWest
+	hexWest
+	hexSouthWest
+	hexSouthEast
+)
+
+// hexSteps are how far each direction moves, on even rows and then odd rows.
+// Odd rows are shoved half a cell right of even ones.
+var hexSteps = [2][6][2]int{
+	{{1, 0}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}, {0, 1}},
+	{{1, 0}, {1, -1}, {0, -1}, {-1, 0}, {0, 1}, {1, 1}},
+}
+
+// HexMaze is a maze on a grid of pointy topped hexagons, each cell joined to
+// as many as six others. Cells are numbered from 0, 0 at the top left.
+type HexMaze struct {
+	width, height int
+	// open has bit d set on a cell when it opens toward direction d, row by
+	// row
+	open []uint8
+}
+
+// NewHexMaze grows a w by h hex maze with the growing tree algorithm,
+// picking which cell to grow from next as the algorithm option asks
+func NewHexMaze(w, h int, algorithm string, rng *rand.Rand) *HexMaze {
+	m := &HexMaze{width: w, height: h, open: make([]uint8, w*h)}
+	seen := make([]bool, w*h)
+	start := rng.Intn(w * h)
+	seen[start] = true
+
+	var cells frontier
+	cells.push(start)
+	for cells.count > 0 {
+		pos := cells.nth(growFrom(rng, algorithm, cells.count))
+		i := cells.cells[pos]
+		var next []int
+		for d := 0; d < 6; d++ {
+			if j, ok := m.neighbor(i, d); ok && !seen[j] {
+				next = append(next, d)
+			}
+		}
+		if len(next) == 0 {
+			cells.remove(pos)
+			continue
+		}
+		d := next[rng.Intn(len(next))]
+		j, _ := m.neighbor(i, d)
+		m.open[i] |= 1 << d
+		m.open[j] |= 1 << ((d + 3) % 6)
+		seen[j] = true
+		cells.push(j)
+	}
+	return m
+}
+
+// neighbor returns the cell next to cell i in direction d, if there is one
+func (m *HexMaze) neighbor(i, d int) (int, bool) {
+	x, y := i%m.width, i/m.width
+	step := hexSteps[y%2][d]
+	x, y = x+step[0], y+step[1]
+	if x < 0 || x >= m.width || y < 0 || y >= m.height {
+		return 0, false
+	}
+	return y*m.width + x, true
+}
+
+// Opens reports if cell x, y opens toward direction d
+func (m *HexMaze) Opens(x, y, d int) bool {
+	return m.open[y*m.width+x]&(1<<d) != 0
+}
+
+// String draws the maze with slashes and bars, two lines per row of cells
+// and four columns per cell
+func (m *HexMaze) String() string {
+	lines := make([][]byte, 2*m.height+1)
+	for i := range lines {
+		lines[i] = []byte(strings.Repeat(" ", 4*m.width+3))
+	}
+	// where each wall is drawn, from the left of the cell's top line
+	walls := [6]struct {
+		line, col int
+		c         byte
+	}{
+		hexEast:      {1, 4, '|'},
+		hexNorthEast: {0, 3, '\\'},
+		hexNorthWest: {0, 1, '/'},
+		hexWest:      {1, 0, '|'},
+		hexSouthWest: {2, 1, '\\'},
+		hexSouthEast: {2, 3, '/'},
+	}
+	for y := 0; y < m.height; y++ {
+		for x := 0; x < m.width; x++ {
+			left := 4*x + 2*(y%2)
+			for d, wall := range walls {
+				if !m.Opens(x, y, d) {
+					lines[2*y+wall.line][left+wall.col] = wall.c
+				}
+			}
+		}
+	}
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(strings.TrimRight(string(line), " "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// WriteSVG draws the maze as an SVG image, size pixels from each hexagon's
+// middle to its corners
+func (m *HexMaze) WriteSVG(w io.Writer, size float64) error {
+	wide := math.Sqrt(3) * size
+	width := wide*float64(m.width) + wide/2 + 2*size
+	height := 1.5*size*float64(m.height) + size/2 + 2*size
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\">\n", width, height)
+	fmt.Fprintf(&b, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n<path stroke=\"black\" stroke-width=\"2\" stroke-linecap=\"round\" fill=\"none\" d=\"")
+	for y := 0; y < m.height; y++ {
+		for x := 0; x < m.width; x++ {
+			cx := size + wide*(float64(x)+0.5*float64(y%2)+0.5)
+			cy := size + 1.5*size*float64(y) + size
+			// the wall toward direction d runs between corners d and d+1,
+			// counting counterclockwise from the one below east
+			corner := func(i int) (float64, float64) {
+				a := math.Pi / 180 * float64(30-60*i)
+				return cx + size*math.Cos(a), cy + size*math.Sin(a)
+			}
+			for d := 0; d < 6; d++ {
+				if m.Opens(x, y, d) {
+					continue
+				}
+				x1, y1 := corner(d)
+				x2, y2 := corner(d + 1)
+				fmt.Fprintf(&b, "M%.1f %.1fL%.1f %.1f", x1, y1, x2, y2)
+			}
+		}
+	}
+	b.WriteString("\"/>\n</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestHexMazeIsPerfect(t *testing.T) {
+	for _, algorithm := range []string{"random", "newest", "oldest", "mixed"} {
+		m := NewHexMaze(9, 7, algorithm, rand.New(rand.NewSource(3)))
+		// every cell reached, and one fewer passage than cells, so no loops
+		seen := map[int]bool{0: true}
+		passages := 0
+		for queue := []int{0}; len(queue) > 0; queue = queue[1:] {
+			for d := 0; d < 6; d++ {
+				if m.open[queue[0]]&(1<<d) == 0 {
+					continue
+				}
+				j, ok := m.neighbor(queue[0], d)
+				if !ok || m.open[j]&(1<<((d+3)%6)) == 0 {
+					t.Fatalf("%s: cell %d opens toward %d onto nothing that opens back", algorithm, queue[0], d)
+				}
+				passages++
+				if !seen[j] {
+					seen[j] = true
+					queue = append(queue, j)
+				}
+			}
+		}
+		if len(seen) != 9*7 || passages/2 != 9*7-1 {
+			t.Errorf("%s: reached %d of %d cells through %d passages", algorithm, len(seen), 9*7, passages/2)
+		}
+	}
+}
+
+func TestHexMazeDrawing(t *testing.T) {
+	m := NewHexMaze(1, 2, "random", rand.New(rand.NewSource(1)))
+	want := " / \\\n|   |\n \\   \\\n  |   |\n   \\ /\n"
+	if got := m.String(); got != want {
+		t.Errorf("drawn as\n%s\nwant\n%s", got, want)
+	}
+
+	m = NewHexMaze(5, 4, "random", rand.New(rand.NewSource(2)))
+	var buf bytes.Buffer
+	if err := m.WriteSVG(&buf, 10); err != nil {
+		t.Fatal(err)
+	}
+	walls := 0
+	for _, open := range m.open {
+		for d := 0; d < 6; d++ {
+			if open&(1<<d) == 0 {
+				walls++
+			}
+		}
+	}
+	if got := strings.Count(buf.String(), "M"); got != walls {
+		t.Errorf("svg draws %d walls, want %d", got, walls)
+	}
+}
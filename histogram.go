@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// histogramBuckets is the most buckets a distribution is split into
+const histogramBuckets = 10
+
+// Distribution is how one stat came out across many mazes. Counts[i] is how
+// many mazes came out from From[i] up to the next bucket's From.
+type Distribution struct {
+	Stat   string    `json:"stat"`
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Mean   float64   `json:"mean"`
+	Bucket float64   `json:"bucket"`
+	From   []float64 `json:"from"`
+	Counts []int     `json:"counts"`
+}
+
+// GenerateStats generates n mazes with opts from the seeds start through
+// start+n-1 and returns the stats of each. It gives up once ctx is cancelled.
+func GenerateStats(ctx context.Context, opts Options, start int64, n int) ([]Stats, error) {
+	all := make([]Stats, 0, n)
+	for seed := start; seed < start+int64(n); seed++ {
+		s, _, err := GenerateStage(ctx, opts.seeded(seed))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, s.Stats())
+	}
+	return all, nil
+}
+
+// Distributions buckets each named stat across all. Stats that only come in
+// whole numbers get whole number buckets.
+func Distributions(all []Stats, names []string) ([]Distribution, error) {
+	known := statValues(Stats{})
+	values := make([]map[string]float64, 0, len(all))
+	for _, st := range all {
+		values = append(values, statValues(st))
+	}
+
+	dists := make([]Distribution, 0, len(names))
+	for _, name := range names {
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown stat %q", name)
+		}
+		d := Distribution{Stat: name, Min: math.Inf(1), Max: math.Inf(-1)}
+		whole := true
+		for _, v := range values {
+			d.Min, d.Max = math.Min(d.Min, v[name]), math.Max(d.Max, v[name])
+			d.Mean += v[name]
+			whole = whole && v[name] == math.Trunc(v[name])
+		}
+		if len(values) == 0 {
+			dists = append(dists, Distribution{Stat: name})
+			continue
+		}
+		d.Mean /= float64(len(values))
+
+		if whole {
+			d.Bucket = math.Max(1, math.Ceil((d.Max-d.Min+1)/histogramBuckets))
+		} else {
+			d.Bucket = math.Max((d.Max-d.Min)/histogramBuckets, math.SmallestNonzeroFloat64)
+		}
+		buckets := int((d.Max-d.Min)/d.Bucket) + 1
+		if buckets > histogramBuckets {
+			buckets = histogramBuckets
+		}
+		d.Counts = make([]int, buckets)
+		for i := range d.Counts {
+			d.From = append(d.From, d.Min+float64(i)*d.Bucket)
+		}
+		for _, v := range values {
+			i := int((v[name] - d.Min) / d.Bucket)
+			if i >= buckets {
+				i = buckets - 1
+			}
+			d.Counts[i]++
+		}
+		dists = append(dists, d)
+	}
+	return dists, nil
+}
+
+// WriteHistograms draws each distribution as a bar chart, one row per bucket
+func WriteHistograms(w io.Writer, dists []Distribution) error {
+	var b strings.Builder
+	for i, d := range dists {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s: min %g, max %g, mean %.2f\n", d.Stat, d.Min, d.Max, d.Mean)
+		most := 0
+		for _, c := range d.Counts {
+			if c > most {
+				most = c
+			}
+		}
+		for j, c := range d.Counts {
+			bar := 0
+			if most > 0 {
+				bar = (c*40 + most - 1) / most
+			}
+			fmt.Fprintf(&b, "%10.4g %s %d\n", d.From[j], strings.Repeat("█", bar), c)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteDistributionsJSON writes the distributions as indented JSON
+func WriteDistributionsJSON(w io.Writer, dists []Distribution) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dists)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+)
+
+// EditOp is one edit to a stage, as a History records it and a patch stores
+// it: Op is "tile", "carve", "fill", "door", "feature", or "stamp". A tile
+// sets cell X, Y to the tile type named Name; carve and fill take the
+// Width by Height rectangle from X, Y; a door is Locked or not; a feature is
+// named Name, "floor" taking it away; and a stamp lays the prefab named Name.
+type EditOp struct {
+	Op     string `json:"op"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Locked bool   `json:"locked,omitempty"`
+}
+
+// History makes edits to a stage through the editing primitives and keeps
+// them, with the stage as it was before each, so they can be undone and
+// redone, and written out as a patch to make them again on another copy.
+type History struct {
+	s      *Stage
+	done   []editStep
+	undone []EditOp
+}
+
+// editStep is an edit that was made and the stage before it
+type editStep struct {
+	op     EditOp
+	before snapshot
+}
+
+// snapshot is what of a stage an edit can change
+type snapshot struct {
+	cell                 []Tile
+	rooms                []Room
+	doors                []Tile
+	monsters             []*Monster
+	items                []*Item
+	traps                []*Trap
+	decorations          []*Decoration
+	bridges              []*Bridge
+	entranceX, entranceY int
+	upX, upY             int
+	downX, downY         int
+}
+
+// NewHistory starts keeping the edits made to s
+func NewHistory(s *Stage) *History {
+	return &History{s: s}
+}
+
+// Do makes the edit op and keeps it, forgetting anything undone. An edit
+// that fails leaves the stage as it was.
+func (h *History) Do(op EditOp) error {
+	before := h.s.snapshot()
+	if err := h.s.apply(op); err != nil {
+		h.s.restore(before)
+		return err
+	}
+	h.done = append(h.done, editStep{op, before})
+	h.undone = nil
+	return nil
+}
+
+// Undo takes back the last edit, reporting false when there's none
+func (h *History) Undo() bool {
+	if len(h.done) == 0 {
+		return false
+	}
+	last := h.done[len(h.done)-1]
+	h.done = h.done[:len(h.done)-1]
+	h.s.restore(last.before)
+	h.undone = append(h.undone, last.op)
+	return true
+}
+
+// Redo makes the last edit undone again, reporting false when there's none
+func (h *History) Redo() bool {
+	if len(h.undone) == 0 {
+		return false
+	}
+	op := h.undone[len(h.undone)-1]
+	undone := h.undone[:len(h.undone)-1]
+	if h.Do(op) != nil {
+		return false
+	}
+	h.undone = undone
+	return true
+}
+
+// Ops returns the edits made and not undone, in order
+func (h *History) Ops() []EditOp {
+	ops := make([]EditOp, len(h.done))
+	for i, step := range h.done {
+		ops[i] = step.op
+	}
+	return ops
+}
+
+// WritePatch writes the edits made and not undone to w, one JSON object to a
+// line, for ApplyPatch
+func (h *History) WritePatch(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, op := range h.Ops() {
+		if err := enc.Encode(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyPatch makes the edits WritePatch wrote to s, stopping at the first
+// that fails
+func (s *Stage) ApplyPatch(r io.Reader) error {
+	lines := bufio.NewScanner(r)
+	for n := 1; lines.Scan(); n++ {
+		if len(lines.Bytes()) == 0 {
+			continue
+		}
+		var op EditOp
+		if err := json.Unmarshal(lines.Bytes(), &op); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		if err := s.apply(op); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	return lines.Err()
+}
+
+// apply makes the edit op
+func (s *Stage) apply(op EditOp) error {
+	rect := image.Rect(op.X, op.Y, op.X+op.Width, op.Y+op.Height)
+	switch op.Op {
+	case "tile":
+		for kind, k := range tileKinds {
+			if k.Name == op.Name {
+				return s.SetTile(op.X, op.Y, TileType(kind))
+			}
+		}
+		return fmt.Errorf("no tile type %q", op.Name)
+	case "carve":
+		return s.CarveRect(rect)
+	case "fill":
+		return s.FillRect(rect)
+	case "door":
+		return s.PlaceDoor(op.X, op.Y, op.Locked)
+	case "feature":
+		for f, k := range featureKinds {
+			if k.Name == op.Name {
+				return s.SetFeature(op.X, op.Y, Feature(f))
+			}
+		}
+		return fmt.Errorf("no feature %q", op.Name)
+	case "stamp":
+		for _, p := range prefabs {
+			if p.Name == op.Name {
+				return s.stamp(p, op.X, op.Y)
+			}
+		}
+		return fmt.Errorf("no prefab %q", op.Name)
+	}
+	return fmt.Errorf("unknown edit %q", op.Op)
+}
+
+// snapshot copies what of the stage an edit can change
+func (s *Stage) snapshot() snapshot {
+	return snapshot{
+		cell:        append([]Tile(nil), s.cell...),
+		rooms:       append([]Room(nil), s.rooms...),
+		doors:       append([]Tile(nil), s.doors...),
+		monsters:    append([]*Monster(nil), s.monsters...),
+		items:       append([]*Item(nil), s.items...),
+		traps:       append([]*Trap(nil), s.traps...),
+		decorations: append([]*Decoration(nil), s.decorations...),
+		bridges:     append([]*Bridge(nil), s.bridges...),
+		entranceX:   s.entranceX, entranceY: s.entranceY,
+		upX: s.upX, upY: s.upY,
+		downX: s.downX, downY: s.downY,
+	}
+}
+
+// restore puts the stage back the way snap found it
+func (s *Stage) restore(snap snapshot) {
+	copy(s.cell, snap.cell)
+	s.rooms = append([]Room(nil), snap.rooms...)
+	s.doors = append([]Tile(nil), snap.doors...)
+	s.monsters = append([]*Monster(nil), snap.monsters...)
+	s.items = append([]*Item(nil), snap.items...)
+	s.traps = append([]*Trap(nil), snap.traps...)
+	s.decorations = append([]*Decoration(nil), snap.decorations...)
+	s.bridges = append([]*Bridge(nil), snap.bridges...)
+	s.entranceX, s.entranceY = snap.entranceX, snap.entranceY
+	s.upX, s.upY = snap.upX, snap.upY
+	s.downX, s.downY = snap.downX, snap.downY
+	s.roomsMoved()
+	s.doorIndex, s.doorsIndexed = nil, 0
+	s.drawn = nil
+}
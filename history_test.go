@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	s, err := New(WithSeed(1), WithStocking(5, 5, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	twin, _ := s.Crop(image.Rect(1, 1, s.width+1, s.height+1))
+	h := NewHistory(s)
+	start := s.String()
+	ops := []EditOp{
+		{Op: "carve", X: 4, Y: 4, Width: 9, Height: 3},
+		{Op: "stamp", X: 21, Y: 5, Name: "pillared hall"},
+		{Op: "tile", X: 6, Y: 9, Name: "water"},
+	}
+	var states []string
+	for _, op := range ops {
+		if err := h.Do(op); err != nil {
+			t.Fatalf("%+v: %v", op, err)
+		}
+		states = append(states, s.String())
+	}
+	before := s.String()
+	rooms, doors := len(s.rooms), len(s.doors)
+	if err := h.Do(EditOp{Op: "fill", X: s.entranceX, Y: s.entranceY, Width: 1, Height: 1}); err == nil {
+		t.Error("filled in the entrance")
+	}
+	if s.String() != before || len(s.rooms) != rooms || len(s.doors) != doors {
+		t.Error("an edit that failed changed the stage")
+	}
+
+	var patch bytes.Buffer
+	if err := h.WritePatch(&patch); err != nil {
+		t.Fatal(err)
+	}
+	if err := twin.ApplyPatch(&patch); err != nil {
+		t.Fatal(err)
+	}
+	if twin.String() != s.String() {
+		t.Error("the patch made a different stage")
+	}
+
+	for i := len(ops) - 1; i >= 0; i-- {
+		if s.String() != states[i] {
+			t.Fatalf("undid to the wrong stage at edit %d", i)
+		}
+		if !h.Undo() {
+			t.Fatalf("couldn't undo edit %d", i)
+		}
+	}
+	if s.String() != start {
+		t.Error("undoing everything didn't get back to the start")
+	}
+	if h.Undo() {
+		t.Error("undid past the start")
+	}
+	for i := range ops {
+		if !h.Redo() {
+			t.Fatalf("couldn't redo edit %d", i)
+		}
+		if s.String() != states[i] {
+			t.Fatalf("redid edit %d to the wrong stage", i)
+		}
+	}
+	if h.Redo() {
+		t.Error("redid past the end")
+	}
+
+	h.Undo()
+	h.Do(EditOp{Op: "door", X: 1, Y: 1})
+	if err := h.Do(EditOp{Op: "tile", X: 4, Y: 12, Name: "floor"}); err != nil {
+		t.Fatal(err)
+	}
+	if h.Redo() {
+		t.Error("redid an edit undone before a new one")
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, patch := range []string{
+		"{\"op\": \"shrink\"}\n",
+		"{\"op\": \"tile\", \"x\": 4, \"y\": 4, \"name\": \"marble\"}\n",
+		"not json\n",
+	} {
+		if err := s.ApplyPatch(bytes.NewBufferString(patch)); err == nil {
+			t.Errorf("applied %q", patch)
+		}
+	}
+}
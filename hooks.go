@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Hooks are called as a stage is generated, to watch it take shape: for
+// animations, telemetry, or live previews. Any left nil are skipped.
+//
+// OnRoomPlaced is called with the cells a room spans once it is carved.
+// OnCellCarved is called whenever a wall is opened up into anything else.
+// OnRegionsJoined is called with the doorway or carved cell where two
+// separate regions meet. OnPassComplete is called with the name of every
+// pipeline pass as it finishes. OnProgress is called as every pass starts,
+// and again each time another percent of the stage is carved.
+type Hooks struct {
+	OnRoomPlaced    func(s *Stage, x, y, width, height int)
+	OnCellCarved    func(s *Stage, x, y int)
+	OnRegionsJoined func(s *Stage, x, y int)
+	OnPassComplete  func(s *Stage, pass string)
+	OnProgress      func(s *Stage, p Progress)
+}
+
+// Progress is how far along generating a stage is: the pass running, how
+// many of the pipeline's passes are done, and the percent of the stage's
+// cells carved open so far
+type Progress struct {
+	Pass   string
+	Done   int
+	Passes int
+	Carved float64
+}
+
+// roomPlaced calls the OnRoomPlaced hook for room
+func (s *Stage) roomPlaced(room Room) {
+	if h := s.opts.Hooks.OnRoomPlaced; h != nil {
+		// rooms span x through x+width inclusive
+		h(s, room.x, room.y, room.width+1, room.height+1)
+	}
+}
+
+// cellCarved counts x, y as carved and calls the OnCellCarved hook for it
+func (s *Stage) cellCarved(x, y int) {
+	s.progress.carved++
+	if h := s.opts.Hooks.OnCellCarved; h != nil {
+		h(s, x, y)
+	}
+	if step := s.width * s.height / 100; step == 0 || s.progress.carved%step == 0 {
+		s.reportProgress()
+	}
+}
+
+// reportProgress calls the OnProgress hook with how far along the stage is
+func (s *Stage) reportProgress() {
+	if h := s.opts.Hooks.OnProgress; h != nil {
+		h(s, Progress{
+			Pass:   s.progress.pass,
+			Done:   s.progress.done,
+			Passes: s.progress.passes,
+			Carved: 100 * float64(s.progress.carved) / float64(s.width*s.height),
+		})
+	}
+}
+
+// regionsJoined calls the OnRegionsJoined hook for x, y
+func (s *Stage) regionsJoined(x, y int) {
+	if h := s.opts.Hooks.OnRegionsJoined; h != nil {
+		h(s, x, y)
+	}
+}
+
+// passComplete calls the OnPassComplete hook for pass
+func (s *Stage) passComplete(pass string) {
+	if h := s.opts.Hooks.OnPassComplete; h != nil {
+		h(s, pass)
+	}
+}
+
+// and returns hooks that call both h's and other's, h's first
+func (h Hooks) and(other Hooks) Hooks {
+	return Hooks{
+		OnRoomPlaced: func(s *Stage, x, y, width, height int) {
+			if h.OnRoomPlaced != nil {
+				h.OnRoomPlaced(s, x, y, width, height)
+			}
+			if other.OnRoomPlaced != nil {
+				other.OnRoomPlaced(s, x, y, width, height)
+			}
+		},
+		OnCellCarved: func(s *Stage, x, y int) {
+			if h.OnCellCarved != nil {
+				h.OnCellCarved(s, x, y)
+			}
+			if other.OnCellCarved != nil {
+				other.OnCellCarved(s, x, y)
+			}
+		},
+		OnRegionsJoined: func(s *Stage, x, y int) {
+			if h.OnRegionsJoined != nil {
+				h.OnRegionsJoined(s, x, y)
+			}
+			if other.OnRegionsJoined != nil {
+				other.OnRegionsJoined(s, x, y)
+			}
+		},
+		OnPassComplete: func(s *Stage, pass string) {
+			if h.OnPassComplete != nil {
+				h.OnPassComplete(s, pass)
+			}
+			if other.OnPassComplete != nil {
+				other.OnPassComplete(s, pass)
+			}
+		},
+		OnProgress: func(s *Stage, p Progress) {
+			if h.OnProgress != nil {
+				h.OnProgress(s, p)
+			}
+			if other.OnProgress != nil {
+				other.OnProgress(s, p)
+			}
+		},
+	}
+}
+
+// progressBar returns hooks that draw a progress bar on w, redrawn in place,
+// with a bar for the passes done and the percent of the stage carved. Stages
+// generated at the same time share the bar, each line drawn whole.
+func progressBar(w io.Writer) Hooks {
+	const width = 30
+	var mu sync.Mutex
+	draw := func(p Progress) {
+		filled := width * p.Done / p.Passes
+		fmt.Fprintf(w, "\r%-12s [%s%s] %2d/%d passes, %3.0f%% carved", p.Pass, strings.Repeat("#", filled), strings.Repeat(" ", width-filled), p.Done, p.Passes, p.Carved)
+	}
+	return Hooks{
+		OnProgress: func(s *Stage, p Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			draw(p)
+		},
+		OnPassComplete: func(s *Stage, pass string) {
+			mu.Lock()
+			defer mu.Unlock()
+			// the bar was last drawn as the final pass started, so fill it
+			// before moving on
+			if p := s.progress; p.done == p.passes {
+				draw(Progress{Pass: pass, Done: p.done, Passes: p.passes, Carved: 100 * float64(p.carved) / float64(s.width*s.height)})
+				fmt.Fprintln(w)
+			}
+		},
+	}
+}
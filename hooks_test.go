@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestProgressBarInBatch(t *testing.T) {
+	var buf bytes.Buffer
+	opts := DefaultOptions()
+	opts.Hooks = progressBar(&buf)
+	if err := WriteBatch(context.Background(), opts, t.TempDir(), "txt", 1, 8, 4); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 8 {
+		t.Fatalf("%d lines, want one per maze", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "12/12 passes") {
+			t.Errorf("progress bar ended before every pass was done: %q", line[strings.LastIndex(line, "\r")+1:])
+		}
+		for _, bar := range strings.Split(line, "\r")[1:] {
+			if !strings.Contains(bar, " passes, ") || !strings.HasSuffix(bar, "% carved") {
+				t.Errorf("garbled progress bar %q", bar)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PickUp moves the item under the player into their inventory
+func (s *Stage) PickUp(p *Player) string {
+	item := s.itemAt(p.x, p.y)
+	if item == nil {
+		return "There is nothing here. "
+	}
+	for i, other := range s.items {
+		if other == item {
+			s.items = append(s.items[:i], s.items[i+1:]...)
+			break
+		}
+	}
+	p.inventory = append(p.inventory, item)
+	return fmt.Sprintf("You pick up the %s. ", item.Name)
+}
+
+// Unlock opens the locked door at x, y if the player carries a key. The key
+// stays in the lock.
+func (s *Stage) Unlock(p *Player, x, y int) string {
+	for i, item := range p.inventory {
+		if item.Class != "key" {
+			continue
+		}
+		p.inventory = append(p.inventory[:i], p.inventory[i+1:]...)
+		s.setKind(x, y, Door)
+		return fmt.Sprintf("You unlock the door with the %s. ", item.Name)
+	}
+	return "The door is locked. "
+}
+
+// Use applies the i-th item in the player's inventory. Potions are used up;
+// equipment stays in the inventory once wielded or worn.
+func (p *Player) Use(i int) string {
+	item := p.inventory[i]
+	switch item.Effect {
+	case "heal":
+		p.hp += item.Power
+		if p.hp > p.maxHP {
+			p.hp = p.maxHP
+		}
+	case "strength":
+		p.attack += item.Power
+	case "wield":
+		if p.weapon != nil {
+			p.attack -= p.weapon.Power
+		}
+		p.weapon = item
+		p.attack += item.Power
+		return fmt.Sprintf("You wield the %s. ", item.Name)
+	case "wear":
+		if p.armor != nil {
+			p.maxHP -= p.armor.Power
+			p.hp -= p.armor.Power
+		}
+		p.armor = item
+		p.maxHP += item.Power
+		p.hp += item.Power
+		return fmt.Sprintf("You put on the %s. ", item.Name)
+	case "":
+		if item.Class == "key" {
+			return "Walk into a locked door to use a key. "
+		}
+		return fmt.Sprintf("You admire the %s. ", item.Name)
+	}
+	p.inventory = append(p.inventory[:i], p.inventory[i+1:]...)
+	return fmt.Sprintf("You drink the %s. ", item.Name)
+}
+
+// inventoryScreen lists what the player carries and lets them pick something
+// to use, drawn to w as a single frame. It returns "" if nothing was used.
+func (s *Stage) inventoryScreen(w io.Writer, p *Player, keys *keyboard) string {
+	var frame strings.Builder
+	frame.WriteString(beginFrame + clearScreen + "You are carrying:\r\n")
+	if len(p.inventory) == 0 {
+		frame.WriteString("  nothing\r\n")
+	}
+	for i, item := range p.inventory {
+		note := ""
+		if item == p.weapon {
+			note = " (wielded)"
+		} else if item == p.armor {
+			note = " (worn)"
+		}
+		fmt.Fprintf(&frame, "  %c) %c %s%s\r\n", 'a'+i, item.Glyph, item.Name, note)
+	}
+	frame.WriteString("\r\npress a letter to use an item, any other key to go back\r\n" + endFrame)
+	io.WriteString(w, frame.String())
+
+	key, err := keys.read()
+	if err != nil || len(key) != 1 {
+		return ""
+	}
+	i := int(key[0] - 'a')
+	if i < 0 || i >= len(p.inventory) {
+		return ""
+	}
+	return p.Use(i)
+}
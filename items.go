@@ -0,0 +1,102 @@
+package main
+
+// ItemKind describes a type of item that can be scattered through the dungeon
+type ItemKind struct {
+	Name   string
+	Class  string // treasure, potion, equipment, or key
+	Glyph  rune
+	Weight int    // relative chance of being picked
+	Depth  int    // minimum percent of the way from the entrance to the farthest cell
+	Effect string // heal, strength, wield, or wear when used from the inventory
+	Power  int
+}
+
+type Item struct {
+	ItemKind
+	x, y int
+}
+
+var itemTable = []ItemKind{
+	{Name: "gold coins", Class: "treasure", Glyph: '$', Weight: 12, Depth: 0},
+	{Name: "gemstone", Class: "treasure", Glyph: '*', Weight: 3, Depth: 50},
+	{Name: "healing potion", Class: "potion", Glyph: '!', Weight: 8, Depth: 0, Effect: "heal", Power: 8},
+	{Name: "potion of strength", Class: "potion", Glyph: '!', Weight: 2, Depth: 40, Effect: "strength", Power: 1},
+	{Name: "dagger", Class: "equipment", Glyph: ')', Weight: 5, Depth: 0, Effect: "wield", Power: 2},
+	{Name: "sword", Class: "equipment", Glyph: ')', Weight: 3, Depth: 30, Effect: "wield", Power: 4},
+	{Name: "leather armor", Class: "equipment", Glyph: '[', Weight: 4, Depth: 10, Effect: "wear", Power: 4},
+	{Name: "plate armor", Class: "equipment", Glyph: '[', Weight: 1, Depth: 70, Effect: "wear", Power: 10},
+}
+
+// keyKind opens a locked door. It is never picked at random; AddLocks
+// places one for every door it locks.
+var keyKind = ItemKind{Name: "iron key", Class: "key", Glyph: '-'}
+
+// AddItems scatters items over the open cells. Dead ends and rooms far from
+// the entrance are favored, so exploring the whole dungeon pays off.
+func (s *Stage) AddItems() {
+	dist := s.DistanceMap(s.entranceX, s.entranceY)
+	open, maxDist := reach(dist)
+
+	count := open * s.opts.ItemRate / 100
+	if count == 0 {
+		return
+	}
+
+	candidates := make([]Tile, 0, open)
+	weights := make([]int, 0, open)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			d, ok := dist.At(x, y)
+			if !ok || d == 0 || s.itemAt(x, y) != nil || s.isStairs(x, y) || !s.onGround(x, y) {
+				continue
+			}
+			w := 10 + 30*d/maxDist
+			if s.isDeadEnd(x, y) {
+				w *= 4
+			} else if _, ok := s.roomAt(x, y); ok && d > maxDist/2 {
+				w *= 2
+			}
+			candidates = append(candidates, s.at(x, y))
+			weights = append(weights, w)
+		}
+	}
+
+	bag := newWeightedBag(weights)
+	for ; count > 0 && bag.left > 0; count-- {
+		t := candidates[bag.pick(s.rng)]
+		d, _ := dist.At(t.x, t.y)
+		s.items = append(s.items, &Item{
+			ItemKind: s.pickItemKind(100 * d / maxDist),
+			x:        t.x,
+			y:        t.y,
+		})
+	}
+}
+
+// pickItemKind chooses an item from the theme allowed at the given depth percent
+func (s *Stage) pickItemKind(depth int) ItemKind {
+	kinds := make([]ItemKind, 0, len(s.theme.Items))
+	weights := make([]int, 0, len(s.theme.Items))
+	for _, k := range s.theme.Items {
+		if k.Depth <= depth {
+			kinds = append(kinds, k)
+			weights = append(weights, k.Weight)
+		}
+	}
+	return kinds[pickWeighted(s.rng, weights)]
+}
+
+// itemAt returns the item lying at x, y, or nil
+func (s *Stage) itemAt(x, y int) *Item {
+	for _, item := range s.items {
+		if item.x == x && item.y == y {
+			return item
+		}
+	}
+	return nil
+}
+
+// isDeadEnd reports if x, y is open with only one open neighbor
+func (s *Stage) isDeadEnd(x, y int) bool {
+	return s.isOpen(x, y) && len(s.openNeighbors(x, y)) == 1
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Labyrinth carves a unicursal labyrinth: a single path, with no branches,
+// through the whole stage. It grows a maze on a grid of half the stage's
+// resolution, then walks around the walls of that maze, keeping a hand on
+// them the whole way, and carves where it walked. A stage whose maze has an
+// odd number of cells across or down leaves the last column or row solid.
+type Labyrinth struct{}
+
+// labyrinthSides are the sides of a cell of the half resolution maze, each
+// with its step to the neighbor on that side and the two corners of the cell
+// along it, as the half steps to them from the cell's middle
+var labyrinthSides = [4]struct {
+	dx, dy         int
+	ax, ay, bx, by int
+}{
+	{0, -1, -1, -1, 1, -1},
+	{1, 0, 1, -1, 1, 1},
+	{0, 1, -1, 1, 1, 1},
+	{-1, 0, -1, -1, -1, 1},
+}
+
+func (Labyrinth) Carve(s *Stage, rng *rand.Rand) error {
+	// each cell of the half resolution maze is four cells of the stage's,
+	// filling the stage cells 4a+2 to 4a+4 across and 4b+2 to 4b+4 down
+	w, h := (s.width-1)/4, (s.height-1)/4
+	middle := func(i int) (int, int) { return 4*(i%w) + 3, 4*(i/w) + 3 }
+	usable := func(i int) bool {
+		x, y := middle(i)
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if s.isEdge(x+dx, y+dy) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	// neighbor returns the cell on side d of cell i, if the two can be
+	// joined
+	neighbor := func(i, d int) (int, bool) {
+		side := labyrinthSides[d]
+		a, b := i%w+side.dx, i/w+side.dy
+		if a < 0 || a >= w || b < 0 || b >= h || !usable(b*w+a) {
+			return 0, false
+		}
+		// the two cells the passages out through this side cross
+		x, y := middle(i)
+		if s.isEdge(x+side.ax+side.dx, y+side.ay+side.dy) || s.isEdge(x+side.bx+side.dx, y+side.by+side.dy) {
+			return 0, false
+		}
+		return b*w + a, true
+	}
+
+	var starts []int
+	for i := 0; i < w*h; i++ {
+		if usable(i) {
+			starts = append(starts, i)
+		}
+	}
+	if len(starts) == 0 {
+		return fmt.Errorf("stage is too small for a labyrinth")
+	}
+
+	// open has bit d set on a cell joined to its neighbor on side d
+	open := make([]uint8, w*h)
+	seen := make([]bool, w*h)
+	start := starts[rng.Intn(len(starts))]
+	seen[start] = true
+	var cells frontier
+	cells.push(start)
+	for cells.count > 0 && !s.cancelled() {
+		pos := cells.nth(growFrom(rng, s.opts.Algorithm, cells.count))
+		i := cells.cells[pos]
+		var next []int
+		for d := range labyrinthSides {
+			if j, ok := neighbor(i, d); ok && !seen[j] {
+				next = append(next, d)
+			}
+		}
+		if len(next) == 0 {
+			cells.remove(pos)
+			continue
+		}
+		d := next[rng.Intn(len(next))]
+		j, _ := neighbor(i, d)
+		open[i] |= 1 << d
+		open[j] |= 1 << ((d + 2) % 4)
+		seen[j] = true
+		cells.push(j)
+	}
+
+	// Walking around the walls goes once up and once down every passage of
+	// the maze, so each cell's four corners are joined around the cell
+	// except on the sides it opens through, where they are joined to the
+	// neighbor's instead. That makes one loop, cut open at its first cell
+	// so it has two ends and the entrance lands on one of them.
+	first := -1
+	for i, ok := range seen {
+		if !ok {
+			continue
+		}
+		x, y := middle(i)
+		for d, side := range labyrinthSides {
+			s.setKind(x+side.ax, y+side.ay, Floor)
+			s.setKind(x+side.bx, y+side.by, Floor)
+			if open[i]&(1<<d) == 0 {
+				s.setKind(x+(side.ax+side.bx)/2, y+(side.ay+side.by)/2, Floor)
+				continue
+			}
+			s.setKind(x+side.ax+side.dx, y+side.ay+side.dy, Floor)
+			s.setKind(x+side.bx+side.dx, y+side.by+side.dy, Floor)
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	// the first cell has nothing to its left or above, so closing its left
+	// side leaves its top left corner at the end of the path
+	x, y := middle(first)
+	s.setKind(x-1, y, Wall)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestLabyrinthIsOnePath(t *testing.T) {
+	for _, algorithm := range []string{"random", "newest", "oldest", "mixed"} {
+		s, err := New(WithSize(41, 21), WithSeed(5), WithAlgorithm(algorithm), WithPipeline(Pipeline{{Name: "labyrinth", Layout: true, Generator: Labyrinth{}}}))
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		// 41 by 21 fits the half resolution maze exactly, so every maze cell
+		// is on the path, which has two ends and no forks
+		ends, open := 0, 0
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				if !s.isOpen(x, y) {
+					if x%2 == 0 && y%2 == 0 {
+						t.Errorf("%s: maze cell (%d, %d) was left solid", algorithm, x, y)
+					}
+					continue
+				}
+				open++
+				switch n := len(s.openNeighbors(x, y)); n {
+				case 1:
+					ends++
+				case 2:
+				default:
+					t.Errorf("%s: (%d, %d) has %d ways out", algorithm, x, y, n)
+				}
+			}
+		}
+		if ends != 2 {
+			t.Errorf("%s: path has %d ends, want 2", algorithm, ends)
+		}
+		if reached, _ := reach(s.DistanceMap(s.entranceX, s.entranceY)); reached != open {
+			t.Errorf("%s: reached %d of %d open cells", algorithm, reached, open)
+		}
+		if len(s.openNeighbors(s.entranceX, s.entranceY)) != 1 {
+			t.Errorf("%s: entrance (%d, %d) isn't at an end of the path", algorithm, s.entranceX, s.entranceY)
+		}
+	}
+}
+
+func TestUnicursalStagesAreValid(t *testing.T) {
+	for _, theme := range []string{"classic", "mine"} {
+		for seed := int64(1); seed <= 10; seed++ {
+			s, err := New(WithSeed(seed), WithTheme(themes[theme]), WithUnicursal())
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", theme, seed, err)
+			}
+			if report := s.Validate(); !report.Valid {
+				t.Errorf("%s seed %d: %v", theme, seed, report.Failures)
+			}
+		}
+	}
+}
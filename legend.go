@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Where things go in a legend, floor first and monsters last
+const (
+	legendFloor = iota
+	legendDoor
+	legendStairs
+	legendTrap
+	legendTerrain
+	legendFeature
+	legendDecoration
+	legendItem
+	legendMonster
+)
+
+// legendName is what a cell is drawn as, named for a legend
+type legendName struct {
+	glyph rune
+	name  string
+	rank  int
+}
+
+// namer returns a function naming what's drawn as r at x, y, checking what
+// could be there in the order glyphs draws it, with where it goes in a
+// legend. Walls have no name.
+func (s *Stage) namer() func(x, y int, r rune) (string, int) {
+	over := make(map[int]legendName)
+	at := func(x, y int, n legendName) { over[(y-1)*s.width+x-1] = n }
+	for i := len(s.decorations) - 1; i >= 0; i-- {
+		d := s.decorations[i]
+		at(d.x, d.y, legendName{d.Glyph, d.Name, legendDecoration})
+	}
+	for i := len(s.traps) - 1; i >= 0; i-- {
+		t := s.traps[i]
+		at(t.x, t.y, legendName{trapGlyph, t.Name, legendTrap})
+	}
+	if s.upX != 0 {
+		at(s.upX, s.upY, legendName{stairsUpGlyph, tileKinds[StairsUp].Name, legendStairs})
+	}
+	if s.downX != 0 {
+		at(s.downX, s.downY, legendName{stairsDownGlyph, tileKinds[StairsDown].Name, legendStairs})
+	}
+	for i := len(s.items) - 1; i >= 0; i-- {
+		item := s.items[i]
+		at(item.x, item.y, legendName{item.Glyph, item.Name, legendItem})
+	}
+	for i := len(s.monsters) - 1; i >= 0; i-- {
+		m := s.monsters[i]
+		at(m.x, m.y, legendName{m.Glyph, m.Name, legendMonster})
+	}
+	return func(x, y int, r rune) (string, int) {
+		if n, ok := over[(y-1)*s.width+x-1]; ok && n.glyph == r {
+			return n.name, n.rank
+		}
+		cell := s.at(x, y)
+		k := cell.kind.Kind()
+		switch {
+		case cell.kind == Wall:
+			return "", 0
+		case cell.kind == LockedDoor && r == lockedDoorGlyph:
+			return k.Name, legendDoor
+		case cell.feature != NoFeature:
+			return cell.feature.Kind().Name, legendFeature
+		case k.Terrain:
+			return k.Name, legendTerrain
+		case cell.ramp:
+			return "ramp", legendTerrain
+		case cell.kind == Door:
+			return k.Name, legendDoor
+		}
+		return tileKinds[Floor].Name, legendFloor
+	}
+}
+
+// legend returns a line for everything drawn on the stage but walls and blank
+// floor, saying what it is: what draw draws it as, and the names of all that
+// glyph draws the same way
+func (s *Stage) legend(draw func(x, y int) string, glyph func(x, y int) rune) []string {
+	type entry struct {
+		drawn string
+		names []string
+		rank  int
+	}
+	entries := make(map[string]*entry)
+	named := s.namer()
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			name, rank := named(x, y, glyph(x, y))
+			drawn := draw(x, y)
+			if name == "" || strings.TrimSpace(drawn) == "" {
+				continue
+			}
+			e := entries[drawn]
+			if e == nil {
+				e = &entry{drawn: drawn, rank: rank}
+				entries[drawn] = e
+			}
+			if rank < e.rank {
+				e.rank = rank
+			}
+			if !containsString(e.names, name) {
+				e.names = append(e.names, name)
+			}
+		}
+	}
+	sorted := make([]*entry, 0, len(entries))
+	for _, e := range entries {
+		sort.Strings(e.names)
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].rank != sorted[j].rank {
+			return sorted[i].rank < sorted[j].rank
+		}
+		return sorted[i].drawn < sorted[j].drawn
+	})
+	lines := make([]string, len(sorted))
+	for i, e := range sorted {
+		lines[i] = fmt.Sprintf("%s  %s", e.drawn, strings.Join(e.names, ", "))
+	}
+	return lines
+}
+
+// writeLegend writes the legend of the stage drawn in format to w, under a
+// blank line
+func (s *Stage) writeLegend(w io.Writer, format string) error {
+	glyph := s.glyphs(true)
+	draw := func(x, y int) string {
+		tile, _ := s.tile(x, y, glyph(x, y))
+		return tile
+	}
+	switch format {
+	case "ascii":
+		ascii := s.asciiRune()
+		glyph, draw = ascii, func(x, y int) string { return string(ascii(x, y)) }
+	case "emoji":
+		draw = s.emoji(true)
+	}
+	b := bufio.NewWriter(w)
+	b.WriteString("\n")
+	for _, line := range s.legend(draw, glyph) {
+		b.WriteString(line + "\n")
+	}
+	return b.Flush()
+}
+
+// containsString reports if list has s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
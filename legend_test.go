@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLegend(t *testing.T) {
+	s, err := New(WithSize(31, 15), WithSeed(7), WithStocking(10, 10, 10), WithLegend())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := s.Write(&b, "unicode"); err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(b.String(), "\n\n", 2)
+	if len(parts) != 2 || parts[0]+"\n" != s.String() {
+		t.Fatalf("legend isn't under the stage:\n%s", b.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(parts[1], "\n"), "\n")
+	has := func(glyph rune, name string) bool {
+		for _, line := range lines {
+			if strings.HasPrefix(line, string(glyph)+"  ") && strings.Contains(line, name) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(s.monsters) == 0 || len(s.items) == 0 || len(s.traps) == 0 {
+		t.Fatal("nothing to put in the legend")
+	}
+	for _, m := range s.monsters {
+		if !has(m.Glyph, m.Name) {
+			t.Errorf("no %c %s in the legend:\n%s", m.Glyph, m.Name, parts[1])
+		}
+	}
+	for _, item := range s.items {
+		if !has(item.Glyph, item.Name) {
+			t.Errorf("no %c %s in the legend:\n%s", item.Glyph, item.Name, parts[1])
+		}
+	}
+	if !has(trapGlyph, s.traps[0].Name) {
+		t.Errorf("no %s in the legend:\n%s", s.traps[0].Name, parts[1])
+	}
+	for _, line := range lines {
+		if r := []rune(line)[0]; r == ' ' || strings.ContainsRune(string(wallRunes[:]), r) {
+			t.Errorf("legend has %q", line)
+		}
+	}
+	// monsters come last
+	last := lines[len(lines)-1]
+	monster := false
+	for _, m := range s.monsters {
+		monster = monster || strings.HasPrefix(last, string(m.Glyph)+"  ")
+	}
+	if !monster {
+		t.Errorf("legend ends with %q", last)
+	}
+
+	b.Reset()
+	if err := s.Write(&b, "ascii"); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range s.monsters {
+		if strings.Contains(strings.SplitN(b.String(), "\n\n", 2)[1], m.Name) {
+			t.Errorf("ascii legend has %s, which ascii doesn't draw", m.Name)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	stairsUpGlyph   = '<'
+	stairsDownGlyph = '>'
+)
+
+// maxLevelTries is how many times a level is regenerated looking for one
+// where the stairs down from the level above open onto most of the level
+const maxLevelTries = 20
+
+// GenerateLevels builds n stacked levels. The stairs down on each level sit
+// at the same x, y as the stairs up on the level below, and every level's
+// stairs down can be reached from its stairs up (or the entrance, on the
+// first level). Level i is generated at difficulty curve[i], and every level
+// is generated with opts. The levels draw from its source one after another.
+// It fails if one of the passes does, or if ctx is cancelled.
+func GenerateLevels(ctx context.Context, opts Options, n int, curve []float64) ([]*Stage, error) {
+	levels := make([]*Stage, 0, n)
+	for i := 0; i < n; i++ {
+		var s *Stage
+		if i == 0 {
+			s = newStage(ctx, opts, curve[i])
+			if err := s.runPasses(true); err != nil {
+				return nil, err
+			}
+			s.PlaceEntrance()
+		} else {
+			above := levels[i-1]
+			var err error
+			if s, err = generateBelow(ctx, opts, above.downX, above.downY, curve[i]); err != nil {
+				return nil, err
+			}
+		}
+		if i < n-1 {
+			s.PlaceStairsDown()
+		}
+		if err := s.runPasses(false); err != nil {
+			return nil, err
+		}
+		levels = append(levels, s)
+	}
+	return levels, nil
+}
+
+// GenerateStage makes a single level, regenerating it up to maxLevelTries
+// times until its difficulty score reaches opts.MinDifficulty. If none of them
+// do, the hardest is kept and ok is false.
+func GenerateStage(ctx context.Context, opts Options) (s *Stage, ok bool, err error) {
+	best, bestScore := (*Stage)(nil), -1.0
+	for try := 0; try < maxLevelTries; try++ {
+		levels, err := GenerateLevels(ctx, opts, 1, []float64{1})
+		if err != nil {
+			return nil, false, err
+		}
+		score := levels[0].DifficultyScore()
+		if score >= opts.MinDifficulty {
+			return levels[0], true, nil
+		}
+		if score > bestScore {
+			best, bestScore = levels[0], score
+		}
+	}
+	return best, false, nil
+}
+
+// generateBelow makes a level whose stairs up (and entrance) are at x, y.
+// Since x, y is an even cell it is always carved by the maze or a room; the
+// level is rerolled a few times if that spot turns out to be walled into a
+// small pocket, keeping whichever try reaches the most of the level.
+func generateBelow(ctx context.Context, opts Options, x, y int, difficulty float64) (*Stage, error) {
+	var best *Stage
+	bestReach := -1
+	for try := 0; try < maxLevelTries; try++ {
+		s := newStage(ctx, opts, difficulty)
+		if err := s.runPasses(true); err != nil {
+			return nil, err
+		}
+		s.setKind(x, y, StairsUp)
+		s.entranceX, s.entranceY = x, y
+		s.upX, s.upY = x, y
+
+		reached, _ := reach(s.DistanceMap(x, y))
+		if reached > bestReach {
+			best, bestReach = s, reached
+		}
+		if reached*2 >= s.openCount() {
+			break
+		}
+	}
+	return best, nil
+}
+
+// newStage returns a stage of solid wall to generate with opts at
+// difficulty until ctx is cancelled
+func newStage(ctx context.Context, opts Options, difficulty float64) *Stage {
+	s := NewStage(opts.Width, opts.Height, opts.Source)
+	s.opts, s.difficulty, s.theme, s.ctx = opts, difficulty, opts.Theme, ctx
+	s.outside = shapeCells(opts.Shape, s.width, s.height)
+	if opts.Mask != nil {
+		masked := opts.Mask.cells(s.width, s.height)
+		if s.outside == nil {
+			s.outside = masked
+		}
+		for i := range masked {
+			s.outside[i] = s.outside[i] || masked[i]
+		}
+	}
+	return s
+}
+
+// ParseDifficultyCurve turns a -difficulty_curve value into a difficulty for
+// each of n levels. Named curves start at 1 on the first level: flat stays
+// there, linear adds half a point per level, and steep squares linear.
+// Otherwise the value lists one multiplier per level; levels past the end of
+// the list repeat the last one.
+func ParseDifficultyCurve(curve string, n int) ([]float64, error) {
+	out := make([]float64, n)
+	switch curve {
+	case "flat", "linear", "steep":
+		for i := range out {
+			linear := 1 + 0.5*float64(i)
+			switch curve {
+			case "flat":
+				out[i] = 1
+			case "linear":
+				out[i] = linear
+			case "steep":
+				out[i] = linear * linear
+			}
+		}
+		return out, nil
+	}
+
+	parts := strings.Split(curve, ",")
+	for i := range out {
+		part := strings.TrimSpace(parts[len(parts)-1])
+		if i < len(parts) {
+			part = strings.TrimSpace(parts[i])
+		}
+		d, err := strconv.ParseFloat(part, 64)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid difficulty curve %q: want flat, linear, steep, or positive numbers like 1,1.5,3", curve)
+		}
+		out[i] = d
+	}
+	return out, nil
+}
+
+// scaleDown shrinks n by the stage's difficulty, never below 1
+func (s *Stage) scaleDown(n int) int {
+	scaled := int(float64(n) / s.difficulty)
+	if scaled < 1 {
+		return 1
+	}
+	return scaled
+}
+
+// scaledPercent returns percent of n, grown by the stage's difficulty
+func (s *Stage) scaledPercent(n, percent int) int {
+	return int(float64(n*percent) / 100 * s.difficulty)
+}
+
+// PlaceStairsDown puts the stairs down on an even cell (so it is open on the
+// level below too) reachable from the entrance, preferring cells far away
+func (s *Stage) PlaceStairsDown() {
+	s.useStream(stairStream)
+	dist := s.DistanceMap(s.entranceX, s.entranceY)
+	candidates := make([]Tile, 0)
+	weights := make([]int, 0)
+	for y := 2; y < s.height; y += 2 {
+		for x := 2; x < s.width; x += 2 {
+			d, ok := dist.At(x, y)
+			if !ok || d == 0 {
+				continue
+			}
+			candidates = append(candidates, s.at(x, y))
+			weights = append(weights, d*d)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	t := candidates[pickWeighted(s.rng, weights)]
+	s.downX, s.downY = t.x, t.y
+	s.setKind(t.x, t.y, StairsDown)
+}
+
+// openCount returns how many cells have been carved out
+func (s *Stage) openCount() int {
+	count := 0
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if s.isOpen(x, y) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// isStairs reports if either staircase is at x, y
+func (s *Stage) isStairs(x, y int) bool {
+	return (s.upX != 0 && x == s.upX && y == s.upY) || (s.downX != 0 && x == s.downX && y == s.downY)
+}
+
+// DungeonJSON ties the levels of a multi-level dungeon together. Each level
+// is written to its own file as well; Links is the level graph, one entry per
+// staircase.
+type DungeonJSON struct {
+	Seed   int64       `json:"seed"`
+	Levels []LevelJSON `json:"levels"`
+	Links  []LinkJSON  `json:"links"`
+}
+
+type LevelJSON struct {
+	Level int       `json:"level"`
+	File  string    `json:"file"`
+	Stage StageJSON `json:"stage"`
+}
+
+type LinkJSON struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	X    int `json:"x"`
+	Y    int `json:"y"`
+}
+
+// formatExt returns the file extension for an output format
+func formatExt(format string) string {
+	if ext, ok := map[string]string{"json": "json", "markdown": "md"}[format]; ok {
+		return ext
+	}
+	return "txt"
+}
+
+// WriteLevels writes every level to dir in the given format, named
+// level_01.txt and so on, plus dungeon.json holding all levels and the
+// stairs between them, generated from seed
+func WriteLevels(dir, format string, seed int64, levels []*Stage) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ext := formatExt(format)
+	dungeon := DungeonJSON{Seed: seed, Links: make([]LinkJSON, 0)}
+	for i, s := range levels {
+		name := fmt.Sprintf("level_%02d.%s", i+1, ext)
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		err = s.Write(f, format)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		dungeon.Levels = append(dungeon.Levels, LevelJSON{Level: i + 1, File: name, Stage: s.JSON()})
+		if s.downX != 0 {
+			dungeon.Links = append(dungeon.Links, LinkJSON{From: i + 1, To: i + 2, X: s.downX, Y: s.downY})
+		}
+	}
+
+	f, err := os.Create(filepath.Join(dir, "dungeon.json"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dungeon)
+}
+
+// Write renders the stage to w in one of the -format output formats, the
+// drawn ones followed by a legend if the stage's options ask for one
+func (s *Stage) Write(w io.Writer, format string) error {
+	var err error
+	switch format {
+	case "json":
+		return s.WriteJSON(w)
+	case "markdown":
+		return s.WriteMarkdown(w)
+	case "dot":
+		return s.WriteDOT(w)
+	case "donjon":
+		return s.WriteDonjon(w)
+	case "ascii":
+		err = s.writeRows(w, s.asciiRune())
+	case "emoji":
+		err = s.WriteEmoji(w)
+	default:
+		if s.opts.Tileset != nil {
+			err = s.writeTiles(w, s.glyphs(true))
+		} else {
+			err = s.writeRows(w, s.glyphs(true))
+		}
+	}
+	if err == nil && s.opts.Legend {
+		err = s.writeLegend(w, format)
+	}
+	return err
+}
+
+// writeRows writes the stage to w a row at a time through a buffer, so even
+// the largest stages never have their whole drawing held in memory. Wide
+// stages have a gap drawn between every two cells in a row.
+func (s *Stage) writeRows(w io.Writer, glyph func(x, y int) rune) error {
+	b := bufio.NewWriterSize(w, 64<<10)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			r := glyph(x, y)
+			if s.opts.Wide && x > 1 {
+				b.WriteRune(s.gap(x-1, y, glyph(x-1, y), r))
+			}
+			b.WriteRune(r)
+		}
+		b.WriteByte('\n')
+	}
+	return b.Flush()
+}
+
+// String returns the stage drawn with box drawing characters, with
+// everything in it drawn on top
+func (s *Stage) String() string {
+	var b strings.Builder
+	s.writeRows(&b, s.glyphs(true))
+	return b.String()
+}
+
+// ASCII returns the bare maze drawn with '#' walls, features, terrain, and
+// ramps. Open cells use the theme's floor glyph, or '.' if that isn't ASCII.
+func (s *Stage) ASCII() string {
+	var b strings.Builder
+	s.writeRows(&b, s.asciiRune())
+	return b.String()
+}
+
+// asciiRune returns the glyph function ASCII draws with
+func (s *Stage) asciiRune() func(x, y int) rune {
+	floor := '.'
+	if s.theme.Floor < 128 {
+		floor = s.theme.Floor
+	}
+	return func(x, y int) rune {
+		t := s.at(x, y)
+		switch {
+		case t.feature != NoFeature:
+			return rune(t.feature.Kind().ASCII)
+		case t.kind.Kind().Terrain:
+			return rune(t.kind.Kind().ASCII)
+		case t.ramp:
+			return rampGlyph
+		case t.kind != Wall:
+			return floor
+		}
+		return '#'
+	}
+}
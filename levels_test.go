@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDifficultyCurve(t *testing.T) {
+	for _, tt := range []struct {
+		curve string
+		n     int
+		want  []float64
+		err   bool
+	}{
+		{"flat", 3, []float64{1, 1, 1}, false},
+		{"linear", 4, []float64{1, 1.5, 2, 2.5}, false},
+		{"steep", 3, []float64{1, 2.25, 4}, false},
+		{"1,1.5,3", 3, []float64{1, 1.5, 3}, false},
+		{"1, 2", 4, []float64{1, 2, 2, 2}, false},
+		{"2,3,4", 2, []float64{2, 3}, false},
+		{"1,0", 2, nil, true},
+		{"1,-2", 2, nil, true},
+		{"wavy", 2, nil, true},
+		{"", 1, nil, true},
+	} {
+		got, err := ParseDifficultyCurve(tt.curve, tt.n)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseDifficultyCurve(%q, %d) error %v", tt.curve, tt.n, err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseDifficultyCurve(%q, %d) = %v, want %v", tt.curve, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import "sort"
+
+// lockedDoorGlyph is how a locked door is drawn
+const lockedDoorGlyph = '+'
+
+// AddLocks turns one room with a single doorway into a vault: the doorway is
+// locked, a treasure is left inside, and a key is hidden somewhere that can be
+// reached without going through the locked door.
+func (s *Stage) AddLocks() {
+	vaults := make([]Room, 0)
+	for _, room := range s.rooms {
+		if s.cancelled() {
+			return
+		}
+		if s.inRoom(room, s.entranceX, s.entranceY) || s.inRoom(room, s.downX, s.downY) {
+			continue
+		}
+		// the treasure goes in the middle, so that has to be dry land
+		if len(s.roomDoors(room)) == 1 && s.onGround(room.x+room.width/2, room.y+room.height/2) && s.seals(room) {
+			vaults = append(vaults, room)
+		}
+	}
+	if len(vaults) == 0 {
+		return
+	}
+
+	room := vaults[s.rng.Intn(len(vaults))]
+	door := s.roomDoors(room)[0]
+	s.setKind(door.x, door.y, LockedDoor)
+	// nothing would ever set off a trap or walk out of a locked doorway, and
+	// anything it dropped could never be picked up
+	s.removeTrap(door.x, door.y)
+	if m := s.monsterAt(door.x, door.y); m != nil {
+		s.removeMonster(m)
+	}
+
+	// leave something worth the trouble inside
+	x, y := room.x+room.width/2, room.y+room.height/2
+	if s.itemAt(x, y) == nil {
+		s.items = append(s.items, &Item{ItemKind: s.pickItemKind(100), x: x, y: y})
+	}
+
+	// the locked door now blocks the distance map, so every candidate is on
+	// the near side of it. far away dead ends make the best hiding spots.
+	dist := s.DistanceMap(s.entranceX, s.entranceY)
+	taken := make(map[int]bool, len(s.items))
+	for _, item := range s.items {
+		taken[(item.y-1)*s.width+item.x-1] = true
+	}
+	candidates := make([]Tile, 0)
+	weights := make([]int, 0)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			d, ok := dist.At(x, y)
+			if !ok || d == 0 || taken[(y-1)*s.width+x-1] || s.isStairs(x, y) || !s.onGround(x, y) {
+				continue
+			}
+			w := d + 1
+			if s.isDeadEnd(x, y) {
+				w *= 4
+			}
+			candidates = append(candidates, s.at(x, y))
+			weights = append(weights, w)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	t := candidates[pickWeighted(s.rng, weights)]
+	s.items = append(s.items, &Item{ItemKind: keyKind, x: t.x, y: t.y})
+}
+
+// seals reports if locking room's door would shut the room off from the rest
+// of the stage: nothing can be walked to from inside it without going through
+// the door. A river carved through a room's wall makes a way in that isn't a
+// door. Only the room is flooded, so this costs no more than its size.
+func (s *Stage) seals(room Room) bool {
+	door := s.roomDoors(room)[0]
+	seen := map[[2]int]bool{}
+	queue := make([]Tile, 0)
+	for x := room.x; x <= room.x+room.width; x++ {
+		for y := room.y; y <= room.y+room.height; y++ {
+			if s.IsWalkable(x, y) {
+				seen[[2]int{x, y}] = true
+				queue = append(queue, s.at(x, y))
+			}
+		}
+	}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		for _, n := range s.openNeighbors(t.x, t.y) {
+			p := [2]int{n.x, n.y}
+			if seen[p] || (n.x == door.x && n.y == door.y) {
+				continue
+			}
+			if !s.inRoom(room, n.x, n.y) {
+				return false
+			}
+			seen[p] = true
+			queue = append(queue, n)
+		}
+	}
+	return true
+}
+
+// roomDoors returns the doors carved into the sides of room, in the order
+// they were carved. Only the walls around it are looked at.
+func (s *Stage) roomDoors(room Room) []Tile {
+	found := make([]int, 0)
+	add := func(x, y int) {
+		if i, ok := s.doorAt(x, y); ok {
+			found = append(found, i)
+		}
+	}
+	for x := room.x; x <= room.x+room.width; x++ {
+		add(x, room.y-1)
+		add(x, room.y+room.height+1)
+	}
+	for y := room.y; y <= room.y+room.height; y++ {
+		add(room.x-1, y)
+		add(room.x+room.width+1, y)
+	}
+	sort.Ints(found)
+	doors := make([]Tile, 0, len(found))
+	for _, i := range found {
+		doors = append(doors, s.doors[i])
+	}
+	return doors
+}
+
+// inRoom reports if x, y is inside room
+func (s *Stage) inRoom(room Room, x, y int) bool {
+	return x >= room.x && x <= room.x+room.width && y >= room.y && y <= room.y+room.height
+}
+
+// removeTrap takes away the trap at x, y, if there is one
+func (s *Stage) removeTrap(x, y int) {
+	for i, t := range s.traps {
+		if t.x == x && t.y == y {
+			s.traps = append(s.traps[:i], s.traps[i+1:]...)
+			return
+		}
+	}
+}
@@ -1,35 +1,165 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"image"
+	"io"
 	"log"
 	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
-
-	"github.com/sethgrid/curse"
 )
 
 var (
-	Width        int
-	Height       int
-	RoomFillRate int
-	Animate      bool
+	Width         int
+	Height        int
+	RoomFillRate  int
+	MonsterRate   int
+	ItemRate      int
+	TrapRate      int
+	Animate       bool
+	Delay         time.Duration
+	FPS           int
+	FrameSkip     int
+	FrameDir      string
+	FrameFormat   string
+	FrameScale    int
+	CastFile      string
+	Addr          string
+	GRPCAddr      string
+	TLSCert       string
+	TLSKey        string
+	SSHAddr       string
+	HostKey       string
+	TelnetAddr    string
+	Play          bool
+	Format        string
+	Seed          int64
+	SeedName      string
+	SaveFile      string
+	LoadFile      string
+	PatchFile     string
+	Zoom          int
+	Autoexplore   bool
+	MinCoverage   float64
+	MinDifficulty float64
+	Levels        int
+	OutDir        string
+	OutFile       string
+	SceneGrid     int
+	SceneImage    string
+	ColorMode     string
+	TilesetFile   string
+	NoColor       bool
+	Difficulty    string
+	ThemeName     string
+	RNG           string
+	Algorithm     string
+	PruneSteps    int
+	ChunkSize     int
+	Timeout       time.Duration
+	ShowProgress  bool
+	Debug         string
+	Where         string
+	MinRoom       string
+	SearchLimit   int
+	BatchSize     int
+	Parallel      int
+	Histograms    string
+	Record        string
+	Verify        string
+	MapFile       string
+	MaskFile      string
+	ShapeName     string
+	WallStyle     string
+	Wide          bool
+	Legend        bool
+	Grid          string
+	Wrap          bool
+	Unicursal     bool
+	Bias          float64
+	SymmetryMode  string
+
+	ElevationLevels int
 )
 
 type Stage struct {
-	width, height int
-	cell          map[int]map[int]Tile
-	rooms         []Room
+	width, height        int
+	cell                 []Tile // row by row; read and write through at and set
+	rooms                []Room
+	monsters             []*Monster
+	items                []*Item
+	traps                []*Trap
+	doors                []Tile
+	entranceX, entranceY int
+	upX, upY             int
+	downX, downY         int
+	// difficulty scales room sizes down and monster and trap counts up
+	difficulty  float64
+	theme       *Theme
+	decorations []*Decoration
+	bridges     []*Bridge
+	// elevationLevels is how many heights cells can be at, 0 for a flat stage
+	elevationLevels int
+	// opts are the options the stage was generated with, and ctx cancels
+	// generating it
+	opts Options
+	ctx  context.Context
+	// progress is how far along generating it is, for the OnProgress hook
+	progress struct {
+		pass         string
+		done, passes int
+		carved       int
+	}
+	// rng makes every random choice for the stage, drawing from whichever of
+	// streams the current phase uses
+	rng     *rand.Rand
+	streams [streamCount]rand.Source
+	// drawn is what the animation last drew in each cell, and dirty the cells
+	// set since, whose glyphs and their neighbors' may have changed. shown is
+	// the part of the stage that fits on the terminal, and controls take the
+	// keys pressed while it runs, when it runs in one.
+	drawn    []rune
+	dirty    []int
+	shown    image.Rectangle
+	controls *animationControls
+	// carves counts the growMaze steps animated, to draw every FrameSkip
+	carves int
+	// chunk is set on the stages Chunks carves pieces of a bigger one in,
+	// which are never drawn themselves
+	chunk bool
+	// roomIndex is the room, plus one, each cell is in, and doorIndex where
+	// in doors, plus one, each doorway is, kept up with rooms and doors as
+	// they are appended so looking them up doesn't mean a pass over every one.
+	// roomBuckets has the rooms, plus one, overlapping each roomBucketSize
+	// square of the stage, for finding them near a point or in a rectangle.
+	roomIndex    []int32
+	roomBuckets  [][]int32
+	roomsIndexed int
+	doorIndex    map[int]int
+	doorsIndexed int
+	// outside is set on the cells outside the mask the stage was generated
+	// in, which are left solid like its border
+	outside []bool
 }
 
 type Tile struct {
-	empty bool
-	x, y  int
+	x, y      int
+	region    int32
+	kind      TileType
+	feature   Feature
+	flags     TileFlags
+	elevation int8
+	ramp      bool
+	ledge     bool
 }
 
-type Region struct{}
-
 type Room struct {
 	width, height, x, y int
 }
@@ -38,145 +168,804 @@ func init() {
 	flag.IntVar(&Width, "width", 79, "Total maze width (default 79)")
 	flag.IntVar(&Height, "height", 21, "Total maze height (default 21)")
 	flag.IntVar(&RoomFillRate, "room_fill_rate", 20, "Minimum percent space given to rooms (default 20)")
-	flag.BoolVar(&Animate, "animate", false, "Set to watch animation in terminal")
+	flag.IntVar(&MonsterRate, "monster_rate", 2, "Percent of open tiles to stock with monsters (default 2)")
+	flag.IntVar(&ItemRate, "item_rate", 1, "Percent of open tiles to scatter items on (default 1)")
+	flag.IntVar(&TrapRate, "trap_rate", 3, "Percent of corridor tiles and doorways to trap (default 3)")
+	flag.BoolVar(&Animate, "animate", false, "Set to watch animation in terminal: space pauses, . steps, and , rewinds")
+	flag.DurationVar(&Delay, "delay", 20*time.Millisecond, "With -animate, how long to wait after each frame (default 20ms)")
+	flag.IntVar(&FPS, "fps", 0, "With -animate, how many frames to draw a second, in place of -delay (default 0)")
+	flag.IntVar(&FrameSkip, "frame_skip", 1, "With -animate or -frames, draw a frame every this many carves, to get through big mazes faster (default 1)")
+	flag.StringVar(&FrameDir, "frames", "", "Write the frames of the maze being carved to numbered files in this directory, without drawing to the terminal")
+	flag.StringVar(&FrameFormat, "frame_format", "png", "With -frames, write them as png or txt (default png)")
+	flag.IntVar(&FrameScale, "frame_scale", 4, "With -frames png, how many pixels across each cell is (default 4)")
+	flag.StringVar(&CastFile, "cast", "", "Record the maze being carved to this file as an asciinema cast, watched with -animate too or not")
+	flag.StringVar(&Addr, "addr", ":8080", "With serve, the address to serve stages over HTTP on (default :8080)")
+	flag.StringVar(&GRPCAddr, "grpc_addr", "", "With serve, also serve the gRPC service in proto/dungeon.proto on this address, over TLS")
+	flag.StringVar(&TLSCert, "tls_cert", "", "With -grpc_addr, the TLS certificate file to serve with")
+	flag.StringVar(&TLSKey, "tls_key", "", "With -grpc_addr, the TLS key file to serve with")
+	flag.StringVar(&SSHAddr, "ssh_addr", "", "With serve, also let anyone who connects over SSH on this address play a dungeon of their own")
+	flag.StringVar(&HostKey, "host_key", "", "With -ssh_addr, the PEM file of the SSH host key; one is made up for the run if not given")
+	flag.StringVar(&TelnetAddr, "telnet_addr", "", "With serve, also let everyone who connects over telnet on this address walk one dungeon together")
+	flag.BoolVar(&Play, "play", false, "Set to walk the maze in the terminal")
+	flag.StringVar(&Format, "format", "unicode", "Output format: unicode, ascii, json, donjon for the JSON of the donjon generator, markdown, emoji, dot for a Graphviz graph of the regions and doors, foundry for a Foundry VTT scene, uvtt for a Universal VTT .dd2vtt map, roll20 for the walls and doors of a Roll20 page, minimap, events for a line of JSON per generation step, or with -grid hex or polar svg, and with polar png (default unicode)")
+	flag.StringVar(&SaveFile, "save_file", "dungeon.sav", "Where play mode saves the session (default dungeon.sav)")
+	flag.StringVar(&LoadFile, "load", "", "Resume a play session saved to this file")
+	flag.IntVar(&Zoom, "zoom", 4, "How many cells across and down each character of -format minimap stands for (default 4)")
+	flag.StringVar(&PatchFile, "patch", "dungeon.patch", "Where the edit command writes its edits as a patch (default dungeon.patch)")
+	flag.BoolVar(&Autoexplore, "autoexplore", false, "Set to print a report from a bot exploring the maze instead of the maze")
+	flag.Float64Var(&MinCoverage, "min_coverage", 0, "With -autoexplore, exit 1 if the bot reaches less than this percent of open tiles")
+	flag.Float64Var(&MinDifficulty, "min_difficulty", 0, "Regenerate the maze until its difficulty score (0 to 100) is at least this (default 0)")
+	flag.IntVar(&Levels, "levels", 1, "Number of stacked levels to generate; more than 1 writes one file per level (default 1)")
+	flag.StringVar(&Difficulty, "difficulty_curve", "linear", "How -levels ramps up difficulty: flat, linear, steep, or a comma separated multiplier per level like 1,1.5,3 (default linear)")
+	flag.StringVar(&RNG, "rng", "go", "Random number generator to draw from: go, pcg, or xoshiro (default go)")
+	flag.StringVar(&Algorithm, "algorithm", "random", "How the maze picks the next cell to grow from: random, newest, oldest, or mixed (default random)")
+	flag.BoolVar(&ShowProgress, "progress", false, "Set to draw a progress bar while generating")
+	flag.DurationVar(&Timeout, "timeout", 0, "Give up generating after this long, like 30s; 0 never gives up (default 0)")
+	flag.IntVar(&PruneSteps, "prune", 0, "How many cells to trim off the end of every dead end corridor (default 0)")
+	flag.IntVar(&ChunkSize, "chunk_size", 0, "Split mazes bigger than this into chunks this size, carved in parallel; even, at least 8, or 0 for one piece (default 0)")
+	flag.StringVar(&ThemeName, "theme", "classic", "Dungeon theme: classic, crypt, sewer, mine, or ice (default classic)")
+	flag.IntVar(&ElevationLevels, "elevation_levels", 1, "Number of heights to give the floor, up to 10; 1 keeps it flat (default 1)")
+	flag.StringVar(&Debug, "debug", "", "Debug view to print instead of the maze: regions")
+	flag.StringVar(&Where, "where", "", "With search, comma separated stats the maze must have, like rooms>=8,path_length>=200")
+	flag.StringVar(&MinRoom, "min_room", "0x0", "With search, the maze must have a room at least this big, like 10x10 (default 0x0)")
+	flag.IntVar(&SearchLimit, "search_limit", 1000, "With search, how many seeds to try before giving up (default 1000)")
+	flag.IntVar(&BatchSize, "n", 10, "With batch or histogram, how many mazes to generate (default 10)")
+	flag.IntVar(&Parallel, "parallel", 1, "With batch, how many mazes to write at once (default 1)")
+	flag.StringVar(&Histograms, "histograms", "rooms,dead_ends,path_length", "With histogram, comma separated stats to chart (default rooms,dead_ends,path_length)")
+	flag.StringVar(&Record, "record", "", "Write the maze to this golden file, along with every flag that made it")
+	flag.StringVar(&Verify, "verify", "", "Regenerate the maze recorded in this golden file and exit 1 if it comes out different")
+	flag.StringVar(&Grid, "grid", "square", "Grid to carve the maze on: square, hex for a plain maze of hexagons drawn about -width by -height, or polar for a circular one of -height/2 rings (default square)")
+	flag.BoolVar(&Wrap, "wrap", false, "Join the maze's left and right edges, and its top and bottom, so it wraps around; -width and -height are rounded up to even (default false)")
+	flag.BoolVar(&Unicursal, "unicursal", false, "Generate a labyrinth of one unbranching path through the whole maze, with no rooms (default false)")
+	flag.Float64Var(&Bias, "bias", 0, "Favor carving the maze east-west, toward 1 for long galleries, or north-south, toward -1 for deep shafts (default 0)")
+	flag.StringVar(&SymmetryMode, "symmetry", "none", "Carve part of the maze and copy it around the rest: none, mirror, rotate2, or rotate4 for a square maze (default none)")
+	flag.StringVar(&WallStyle, "style", "heavy", "Lines walls are drawn with: single, double, rounded, heavy, or block for solid blocks and dotted floor (default heavy)")
+	flag.BoolVar(&Wide, "wide", false, "Print every cell two columns wide, so the maze is as tall as it is wide on a terminal")
+	flag.BoolVar(&Legend, "legend", false, "Print a legend under the maze saying what each glyph on it stands for")
+	flag.StringVar(&ShapeName, "shape", "rectangle", "Outline to generate the maze inside: rectangle, cross, ring, or diamond (default rectangle)")
+	flag.StringVar(&MaskFile, "mask", "", "Generate the maze inside the white part of this black and white PNG, or the spaces in this text file of spaces and #s, stretched over the whole maze")
+	flag.StringVar(&MapFile, "in", "", "Read the maze from this file, as printed by -format unicode or ascii with the same -theme, instead of generating one")
+	flag.StringVar(&OutDir, "out_dir", ".", "Where -levels and batch write their files (default .)")
+	flag.StringVar(&OutDir, "out", ".", "Alias for -out_dir, as in batch -out dir/ (default .)")
+	flag.StringVar(&ColorMode, "color", "auto", "Draw in color: always, never, or auto, only on a terminal when NO_COLOR isn't set (default auto)")
+	flag.BoolVar(&NoColor, "no_color", false, "Alias for -color never")
+	flag.StringVar(&TilesetFile, "tileset", "", "Draw the maze in the glyphs and colors of this JSON tileset")
+	flag.StringVar(&OutFile, "o", "", "Write the maze, or what the command prints, to this file instead of stdout, leaving animation and progress on the terminal")
+	flag.IntVar(&SceneGrid, "scene_grid", 100, "With -format foundry or uvtt, how many pixels across each cell of the map and its image is (default 100)")
+	flag.StringVar(&SceneImage, "scene_image", "dungeon.png", "With -format foundry or roll20, where to draw the map as a PNG, which the scene expects beside it in Foundry, or to go on the Roll20 page's map layer (default dungeon.png)")
+	flag.Var(seedFlag{&Seed, &SeedName}, "seed", "Seed for the random generator, a number or any name, 0 picks one from the clock (default 0)")
 
 	Width = roundUpToEven(Width) - 1
 	Height = roundUpToEven(Height) - 1
-
-	rand.Seed(time.Now().Unix())
 }
 
 func main() {
-	flag.Parse()
+	if runWASM() {
+		return
+	}
+	// a subcommand goes before the flags, like: dungeon_maze analyze -seed 7
+	command, args := "", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if command == "" && flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+	if Wrap {
+		// with no border, the maze's last row and column of walls are the
+		// first ones over again
+		Width, Height = roundUpToEven(Width), roundUpToEven(Height)
+	}
+	switch command {
+	case "", "generate", "analyze", "validate", "search", "batch", "histogram", "edit", "preview", "serve":
+	default:
+		log.Fatalf("unknown command %q", command)
+	}
+	if NoColor {
+		ColorMode = "never"
+	}
+	if ColorMode != "auto" && ColorMode != "always" && ColorMode != "never" {
+		log.Fatalf("unknown -color %q, want auto, always, or never", ColorMode)
+	}
+
+	// a golden file brings its own flags, so read it before anything uses them
+	var golden string
+	if Verify != "" {
+		f, err := os.Open(Verify)
+		if err != nil {
+			log.Fatal(err)
+		}
+		golden, err = ReadGolden(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", Verify, err)
+		}
+	}
+
+	if Seed == 0 {
+		Seed = time.Now().UnixNano()
+	}
+	if SeedName != "" {
+		log.Printf("seed %q is %d", SeedName, Seed)
+	}
+	src, err := NewSource(RNG, Seed)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var tileset *Tileset
+	if TilesetFile != "" {
+		if tileset, err = ReadTilesetFile(TilesetFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if LoadFile != "" {
+		f, err := os.Open(LoadFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s, p, err := Load(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("loading %s: %v", LoadFile, err)
+		}
+		s.opts.Tileset, s.opts.WallStyle = tileset, WallStyle
+		if command == "edit" {
+			s.opts.NoColor = !wantColor(os.Stdout)
+			Edit(s)
+			return
+		}
+		if p == nil {
+			p = NewPlayer(s.entranceX, s.entranceY)
+		}
+		s.opts.NoColor = !wantColor(os.Stdout)
+		s.Play(p)
+		return
+	}
+
+	theme, err := LookupTheme(ThemeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := flagOptions(theme)
+	if err := opts.check(); err != nil {
+		log.Fatal(err)
+	}
+	opts.Source = src
+	opts.Tileset = tileset
+	if MaskFile != "" {
+		if opts.Mask, err = ReadMaskFile(MaskFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	out := os.Stdout
+	if OutFile != "" {
+		f, err := os.Create(OutFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}()
+		out = f
+	}
+	opts.NoColor = !wantColor(out)
+	framesWritten := func() error { return nil }
+	if FrameDir != "" {
+		var frames Hooks
+		if frames, framesWritten, err = FrameWriter(FrameDir, FrameFormat, FrameSkip, FrameScale); err != nil {
+			log.Fatal(err)
+		}
+		opts.Hooks = opts.Hooks.and(frames)
+	}
+	eventsWritten := func() error { return nil }
+	if Format == "events" {
+		var events Hooks
+		events, eventsWritten = EventWriter(out)
+		opts.Hooks = opts.Hooks.and(events)
+	}
+	var cast *os.File
+	if CastFile != "" {
+		if cast, err = os.Create(CastFile); err != nil {
+			log.Fatal(err)
+		}
+		// the cast is as big as the terminal it's watched on, or else as
+		// the stage with the line the cursor is left on below it
+		var tee io.Writer
+		width, height := Width, Height+1
+		if Animate {
+			tee = os.Stdout
+			if rows, cols := terminalSize(); rows > 0 {
+				width, height = cols, rows
+			}
+		}
+		opts.Animate = NewCastWriter(cast, tee, width, height)
+	}
+
+	switch Grid {
+	case "square":
+	case "hex":
+		// each hexagon is drawn four columns wide and two lines high
+		m := NewHexMaze((Width-1)/4, (Height-1)/2, Algorithm, rand.New(src))
+		if Format == "svg" {
+			err = m.WriteSVG(out, 12)
+		} else {
+			_, err = io.WriteString(out, m.String())
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "polar":
+		m := NewPolarMaze((Height-1)/2, Algorithm, rand.New(src))
+		switch Format {
+		case "svg":
+			err = m.WriteSVG(out, 12)
+		case "png":
+			err = m.WritePNG(out, 12)
+		default:
+			log.Fatalf("polar mazes are drawn as svg or png, not %s", Format)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	default:
+		log.Fatalf("unknown grid %q, want square, hex, or polar", Grid)
+	}
+
+	ctx := context.Background()
+	if Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, Timeout)
+		defer cancel()
+	}
+	if Debug != "" && Debug != "regions" {
+		log.Fatalf("unknown -debug view %q", Debug)
+	}
+
+	if command == "serve" {
+		// players' terminals are their own, whatever this one is
+		opts.NoColor = ColorMode == "never"
+		if TelnetAddr != "" {
+			l, err := net.Listen("tcp", TelnetAddr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			go func() {
+				log.Printf("serving telnet on %s", TelnetAddr)
+				log.Fatal(ServeTelnet(l, opts))
+			}()
+		}
+		if SSHAddr != "" {
+			l, err := net.Listen("tcp", SSHAddr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			go func() {
+				log.Printf("serving SSH on %s", SSHAddr)
+				log.Fatal(ServeSSH(l, opts, HostKey))
+			}()
+		}
+		if GRPCAddr != "" {
+			// gRPC runs over HTTP/2, which is only served over TLS
+			if TLSCert == "" || TLSKey == "" {
+				log.Fatal("-grpc_addr needs -tls_cert and -tls_key")
+			}
+			go func() {
+				log.Printf("serving gRPC on %s", GRPCAddr)
+				log.Fatal(http.ListenAndServeTLS(GRPCAddr, TLSCert, TLSKey, NewGRPCServer(opts)))
+			}()
+		}
+		log.Printf("serving stages on %s", Addr)
+		log.Fatal(http.ListenAndServe(Addr, NewServer(opts)))
+	}
+
+	if command == "preview" {
+		fmt.Fprintln(out, previewFlags(Preview(ctx, opts)))
+		return
+	}
+
+	if command == "analyze" {
+		s := loadOrGenerate(ctx, opts)
+		if err := s.Stats().WriteJSON(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == "search" {
+		criteria, err := ParseCriteria(Where)
+		if err != nil {
+			log.Fatal(err)
+		}
+		roomW, roomH, err := ParseRoomSize(MinRoom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		seed, s, err := SearchSeeds(ctx, opts, Seed, SearchLimit, criteria, roomW, roomH)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(out, "Seed: %d\n", seed)
+		if err := s.Write(out, Format); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == "batch" {
+		if err := WriteBatch(ctx, opts, OutDir, Format, Seed, BatchSize, Parallel); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == "histogram" {
+		all, err := GenerateStats(ctx, opts, Seed, BatchSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dists, err := Distributions(all, strings.Split(Histograms, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if Format == "json" {
+			err = WriteDistributionsJSON(out, dists)
+		} else {
+			err = WriteHistograms(out, dists)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == "validate" {
+		report := loadOrGenerate(ctx, opts).Validate()
+		if err := report.WriteJSON(out); err != nil {
+			log.Fatal(err)
+		}
+		if !report.Valid {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if Levels > 1 {
+		curve, err := ParseDifficultyCurve(Difficulty, Levels)
+		if err != nil {
+			log.Fatal(err)
+		}
+		levels, err := GenerateLevels(ctx, opts, Levels, curve)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := WriteLevels(OutDir, Format, opts.Seed, levels); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// the regions view shows the stage before its rooms were connected too,
+	// kept for every stage tried so only the one picked is shown
+	before := make(map[*Stage]string)
+	if Debug == "regions" {
+		done := opts.Hooks.OnPassComplete
+		opts.Hooks.OnPassComplete = func(s *Stage, pass string) {
+			if pass == "maze" || pass == "chunks" {
+				var b strings.Builder
+				s.PrintRegions(&b, false)
+				before[s] = b.String()
+			}
+			if done != nil {
+				done(s, pass)
+			}
+		}
+	}
+	s := loadOrGenerate(ctx, opts)
+	if err := framesWritten(); err != nil {
+		log.Fatal(err)
+	}
+	if cast != nil {
+		if err := cast.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if Format == "events" {
+		// the events were the output
+		if err := eventsWritten(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// the game is played on the terminal, whatever -o says
+	if command == "edit" {
+		s.opts.NoColor = !wantColor(os.Stdout)
+		Edit(s)
+		return
+	}
+
+	if Play {
+		s.opts.NoColor = !wantColor(os.Stdout)
+		s.Play(NewPlayer(s.entranceX, s.entranceY))
+		return
+	}
+
+	if Debug == "regions" {
+		fmt.Fprintln(out, "Regions before connecting rooms:")
+		fmt.Fprint(out, before[s])
+		fmt.Fprintln(out, "Regions, joined through their doors:")
+		if err := s.PrintRegions(out, true); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	s := NewStage(Width, Height)
-	s.AddRooms()
-	s.FillMaze()
+	if Autoexplore {
+		report := s.Autoexplore()
+		if err := report.WriteJSON(out); err != nil {
+			log.Fatal(err)
+		}
+		if report.Coverage < MinCoverage {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if Verify != "" || Record != "" {
+		var b strings.Builder
+		if err := s.Write(&b, Format); err != nil {
+			log.Fatal(err)
+		}
+		if Verify != "" {
+			if line, got, want := firstDifference(b.String(), golden); line != 0 {
+				fmt.Printf("%s: line %d differs\n want: %s\n  got: %s\n", Verify, line, want, got)
+				os.Exit(1)
+			}
+			fmt.Printf("%s: ok\n", Verify)
+		}
+		if Record != "" {
+			f, err := os.Create(Record)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = WriteGolden(f, b.String())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
 
-	s.PrintUnicode()
+	switch Format {
+	case "minimap":
+		err = s.WriteMinimap(out, Zoom)
+	case "foundry", "roll20":
+		scale := SceneGrid
+		if Format == "roll20" {
+			scale = roll20Square
+		}
+		var f *os.File
+		if f, err = os.Create(SceneImage); err != nil {
+			log.Fatal(err)
+		}
+		err = s.WritePNG(f, scale)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		switch {
+		case err != nil:
+		case Format == "roll20":
+			err = s.WriteRoll20(out, filepath.Base(SceneImage))
+		default:
+			err = s.WriteFoundry(out, SceneGrid, filepath.Base(SceneImage))
+		}
+	case "uvtt":
+		err = s.WriteUVTT(out, SceneGrid)
+	default:
+		err = s.Write(out, Format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-func NewStage(w, h int) *Stage {
-	s := &Stage{width: w, height: h, cell: make(map[int]map[int]Tile)}
+// NewStage returns a w by h stage of solid wall. Every random choice made
+// generating and playing it draws from a stream seeded from src.
+func NewStage(w, h int, src rand.Source) *Stage {
+	s := &Stage{width: w, height: h, cell: make([]Tile, w*h), difficulty: 1, theme: themes["classic"], opts: DefaultOptions(), ctx: context.Background()}
+	s.opts.Width, s.opts.Height, s.opts.Source = w, h, src
+	s.seedStreams(src)
 
-	// init all the cells with a new filled tile (empty defaults to false)
-	for ; w >= 1; w-- {
-		s.cell[w] = make(map[int]Tile)
-		for ; h >= 1; h-- {
-			s.cell[w][h] = Tile{x: w, y: h}
+	// init all the cells with a new filled tile (kind defaults to Wall)
+	for y := 1; y <= h; y++ {
+		for x := 1; x <= w; x++ {
+			s.set(x, y, Tile{x: x, y: y})
 		}
-		h = s.height
 	}
 
 	return s
 }
 
-// cellMask returns four character string "0000" ... "1111"
-// each digit represents if the cell above, below, left, and right are walls (1)
-func (s *Stage) cellMask(x, y int) string {
-	top, right, bottom, left := "0", "0", "0", "0"
+// Bits of a cellMask, set when the cell on that side is a wall
+const (
+	wallLeft = 1 << iota
+	wallBelow
+	wallRight
+	wallAbove
+)
+
+// cellMask returns which of the cells above, right of, below, and left of
+// x, y are walls, as wallAbove, wallRight, wallBelow, and wallLeft bits
+func (s *Stage) cellMask(x, y int) int {
+	mask := 0
+	for _, side := range [4]struct{ dx, dy, bit int }{{0, -1, wallAbove}, {1, 0, wallRight}, {0, 1, wallBelow}, {-1, 0, wallLeft}} {
+		if nx, ny := s.step(x, y, side.dx, side.dy); s.cellExists(nx, ny) && s.at(nx, ny).kind == Wall {
+			mask |= side.bit
+		}
+	}
+	return mask
+}
+
+// wallRunes are the box drawing characters for a wall, indexed by its
+// cellMask. A wall standing alone is drawn as a cross.
+var wallRunes = [16]rune{
+	0:                                 '╋',
+	wallLeft:                          '╸',
+	wallBelow:                         '╻',
+	wallBelow | wallLeft:              '┓',
+	wallRight:                         '╺',
+	wallRight | wallLeft:              '━',
+	wallRight | wallBelow:             '┏',
+	wallRight | wallBelow | wallLeft:  '┳',
+	wallAbove:                         '╹',
+	wallAbove | wallLeft:              '┛',
+	wallAbove | wallBelow:             '┃',
+	wallAbove | wallBelow | wallLeft:  '┫',
+	wallAbove | wallRight:             '┗',
+	wallAbove | wallRight | wallLeft:  '┻',
+	wallAbove | wallRight | wallBelow: '┣',
+	wallAbove | wallRight | wallBelow | wallLeft: '╋',
+}
+
+// step returns the cell dx, dy away from x, y. On a stage that wraps
+// around, stepping off one edge comes back on at the opposite one.
+func (s *Stage) step(x, y, dx, dy int) (int, int) {
+	x, y = x+dx, y+dy
+	if s.opts.Wrap {
+		x = ((x-1)%s.width+s.width)%s.width + 1
+		y = ((y-1)%s.height+s.height)%s.height + 1
+	}
+	return x, y
+}
+
+// cellExists reports if x, y is on the stage
+func (s *Stage) cellExists(x, y int) bool {
+	return x >= 1 && x <= s.width && y >= 1 && y <= s.height
+}
+
+// at returns the tile at x, y, or a zero tile (solid wall) off the stage
+func (s *Stage) at(x, y int) Tile {
+	if !s.cellExists(x, y) {
+		return Tile{}
+	}
+	return s.cell[(y-1)*s.width+x-1]
+}
+
+// set puts t at x, y. Off the stage it does nothing.
+func (s *Stage) set(x, y int, t Tile) {
+	if s.cellExists(x, y) {
+		s.cell[(y-1)*s.width+x-1] = t
+		if s.drawn != nil {
+			s.dirty = append(s.dirty, (y-1)*s.width+x-1)
+		}
+	}
+}
 
-	if s.cellExists(x, y-1) && !s.cell[x][y-1].empty {
-		top = "1"
+// flagOptions returns the options the flags ask for, dressed in theme
+func flagOptions(theme *Theme) Options {
+	opts := Options{
+		Width:           Width,
+		Height:          Height,
+		Seed:            Seed,
+		RNG:             RNG,
+		Algorithm:       Algorithm,
+		Theme:           theme,
+		RoomFillRate:    RoomFillRate,
+		MonsterRate:     MonsterRate,
+		ItemRate:        ItemRate,
+		TrapRate:        TrapRate,
+		ElevationLevels: ElevationLevels,
+		MinDifficulty:   MinDifficulty,
+		Prune:           PruneSteps,
+		ChunkSize:       ChunkSize,
+		Shape:           ShapeName,
+		WallStyle:       WallStyle,
+		Wide:            Wide,
+		Legend:          Legend,
+		Wrap:            Wrap,
+		Unicursal:       Unicursal,
+		Bias:            Bias,
+		Symmetry:        SymmetryMode,
 	}
-	if s.cellExists(x+1, y) && !s.cell[x+1][y].empty {
-		right = "1"
+	if ShowProgress {
+		opts.Hooks = progressBar(os.Stderr)
+	}
+	if Animate {
+		opts.Animate = os.Stdout
+	}
+	if Animate || CastFile != "" {
+		opts.FrameDelay, opts.FrameSkip = Delay, FrameSkip
+		if FPS != 0 {
+			opts.FrameDelay = time.Second / time.Duration(FPS)
+		}
 	}
-	if s.cellExists(x, y+1) && !s.cell[x][y+1].empty {
-		bottom = "1"
+	return opts
+}
+
+// generateStage generates the maze from the options, warning if it couldn't
+// be made as hard as -min_difficulty asks
+func generateStage(ctx context.Context, opts Options) *Stage {
+	s, ok, err := GenerateStage(ctx, opts)
+	if err != nil {
+		log.Fatal(err)
 	}
-	if s.cellExists(x-1, y) && !s.cell[x-1][y].empty {
-		left = "1"
+	if !ok {
+		log.Printf("no maze reached difficulty %.1f in %d tries, using one at %.1f", opts.MinDifficulty, maxLevelTries, s.DifficultyScore())
 	}
+	return s
+}
 
-	return top + right + bottom + left
+// loadOrGenerate returns the stage read from -in, or if there isn't one a
+// stage generated with opts
+func loadOrGenerate(ctx context.Context, opts Options) *Stage {
+	if MapFile == "" {
+		return generateStage(ctx, opts)
+	}
+	text, err := os.ReadFile(MapFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s, err := NewStageFromString(string(text), opts.Theme)
+	if err != nil {
+		log.Fatalf("%s: %v", MapFile, err)
+	}
+	s.opts.NoColor, s.opts.Tileset, s.opts.WallStyle = opts.NoColor, opts.Tileset, opts.WallStyle
+	return s
 }
 
-// cellExists is a DRY way to check into the multidimensional map
-func (s *Stage) cellExists(x, y int) bool {
-	if _, ok := s.cell[x]; !ok {
+// wantColor reports if what's written to f is drawn in color, as -color
+// says: when it's auto, only if f is a terminal and the NO_COLOR environment
+// variable isn't set, as https://no-color.org has it
+func wantColor(f *os.File) bool {
+	switch ColorMode {
+	case "always":
+		return true
+	case "never":
 		return false
 	}
-	if _, ok := s.cell[x][y]; !ok {
+	if os.Getenv("NO_COLOR") != "" {
 		return false
 	}
-	return true
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-// PrintUnicode inspects surrounding cells and determines the correct
-// unicode box drawing character to use
-// If Animate is set to true, it will re-paint by clearing the terminal
-func (s *Stage) PrintUnicode() {
-	if Animate {
-		// erase the terminal and start at the top
-		c, _ := curse.New()
-		c.Move(1, 1)
-		c.EraseAll()
+// clearScreen moves the cursor to the top of the terminal and erases it
+const clearScreen = "\x1b[1;1H\x1b[2J"
+
+// PrintUnicode writes the stage to w drawn with box drawing characters, a
+// row at a time through a buffer so small stages go out in one write. After
+// an animation it is left on the normal screen, below what was there before.
+func (s *Stage) PrintUnicode(w io.Writer) error {
+	return s.Write(w, "unicode")
+}
+
+// glyph returns what to draw at x, y: a monster, then an item, then stairs,
+// then a trap (only found traps unless showHidden is set), then a locked door,
+// then a decoration, and finally the box drawing character for the cell itself
+func (s *Stage) glyph(x, y int, showHidden bool) rune {
+	if m := s.monsterAt(x, y); m != nil {
+		return m.Glyph
 	}
-	for y := 1; y <= s.height; y++ {
-		for x := 1; x <= s.width; x++ {
-			r := ' '
-			if s.cell[x][y].empty {
-				r = ' '
-			} else {
-				switch s.cellMask(x, y) {
-				case "1111":
-					r = '╋'
-				case "0111":
-					r = '┳'
-				case "1011":
-					r = '┫'
-				case "1101":
-					r = '┻'
-				case "1110":
-					r = '┣'
-				case "0011":
-					r = '┓'
-				case "0110":
-					r = '┏'
-				case "0101":
-					r = '━'
-				case "1010":
-					r = '┃'
-				case "1001":
-					r = '┛'
-				case "1100":
-					r = '┗'
-				case "0010":
-					r = '╻'
-				case "0100":
-					r = '╺'
-				case "0001":
-					r = '╸'
-				case "1000":
-					r = '╹'
-				case "0000":
-					r = '╋'
-				default:
-					r = '?'
-				}
-			}
-			fmt.Printf("%c", r)
+	if item := s.itemAt(x, y); item != nil {
+		return item.Glyph
+	}
+	if s.downX != 0 && x == s.downX && y == s.downY {
+		return stairsDownGlyph
+	}
+	if s.upX != 0 && x == s.upX && y == s.upY {
+		return stairsUpGlyph
+	}
+	if t := s.trapAt(x, y); t != nil && (t.found || showHidden) {
+		return trapGlyph
+	}
+	if s.at(x, y).kind == LockedDoor {
+		return lockedDoorGlyph
+	}
+	if d := s.decorationAt(x, y); d != nil {
+		return d.Glyph
+	}
+	return s.unicodeRune(x, y)
+}
+
+// glyphs returns a glyph function that draws the same as glyph, with the
+// monsters, items, traps, and decorations looked up from a map built once so
+// drawing a whole stage doesn't scan every list at every cell
+func (s *Stage) glyphs(showHidden bool) func(x, y int) rune {
+	over := make(map[int]rune)
+	at := func(x, y int, r rune) { over[(y-1)*s.width+x-1] = r }
+	// lowest priority first, and each list backwards, so whatever glyph
+	// would have found first is the one left in the map. Only the first
+	// trap on a cell counts, as with trapAt.
+	for i := len(s.decorations) - 1; i >= 0; i-- {
+		if d := s.decorations[i]; s.at(d.x, d.y).kind != LockedDoor {
+			at(d.x, d.y, d.Glyph)
+		}
+	}
+	trapped := make(map[int]bool)
+	for _, t := range s.traps {
+		if i := (t.y-1)*s.width + t.x - 1; !trapped[i] && (t.found || showHidden) {
+			at(t.x, t.y, trapGlyph)
 		}
-		fmt.Printf("\n")
+		trapped[(t.y-1)*s.width+t.x-1] = true
+	}
+	if s.upX != 0 {
+		at(s.upX, s.upY, stairsUpGlyph)
+	}
+	if s.downX != 0 {
+		at(s.downX, s.downY, stairsDownGlyph)
+	}
+	for i := len(s.items) - 1; i >= 0; i-- {
+		at(s.items[i].x, s.items[i].y, s.items[i].Glyph)
+	}
+	for i := len(s.monsters) - 1; i >= 0; i-- {
+		at(s.monsters[i].x, s.monsters[i].y, s.monsters[i].Glyph)
+	}
+	return func(x, y int) rune {
+		if r, ok := over[(y-1)*s.width+x-1]; ok {
+			return r
+		}
+		if s.at(x, y).kind == LockedDoor {
+			return lockedDoorGlyph
+		}
+		return s.unicodeRune(x, y)
 	}
 }
 
-// Print prints a non-unicode maze. Boring.
-func (s *Stage) Print() {
-	for y := 1; y <= s.height; y++ {
-		for x := 1; x <= s.width; x++ {
-			if s.cell[x][y].empty {
-				fmt.Print(" ")
-			} else {
-				fmt.Printf("%c", '#')
-			}
+// unicodeRune returns the box drawing character for the cell at x, y, or
+// if it is open the feature or terrain on it, a ramp, or the theme's floor glyph
+func (s *Stage) unicodeRune(x, y int) rune {
+	if s.at(x, y).kind != Wall {
+		if f := s.at(x, y).feature; f != NoFeature {
+			return f.Kind().Glyph
+		}
+		if t := s.at(x, y).kind; t.Kind().Terrain {
+			return t.Kind().Glyph
+		}
+		if s.at(x, y).ramp {
+			return rampGlyph
 		}
-		fmt.Printf("\n")
+		return s.floor()
 	}
+	return s.walls()[s.cellMask(x, y)]
 }
 
-// FillMaze changes s.cell values to be empty or not empty and forms a maze
+// Print prints a non-unicode maze to stdout. Boring.
+func (s *Stage) Print() {
+	s.writeRows(os.Stdout, s.asciiRune())
+}
+
+// FillMaze changes cells to be floor or wall and forms a maze
 func (s *Stage) FillMaze() {
 	/*
 		Growing Tree Algorythm - http://www.astrolog.org/labyrnth/algrithm.htm
@@ -186,110 +975,278 @@ func (s *Stage) FillMaze() {
 		The Maze is done when the list becomes empty
 	*/
 
+	// rooms can leave nowhere to start from
+	if !s.uncarvedCell() {
+		return
+	}
+
 	// get init cell
 	var x, y int
-	for x == 0 && y == 0 {
-		x1, y1 := roundUpToEven(rand.Intn(s.width)), roundUpToEven(rand.Intn(s.height))
+	for x == 0 && y == 0 && !s.cancelled() {
+		x1, y1 := roundUpToEven(s.rng.Intn(s.width)), roundUpToEven(s.rng.Intn(s.height))
 		// start on a border
-		if rand.Intn(1) == 1 {
+		if s.rng.Intn(1) == 1 {
 			x = 0
 		} else {
 			y = 0
 		}
-		// cells start filled as walls. empty cells are carved out already
-		if !s.cellExists(x1, y1) || s.cell[x1][y1].empty {
+		// cells start filled as walls. open cells are carved out already
+		if !s.cellExists(x1, y1) || s.at(x1, y1).kind != Wall || s.isEdge(x1, y1) {
 			continue
 		}
 
 		x, y = x1, y1
 	}
 
+	s.growMaze(x, y)
+	// rooms can wall off pockets the maze never grew into, so grow into those
+	// too. With every even cell carved, doorways always have somewhere to
+	// open onto.
+	for y := 2; y <= s.height; y += 2 {
+		for x := 2; x <= s.width; x += 2 {
+			if s.at(x, y).kind == Wall && !s.isEdge(x, y) && !s.cancelled() {
+				s.growMaze(x, y)
+			}
+		}
+	}
+	if s.opts.Animate != nil {
+		s.endAnimation(s.opts.Animate)
+	}
+}
+
+// uncarvedCell reports if any of the even cells the maze can start from is
+// still solid wall
+func (s *Stage) uncarvedCell() bool {
+	for y := 2; y <= s.height; y += 2 {
+		for x := 2; x <= s.width; x += 2 {
+			if s.at(x, y).kind == Wall && !s.isEdge(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// growMaze carves a maze out from x, y through the solid wall around it
+func (s *Stage) growMaze(x, y int) {
 	// clear out the init cell
-	tmpTile := s.cell[x][y]
-	tmpTile.empty = true
-	s.cell[x][y] = tmpTile
-
-	tiles := make([]Tile, 0)
-	tiles = append(tiles, s.cell[x][y])
-	i := 0
-	for len(tiles) > 0 {
-		if Animate {
-			s.PrintUnicode()
-			time.Sleep(time.Millisecond * 20)
+	s.setKind(x, y, Floor)
+
+	var cells frontier
+	cells.push((y-1)*s.width + x - 1)
+	for cells.count > 0 && !s.cancelled() {
+		if s.opts.Animate != nil {
+			if s.carves++; s.opts.FrameSkip <= 1 || s.carves%s.opts.FrameSkip == 0 {
+				s.drawChanges(s.opts.Animate)
+				waitFrame(s.opts.Animate, s.opts.FrameDelay)
+			}
 		}
-		// pick a random cell
-		i = rand.Intn(len(tiles))
+		pos := cells.nth(s.growFrom(cells.count))
+		x, y := cells.cells[pos]%s.width+1, cells.cells[pos]/s.width+1
 
 		// find the next cell to carve out
-		nextX, nextY, middleX, middleY := s.getNextMove(tiles, i)
+		nextX, nextY, middleX, middleY := s.getNextMove(x, y)
 		if nextX == 0 || nextY == 0 || middleX == 0 || middleY == 0 {
 			// no new move found, remove this tile from the list
-			tiles = append(tiles[:i], tiles[i+1:]...)
+			cells.remove(pos)
 			continue
 		}
-		//fmt.Println(tiles)
 		// carve out this cell and add it to the list, and start over
-		if s.cellExists(nextX, nextY) {
-			tmpTile := s.cell[nextX][nextY]
-			tmpTile.empty = true
-			s.cell[nextX][nextY] = tmpTile
-		} else {
-			//fmt.Printf("Now you fucked up.")
-			// tiles = append(tiles[:i], tiles[i+1:]...)
+		if !s.cellExists(nextX, nextY) {
 			continue
 		}
+		s.setKind(nextX, nextY, Floor)
 		// and clear the cell in the middle
 		if s.cellExists(middleX, middleY) {
-			tmpTile := s.cell[middleX][middleY]
-			tmpTile.empty = true
-			s.cell[middleX][middleY] = tmpTile
+			s.setKind(middleX, middleY, Floor)
 		}
 
-		tiles = append(tiles, s.cell[nextX][nextY])
+		cells.push((nextY-1)*s.width + nextX - 1)
 	}
+}
 
-	// if there are rooms, open them up
+// growFrom picks which of the n cells the maze is growing from to carve on
+// from next, as the algorithm option asks
+func (s *Stage) growFrom(n int) int {
+	return growFrom(s.rng, s.opts.Algorithm, n)
+}
+
+// growFrom picks which of the n cells a growing tree is growing from to
+// carve on from next, with the named algorithm
+func growFrom(rng *rand.Rand, algorithm string, n int) int {
+	switch algorithm {
+	case "newest":
+		return n - 1
+	case "oldest":
+		return 0
+	case "mixed":
+		if rng.Intn(2) == 0 {
+			return n - 1
+		}
+	}
+	return rng.Intn(n)
+}
+
+// ConnectRooms opens one or two doorways in the walls of every room, each
+// lined up with a maze cell on the other side, then joins up whatever is
+// still cut off from the rest
+func (s *Stage) ConnectRooms() {
 	for _, room := range s.rooms {
-		for i := 0; i < rand.Intn(2)+1; i++ {
-			side := rand.Intn(4)
-			xSide := rand.Intn(room.width) + room.x
-			ySide := rand.Intn(room.height) + room.y
-			x, y := 0, 0
-			switch side {
-			case 0:
-				x, y = xSide, room.y-1
-			case 1:
-				x, y = room.width+room.x+1, ySide
-			case 2:
-				x, y = xSide, room.height+room.y+1
-			case 3:
-				x, y = room.x-1, ySide
+		spots := s.doorSpots(room)
+		for i := s.rng.Intn(2) + 1; i > 0 && len(spots) > 0; i-- {
+			j := s.rng.Intn(len(spots))
+			x, y := spots[j][0], spots[j][1]
+			spots = append(spots[:j], spots[j+1:]...)
+			s.setKind(x, y, Door)
+			s.doors = append(s.doors, s.at(x, y))
+			s.regionsJoined(x, y)
+		}
+	}
+	s.joinPockets()
+}
+
+// doorSpots returns the walls around room a doorway could go in: on even
+// offsets, so they line up with a maze cell, and with something open on the
+// other side
+func (s *Stage) doorSpots(room Room) [][2]int {
+	var spots [][2]int
+	add := func(x, y, outX, outY int) {
+		outX, outY = s.step(outX, outY, 0, 0)
+		if s.cellExists(x, y) && !s.isEdge(x, y) && s.at(x, y).kind == Wall && s.isOpen(outX, outY) {
+			spots = append(spots, [2]int{x, y})
+		}
+	}
+	for x := room.x; x <= room.x+room.width; x += 2 {
+		add(x, room.y-1, x, room.y-2)
+		add(x, room.y+room.height+1, x, room.y+room.height+2)
+	}
+	for y := room.y; y <= room.y+room.height; y += 2 {
+		add(room.x-1, y, room.x-2, y)
+		add(room.x+room.width+1, y, room.x+room.width+2, y)
+	}
+	return spots
+}
+
+// joinPockets opens walls between the open parts of the stage, picked at
+// random, until every open cell can be reached from every other. Only walls
+// between two even cells are opened, the same as the maze carves, so the
+// stage stays a grid of passages. A wall opened next to a room is a door.
+func (s *Stage) joinPockets() {
+	// label every open cell with the part of the stage it's in
+	label := make([]int, len(s.cell))
+	parts := 0
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			i := (y-1)*s.width + x - 1
+			if !s.isOpen(x, y) || label[i] != 0 {
+				continue
 			}
+			parts++
+			label[i] = parts
+			queue := [][2]int{{x, y}}
+			for len(queue) > 0 {
+				p := queue[0]
+				queue = queue[1:]
+				for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+					nx, ny := s.step(p[0], p[1], d[0], d[1])
+					if j := (ny-1)*s.width + nx - 1; s.isOpen(nx, ny) && label[j] == 0 {
+						label[j] = parts
+						queue = append(queue, [2]int{nx, ny})
+					}
+				}
+			}
+		}
+	}
+	if parts < 2 {
+		return
+	}
 
-			if s.cellExists(x, y) && x != 1 && x != s.width && y != 1 && y != s.height {
-				tmpTile := s.cell[x][y]
-				tmpTile.empty = true
-				s.cell[x][y] = tmpTile
-			} else {
-				i--
+	// walls with a different part on either side, tried in random order.
+	// Only a stage that wraps has any on its outermost cells.
+	type join struct{ x, y, a, b int }
+	var joins []join
+	first := 2
+	if s.opts.Wrap {
+		first = 1
+	}
+	for y := first; y <= s.height-first+1; y++ {
+		for x := first; x <= s.width-first+1; x++ {
+			if s.at(x, y).kind != Wall || x%2 == y%2 || s.isEdge(x, y) {
+				continue
 			}
+			ax, ay := s.step(x, y, -1, 0)
+			bx, by := s.step(x, y, 1, 0)
+			if y%2 == 1 {
+				ax, ay = s.step(x, y, 0, -1)
+				bx, by = s.step(x, y, 0, 1)
+			}
+			if !s.isOpen(ax, ay) || !s.isOpen(bx, by) {
+				continue
+			}
+			a, b := label[(ay-1)*s.width+ax-1], label[(by-1)*s.width+bx-1]
+			if a != b {
+				joins = append(joins, join{x, y, a, b})
+			}
+		}
+	}
+	s.rng.Shuffle(len(joins), func(i, j int) { joins[i], joins[j] = joins[j], joins[i] })
+
+	parent := make([]int, parts+1)
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for _, j := range joins {
+		if parts == 1 || s.cancelled() {
+			return
+		}
+		a, b := find(j.a), find(j.b)
+		if a == b {
+			continue
+		}
+		parent[a] = b
+		parts--
+		if s.nextToRoom(j.x, j.y) {
+			s.setKind(j.x, j.y, Door)
+			s.doors = append(s.doors, s.at(j.x, j.y))
+		} else {
+			s.setKind(j.x, j.y, Floor)
+		}
+		s.regionsJoined(j.x, j.y)
+	}
+}
 
+// nextToRoom reports if any cell beside x, y is in a room
+func (s *Stage) nextToRoom(x, y int) bool {
+	for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+		if _, ok := s.roomAt(x+d[0], y+d[1]); ok {
+			return true
 		}
 	}
+	return false
 }
 
 // getNextMove finds the next cell's x and y. Because we have to clear out
 // two cells, it returns two sets of x,y (the destination cell, and the
 // cell in between)
 //
-//   Ex: we start at cell N, target cell M, and will need to clear O
-//   ####    ####    ####
-//   #N## => #N#M => #NOM
-//   ####    ####    ####
-//   In this way, we eat through the maze. nom nom nom
-func (s *Stage) getNextMove(tiles []Tile, i int) (int, int, int, int) {
+//	Ex: we start at cell N, target cell M, and will need to clear O
+//	####    ####    ####
+//	#N## => #N#M => #NOM
+//	####    ####    ####
+//	In this way, we eat through the maze. nom nom nom
+func (s *Stage) getNextMove(x, y int) (int, int, int, int) {
 	// pick random order (1 up, 2 right, 3 down, 4 left)
-	directions := getRandomIntList(1, 5)
+	directions := getRandomIntList(s.rng, 1, 5)
+	if s.opts.Bias != 0 {
+		directions = biasedDirections(s.rng, s.opts.Bias)
+	}
 	nextX, nextY, middleX, middleY := 0, 0, 0, 0
 
 	for _, direction := range directions {
@@ -305,12 +1262,12 @@ func (s *Stage) getNextMove(tiles []Tile, i int) (int, int, int, int) {
 		case 4:
 			curXAdj -= 2
 		default:
-			log.Printf("error - direction list gave unexpected result ", direction)
+			log.Printf("error - direction list gave unexpected result %d", direction)
 		}
-		nextX = tiles[i].x + curXAdj
-		nextY = tiles[i].y + curYAdj
+		nextX, nextY = s.step(x, y, curXAdj, curYAdj)
+		midX, midY := s.step(x, y, curXAdj/2, curYAdj/2)
 
-		if s.isEdge(nextX, nextY) {
+		if s.isEdge(nextX, nextY) || s.isEdge(midX, midY) {
 			continue
 		}
 
@@ -318,7 +1275,7 @@ func (s *Stage) getNextMove(tiles []Tile, i int) (int, int, int, int) {
 			continue
 		}
 
-		if s.cell[nextX][nextY].empty {
+		if s.at(nextX, nextY).kind != Wall {
 			// todo - is this where logic goes to not collide with rooms?
 			continue
 		}
@@ -327,21 +1284,23 @@ func (s *Stage) getNextMove(tiles []Tile, i int) (int, int, int, int) {
 			continue
 		}
 
-		middleX, middleY = tiles[i].x+curXAdj/2, tiles[i].y+curYAdj/2
+		middleX, middleY = midX, midY
 		break
 	}
 	return nextX, nextY, middleX, middleY
 }
 
+// isEdge reports if x, y is on the stage's solid border: its outermost
+// cells, unless it wraps around, or outside its mask
 func (s *Stage) isEdge(x, y int) bool {
-	if x == 1 || x == s.width || y == 1 || y == s.height {
+	if !s.opts.Wrap && (x == 1 || x == s.width || y == 1 || y == s.height) {
 		return true
 	}
-	return false
+	return s.outside != nil && s.cellExists(x, y) && s.outside[(y-1)*s.width+x-1]
 }
 
 // getRandomIntList returns [start, end) random sorted list of ints
-func getRandomIntList(start, end int) []int {
+func getRandomIntList(rng *rand.Rand, start, end int) []int {
 	r := make([]int, end-start)
 	// populate it with our starting numbers
 	for i, _ := range r {
@@ -349,12 +1308,28 @@ func getRandomIntList(start, end int) []int {
 	}
 	// do some swaps
 	for i, _ := range r {
-		j := rand.Intn(i + 1)
+		j := rng.Intn(i + 1)
 		r[i], r[j] = r[j], r[i]
 	}
 	return r
 }
 
+// biasedDirections orders the directions getNextMove tries like
+// getRandomIntList, but with right and left more likely to come first the
+// closer bias is to 1, and up and down the closer it is to -1. Even at either
+// end the other way is still tried last, so the maze can fill every pocket.
+func biasedDirections(rng *rand.Rand, bias float64) []int {
+	across, down := int(100*(1+bias))+1, int(100*(1-bias))+1
+	r := []int{1, 2, 3, 4}
+	weights := []int{down, across, down, across}
+	for i := range r {
+		j := i + pickWeighted(rng, weights[i:])
+		r[i], r[j] = r[j], r[i]
+		weights[i], weights[j] = weights[j], weights[i]
+	}
+	return r
+}
+
 func roundUpToEven(n int) int {
 	if n%2 == 0 {
 		return n
@@ -363,29 +1338,35 @@ func roundUpToEven(n int) int {
 }
 
 func (s *Stage) AddRooms() {
-	roomVolumeLeft := s.width * s.height * RoomFillRate / 100
+	roomVolumeLeft := s.width * s.height * s.opts.RoomFillRate / 100
 	if roomVolumeLeft == 0 {
 		return
 	}
 
 	// pick some big max just to avoid infinate looping
-	for maxIterations := 10000; maxIterations >= 0; maxIterations-- {
+	for maxIterations := 10000; maxIterations >= 0 && !s.cancelled(); maxIterations-- {
 		room := Room{
-			width:  roundUpToEven(rand.Intn(12) + 3),
-			height: roundUpToEven(rand.Intn(8) + 3),
-			x:      roundUpToEven(rand.Intn(s.width) + 1),
-			y:      roundUpToEven(rand.Intn(s.height) + 1),
+			width:  roundUpToEven(s.rng.Intn(s.scaleDown(12)) + 3),
+			height: roundUpToEven(s.rng.Intn(s.scaleDown(8)) + 3),
+			x:      roundUpToEven(s.rng.Intn(s.width) + 1),
+			y:      roundUpToEven(s.rng.Intn(s.height) + 1),
 		}
 
 		validRoom := true
 		// +/- 1 as padding
 		for x := room.x - 1; x <= room.x+room.width+1; x++ {
 			for y := room.y - 1; y <= room.y+room.height+1; y++ {
-				// cells start filled
-				if x > s.width || y > s.height || s.cell[x][y].empty {
+				// cells start filled. A chunk's rooms stay off its edge, so
+				// the maze can run all the way around them to the seams.
+				if x > s.width || y > s.height || s.at(x, y).kind != Wall || (s.chunk && s.isEdge(x, y)) {
 					validRoom = false
 					continue
 				}
+				// and inside the mask, though its walls can be outside
+				inside := x >= room.x && x <= room.x+room.width && y >= room.y && y <= room.y+room.height
+				if inside && s.isEdge(x, y) {
+					validRoom = false
+				}
 			}
 		}
 
@@ -399,11 +1380,10 @@ func (s *Stage) AddRooms() {
 		for x := room.x; x <= room.x+room.width; x++ {
 			for y := room.y; y <= room.y+room.height; y++ {
 				// cells start filled
-				tmpTile := s.cell[x][y]
-				tmpTile.empty = true
-				s.cell[x][y] = tmpTile
+				s.setKind(x, y, Floor)
 			}
 		}
+		s.roomPlaced(room)
 		roomVolumeLeft -= room.height * room.width
 		if roomVolumeLeft <= 0 {
 			break
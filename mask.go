@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Mask is the outline a stage is generated inside. It is stretched over the
+// whole stage, and cells outside it are left solid like the stage's border,
+// so neither rooms nor the maze reach them.
+type Mask struct {
+	width, height int
+	allowed       []bool // row by row
+}
+
+// ReadPNGMask reads a mask from a black and white PNG: white, or any light
+// color, is where the stage can be generated
+func ReadPNGMask(r io.Reader) (*Mask, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return imageMask(img)
+}
+
+// imageMask returns the mask of img's light pixels
+func imageMask(img image.Image) (*Mask, error) {
+	b := img.Bounds()
+	m := &Mask{width: b.Dx(), height: b.Dy(), allowed: make([]bool, b.Dx()*b.Dy())}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			m.allowed[(y-b.Min.Y)*m.width+x-b.Min.X] = gray.Y >= 128
+		}
+	}
+	return m, m.check()
+}
+
+// ParseMask reads a mask sketched as text: a space is where the stage can
+// be generated and '#' where it can't. Short rows are padded with '#'.
+func ParseMask(text string) (*Mask, error) {
+	rows := strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	m := &Mask{width: width, height: len(rows), allowed: make([]bool, width*len(rows))}
+	for y, row := range rows {
+		for x, c := range []byte(row) {
+			switch c {
+			case ' ':
+				m.allowed[y*width+x] = true
+			case '#':
+			default:
+				return nil, fmt.Errorf("mask row %d has %q at column %d, want ' ' or '#'", y+1, c, x+1)
+			}
+		}
+	}
+	return m, m.check()
+}
+
+// ReadMaskFile reads the mask in the file at path, a PNG or else a text
+// sketch
+func ReadMaskFile(path string) (*Mask, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m *Mask
+	if bytes.HasPrefix(data, []byte("\x89PNG")) {
+		m, err = ReadPNGMask(bytes.NewReader(data))
+	} else {
+		m, err = ParseMask(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// shapes are the built in outlines a stage can be generated in, each
+// reporting if a point is inside it. The stage spans -1 to 1 both ways.
+var shapes = map[string]func(u, v float64) bool{
+	"rectangle": func(u, v float64) bool { return true },
+	"cross":     func(u, v float64) bool { return math.Abs(u) < 0.4 || math.Abs(v) < 0.4 },
+	"diamond":   func(u, v float64) bool { return math.Abs(u)+math.Abs(v) <= 1 },
+	"ring": func(u, v float64) bool {
+		r := u*u + v*v
+		return r <= 1 && r >= 0.2
+	},
+}
+
+// shapeCells returns which cells of a w by h stage are outside the named
+// shape, row by row, or nil for a rectangle
+func shapeCells(name string, w, h int) []bool {
+	if name == "" || name == "rectangle" {
+		return nil
+	}
+	in := shapes[name]
+	outside := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		v := (2*float64(y)+1)/float64(h) - 1
+		for x := 0; x < w; x++ {
+			u := (2*float64(x)+1)/float64(w) - 1
+			outside[y*w+x] = !in(u, v)
+		}
+	}
+	return outside
+}
+
+// check reports if nothing can be generated inside the mask
+func (m *Mask) check() error {
+	for _, ok := range m.allowed {
+		if ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("mask leaves no room to generate in")
+}
+
+// cells returns which cells of a w by h stage are outside the mask, row by
+// row, sampling the pixel each cell's middle falls on
+func (m *Mask) cells(w, h int) []bool {
+	outside := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		my := (2*y + 1) * m.height / (2 * h)
+		for x := 0; x < w; x++ {
+			mx := (2*x + 1) * m.width / (2 * w)
+			outside[y*w+x] = !m.allowed[my*m.width+mx]
+		}
+	}
+	return outside
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// ringPNG returns a w by h PNG that is white except for a black border and
+// a black block in the middle
+func ringPNG(t *testing.T, w, h int) []byte {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			edge := x < w/8 || x >= w-w/8 || y < h/8 || y >= h-h/8
+			middle := x >= w*3/8 && x < w*5/8 && y >= h*3/8 && y < h*5/8
+			if !edge && !middle {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPNGMask(t *testing.T) {
+	m, err := ReadPNGMask(bytes.NewReader(ringPNG(t, 64, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunks := range []int{0, 16} {
+		s, err := New(WithSize(79, 41), WithSeed(6), WithMask(m), WithChunks(chunks))
+		if err != nil {
+			t.Fatal(err)
+		}
+		open := 0
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				if s.isEdge(x, y) && s.at(x, y).kind != Wall {
+					t.Fatalf("chunks %d: %d,%d is open outside the mask:\n%s", chunks, x, y, s.ASCII())
+				}
+				if s.isOpen(x, y) {
+					open++
+				}
+			}
+		}
+		if open < s.width*s.height/4 {
+			t.Errorf("chunks %d: only %d cells open inside the mask:\n%s", chunks, open, s.ASCII())
+		}
+		if chunks == 0 {
+			if report := s.Validate(); !report.Valid {
+				t.Errorf("%v\n%s", report.Failures, s.ASCII())
+			}
+		}
+	}
+}
+
+func TestReadPNGMaskRejects(t *testing.T) {
+	if _, err := ReadPNGMask(bytes.NewReader([]byte("not a png"))); err == nil {
+		t.Errorf("read a mask from garbage")
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)))
+	if _, err := ReadPNGMask(&buf); err == nil {
+		t.Errorf("read an all black mask")
+	}
+}
+
+func TestParseMask(t *testing.T) {
+	m, err := ParseMask("#####\n#   #\n# # \n#   #\n#####\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "#####\n#   #\n# # #\n#   #\n#####\n"
+	var got strings.Builder
+	for y := 0; y < m.height; y++ {
+		for x := 0; x < m.width; x++ {
+			if m.allowed[y*m.width+x] {
+				got.WriteByte(' ')
+			} else {
+				got.WriteByte('#')
+			}
+		}
+		got.WriteByte('\n')
+	}
+	if got.String() != want {
+		t.Errorf("mask came out as\n%swant\n%s", got.String(), want)
+	}
+
+	s, err := New(WithSize(41, 21), WithSeed(2), WithMask(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := s.Validate(); !report.Valid {
+		t.Errorf("%v\n%s", report.Failures, s.ASCII())
+	}
+	if s.isOpen(21, 11) {
+		t.Errorf("the middle of the ring is open:\n%s", s.ASCII())
+	}
+
+	for _, text := range []string{"", "###\n###\n", "# .#\n"} {
+		if _, err := ParseMask(text); err == nil {
+			t.Errorf("ParseMask(%q) gave no error", text)
+		}
+	}
+}
+
+func TestShapes(t *testing.T) {
+	for name := range shapes {
+		s, err := New(WithSize(61, 31), WithSeed(4), WithShape(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report := s.Validate(); !report.Valid {
+			t.Errorf("%s: %v\n%s", name, report.Failures, s.ASCII())
+		}
+		if name != "rectangle" && s.isOpen(2, 2) {
+			t.Errorf("%s: the corner is open:\n%s", name, s.ASCII())
+		}
+	}
+	if s, _ := New(WithSize(61, 31), WithSeed(4), WithShape("ring")); s.isOpen(31, 16) {
+		t.Errorf("the middle of the ring is open:\n%s", s.ASCII())
+	}
+	if _, err := New(WithShape("hexagon")); err == nil {
+		t.Errorf("generated an unknown shape")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// served keeps the metrics for every stage generated to serve, over
+// whichever protocol, for /metrics
+var served = newServeMetrics()
+
+// secondsBuckets are the upper bounds of the histograms of how long
+// generating takes, and cellsBuckets of the ones of how big stages are
+var (
+	secondsBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	cellsBuckets   = []float64{100, 1000, 2500, 10000, 25000, 100000, 250000, 1000000}
+)
+
+// serveMetrics counts the stages generated to serve, by endpoint and
+// whether it worked, and keeps histograms of how long they and each of
+// their passes took and how many cells they have
+type serveMetrics struct {
+	mu         sync.Mutex
+	generated  map[[2]string]int64
+	seconds    map[string]*histogram
+	passes     map[string]*histogram
+	cells      *histogram
+	passStarts map[*Stage]time.Time
+}
+
+// newServeMetrics returns metrics with nothing generated yet
+func newServeMetrics() *serveMetrics {
+	return &serveMetrics{
+		generated:  make(map[[2]string]int64),
+		seconds:    make(map[string]*histogram),
+		passes:     make(map[string]*histogram),
+		cells:      newHistogram(cellsBuckets),
+		passStarts: make(map[*Stage]time.Time),
+	}
+}
+
+// generate generates a stage from opts to serve at endpoint, counting it
+// and timing it and its passes
+func (m *serveMetrics) generate(ctx context.Context, opts Options, endpoint string) (*Stage, error) {
+	var stages []*Stage
+	opts.Hooks = opts.Hooks.and(Hooks{
+		OnProgress: func(s *Stage, p Progress) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			// it's called again as the stage is carved, not just as the pass
+			// starts
+			if _, ok := m.passStarts[s]; !ok {
+				m.passStarts[s] = time.Now()
+				stages = append(stages, s)
+			}
+		},
+		OnPassComplete: func(s *Stage, pass string) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if start, ok := m.passStarts[s]; ok {
+				m.histogram(m.passes, pass, secondsBuckets).observe(time.Since(start).Seconds())
+				delete(m.passStarts, s)
+			}
+		},
+	})
+	start := time.Now()
+	s, _, err := GenerateStage(ctx, opts)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.generated[[2]string{endpoint, result}]++
+	m.histogram(m.seconds, endpoint, secondsBuckets).observe(time.Since(start).Seconds())
+	if err == nil {
+		m.cells.observe(float64(s.width * s.height))
+	}
+	// stages given up on leave their last pass unfinished
+	for _, stage := range stages {
+		delete(m.passStarts, stage)
+	}
+	return s, err
+}
+
+// histogram returns the histogram for label in hs, adding one with buckets
+// if there isn't one
+func (m *serveMetrics) histogram(hs map[string]*histogram, label string, buckets []float64) *histogram {
+	h := hs[label]
+	if h == nil {
+		h = newHistogram(buckets)
+		hs[label] = h
+	}
+	return h
+}
+
+// ServeHTTP writes the metrics in Prometheus's text format
+func (m *serveMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in Prometheus's text format
+func (m *serveMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("# HELP dungeon_maze_stages_generated_total Stages generated to serve, by endpoint and result.\n")
+	b.WriteString("# TYPE dungeon_maze_stages_generated_total counter\n")
+	var keys [][2]string
+	for k := range m.generated {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "dungeon_maze_stages_generated_total{endpoint=%q,result=%q} %d\n", k[0], k[1], m.generated[k])
+	}
+	writeHistograms(&b, "dungeon_maze_generate_seconds", "Seconds taken to generate a stage to serve, by endpoint.", "endpoint", m.seconds)
+	writeHistograms(&b, "dungeon_maze_pass_seconds", "Seconds taken by each pipeline pass of stages generated to serve.", "pass", m.passes)
+	writeHistograms(&b, "dungeon_maze_stage_cells", "Cells in the stages generated to serve.", "", map[string]*histogram{"": m.cells})
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// histogram counts observations into buckets, each upper bound inclusive
+type histogram struct {
+	bounds []float64
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+// newHistogram returns an empty histogram with bounds, in increasing order
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int64, len(bounds))}
+}
+
+// observe counts v
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// writeHistograms writes the histograms hs called name to b, each with its
+// key for label, or none if label is ""
+func writeHistograms(b *strings.Builder, name, help, label string, hs map[string]*histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var labels []string
+	for l := range hs {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		h := hs[l]
+		prefix := ""
+		if label != "" {
+			prefix = fmt.Sprintf("%s=%q,", label, l)
+		}
+		cumulative := int64(0)
+		for i, bound := range h.bounds {
+			cumulative += h.counts[i]
+			fmt.Fprintf(b, "%s_bucket{%sle=\"%g\"} %d\n", name, prefix, bound, cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket{%sle=\"+Inf\"} %d\n", name, prefix, h.count)
+		prefix = strings.TrimSuffix(prefix, ",")
+		if prefix != "" {
+			prefix = "{" + prefix + "}"
+		}
+		fmt.Fprintf(b, "%s_sum%s %g\n%s_count%s %d\n", name, prefix, h.sum, name, prefix, h.count)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeMetrics(t *testing.T) {
+	m := newServeMetrics()
+	opts := DefaultOptions()
+	opts.Width, opts.Height = 31, 15
+	if _, err := m.generate(context.Background(), opts.seeded(7), "dungeon"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.generate(ctx, opts.seeded(7), "ssh"); err == nil {
+		t.Error("generating with a cancelled context worked")
+	}
+
+	var b strings.Builder
+	m.WriteTo(&b)
+	got := b.String()
+	for _, want := range []string{
+		`dungeon_maze_stages_generated_total{endpoint="dungeon",result="ok"} 1`,
+		`dungeon_maze_stages_generated_total{endpoint="ssh",result="error"} 1`,
+		`dungeon_maze_generate_seconds_bucket{endpoint="dungeon",le="+Inf"} 1`,
+		`dungeon_maze_generate_seconds_count{endpoint="ssh"} 1`,
+		`dungeon_maze_pass_seconds_count{pass="rooms"} 1`,
+		`dungeon_maze_stage_cells_bucket{le="1000"} 1`,
+		"dungeon_maze_stage_cells_sum 465\n",
+		"# TYPE dungeon_maze_pass_seconds histogram\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics have no %s in\n%s", want, got)
+		}
+	}
+	if len(m.passStarts) != 0 {
+		t.Errorf("%d passes are left timing", len(m.passStarts))
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	srv := httptest.NewServer(NewServer(DefaultOptions()))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/dungeon?width=31&height=15&seed=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	res, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("metrics are served as %q", res.Header.Get("Content-Type"))
+	}
+	// other tests generate too
+	if !strings.Contains(string(body), `dungeon_maze_stages_generated_total{endpoint="dungeon",result="ok"} `) {
+		t.Errorf("no stages generated for /dungeon in\n%s", body)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{1, 10})
+	for _, v := range []float64{0.5, 1, 5, 50} {
+		h.observe(v)
+	}
+	var b strings.Builder
+	writeHistograms(&b, "h", "A histogram.", "", map[string]*histogram{"": h})
+	want := `# HELP h A histogram.
+# TYPE h histogram
+h_bucket{le="1"} 2
+h_bucket{le="10"} 3
+h_bucket{le="+Inf"} 4
+h_sum 56.5
+h_count 4
+`
+	if b.String() != want {
+		t.Errorf("histogram is\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// minimapShades are drawn for blocks of cells from all wall to all open
+var minimapShades = []rune{'█', '▓', '▒', '░', ' '}
+
+// WriteMinimap writes an overview of the stage to w, each character standing
+// for a zoom by zoom block of cells: shaded darker the more of it is wall,
+// with the stairs and entrance drawn where they are.
+func (s *Stage) WriteMinimap(w io.Writer, zoom int) error {
+	if zoom < 1 {
+		return fmt.Errorf("zoom must be at least 1, got %d", zoom)
+	}
+	b := bufio.NewWriter(w)
+	for _, row := range s.minimap(zoom, 0, 0) {
+		b.WriteString(row)
+		b.WriteByte('\n')
+	}
+	return b.Flush()
+}
+
+// minimap draws the overview WriteMinimap writes, a row to a string, with
+// '@' on the block holding x, y unless it's 0, 0
+func (s *Stage) minimap(zoom, x, y int) []string {
+	var rows []string
+	for by := 1; by <= s.height; by += zoom {
+		var row strings.Builder
+		for bx := 1; bx <= s.width; bx += zoom {
+			open, cells := 0, 0
+			var mark rune
+			for cy := by; cy < by+zoom && cy <= s.height; cy++ {
+				for cx := bx; cx < bx+zoom && cx <= s.width; cx++ {
+					cells++
+					if s.isOpen(cx, cy) {
+						open++
+					}
+					switch {
+					case cx == x && cy == y:
+						mark = '@'
+					case mark == '@':
+					case s.isStairs(cx, cy):
+						mark = s.at(cx, cy).kind.Kind().Glyph
+					case mark == 0 && cx == s.entranceX && cy == s.entranceY:
+						mark = '*'
+					}
+				}
+			}
+			if mark == 0 {
+				mark = minimapShades[open*(len(minimapShades)-1)/cells]
+			}
+			row.WriteRune(mark)
+		}
+		rows = append(rows, row.String())
+	}
+	return rows
+}
+
+// overlayMinimap draws an overview of the stage over the top right corner of
+// a rows by cols terminal, zoomed out to fit a quarter of its width and a
+// third of its height, with '@' on x, y
+func (s *Stage) overlayMinimap(w io.Writer, rows, cols, x, y int) {
+	if rows <= 0 || cols <= 0 {
+		return
+	}
+	zoom := 2
+	for zoom < s.width+s.height && ((s.width+zoom-1)/zoom > cols/4 || (s.height+zoom-1)/zoom > rows/3) {
+		zoom++
+	}
+	lines := s.minimap(zoom, x, y)
+	width := len([]rune(lines[0]))
+	// a border on the left and below keeps it apart from the stage
+	for i, line := range lines {
+		fmt.Fprintf(w, "\x1b[%d;%dH│%s", i+1, cols-width, line)
+	}
+	fmt.Fprintf(w, "\x1b[%d;%dH└%s", len(lines)+1, cols-width, strings.Repeat("─", width))
+}
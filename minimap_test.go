@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWriteMinimap(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := s.WriteMinimap(&b, 4); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	// 79x21 cells in 4x4 blocks
+	if len(rows) != 6 {
+		t.Errorf("%d rows, want 6", len(rows))
+	}
+	for _, row := range rows {
+		if n := utf8.RuneCountInString(row); n != 20 {
+			t.Errorf("row %q is %d wide, want 20", row, n)
+		}
+	}
+	if !strings.ContainsRune(b.String(), '*') {
+		t.Error("no entrance on the minimap")
+	}
+
+	// each cell its own block is just wall or not
+	s.entranceX, s.entranceY, s.upX, s.downX = 0, 0, 0, 0
+	for y, row := range s.minimap(1, 0, 0) {
+		for x, r := range []rune(row) {
+			if want := s.isOpen(x+1, y+1); (r == ' ') != want {
+				t.Fatalf("(%d, %d) is %q on the minimap", x+1, y+1, r)
+			}
+		}
+	}
+	if err := s.WriteMinimap(&b, 0); err == nil {
+		t.Error("wrote a minimap zoomed to 0")
+	}
+}
+
+func TestOverlayMinimap(t *testing.T) {
+	s, err := New(WithSeed(1), WithSize(201, 101))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	s.overlayMinimap(&b, 24, 80, s.entranceX, s.entranceY)
+	lines := strings.Count(b.String(), "\x1b[")
+	if lines > 24/3+1 {
+		t.Errorf("minimap is %d lines, more than a third of the screen", lines)
+	}
+	if !strings.ContainsRune(b.String(), '@') {
+		t.Error("no @ on the minimap")
+	}
+}
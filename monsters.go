@@ -0,0 +1,226 @@
+package main
+
+import "math/rand"
+
+// MonsterKind describes a type of monster that can be stocked in the dungeon
+type MonsterKind struct {
+	Name   string
+	Glyph  rune
+	Weight int // relative chance of being picked
+	Depth  int // minimum percent of the way from the entrance to the farthest cell
+	Sight  int // how many steps away the monster notices the player
+	HP     int
+	Attack int // most damage dealt by one hit
+}
+
+type Monster struct {
+	MonsterKind
+	x, y int
+	hp   int
+}
+
+var monsterTable = []MonsterKind{
+	{Name: "rat", Glyph: 'r', Weight: 10, Depth: 0, Sight: 4, HP: 3, Attack: 1},
+	{Name: "goblin", Glyph: 'g', Weight: 8, Depth: 20, Sight: 6, HP: 6, Attack: 2},
+	{Name: "orc", Glyph: 'o', Weight: 5, Depth: 40, Sight: 8, HP: 10, Attack: 3},
+	{Name: "troll", Glyph: 'T', Weight: 2, Depth: 70, Sight: 10, HP: 20, Attack: 5},
+}
+
+// PlaceEntrance picks where the player enters the dungeon: the center of the
+// first room, or the first open cell if there are no rooms
+func (s *Stage) PlaceEntrance() {
+	if len(s.rooms) > 0 {
+		room := s.rooms[0]
+		s.entranceX, s.entranceY = room.x+room.width/2, room.y+room.height/2
+		return
+	}
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if s.isOpen(x, y) {
+				s.entranceX, s.entranceY = x, y
+				return
+			}
+		}
+	}
+}
+
+// AddMonsters stocks the open cells with monsters. Rooms are favored over
+// corridors, and cells far from the entrance are both more likely to get a
+// monster and more likely to get a nasty one.
+func (s *Stage) AddMonsters() {
+	dist := s.DistanceMap(s.entranceX, s.entranceY)
+	open, maxDist := reach(dist)
+
+	count := s.scaledPercent(open, s.opts.MonsterRate)
+	if count == 0 {
+		return
+	}
+
+	// weight every candidate cell, keeping the area around the entrance clear
+	candidates := make([]Tile, 0, open)
+	weights := make([]int, 0, open)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			d, ok := dist.At(x, y)
+			if !ok || d < 5 || s.isStairs(x, y) || !s.onGround(x, y) {
+				continue
+			}
+			w := 10 + 30*d/maxDist
+			if _, ok := s.roomAt(x, y); ok {
+				w *= 3
+			}
+			candidates = append(candidates, s.at(x, y))
+			weights = append(weights, w)
+		}
+	}
+
+	bag := newWeightedBag(weights)
+	for ; count > 0 && bag.left > 0; count-- {
+		t := candidates[bag.pick(s.rng)]
+		d, _ := dist.At(t.x, t.y)
+		kind := s.pickMonsterKind(100 * d / maxDist)
+		s.monsters = append(s.monsters, &Monster{MonsterKind: kind, x: t.x, y: t.y, hp: kind.HP})
+	}
+}
+
+// pickMonsterKind chooses a monster from the theme allowed at the given depth percent
+func (s *Stage) pickMonsterKind(depth int) MonsterKind {
+	kinds := make([]MonsterKind, 0, len(s.theme.Monsters))
+	weights := make([]int, 0, len(s.theme.Monsters))
+	for _, k := range s.theme.Monsters {
+		if k.Depth <= depth {
+			kinds = append(kinds, k)
+			weights = append(weights, k.Weight)
+		}
+	}
+	return kinds[pickWeighted(s.rng, weights)]
+}
+
+// MoveMonsters gives every monster a turn. Monsters next to the player attack,
+// monsters that can see the player (by walking distance) chase them along the
+// cheapest way there, and everyone else wanders. It returns what the player
+// saw happen.
+func (s *Stage) MoveMonsters(p *Player) string {
+	message := ""
+	dist := s.DistanceMap(p.x, p.y)
+	cost := s.CostMap(p.x, p.y)
+	for _, m := range s.monsters {
+		if d, found := dist.At(m.x, m.y); found && d == 1 {
+			message += s.MonsterAttack(m, p)
+			continue
+		}
+		x, y, ok := m.x, m.y, false
+		if d, found := dist.At(m.x, m.y); found && d <= m.Sight {
+			x, y, ok = s.StepToward(m.x, m.y, cost)
+		} else if s.rng.Intn(2) == 0 {
+			neighbors := s.openNeighbors(m.x, m.y)
+			if len(neighbors) > 0 {
+				n := neighbors[s.rng.Intn(len(neighbors))]
+				x, y, ok = n.x, n.y, true
+			}
+		}
+		if !ok || (x == p.x && y == p.y) || s.monsterAt(x, y) != nil {
+			continue
+		}
+		m.x, m.y = x, y
+	}
+	return message
+}
+
+// monsterAt returns the monster standing at x, y, or nil
+func (s *Stage) monsterAt(x, y int) *Monster {
+	for _, m := range s.monsters {
+		if m.x == x && m.y == y {
+			return m
+		}
+	}
+	return nil
+}
+
+// roomAt returns the room containing x, y
+func (s *Stage) roomAt(x, y int) (Room, bool) {
+	if !s.cellExists(x, y) {
+		return Room{}, false
+	}
+	s.indexRooms()
+	if r := s.roomIndex[(y-1)*s.width+x-1]; r > 0 {
+		return s.rooms[r-1], true
+	}
+	return Room{}, false
+}
+
+// indexRooms adds any rooms appended since it last ran to the room index.
+// Rooms are only ever appended, so anything that moves or drops them has to
+// call roomsMoved.
+func (s *Stage) indexRooms() {
+	if len(s.rooms) < s.roomsIndexed {
+		s.roomsMoved()
+	}
+	if s.roomIndex == nil {
+		s.roomIndex = make([]int32, len(s.cell))
+		s.roomBuckets = make([][]int32, s.bucketsAcross()*s.bucketsDown())
+	}
+	for ; s.roomsIndexed < len(s.rooms); s.roomsIndexed++ {
+		room := s.rooms[s.roomsIndexed]
+		s.bucketRoom(room, int32(s.roomsIndexed+1))
+		for y := room.y; y <= room.y+room.height; y++ {
+			for x := room.x; x <= room.x+room.width; x++ {
+				// the first room a cell is in is the one it belongs to
+				if i := (y-1)*s.width + x - 1; s.cellExists(x, y) && s.roomIndex[i] == 0 {
+					s.roomIndex[i] = int32(s.roomsIndexed + 1)
+				}
+			}
+		}
+	}
+}
+
+// roomsMoved throws away the room index, to be built again from scratch
+func (s *Stage) roomsMoved() {
+	s.roomIndex, s.roomBuckets, s.roomsIndexed = nil, nil, 0
+}
+
+// pickWeighted returns a random index into weights, with each index as
+// likely as its weight
+func pickWeighted(rng *rand.Rand, weights []int) int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	n := rng.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(weights) - 1
+}
+
+// weightedBag picks indexes into weights the way pickWeighted does, but
+// without putting them back: each pick is the one pickWeighted would make if
+// the ones picked before had been cut out of the list. Picks take log time
+// rather than a pass over every weight.
+type weightedBag struct {
+	weights []int
+	tree    fenwick
+	total   int
+	left    int
+}
+
+func newWeightedBag(weights []int) *weightedBag {
+	b := &weightedBag{weights: weights, tree: newFenwick(weights), left: len(weights)}
+	for _, w := range weights {
+		b.total += w
+	}
+	return b
+}
+
+// pick returns a random index still in the bag, as likely as its weight,
+// and takes it out
+func (b *weightedBag) pick(rng *rand.Rand) int {
+	i := b.tree.find(rng.Intn(b.total))
+	b.tree.add(i, -b.weights[i])
+	b.total -= b.weights[i]
+	b.left--
+	return i
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Options are the settings a stage is generated with. Source is what every
+// random choice draws from; when it is nil one is made from Seed using the
+// RNG backend, and a Seed of 0 picks one from the clock. Pipeline is the passes
+// the stage is generated with; when nil, DefaultPipeline is used, which
+// splits stages bigger than ChunkSize into chunks carved in parallel. Hooks
+// are called as it takes shape, and when Animate is set the maze is drawn to
+// it as it grows, a frame every FrameSkip carves, 0 meaning every one, with
+// a pause of FrameDelay after each. Shape is the built in outline the stage is generated inside,
+// and Mask, when set, one of its own; cells outside either are left solid.
+// When Wrap is set the stage has no border: its left and right edges, and its
+// top and bottom, are joined, for worlds that wrap around. When Unicursal is
+// set the stage is a labyrinth of one unbranching path instead of rooms and a
+// maze. Bias, from -1 to 1, favors carving the maze north-south or east-west.
+// Symmetry, when set, is how the stage's layout is copied around it: mirror,
+// rotate2, or rotate4. WallStyle is how walls are drawn: heavy, the default,
+// single, rounded, double, or block, and Wide draws every cell two columns
+// wide, so stages print as tall as they are wide. Legend follows a printed
+// stage with what everything drawn on it is. NoColor draws the stage without colors, and
+// Tileset, when set, in its glyphs and colors.
+type Options struct {
+	Width, Height   int
+	Seed            int64
+	RNG             string
+	Source          rand.Source
+	Algorithm       string
+	Theme           *Theme
+	RoomFillRate    int
+	MonsterRate     int
+	ItemRate        int
+	TrapRate        int
+	ElevationLevels int
+	MinDifficulty   float64
+	Prune           int
+	ChunkSize       int
+	Pipeline        Pipeline
+	Hooks           Hooks
+	Animate         io.Writer
+	FrameDelay      time.Duration
+	FrameSkip       int
+	Shape           string
+	Mask            *Mask
+	Wrap            bool
+	Unicursal       bool
+	Bias            float64
+	Symmetry        string
+	WallStyle       string
+	Wide            bool
+	Legend          bool
+	NoColor         bool
+	Tileset         *Tileset
+}
+
+// An Option changes one of the Options a stage is generated with
+type Option func(*Options)
+
+// DefaultOptions are the options New starts from, the same as the command
+// line's defaults
+func DefaultOptions() Options {
+	return Options{
+		Width:           79,
+		Height:          21,
+		RNG:             "go",
+		Algorithm:       "random",
+		Theme:           themes["classic"],
+		RoomFillRate:    20,
+		MonsterRate:     2,
+		ItemRate:        1,
+		TrapRate:        3,
+		ElevationLevels: 1,
+		FrameDelay:      20 * time.Millisecond,
+	}
+}
+
+// algorithms are the ways the growing tree can pick which cell to grow from
+// next: random grows evenly in every direction, newest runs off in long
+// winding passages, oldest fans out from where it started, and mixed picks
+// the newest half the time and any other half
+var algorithms = map[string]bool{"random": true, "newest": true, "oldest": true, "mixed": true}
+
+// WithSize sets the stage's width and height in cells
+func WithSize(w, h int) Option {
+	return func(o *Options) { o.Width, o.Height = w, h }
+}
+
+// WithSeed sets the seed the stage's random choices start from
+func WithSeed(seed int64) Option {
+	return func(o *Options) { o.Seed = seed }
+}
+
+// WithRNG sets the random number generator backend seeded with the seed:
+// go, pcg, or xoshiro
+func WithRNG(backend string) Option {
+	return func(o *Options) { o.RNG = backend }
+}
+
+// WithSource makes the stage draw from src instead of a source made from
+// the seed
+func WithSource(src rand.Source) Option {
+	return func(o *Options) { o.Source = src }
+}
+
+// WithAlgorithm sets how the maze picks the next cell to grow from: random,
+// newest, oldest, or mixed
+func WithAlgorithm(name string) Option {
+	return func(o *Options) { o.Algorithm = name }
+}
+
+// WithTheme sets the theme the stage is dressed in
+func WithTheme(theme *Theme) Option {
+	return func(o *Options) { o.Theme = theme }
+}
+
+// WithRoomFillRate sets the minimum percent of the stage given to rooms
+func WithRoomFillRate(percent int) Option {
+	return func(o *Options) { o.RoomFillRate = percent }
+}
+
+// WithStocking sets the percent of open tiles stocked with monsters and
+// scattered with items, and of corridor tiles and doorways trapped
+func WithStocking(monsters, items, traps int) Option {
+	return func(o *Options) { o.MonsterRate, o.ItemRate, o.TrapRate = monsters, items, traps }
+}
+
+// WithElevationLevels sets how many heights the floor is given; 1 keeps it
+// flat
+func WithElevationLevels(n int) Option {
+	return func(o *Options) { o.ElevationLevels = n }
+}
+
+// WithMinDifficulty regenerates the stage until its difficulty score is at
+// least score
+func WithMinDifficulty(score float64) Option {
+	return func(o *Options) { o.MinDifficulty = score }
+}
+
+// WithPrune trims steps cells off the end of every dead end corridor
+func WithPrune(steps int) Option {
+	return func(o *Options) { o.Prune = steps }
+}
+
+// WithChunks has the default pipeline split stages bigger than size by size
+// into chunks of that size, carved in parallel
+func WithChunks(size int) Option {
+	return func(o *Options) { o.ChunkSize = size }
+}
+
+// WithPipeline generates the stage with p's passes instead of the default
+// pipeline
+func WithPipeline(p Pipeline) Option {
+	return func(o *Options) { o.Pipeline = p }
+}
+
+// WithHooks calls h as the stage is generated
+func WithHooks(h Hooks) Option {
+	return func(o *Options) { o.Hooks = h }
+}
+
+// WithShape generates the stage inside a built in outline: rectangle, cross,
+// ring, or diamond
+func WithShape(name string) Option {
+	return func(o *Options) { o.Shape = name }
+}
+
+// WithMask generates the stage inside m's outline
+func WithMask(m *Mask) Option {
+	return func(o *Options) { o.Mask = m }
+}
+
+// WithWrap joins the stage's opposite edges, so the maze, and anything
+// walking it, can go off one side and come back on the other
+func WithWrap() Option {
+	return func(o *Options) { o.Wrap = true }
+}
+
+// WithUnicursal generates a labyrinth of a single path through the whole
+// stage, with no rooms and no branches
+func WithUnicursal() Option {
+	return func(o *Options) { o.Unicursal = true }
+}
+
+// WithBias favors carving the maze east-west, the closer bias is to 1, or
+// north-south, the closer it is to -1
+func WithBias(bias float64) Option {
+	return func(o *Options) { o.Bias = bias }
+}
+
+// WithSymmetry carves part of the stage and copies it around the rest: mirror
+// flips the left half onto the right, rotate2 turns it halfway round, and
+// rotate4 turns the top left quarter of a square stage onto each other quarter
+func WithSymmetry(mode string) Option {
+	return func(o *Options) { o.Symmetry = mode }
+}
+
+// WithWallStyle draws walls with single, double, rounded, or heavy lines, or
+// as solid blocks
+func WithWallStyle(style string) Option {
+	return func(o *Options) { o.WallStyle = style }
+}
+
+// WithWide draws every cell two columns wide, so the stage prints with
+// square proportions in a terminal, where characters are twice as tall as
+// they're wide
+func WithWide() Option {
+	return func(o *Options) { o.Wide = true }
+}
+
+// WithLegend follows the stage, when written, with a legend saying what
+// each glyph drawn on it stands for
+func WithLegend() Option {
+	return func(o *Options) { o.Legend = true }
+}
+
+// WithAnimation draws the maze to the terminal w as it grows
+func WithAnimation(w io.Writer) Option {
+	return func(o *Options) { o.Animate = w }
+}
+
+// WithFrameRate draws a frame of the animation every skip carves, and waits
+// delay after each
+func WithFrameRate(delay time.Duration, skip int) Option {
+	return func(o *Options) { o.FrameDelay, o.FrameSkip = delay, skip }
+}
+
+// New generates a stage with the default options changed by opts. If no
+// stage reaches the minimum difficulty the hardest one tried is returned.
+func New(opts ...Option) (*Stage, error) {
+	return NewContext(context.Background(), opts...)
+}
+
+// NewContext is New, giving up with ctx's error once ctx is cancelled
+func NewContext(ctx context.Context, opts ...Option) (*Stage, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.check(); err != nil {
+		return nil, err
+	}
+	if o.Source == nil {
+		if o.Seed == 0 {
+			o.Seed = time.Now().UnixNano()
+		}
+		o = o.seeded(o.Seed)
+	}
+	s, _, err := GenerateStage(ctx, o)
+	return s, err
+}
+
+// check reports the first option that can't be generated with
+func (o Options) check() error {
+	switch {
+	case o.Width < 3 || o.Height < 3:
+		return fmt.Errorf("stage must be at least 3x3, got %dx%d", o.Width, o.Height)
+	case o.Theme == nil:
+		return fmt.Errorf("no theme")
+	case !algorithms[o.Algorithm]:
+		return fmt.Errorf("unknown algorithm %q, want random, newest, oldest, or mixed", o.Algorithm)
+	case o.ElevationLevels < 1 || o.ElevationLevels > 10:
+		return fmt.Errorf("elevation levels must be from 1 to 10, got %d", o.ElevationLevels)
+	case o.Bias < -1 || o.Bias > 1:
+		return fmt.Errorf("bias must be from -1 to 1, got %g", o.Bias)
+	case o.Shape != "" && shapes[o.Shape] == nil:
+		return fmt.Errorf("unknown shape %q, want rectangle, cross, ring, or diamond", o.Shape)
+	case o.Wrap && (o.Width%2 != 0 || o.Height%2 != 0):
+		return fmt.Errorf("a stage that wraps must be an even size, got %dx%d", o.Width, o.Height)
+	case o.Symmetry != "" && o.Symmetry != "none" && symmetries[o.Symmetry] == nil:
+		return fmt.Errorf("unknown symmetry %q, want none, mirror, rotate2, or rotate4", o.Symmetry)
+	case o.WallStyle != "" && wallStyles[o.WallStyle] == nil:
+		return fmt.Errorf("unknown wall style %q, want single, double, rounded, heavy, or block", o.WallStyle)
+	case o.Symmetry == "rotate4" && o.Width != o.Height:
+		return fmt.Errorf("rotate4 symmetry needs a square stage, got %dx%d", o.Width, o.Height)
+	case symmetries[o.Symmetry] != nil && (o.Wrap || o.Unicursal):
+		return fmt.Errorf("a symmetric stage can't also wrap or be unicursal")
+	case o.FrameDelay < 0 || o.FrameSkip < 0:
+		return fmt.Errorf("frame delay and skip can't be negative, got %v and %d", o.FrameDelay, o.FrameSkip)
+	case o.Wrap && o.ChunkSize != 0:
+		return fmt.Errorf("a stage that wraps can't be carved in chunks")
+	case o.ChunkSize != 0 && (o.ChunkSize < minChunkSize || o.ChunkSize%2 != 0):
+		return fmt.Errorf("chunk size must be even and at least %d, got %d", minChunkSize, o.ChunkSize)
+	}
+	if o.Source == nil {
+		if _, err := NewSource(o.RNG, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seeded returns the options with seed's source from the RNG backend, which
+// has already been checked is known
+func (o Options) seeded(seed int64) Options {
+	o.Seed = seed
+	o.Source, _ = NewSource(o.RNG, seed)
+	return o
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NewStageFromString reads a stage back from the unicode or ascii output
+// drawn with theme (classic if nil). Walls, floor, features, terrain, ramps,
+// stairs, and locked doors come back as they were; from unicode output so do
+// monsters, items, found traps, and decorations, which ascii doesn't draw.
+// Rooms are the open areas at least two cells wide, and their doors the
+// openings in the walls around them, so terrain cut through the walls can
+// join a room to what's around it. The entrance is the stairs up, if any.
+func NewStageFromString(text string, theme *Theme) (*Stage, error) {
+	if theme == nil {
+		theme = themes["classic"]
+	}
+	rows := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	width := 0
+	for _, row := range rows {
+		if n := len([]rune(row)); n > width {
+			width = n
+		}
+	}
+	if width < 3 || len(rows) < 3 {
+		return nil, fmt.Errorf("stage must be at least 3x3, got %dx%d", width, len(rows))
+	}
+
+	// unicode output draws walls with box drawing characters, and ascii
+	// with '#', which a theme's decorations can be drawn with too. Bridges
+	// are drawn as double walls run east-west, so they're only walls in
+	// output drawn with double walls, where bridges can't be told apart.
+	isWall := make(map[rune]bool)
+	for _, walls := range wallStyles {
+		for _, r := range walls {
+			isWall[r] = true
+		}
+	}
+	bridge, double := BridgeDeck.Kind().Glyph, false
+	for _, r := range doubleWallRunes {
+		double = double || r != bridge && strings.ContainsRune(text, r)
+	}
+	if !double {
+		delete(isWall, bridge)
+	}
+	unicode := strings.IndexFunc(text, func(r rune) bool { return isWall[r] }) >= 0
+	if !unicode {
+		isWall = map[rune]bool{'#': true}
+	}
+
+	src, _ := NewSource("go", 1)
+	s := NewStage(width, len(rows), src)
+	s.theme = theme
+	for y, row := range rows {
+		if n := len([]rune(row)); n != width {
+			return nil, fmt.Errorf("row %d has %d cells, expected %d", y+1, n, width)
+		}
+		for i, r := range []rune(row) {
+			if err := s.parseCell(i+1, y+1, r, isWall, unicode); err != nil {
+				return nil, fmt.Errorf("row %d: %v", y+1, err)
+			}
+		}
+	}
+	s.findRooms()
+	if s.upX != 0 {
+		s.entranceX, s.entranceY = s.upX, s.upY
+	} else {
+		s.PlaceEntrance()
+	}
+	return s, nil
+}
+
+// parseCell sets the cell at x, y to what r draws
+func (s *Stage) parseCell(x, y int, r rune, isWall map[rune]bool, unicode bool) error {
+	if isWall[r] {
+		return nil
+	}
+	s.setKind(x, y, Floor)
+	switch r {
+	case ' ', '.', blockFloorGlyph, s.theme.Floor:
+		return nil
+	case stairsUpGlyph:
+		s.setKind(x, y, StairsUp)
+		s.upX, s.upY = x, y
+		return nil
+	case stairsDownGlyph:
+		s.setKind(x, y, StairsDown)
+		s.downX, s.downY = x, y
+		return nil
+	case lockedDoorGlyph:
+		s.setKind(x, y, LockedDoor)
+		return nil
+	case rampGlyph:
+		tmpTile := s.at(x, y)
+		tmpTile.ramp = true
+		s.set(x, y, tmpTile)
+		return nil
+	}
+	for f, k := range featureKinds {
+		if Feature(f) != NoFeature && (unicode && r == k.Glyph || !unicode && r == rune(k.ASCII)) {
+			s.setFeature(x, y, Feature(f))
+			return nil
+		}
+	}
+	for t, k := range tileKinds {
+		if k.Terrain && (unicode && r == k.Glyph || !unicode && r == rune(k.ASCII)) {
+			s.setKind(x, y, TileType(t))
+			return nil
+		}
+	}
+	if !unicode {
+		return fmt.Errorf("unknown glyph %q at column %d", r, x)
+	}
+	if r == trapGlyph {
+		s.traps = append(s.traps, &Trap{TrapKind: trapTable[0], x: x, y: y, found: true})
+		return nil
+	}
+	for _, k := range s.theme.Monsters {
+		if r == k.Glyph {
+			s.monsters = append(s.monsters, &Monster{MonsterKind: k, x: x, y: y, hp: k.HP})
+			return nil
+		}
+	}
+	for _, k := range append(s.theme.Items, keyKind) {
+		if r == k.Glyph {
+			s.items = append(s.items, &Item{ItemKind: k, x: x, y: y})
+			return nil
+		}
+	}
+	for _, k := range s.theme.Decorations {
+		if r == k.Glyph {
+			s.decorations = append(s.decorations, &Decoration{DecorationKind: k, x: x, y: y})
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown glyph %q at column %d", r, x)
+}
+
+// findRooms finds the rooms in a stage read back from its output: corridors
+// are one cell wide, so every open two by two block is in a room, and each
+// room is the box around the blocks joined to each other. The open cells in
+// the wall around a room are its doors.
+func (s *Stage) findRooms() {
+	open := func(x, y int) bool {
+		k := s.at(x, y).kind
+		return s.cellExists(x, y) && k != Wall && k != LockedDoor
+	}
+	inBlock := make([]bool, len(s.cell))
+	for y := 1; y < s.height; y++ {
+		for x := 1; x < s.width; x++ {
+			if open(x, y) && open(x+1, y) && open(x, y+1) && open(x+1, y+1) {
+				for _, c := range [][2]int{{x, y}, {x + 1, y}, {x, y + 1}, {x + 1, y + 1}} {
+					inBlock[(c[1]-1)*s.width+c[0]-1] = true
+				}
+			}
+		}
+	}
+
+	seen := make([]bool, len(s.cell))
+	for i := range s.cell {
+		if !inBlock[i] || seen[i] {
+			continue
+		}
+		seen[i] = true
+		x0, y0 := i%s.width+1, i/s.width+1
+		x1, y1 := x0, y0
+		for queue := []int{i}; len(queue) > 0; queue = queue[1:] {
+			x, y := queue[0]%s.width+1, queue[0]/s.width+1
+			if x < x0 {
+				x0 = x
+			}
+			if x > x1 {
+				x1 = x
+			}
+			if y < y0 {
+				y0 = y
+			}
+			if y > y1 {
+				y1 = y
+			}
+			for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+				if nx, ny := x+d[0], y+d[1]; s.cellExists(nx, ny) {
+					if j := (ny-1)*s.width + nx - 1; inBlock[j] && !seen[j] {
+						seen[j] = true
+						queue = append(queue, j)
+					}
+				}
+			}
+		}
+		room := Room{x: x0, y: y0, width: x1 - x0, height: y1 - y0}
+		s.rooms = append(s.rooms, room)
+
+		// the wall around it, leaving out the corners
+		for x := x0; x <= x1; x++ {
+			s.findDoor(x, y0-1)
+			s.findDoor(x, y1+1)
+		}
+		for y := y0; y <= y1; y++ {
+			s.findDoor(x0-1, y)
+			s.findDoor(x1+1, y)
+		}
+	}
+}
+
+// findDoor makes x, y a doorway if it is open, keeping a locked door locked
+func (s *Stage) findDoor(x, y int) {
+	if !s.cellExists(x, y) || s.at(x, y).kind == Wall || s.isDoor(x, y) {
+		return
+	}
+	if s.at(x, y).kind == Floor {
+		s.setKind(x, y, Door)
+	}
+	s.doors = append(s.doors, s.at(x, y))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNewStageFromString(t *testing.T) {
+	for _, theme := range []string{"classic", "crypt", "sewer", "mine", "ice"} {
+		s, err := New(WithSeed(8), WithTheme(themes[theme]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := NewStageFromString(s.String(), themes[theme])
+		if err != nil {
+			t.Fatalf("%s: %v", theme, err)
+		}
+		if got, want := parsed.String(), s.String(); got != want {
+			t.Errorf("%s: unicode came back as\n%s\nwant:\n%s", theme, got, want)
+		}
+		// rivers and veins cut through walls, joining rooms to what's
+		// around them, but classic only puts pools in rooms
+		if theme == "classic" {
+			sortRooms := func(rooms []Room) []Room {
+				rooms = append([]Room(nil), rooms...)
+				sort.Slice(rooms, func(i, j int) bool {
+					return rooms[i].y < rooms[j].y || rooms[i].y == rooms[j].y && rooms[i].x < rooms[j].x
+				})
+				return rooms
+			}
+			if got, want := sortRooms(parsed.rooms), sortRooms(s.rooms); !reflect.DeepEqual(got, want) {
+				t.Errorf("found rooms %v, want %v", got, want)
+			}
+			if len(parsed.doors) != len(s.doors) {
+				t.Errorf("found %d doors, want %d", len(parsed.doors), len(s.doors))
+			}
+			if len(parsed.monsters) != len(s.monsters) || len(parsed.items) != len(s.items) {
+				t.Errorf("found %d monsters and %d items, want %d and %d",
+					len(parsed.monsters), len(parsed.items), len(s.monsters), len(s.items))
+			}
+		}
+
+		parsed, err = NewStageFromString(s.ASCII(), themes[theme])
+		if err != nil {
+			t.Fatalf("%s ascii: %v", theme, err)
+		}
+		if got, want := parsed.ASCII(), s.ASCII(); got != want {
+			t.Errorf("%s: ascii came back as\n%s\nwant:\n%s", theme, got, want)
+		}
+	}
+}
+
+func TestNewStageFromStringRejects(t *testing.T) {
+	for _, tt := range []struct {
+		name, text string
+	}{
+		{"too small", "##\n##\n"},
+		{"ragged", "#####\n#   #\n####\n"},
+		{"unknown glyph", "#####\n# ? #\n#####\n"},
+	} {
+		if _, err := NewStageFromString(tt.text, nil); err == nil {
+			t.Errorf("%s: parsed", tt.name)
+		}
+	}
+	if _, err := NewStageFromString(strings.Repeat("###\n", 3), nil); err != nil {
+		t.Errorf("solid wall: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import "container/heap"
+
+// isOpen reports if the cell at x, y exists and has been carved out
+func (s *Stage) isOpen(x, y int) bool {
+	return s.cellExists(x, y) && s.at(x, y).kind != Wall
+}
+
+// blocker names whatever keeps x, y from being walked onto
+func (s *Stage) blocker(x, y int) string {
+	if f := s.at(x, y).feature; !f.Kind().Flags.Has(Walkable) {
+		return f.Kind().Name
+	}
+	return s.at(x, y).kind.Kind().Name
+}
+
+// openNeighbors returns the carved cells directly above, right, below, and left of x, y,
+// wrapping around a stage that wraps. Locked doors and impassable terrain are left out,
+// since nothing can walk through them.
+func (s *Stage) openNeighbors(x, y int) []Tile {
+	neighbors := make([]Tile, 0, 4)
+	for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+		if nx, ny := s.step(x, y, d[0], d[1]); s.IsWalkable(nx, ny) {
+			neighbors = append(neighbors, s.at(nx, ny))
+		}
+	}
+	return neighbors
+}
+
+// Distances are the steps, or the cost, from every cell to one cell, kept in
+// a flat slice laid out like the stage's cells rather than a map per column,
+// so they stay cheap on huge stages
+type Distances struct {
+	width int
+	d     []int32
+}
+
+// newDistances returns distances for s with every cell unreached
+func (s *Stage) newDistances() Distances {
+	d := Distances{width: s.width, d: make([]int32, len(s.cell))}
+	for i := range d.d {
+		d.d[i] = -1
+	}
+	return d
+}
+
+// At returns the distance at x, y, and whether it was reached at all
+func (d Distances) At(x, y int) (int, bool) {
+	if x < 1 || x > d.width || y < 1 || len(d.d) == 0 || y > len(d.d)/d.width {
+		return 0, false
+	}
+	v := d.d[(y-1)*d.width+x-1]
+	return int(v), v >= 0
+}
+
+// set records the distance at x, y
+func (d Distances) set(x, y, v int) {
+	d.d[(y-1)*d.width+x-1] = int32(v)
+}
+
+// DistanceMap returns the number of steps from x, y to every open cell that
+// can be reached from it. Unreachable cells are left out.
+func (s *Stage) DistanceMap(x, y int) Distances {
+	dist := s.newDistances()
+	if !s.cellExists(x, y) {
+		return dist
+	}
+	dist.set(x, y, 0)
+	if !s.isOpen(x, y) {
+		return dist
+	}
+
+	// breadth first, so the first time we see a cell is the shortest way
+	// there. The queue holds cell indexes and is never shifted, only read
+	// through, so it is allocated once at the size it ends up.
+	queue := make([]int, 1, 64)
+	queue[0] = (y-1)*s.width + x - 1
+	for head := 0; head < len(queue); head++ {
+		i := queue[head]
+		tx, ty := i%s.width+1, i/s.width+1
+		for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			nx, ny := s.step(tx, ty, d[0], d[1])
+			if !s.IsWalkable(nx, ny) {
+				continue
+			}
+			if j := (ny-1)*s.width + nx - 1; dist.d[j] < 0 {
+				dist.d[j] = dist.d[i] + 1
+				queue = append(queue, j)
+			}
+		}
+	}
+	return dist
+}
+
+// CostMap returns the movement cost of walking from every cell that can reach
+// x, y to x, y, counting the cost of each cell stepped onto along the way.
+// Cells that can't reach it are left out. It can be walked with StepToward
+// the same as a distance map.
+func (s *Stage) CostMap(x, y int) Distances {
+	cost := s.newDistances()
+	if !s.cellExists(x, y) {
+		return cost
+	}
+	cost.set(x, y, 0)
+	if !s.isOpen(x, y) {
+		return cost
+	}
+
+	// Dijkstra outward from x, y. Walking back in toward it, each step onto t
+	// from a neighbor costs t's move cost.
+	done := make([]bool, len(s.cell))
+	frontier := &costQueue{{x: x, y: y}}
+	for frontier.Len() > 0 {
+		c := heap.Pop(frontier).(costCell)
+		if i := (c.y-1)*s.width + c.x - 1; done[i] {
+			continue
+		} else {
+			done[i] = true
+		}
+		next := c.cost + s.MoveCost(c.x, c.y)
+		for _, n := range s.openNeighbors(c.x, c.y) {
+			if old, seen := cost.At(n.x, n.y); seen && old <= next {
+				continue
+			}
+			cost.set(n.x, n.y, next)
+			heap.Push(frontier, costCell{x: n.x, y: n.y, cost: next})
+		}
+	}
+	return cost
+}
+
+// FindPath returns the cheapest walk from the start to the goal, both ends
+// included, and what it costs, using A* with each step costing the move cost
+// of the cell stepped onto. ok is false if the goal can't be reached.
+func (s *Stage) FindPath(fromX, fromY, toX, toY int) (path []Tile, cost int, ok bool) {
+	if !s.IsWalkable(fromX, fromY) || !s.IsWalkable(toX, toY) {
+		return nil, 0, false
+	}
+	// every step costs at least 1, so the manhattan distance never
+	// overestimates, going around the other way if that's shorter
+	guess := func(x, y int) int {
+		dx, dy := abs(toX-x), abs(toY-y)
+		if s.opts.Wrap {
+			if s.width-dx < dx {
+				dx = s.width - dx
+			}
+			if s.height-dy < dy {
+				dy = s.height - dy
+			}
+		}
+		return dx + dy
+	}
+
+	spent := s.newDistances()
+	spent.set(fromX, fromY, 0)
+	// came is the cell index each cell was reached from
+	came := make([]int32, len(s.cell))
+	frontier := &costQueue{{x: fromX, y: fromY, cost: guess(fromX, fromY)}}
+	for frontier.Len() > 0 {
+		c := heap.Pop(frontier).(costCell)
+		if c.x == toX && c.y == toY {
+			break
+		}
+		here, _ := spent.At(c.x, c.y)
+		if c.cost > here+guess(c.x, c.y) {
+			// a cheaper way here was already expanded
+			continue
+		}
+		for _, n := range s.openNeighbors(c.x, c.y) {
+			next := here + s.MoveCost(n.x, n.y)
+			if old, seen := spent.At(n.x, n.y); seen && old <= next {
+				continue
+			}
+			spent.set(n.x, n.y, next)
+			came[(n.y-1)*s.width+n.x-1] = int32((c.y-1)*s.width + c.x - 1)
+			heap.Push(frontier, costCell{x: n.x, y: n.y, cost: next + guess(n.x, n.y)})
+		}
+	}
+
+	cost, ok = spent.At(toX, toY)
+	if !ok {
+		return nil, 0, false
+	}
+	for t := s.at(toX, toY); ; t = s.cell[came[(t.y-1)*s.width+t.x-1]] {
+		path = append(path, t)
+		if t.x == fromX && t.y == fromY {
+			break
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, cost, true
+}
+
+// costCell is a cell waiting in a costQueue
+type costCell struct {
+	x, y, cost int
+}
+
+// costQueue is a min-heap of cells by cost. Ties go to the topmost, then
+// leftmost cell so paths come out the same every run.
+type costQueue []costCell
+
+func (q costQueue) Len() int      { return len(q) }
+func (q costQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q costQueue) Less(i, j int) bool {
+	if q[i].cost != q[j].cost {
+		return q[i].cost < q[j].cost
+	}
+	if q[i].y != q[j].y {
+		return q[i].y < q[j].y
+	}
+	return q[i].x < q[j].x
+}
+func (q *costQueue) Push(c interface{}) { *q = append(*q, c.(costCell)) }
+func (q *costQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// StepToward returns the neighbor of x, y that is closest to the origin of
+// the given distance or cost map. ok is false if no neighbor is closer than
+// x, y.
+func (s *Stage) StepToward(x, y int, dist Distances) (nextX, nextY int, ok bool) {
+	best, found := dist.At(x, y)
+	if !found {
+		return x, y, false
+	}
+	for _, n := range s.openNeighbors(x, y) {
+		if d, found := dist.At(n.x, n.y); found && d < best {
+			best, nextX, nextY, ok = d, n.x, n.y, true
+		}
+	}
+	return nextX, nextY, ok
+}
+
+// reach returns how many cells a distance map covers and the farthest
+// distance in it (at least 1, so it is safe to divide by)
+func reach(dist Distances) (count, farthest int) {
+	farthest = 1
+	for _, d := range dist.d {
+		if d >= 0 {
+			count++
+		}
+		if int(d) > farthest {
+			farthest = int(d)
+		}
+	}
+	return count, farthest
+}
@@ -0,0 +1,179 @@
+package main
+
+import "fmt"
+
+// A Pass is one named step of generating a stage. Layout passes carve the
+// stage before its entrance and stairs are placed; the rest dress it
+// afterwards.
+type Pass struct {
+	Name      string
+	Layout    bool
+	Generator Generator
+}
+
+// Pipeline is the passes a stage is generated with, run in order
+type Pipeline []Pass
+
+// passStreams are the random streams the built in passes draw from. A pass
+// that replaces a built in one under the same name draws from its stream;
+// passes with any other name share one of their own.
+var passStreams = map[string]int{
+	"rooms":       roomStream,
+	"maze":        mazeStream,
+	"connectors":  connectStream,
+	"chunks":      mazeStream,
+	"seams":       connectStream,
+	"labyrinth":   mazeStream,
+	"symmetry":    mazeStream,
+	"terrain":     terrainStream,
+	"features":    terrainStream,
+	"monsters":    stockStream,
+	"items":       stockStream,
+	"traps":       stockStream,
+	"locks":       stockStream,
+	"decorations": stockStream,
+	"elevation":   terrainStream,
+}
+
+// DefaultPipeline returns the built in passes opts generates a stage with.
+// A stage bigger than the chunk size has its rooms and maze carved by a chunks
+// pass instead, and the chunks joined up by a seams pass after the
+// connectors. A unicursal stage is carved by a labyrinth pass alone, and
+// isn't pruned, since that would eat its path from both ends, and a symmetric
+// one by a symmetry pass.
+func DefaultPipeline(opts Options) Pipeline {
+	layout := Pipeline{
+		{Name: "rooms", Layout: true, Generator: Rooms{}},
+		{Name: "maze", Layout: true, Generator: Maze{}},
+		{Name: "connectors", Layout: true, Generator: Connectors{}},
+	}
+	if size := opts.ChunkSize; size > 0 && (opts.Width > size+1 || opts.Height > size+1) {
+		layout = Pipeline{
+			{Name: "chunks", Layout: true, Generator: Chunks{Size: size}},
+			{Name: "connectors", Layout: true, Generator: Connectors{}},
+			{Name: "seams", Layout: true, Generator: Seams{Size: size}},
+		}
+	}
+	if symmetries[opts.Symmetry] != nil {
+		layout = Pipeline{{Name: "symmetry", Layout: true, Generator: Symmetry{Mode: opts.Symmetry}}}
+	}
+	prune := Pipeline{{Name: "prune", Layout: true, Generator: Prune{Steps: opts.Prune}}}
+	if opts.Unicursal {
+		layout, prune = Pipeline{{Name: "labyrinth", Layout: true, Generator: Labyrinth{}}}, nil
+	}
+	return layout.Append(prune...).Append(Pipeline{
+		{Name: "terrain", Generator: checkedPass((*Stage).AddTerrain)},
+		{Name: "features", Generator: stagePass((*Stage).AddFeatures)},
+		{Name: "monsters", Generator: stagePass((*Stage).AddMonsters)},
+		{Name: "items", Generator: stagePass((*Stage).AddItems)},
+		{Name: "traps", Generator: stagePass((*Stage).AddTraps)},
+		{Name: "locks", Generator: stagePass((*Stage).AddLocks)},
+		{Name: "decorations", Generator: stagePass((*Stage).AddDecorations)},
+		{Name: "elevation", Generator: stagePass((*Stage).AddElevation)},
+	}...)
+}
+
+// Append returns the pipeline with passes added to the end
+func (p Pipeline) Append(passes ...Pass) Pipeline {
+	return append(p[:len(p):len(p)], passes...)
+}
+
+// InsertAfter returns the pipeline with passes added right after the pass
+// called name
+func (p Pipeline) InsertAfter(name string, passes ...Pass) (Pipeline, error) {
+	i, err := p.index(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.insert(i+1, passes), nil
+}
+
+// InsertBefore returns the pipeline with passes added right before the pass
+// called name
+func (p Pipeline) InsertBefore(name string, passes ...Pass) (Pipeline, error) {
+	i, err := p.index(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.insert(i, passes), nil
+}
+
+// Replace returns the pipeline with the pass called name generated by g
+// instead
+func (p Pipeline) Replace(name string, g Generator) (Pipeline, error) {
+	i, err := p.index(name)
+	if err != nil {
+		return nil, err
+	}
+	out := append(Pipeline{}, p...)
+	out[i].Generator = g
+	return out, nil
+}
+
+// Remove returns the pipeline without the pass called name
+func (p Pipeline) Remove(name string) (Pipeline, error) {
+	i, err := p.index(name)
+	if err != nil {
+		return nil, err
+	}
+	out := append(Pipeline{}, p[:i]...)
+	return append(out, p[i+1:]...), nil
+}
+
+// index returns where the pass called name is
+func (p Pipeline) index(name string) (int, error) {
+	for i, pass := range p {
+		if pass.Name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no pass called %q", name)
+}
+
+// insert returns a copy of the pipeline with passes added at i
+func (p Pipeline) insert(i int, passes []Pass) Pipeline {
+	out := make(Pipeline, 0, len(p)+len(passes))
+	out = append(out, p[:i]...)
+	out = append(out, passes...)
+	return append(out, p[i:]...)
+}
+
+// runPasses runs the stage's layout passes, or the rest, in order, stopping
+// at the first that fails
+func (s *Stage) runPasses(layout bool) error {
+	p := s.opts.Pipeline
+	if p == nil {
+		p = DefaultPipeline(s.opts)
+	}
+	s.progress.passes = len(p)
+	for _, pass := range p {
+		if pass.Layout != layout {
+			continue
+		}
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		stream, ok := passStreams[pass.Name]
+		if !ok {
+			stream = customStream
+		}
+		s.useStream(stream)
+		s.progress.pass = pass.Name
+		s.reportProgress()
+		if err := pass.Generator.Carve(s, s.rng); err != nil {
+			return fmt.Errorf("%s pass: %v", pass.Name, err)
+		}
+		// built in passes stop early when cancelled, leaving them unfinished
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		s.progress.done++
+		s.passComplete(pass.Name)
+	}
+	return nil
+}
+
+// cancelled reports if generating the stage has been cancelled
+func (s *Stage) cancelled() bool {
+	return s.ctx.Err() != nil
+}
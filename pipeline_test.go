@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// passNames returns the names of p's passes in order
+func passNames(p Pipeline) []string {
+	names := make([]string, 0, len(p))
+	for _, pass := range p {
+		names = append(names, pass.Name)
+	}
+	return names
+}
+
+func TestPipelineEditing(t *testing.T) {
+	p := Pipeline{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	x, y := Pass{Name: "x"}, Pass{Name: "y"}
+	for _, tt := range []struct {
+		name string
+		edit func() (Pipeline, error)
+		want []string
+	}{
+		{"append", func() (Pipeline, error) { return p.Append(x, y), nil }, []string{"a", "b", "c", "x", "y"}},
+		{"insert after", func() (Pipeline, error) { return p.InsertAfter("a", x, y) }, []string{"a", "x", "y", "b", "c"}},
+		{"insert after last", func() (Pipeline, error) { return p.InsertAfter("c", x) }, []string{"a", "b", "c", "x"}},
+		{"insert before", func() (Pipeline, error) { return p.InsertBefore("a", x) }, []string{"x", "a", "b", "c"}},
+		{"remove", func() (Pipeline, error) { return p.Remove("b") }, []string{"a", "c"}},
+		{"replace", func() (Pipeline, error) { return p.Replace("b", Maze{}) }, []string{"a", "b", "c"}},
+	} {
+		got, err := tt.edit()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if names := passNames(got); !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, names, tt.want)
+		}
+		// the pipeline edited is left alone
+		if names := passNames(p); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+			t.Fatalf("%s changed the original pipeline to %v", tt.name, names)
+		}
+	}
+
+	for name, edit := range map[string]func() (Pipeline, error){
+		"insert after":  func() (Pipeline, error) { return p.InsertAfter("z", x) },
+		"insert before": func() (Pipeline, error) { return p.InsertBefore("z", x) },
+		"remove":        func() (Pipeline, error) { return p.Remove("z") },
+		"replace":       func() (Pipeline, error) { return p.Replace("z", Maze{}) },
+	} {
+		if _, err := edit(); err == nil {
+			t.Errorf("%s: found a pass that isn't there", name)
+		}
+	}
+}
+
+func TestCustomPipeline(t *testing.T) {
+	ran := []string{}
+	mark := func(name string) Pass {
+		return Pass{Name: name, Generator: GeneratorFunc(func(s *Stage, rng *rand.Rand) error {
+			ran = append(ran, name)
+			return nil
+		})}
+	}
+	p, err := DefaultPipeline(DefaultOptions()).Remove("monsters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err = p.InsertAfter("items", mark("census")); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(WithSeed(4), WithPipeline(p.Append(mark("last"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.monsters) != 0 {
+		t.Errorf("%d monsters stocked without a monsters pass", len(s.monsters))
+	}
+	if !reflect.DeepEqual(ran, []string{"census", "last"}) {
+		t.Errorf("custom passes ran %v", ran)
+	}
+}
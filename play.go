@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Play lets the player walk the stage, one keypress per turn.
+// Walking into a monster attacks it, and walking into a locked door tries
+// to unlock it. Monsters take their turn after every player action, and the
+// game is over when the player runs out of hit points.
+func (s *Stage) Play(p *Player) {
+	restore := rawTerminal()
+	defer restore()
+	keys := newKeyboard(os.Stdin)
+	defer keys.close()
+	s.play(&terminal{out: os.Stdout, keys: keys, size: terminalSize, canSave: true}, p)
+}
+
+// terminal is what a game is played on: frames are drawn to out, keys are
+// read from keys, and size says how many rows and columns there are. Only a
+// game played where the files it'd save to are its own can save.
+type terminal struct {
+	out     io.Writer
+	keys    *keyboard
+	size    func() (rows, cols int)
+	canSave bool
+}
+
+// play is Play on t, which is already taking keypresses one at a time
+func (s *Stage) play(t *terminal, p *Player) {
+	s.useStream(playStream)
+	io.WriteString(t.out, altScreen)
+	defer io.WriteString(t.out, mainScreen)
+
+	message, minimap := "", false
+	for {
+		// draw the whole frame before writing it so it doesn't flicker
+		var frame strings.Builder
+		frame.WriteString(beginFrame + clearScreen)
+		// the status and message lines go under the stage
+		rows, cols := t.size()
+		s.printPlay(&frame, p, s.view(rows-2, cols, p.x, p.y))
+		fmt.Fprintf(&frame, "HP %d/%d  move or attack: arrows, wasd, or hjkl. pick up: g. inventory: i. map: m. save: S. quit: q\r\n", p.hp, p.maxHP)
+		frame.WriteString(message + "\r\n")
+		if minimap {
+			s.overlayMinimap(&frame, rows, cols, p.x, p.y)
+		}
+		frame.WriteString(endFrame)
+		io.WriteString(t.out, frame.String())
+		message = ""
+
+		if p.hp <= 0 {
+			io.WriteString(t.out, "You die... press any key\r\n")
+			// resizing the terminal isn't a keypress
+			key, _ := t.keys.read()
+			for key == resizeKey {
+				key, _ = t.keys.read()
+			}
+			return
+		}
+
+		key, err := t.keys.read()
+		if err != nil {
+			return
+		}
+		dx, dy := 0, 0
+		switch key {
+		case "q":
+			return
+		case "w", "k", "\x1b[A":
+			dy = -1
+		case "d", "l", "\x1b[C":
+			dx = 1
+		case "s", "j", "\x1b[B":
+			dy = 1
+		case "a", "h", "\x1b[D":
+			dx = -1
+		case "g", ",":
+			message = s.PickUp(p)
+		case "i":
+			message = s.inventoryScreen(t.out, p, t.keys)
+			if message == "" {
+				continue
+			}
+		case "m":
+			// nor does looking at the map
+			minimap = !minimap
+			continue
+		case "S":
+			// saving doesn't take a turn
+			message = "Saving isn't available here. "
+			if t.canSave {
+				message = s.saveSession(p)
+			}
+			continue
+		default:
+			continue
+		}
+
+		message += s.takeTurn(p, dx, dy)
+	}
+}
+
+// takeTurn moves the player dx, dy, attacking a monster or trying a locked
+// door in the way, then has the monsters take their turn, returning what
+// happened. A turn standing still, 0, 0, just lets them.
+func (s *Stage) takeTurn(p *Player, dx, dy int) string {
+	message := ""
+	nx, ny := s.step(p.x, p.y, dx, dy)
+	if m := s.monsterAt(nx, ny); m != nil {
+		message = s.PlayerAttack(p, m)
+	} else if s.cellExists(nx, ny) && s.at(nx, ny).kind == LockedDoor {
+		message = s.Unlock(p, nx, ny)
+	} else if (dx != 0 || dy != 0) && s.isOpen(nx, ny) && !s.IsWalkable(nx, ny) {
+		message = fmt.Sprintf("The %s blocks your way. ", s.blocker(nx, ny))
+	} else if (dx != 0 || dy != 0) && s.isOpen(nx, ny) {
+		p.x, p.y = nx, ny
+		if k := s.at(p.x, p.y).kind.Kind(); s.IsHazardous(p.x, p.y) {
+			p.hp -= k.Damage
+			message = fmt.Sprintf("The %s burns you for %d! ", k.Name, k.Damage)
+		}
+		if t := s.trapAt(p.x, p.y); t != nil && !t.found {
+			t.found = true
+			message += s.springTrap(t, p)
+		}
+		if item := s.itemAt(p.x, p.y); item != nil {
+			message += fmt.Sprintf("You see the %s here. ", item.Name)
+		}
+	}
+	for _, t := range s.searchTraps(p.x, p.y) {
+		message += fmt.Sprintf("You notice a %s. ", t.Name)
+	}
+	message += s.MoveMonsters(p)
+	return message
+}
+
+// springTrap applies a trap's effect to the player and describes what happened
+func (s *Stage) springTrap(t *Trap, p *Player) string {
+	p.hp -= t.Damage
+	switch t.Effect {
+	case "fall":
+		return fmt.Sprintf("You fall into a %s for %d! ", t.Name, t.Damage)
+	case "dart":
+		return fmt.Sprintf("A %s shoots you for %d! ", t.Name, t.Damage)
+	case "alarm":
+		// every monster in the dungeon is now on the lookout
+		for _, m := range s.monsters {
+			m.Sight *= 2
+		}
+		return fmt.Sprintf("You step on a %s. An alarm rings out! ", t.Name)
+	}
+	return ""
+}
+
+// printPlay writes the cells of the stage in view to w with the player,
+// monsters, items, and known traps drawn on top
+func (s *Stage) printPlay(w io.Writer, p *Player, view image.Rectangle) {
+	glyph := s.glyphs(false)
+	for y := view.Min.Y; y < view.Max.Y; y++ {
+		for x := view.Min.X; x < view.Max.X; x++ {
+			r := glyph(x, y)
+			if x == p.x && y == p.y {
+				r = '@'
+			}
+			s.printCell(w, x, y, r)
+		}
+		// the terminal is in raw mode, so return the carriage ourselves
+		fmt.Fprintf(w, "\r\n")
+	}
+}
+
+// printCell writes r for the cell at x, y to w, in the color of what's there
+func (s *Stage) printCell(w io.Writer, x, y int, r rune) {
+	if s.opts.NoColor {
+		tile, _ := s.tile(x, y, r)
+		io.WriteString(w, tile)
+		return
+	}
+	tile, color := s.tile(x, y, r)
+	// shade the floor darker the lower it is
+	shade := ""
+	if s.elevationLevels > 1 && s.at(x, y).kind != Wall {
+		shade = fmt.Sprintf("\x1b[48;5;%dm", 232+12*int(s.at(x, y).elevation)/(s.elevationLevels-1))
+	}
+	switch {
+	case color != 0:
+		fmt.Fprintf(w, "%s\x1b[%dm%s\x1b[0m", shade, color, tile)
+	case shade != "":
+		fmt.Fprintf(w, "%s%s\x1b[0m", shade, tile)
+	default:
+		io.WriteString(w, tile)
+	}
+}
+
+// readKey reads a single keypress, keeping arrow key escape sequences whole
+func readKey(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil || b != '\x1b' {
+		return string(b), err
+	}
+	seq := []byte{b}
+	for len(seq) < 3 && r.Buffered() > 0 {
+		b, _ = r.ReadByte()
+		seq = append(seq, b)
+	}
+	return string(seq), nil
+}
+
+// rawTerminal turns off line buffering and echo so single keypresses can be
+// read from stdin. The returned func restores the previous terminal settings.
+func rawTerminal() func() {
+	return setTerminal("raw", "-echo")
+}
+
+// setTerminal changes the terminal's settings with stty, returning a func
+// that restores the ones it had
+func setTerminal(args ...string) func() {
+	stty := func(args ...string) string {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		out, _ := cmd.Output()
+		return strings.TrimSpace(string(out))
+	}
+	saved := stty("-g")
+	stty(args...)
+	return func() {
+		stty(saved)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// PolarMaze is a circular maze of rings around a single middle cell. Each
+// ring is split into as many cells as keeps them about as wide as they are
+// deep, so outer rings have more cells, each splitting into one or more
+// cells in the ring outside it.
+type PolarMaze struct {
+	// counts are how many cells each ring has, and offsets where each
+	// ring's cells start in the flat cell lists
+	counts, offsets []int
+	// inward is set on a cell open to the cell in the ring inside it, and
+	// clockwise on a cell open to the next cell clockwise in its ring
+	inward, clockwise []bool
+}
+
+// NewPolarMaze grows a maze of rings rings with the growing tree algorithm,
+// picking which cell to grow from next as the algorithm option asks
+func NewPolarMaze(rings int, algorithm string, rng *rand.Rand) *PolarMaze {
+	m := &PolarMaze{counts: []int{1}, offsets: []int{0}}
+	total := 1
+	for r := 1; r < rings; r++ {
+		// how wide the last ring's cells would be this far out, in ring
+		// depths
+		wide := 2 * math.Pi * float64(r) / float64(m.counts[r-1])
+		n := m.counts[r-1] * int(math.Max(1, math.Round(wide)))
+		m.counts = append(m.counts, n)
+		m.offsets = append(m.offsets, total)
+		total += n
+	}
+	m.inward, m.clockwise = make([]bool, total), make([]bool, total)
+
+	seen := make([]bool, total)
+	start := rng.Intn(total)
+	seen[start] = true
+	var cells frontier
+	cells.push(start)
+	for cells.count > 0 {
+		pos := cells.nth(growFrom(rng, algorithm, cells.count))
+		i := cells.cells[pos]
+		var next []int
+		for _, j := range m.neighbors(i) {
+			if !seen[j] {
+				next = append(next, j)
+			}
+		}
+		if len(next) == 0 {
+			cells.remove(pos)
+			continue
+		}
+		j := next[rng.Intn(len(next))]
+		m.join(i, j)
+		seen[j] = true
+		cells.push(j)
+	}
+	return m
+}
+
+// ring returns which ring cell i is in, and where around it
+func (m *PolarMaze) ring(i int) (r, at int) {
+	for r = len(m.offsets) - 1; m.offsets[r] > i; r-- {
+	}
+	return r, i - m.offsets[r]
+}
+
+// parent returns the cell in the ring inside cell i that it opens inward
+// onto
+func (m *PolarMaze) parent(i int) int {
+	r, at := m.ring(i)
+	return m.offsets[r-1] + at*m.counts[r-1]/m.counts[r]
+}
+
+// neighbors returns the cells next to cell i: inward, outward, and to
+// either side
+func (m *PolarMaze) neighbors(i int) []int {
+	r, at := m.ring(i)
+	var out []int
+	if r > 0 {
+		out = append(out, m.parent(i))
+		if n := m.counts[r]; n > 1 {
+			out = append(out, m.offsets[r]+(at+1)%n, m.offsets[r]+(at+n-1)%n)
+		}
+	}
+	if r+1 < len(m.counts) {
+		split := m.counts[r+1] / m.counts[r]
+		for k := 0; k < split; k++ {
+			out = append(out, m.offsets[r+1]+at*split+k)
+		}
+	}
+	return out
+}
+
+// join opens the wall between neighboring cells i and j
+func (m *PolarMaze) join(i, j int) {
+	ri, ai := m.ring(i)
+	rj, aj := m.ring(j)
+	switch {
+	case ri > rj:
+		m.inward[i] = true
+	case rj > ri:
+		m.inward[j] = true
+	case (ai+1)%m.counts[ri] == aj:
+		m.clockwise[i] = true
+	default:
+		m.clockwise[j] = true
+	}
+}
+
+// polarWall is a wall of a polar maze: an arc around the middle at radius
+// r1 from angle a1 to a2, or a line out from it at angle a1 from radius r1
+// to r2
+type polarWall struct {
+	arc            bool
+	r1, r2, a1, a2 float64
+}
+
+// walls returns the walls still standing when each ring is size deep, the
+// outer wall last
+func (m *PolarMaze) walls(size float64) []polarWall {
+	var out []polarWall
+	for r := 1; r < len(m.counts); r++ {
+		step := 2 * math.Pi / float64(m.counts[r])
+		for at := 0; at < m.counts[r]; at++ {
+			i := m.offsets[r] + at
+			a1, a2 := float64(at)*step, float64(at+1)*step
+			if !m.inward[i] {
+				out = append(out, polarWall{arc: true, r1: float64(r) * size, a1: a1, a2: a2})
+			}
+			if !m.clockwise[i] {
+				out = append(out, polarWall{r1: float64(r) * size, r2: float64(r+1) * size, a1: a2})
+			}
+		}
+	}
+	return append(out, polarWall{arc: true, r1: float64(len(m.counts)) * size, a1: 0, a2: 2 * math.Pi})
+}
+
+// WriteSVG draws the maze as an SVG image with rings size pixels deep
+func (m *PolarMaze) WriteSVG(w io.Writer, size float64) error {
+	c := size * float64(len(m.counts)+1)
+	point := func(r, a float64) (float64, float64) { return c + r*math.Cos(a), c + r*math.Sin(a) }
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\">\n", 2*c, 2*c)
+	fmt.Fprintf(&b, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n<path stroke=\"black\" stroke-width=\"2\" stroke-linecap=\"round\" fill=\"none\" d=\"")
+	for _, wall := range m.walls(size) {
+		switch {
+		case wall.arc && wall.a2-wall.a1 >= 2*math.Pi:
+			// an arc can't end where it starts, so draw a full circle as two
+			x1, y1 := point(wall.r1, 0)
+			x2, y2 := point(wall.r1, math.Pi)
+			fmt.Fprintf(&b, "M%.1f %.1fA%.1f %.1f 0 0 1 %.1f %.1fA%.1f %.1f 0 0 1 %.1f %.1f", x1, y1, wall.r1, wall.r1, x2, y2, wall.r1, wall.r1, x1, y1)
+		case wall.arc:
+			x1, y1 := point(wall.r1, wall.a1)
+			x2, y2 := point(wall.r1, wall.a2)
+			large := 0
+			if wall.a2-wall.a1 > math.Pi {
+				large = 1
+			}
+			fmt.Fprintf(&b, "M%.1f %.1fA%.1f %.1f 0 %d 1 %.1f %.1f", x1, y1, wall.r1, wall.r1, large, x2, y2)
+		default:
+			x1, y1 := point(wall.r1, wall.a1)
+			x2, y2 := point(wall.r2, wall.a1)
+			fmt.Fprintf(&b, "M%.1f %.1fL%.1f %.1f", x1, y1, x2, y2)
+		}
+	}
+	b.WriteString("\"/>\n</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WritePNG draws the maze as a PNG image with rings size pixels deep
+func (m *PolarMaze) WritePNG(w io.Writer, size float64) error {
+	c := size * float64(len(m.counts)+1)
+	img := image.NewGray(image.Rect(0, 0, int(2*c), int(2*c)))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	// walls are drawn two pixels thick, a dot every half pixel along them
+	dot := func(r, a float64) {
+		x, y := int(c+r*math.Cos(a)), int(c+r*math.Sin(a))
+		for _, d := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			img.SetGray(x+d[0], y+d[1], color.Gray{})
+		}
+	}
+	for _, wall := range m.walls(size) {
+		if wall.arc {
+			step := 0.5 / wall.r1
+			for a := wall.a1; a <= wall.a2; a += step {
+				dot(wall.r1, a)
+			}
+			dot(wall.r1, wall.a2)
+			continue
+		}
+		for r := wall.r1; r <= wall.r2; r += 0.5 {
+			dot(r, wall.a1)
+		}
+	}
+	return png.Encode(w, img)
+}
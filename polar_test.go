@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestPolarMazeIsPerfect(t *testing.T) {
+	m := NewPolarMaze(8, "random", rand.New(rand.NewSource(5)))
+	for r := 1; r < len(m.counts); r++ {
+		if m.counts[r]%m.counts[r-1] != 0 {
+			t.Fatalf("ring %d has %d cells, not a multiple of the %d inside it", r, m.counts[r], m.counts[r-1])
+		}
+	}
+	if m.counts[1] != 6 || m.counts[7] <= m.counts[2] {
+		t.Errorf("rings split into %v cells", m.counts)
+	}
+
+	// every cell reached, and one fewer passage than cells, so no loops
+	total := len(m.inward)
+	parent := make([]int, total)
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			i = parent[i]
+		}
+		return i
+	}
+	passages := 0
+	for i := 0; i < total; i++ {
+		for _, j := range m.neighbors(i) {
+			ri, ai := m.ring(i)
+			rj, aj := m.ring(j)
+			open := ri > rj && m.inward[i] || ri == rj && (ai+1)%m.counts[ri] == aj && m.clockwise[i]
+			if !open {
+				continue
+			}
+			passages++
+			if find(i) == find(j) {
+				t.Fatalf("cells %d and %d are joined twice", i, j)
+			}
+			parent[find(i)] = find(j)
+		}
+	}
+	if passages != total-1 {
+		t.Errorf("%d passages between %d cells", passages, total)
+	}
+}
+
+func TestPolarMazeDrawing(t *testing.T) {
+	m := NewPolarMaze(5, "random", rand.New(rand.NewSource(1)))
+	var buf bytes.Buffer
+	if err := m.WriteSVG(&buf, 10); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "<svg") || strings.Count(buf.String(), "M") != len(m.walls(10)) {
+		t.Errorf("svg doesn't draw every wall:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := m.WritePNG(&buf, 10); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 120 || b.Dy() != 120 {
+		t.Errorf("png is %dx%d, want 120x120", b.Dx(), b.Dy())
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// Preview shows the stage opts make in the terminal and regenerates it as
+// keys tweak the size, room fill rate, pruning, and seed, for trying options
+// out. It returns the options last shown, so they can be printed as flags.
+func Preview(ctx context.Context, opts Options) Options {
+	restore := rawTerminal()
+	defer restore()
+	os.Stdout.WriteString(altScreen)
+	defer os.Stdout.WriteString(mainScreen)
+
+	p := &preview{opts: opts}
+	p.opts.Hooks, p.opts.Animate = Hooks{}, nil
+	message := ""
+	if err := p.regenerate(ctx); err != nil {
+		message = err.Error()
+	}
+	keys := newKeyboard(os.Stdin)
+	defer keys.close()
+	for {
+		var frame strings.Builder
+		frame.WriteString(beginFrame + clearScreen)
+		if p.s != nil {
+			// the flags, help, and message lines go under the stage
+			rows, cols := terminalSize()
+			p.s.printStage(&frame, p.s.view(rows-3, cols, p.x, p.y))
+		}
+		fmt.Fprintf(&frame, "%s\r\n", previewFlags(p.opts))
+		frame.WriteString("width: w/W. height: h/H. room fill: f/F. prune: p/P. seed: n/N, random: r. pan: arrows. quit: q\r\n")
+		frame.WriteString(message + "\r\n" + endFrame)
+		os.Stdout.WriteString(frame.String())
+
+		key, err := keys.read()
+		if err != nil {
+			return p.opts
+		}
+		var quit bool
+		if message, quit = p.key(ctx, key); quit {
+			return p.opts
+		}
+	}
+}
+
+// preview is the options being tried, the stage they last made, and the
+// cell shown in the middle of the screen when the stage doesn't fit
+type preview struct {
+	opts Options
+	s    *Stage
+	x, y int
+}
+
+// key tweaks the options as key asks and regenerates the stage, returning a
+// message saying why it couldn't if it couldn't, and whether to quit
+func (p *preview) key(ctx context.Context, key string) (string, bool) {
+	was := p.opts
+	o := &p.opts
+	switch key {
+	case "q", "\r":
+		return "", true
+	case "\x1b[A":
+		p.pan(0, -panStep)
+		return "", false
+	case "\x1b[C":
+		p.pan(panStep, 0)
+		return "", false
+	case "\x1b[B":
+		p.pan(0, panStep)
+		return "", false
+	case "\x1b[D":
+		p.pan(-panStep, 0)
+		return "", false
+	// the size goes up and down by 2 so the maze still lines up
+	case "w":
+		o.Width -= 2
+	case "W":
+		o.Width += 2
+	case "h":
+		o.Height -= 2
+	case "H":
+		o.Height += 2
+	case "f":
+		o.RoomFillRate -= 5
+	case "F":
+		o.RoomFillRate += 5
+	case "p":
+		o.Prune--
+	case "P":
+		o.Prune++
+	case "n":
+		o.Seed++
+	case "N":
+		o.Seed--
+	case "r":
+		o.Seed = rand.Int63()
+	default:
+		return "", false
+	}
+	switch {
+	case o.RoomFillRate < 0 || o.RoomFillRate > 100:
+		p.opts = was
+		return "Room fill rate is a percent. ", false
+	case o.Prune < 0:
+		p.opts = was
+		return "Prune can't go below 0. ", false
+	}
+	if err := p.regenerate(ctx); err != nil {
+		p.opts = was
+		return fmt.Sprintf("Can't: %v. ", err), false
+	}
+	return "", false
+}
+
+// regenerate makes the stage again from the options, the same every time for
+// the same options
+func (p *preview) regenerate(ctx context.Context) error {
+	if err := p.opts.check(); err != nil {
+		return err
+	}
+	src, err := NewSource(p.opts.RNG, p.opts.Seed)
+	if err != nil {
+		return err
+	}
+	opts := p.opts
+	opts.Source = src
+	s, _, err := GenerateStage(ctx, opts)
+	if err != nil {
+		return err
+	}
+	p.s = s
+	p.pan(0, 0)
+	return nil
+}
+
+// panStep is how many cells the arrow keys pan the preview by
+const panStep = 8
+
+// pan moves the middle of the screen dx, dy cells, keeping it on the stage
+func (p *preview) pan(dx, dy int) {
+	if p.x == 0 {
+		p.x, p.y = p.s.width/2+1, p.s.height/2+1
+	}
+	p.x, p.y = p.x+dx, p.y+dy
+	if p.x < 1 {
+		p.x = 1
+	}
+	if p.x > p.s.width {
+		p.x = p.s.width
+	}
+	if p.y < 1 {
+		p.y = 1
+	}
+	if p.y > p.s.height {
+		p.y = p.s.height
+	}
+}
+
+// previewFlags returns the flags for what Preview tweaks in o
+func previewFlags(o Options) string {
+	return fmt.Sprintf("-width %d -height %d -room_fill_rate %d -prune %d -seed %d", o.Width, o.Height, o.RoomFillRate, o.Prune, o.Seed)
+}
+
+// printStage writes the cells of the stage in view to w in color, for the
+// terminal in raw mode
+func (s *Stage) printStage(w io.Writer, view image.Rectangle) {
+	glyph := s.glyphs(false)
+	for y := view.Min.Y; y < view.Max.Y; y++ {
+		for x := view.Min.X; x < view.Max.X; x++ {
+			s.printCell(w, x, y, glyph(x, y))
+		}
+		fmt.Fprintf(w, "\r\n")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPreviewKeys(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Width, opts.Seed = 39, 1
+	p := &preview{opts: opts}
+	ctx := context.Background()
+	if err := p.regenerate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first := p.s.String()
+
+	for _, key := range []string{"W", "H", "F", "P", "n"} {
+		if message, _ := p.key(ctx, key); message != "" {
+			t.Fatalf("%q: %s", key, message)
+		}
+	}
+	want := Options{Width: 41, Height: 23, Seed: 2, RoomFillRate: 25, Prune: 1}
+	if o := p.opts; o.Width != want.Width || o.Height != want.Height || o.Seed != want.Seed || o.RoomFillRate != want.RoomFillRate || o.Prune != want.Prune {
+		t.Errorf("options are %s, want %s", previewFlags(o), previewFlags(want))
+	}
+	if p.s.width != 41 || p.s.height != 23 {
+		t.Errorf("stage is %dx%d, want 41x23", p.s.width, p.s.height)
+	}
+
+	// tweaking back makes the same stage again
+	for _, key := range []string{"w", "h", "f", "p", "N"} {
+		p.key(ctx, key)
+	}
+	if p.s.String() != first {
+		t.Error("the same options made a different stage")
+	}
+
+	p.opts.Width = 3
+	if message, _ := p.key(ctx, "w"); message == "" || p.opts.Width != 3 {
+		t.Errorf("shrank a 3 wide stage to %d", p.opts.Width)
+	}
+	if _, quit := p.key(ctx, "q"); !quit {
+		t.Error("q didn't quit")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math/rand"
+)
+
+// RegenerateRoom rerolls room i: its shape, a new room anywhere inside the
+// old one with maze grown around it, and what's in it, with the rest of the
+// stage left as it was. Doorways into the old room still lead in, through the
+// maze if the new room no longer reaches them, and the new room gets one or
+// two doorways of its own. The same seed rerolls it the same way.
+func (s *Stage) RegenerateRoom(i int, seed int64) error {
+	if i < 0 || i >= len(s.rooms) {
+		return fmt.Errorf("no room %d", i)
+	}
+	rng, err := s.rerollRNG(seed)
+	if err != nil {
+		return err
+	}
+	defer func(r *rand.Rand) { s.rng = r }(s.rng)
+	old := s.rooms[i]
+	area := image.Rect(old.x, old.y, old.x+old.width+1, old.y+old.height+1)
+	hole := func(x, y int) bool { return image.Pt(x, y).In(area) }
+	s.clear(hole)
+
+	// rooms are on even cells with even sizes, at least 4 across unless a
+	// paste has cut them down
+	room := old
+	if old.x%2 == 0 && old.width%2 == 0 && old.width >= 4 {
+		room.width = 4 + 2*rng.Intn((old.width-4)/2+1)
+		room.x = old.x + 2*rng.Intn((old.width-room.width)/2+1)
+	}
+	if old.y%2 == 0 && old.height%2 == 0 && old.height >= 4 {
+		room.height = 4 + 2*rng.Intn((old.height-4)/2+1)
+		room.y = old.y + 2*rng.Intn((old.height-room.height)/2+1)
+	}
+	for y := room.y; y <= room.y+room.height; y++ {
+		for x := room.x; x <= room.x+room.width; x++ {
+			s.setKind(x, y, Floor)
+		}
+	}
+	s.rooms[i] = room
+	s.roomsMoved()
+	s.roomPlaced(room)
+	s.regrow(area, rng)
+
+	// the old room's doorways open onto the maze now, unless they're still
+	// beside the room, and the new room gets doorways of its own
+	inRoom := image.Rect(room.x, room.y, room.x+room.width+1, room.y+room.height+1)
+	beside := func(d Tile, r image.Rectangle) bool {
+		for _, n := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			if image.Pt(d.x+n[0], d.y+n[1]).In(r) {
+				return true
+			}
+		}
+		return false
+	}
+	var doors []Tile
+	for _, d := range s.doors {
+		if s.at(d.x, d.y).kind == Door && beside(d, area) && !beside(d, inRoom) {
+			s.setKind(d.x, d.y, Floor)
+			continue
+		}
+		doors = append(doors, d)
+	}
+	s.doors, s.doorIndex, s.doorsIndexed = doors, nil, 0
+	spots := s.doorSpots(room)
+	for n := rng.Intn(2) + 1; n > 0 && len(spots) > 0; n-- {
+		j := rng.Intn(len(spots))
+		x, y := spots[j][0], spots[j][1]
+		spots = append(spots[:j], spots[j+1:]...)
+		s.setKind(x, y, Door)
+		s.doors = append(s.doors, s.at(x, y))
+		s.regionsJoined(x, y)
+	}
+	s.joinPockets()
+	s.rehomeKeys(hole)
+
+	if hole(s.entranceX, s.entranceY) && !(s.entranceX == s.upX && s.entranceY == s.upY) {
+		s.entranceX, s.entranceY = room.x+room.width/2, room.y+room.height/2
+	}
+	s.redress(hole, rng)
+	return nil
+}
+
+// RegenerateRegion rerolls the corridors of region id, as labeled by the
+// last call to Regions: the maze through them is grown again and what's in
+// them picked again, with the rooms and everything else left as they were.
+// The corridors' cells are left out of any region until Regions is called
+// again. The same seed rerolls them the same way.
+func (s *Stage) RegenerateRegion(id int, seed int64) error {
+	rng, err := s.rerollRNG(seed)
+	if err != nil {
+		return err
+	}
+	defer func(r *rand.Rand) { s.rng = r }(s.rng)
+	var area image.Rectangle
+	inRegion := make([]bool, len(s.cell))
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if _, ok := s.roomAt(x, y); ok || s.RegionAt(x, y) != id {
+				continue
+			}
+			inRegion[(y-1)*s.width+x-1] = true
+			area = area.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	if id == 0 || area.Empty() {
+		return fmt.Errorf("no corridors in region %d", id)
+	}
+	hole := func(x, y int) bool { return s.cellExists(x, y) && inRegion[(y-1)*s.width+x-1] }
+	s.clear(hole)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if hole(x, y) {
+				s.setRegion(x, y, 0)
+			}
+		}
+	}
+	s.regrow(area, rng)
+	s.joinPockets()
+	s.rehomeKeys(hole)
+	if !s.isOpen(s.entranceX, s.entranceY) {
+		s.PlaceEntrance()
+	}
+	s.redress(hole, rng)
+	return nil
+}
+
+// rerollRNG returns the random numbers to reroll part of the stage with
+func (s *Stage) rerollRNG(seed int64) (*rand.Rand, error) {
+	src, err := NewSource(s.opts.RNG, seed)
+	if err != nil {
+		return nil, err
+	}
+	return rand.New(src), nil
+}
+
+// clear fills the cells in the hole back in with wall, taking away whatever
+// was on them. Keys are kept, since a locked door somewhere may need them,
+// and the stairs stay where they are.
+func (s *Stage) clear(hole func(x, y int) bool) {
+	var monsters []*Monster
+	for _, m := range s.monsters {
+		if !hole(m.x, m.y) {
+			monsters = append(monsters, m)
+		}
+	}
+	s.monsters = monsters
+	var items []*Item
+	for _, it := range s.items {
+		if !hole(it.x, it.y) || it.ItemKind == keyKind {
+			items = append(items, it)
+		}
+	}
+	s.items = items
+	var traps []*Trap
+	for _, t := range s.traps {
+		if !hole(t.x, t.y) {
+			traps = append(traps, t)
+		}
+	}
+	s.traps = traps
+	var decorations []*Decoration
+	for _, d := range s.decorations {
+		if !hole(d.x, d.y) {
+			decorations = append(decorations, d)
+		}
+	}
+	s.decorations = decorations
+	var bridges []*Bridge
+	for _, b := range s.bridges {
+		if !hole(b.x, b.y) && !hole(b.x+(b.length-1)*b.dx, b.y+(b.length-1)*b.dy) {
+			bridges = append(bridges, b)
+		}
+	}
+	s.bridges = bridges
+
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if hole(x, y) && !s.isStairs(x, y) {
+				s.setFeature(x, y, NoFeature)
+				s.setKind(x, y, Wall)
+			}
+		}
+	}
+}
+
+// rehomeKeys moves any key left in the wall of the hole onto the first cell
+// of it that can be walked on
+func (s *Stage) rehomeKeys(hole func(x, y int) bool) {
+	for _, it := range s.items {
+		if it.ItemKind != keyKind || !hole(it.x, it.y) || s.IsWalkable(it.x, it.y) {
+			continue
+		}
+		for y := 1; y <= s.height && !s.IsWalkable(it.x, it.y); y++ {
+			for x := 1; x <= s.width; x++ {
+				if hole(x, y) && s.IsWalkable(x, y) && !s.isStairs(x, y) {
+					it.x, it.y = x, y
+					break
+				}
+			}
+		}
+	}
+}
+
+// regrow grows maze through the even cells inside area left solid, the same
+// as FillMaze fills the pockets rooms leave
+func (s *Stage) regrow(area image.Rectangle, rng *rand.Rand) {
+	s.rng = rng
+	for y := area.Min.Y + area.Min.Y%2; y < area.Max.Y; y += 2 {
+		for x := area.Min.X + area.Min.X%2; x < area.Max.X; x += 2 {
+			if s.at(x, y).kind == Wall && !s.isEdge(x, y) && !s.cancelled() {
+				s.growMaze(x, y)
+			}
+		}
+	}
+}
+
+// redress picks what's in the hole again: the stage is copied, the copy
+// furnished and stocked the way a new stage is, and whatever the copy got in
+// the hole is kept
+func (s *Stage) redress(hole func(x, y int) bool, rng *rand.Rand) {
+	scratch, _ := s.Crop(image.Rect(1, 1, s.width+1, s.height+1))
+	scratch.monsters, scratch.items, scratch.traps, scratch.decorations = nil, nil, nil, nil
+	scratch.rng = rng
+	scratch.AddFeatures()
+	scratch.AddMonsters()
+	scratch.AddItems()
+	scratch.AddTraps()
+	scratch.AddDecorations()
+
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if hole(x, y) && s.at(x, y).feature == NoFeature && scratch.at(x, y).feature != NoFeature {
+				s.setFeature(x, y, scratch.at(x, y).feature)
+			}
+		}
+	}
+	for _, m := range scratch.monsters {
+		if hole(m.x, m.y) {
+			s.monsters = append(s.monsters, m)
+		}
+	}
+	for _, it := range scratch.items {
+		if hole(it.x, it.y) {
+			s.items = append(s.items, it)
+		}
+	}
+	for _, t := range scratch.traps {
+		if hole(t.x, t.y) {
+			s.traps = append(s.traps, t)
+		}
+	}
+	for _, d := range scratch.decorations {
+		if hole(d.x, d.y) {
+			s.decorations = append(s.decorations, d)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestRegenerateRoom(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		s, err := New(WithSeed(seed), WithStocking(5, 5, 5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		twin, _ := s.Crop(image.Rect(1, 1, s.width+1, s.height+1))
+		before, _ := s.Crop(image.Rect(1, 1, s.width+1, s.height+1))
+		i := len(s.rooms) / 2
+		old := s.rooms[i]
+		if err := s.RegenerateRoom(i, 42); err != nil {
+			t.Fatal(err)
+		}
+		if report := s.Validate(); !report.Valid {
+			t.Errorf("seed %d: %v", seed, report.Failures)
+		}
+		if len(s.rooms) != len(before.rooms) {
+			t.Errorf("seed %d: %d rooms, want %d", seed, len(s.rooms), len(before.rooms))
+		}
+		room := s.rooms[i]
+		if room.x < old.x || room.y < old.y || room.x+room.width > old.x+old.width || room.y+room.height > old.y+old.height {
+			t.Errorf("seed %d: room %+v grew out of %+v", seed, room, old)
+		}
+		// only the old room, the wall around it, and the walls around that
+		// the maze can be joined back up through, have changed
+		near := image.Rect(old.x-2, old.y-2, old.x+old.width+3, old.y+old.height+3)
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				if !image.Pt(x, y).In(near) && s.at(x, y).kind != before.at(x, y).kind && before.at(x, y).kind != Wall {
+					t.Errorf("seed %d: (%d, %d) far from the room changed from %v to %v", seed, x, y, before.at(x, y).kind, s.at(x, y).kind)
+				}
+			}
+		}
+
+		if err := twin.RegenerateRoom(i, 42); err != nil {
+			t.Fatal(err)
+		}
+		if twin.String() != s.String() {
+			t.Errorf("seed %d: the same seed rerolled the room differently", seed)
+		}
+	}
+	s, _ := New(WithSeed(1))
+	if err := s.RegenerateRoom(len(s.rooms), 1); err == nil {
+		t.Error("rerolling a room past the last should fail")
+	}
+}
+
+func TestRegenerateRegion(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		s, err := New(WithSeed(seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the biggest stretch of corridors
+		var biggest Region
+		for _, r := range s.Regions() {
+			if r.Kind == "corridors" && r.Size > biggest.Size {
+				biggest = r
+			}
+		}
+		if biggest.ID == 0 {
+			continue
+		}
+		before := s.String()
+		if err := s.RegenerateRegion(biggest.ID, 7); err != nil {
+			t.Fatal(err)
+		}
+		if s.String() == before {
+			t.Errorf("seed %d: rerolling region %d changed nothing", seed, biggest.ID)
+		}
+		if report := s.Validate(); !report.Valid {
+			t.Errorf("seed %d: %v", seed, report.Failures)
+		}
+	}
+	s, _ := New(WithSeed(1))
+	s.Regions()
+	if err := s.RegenerateRegion(0, 1); err == nil {
+		t.Error("rerolling region 0 should fail")
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import "fmt"
+
+// Region is one connected open area of the stage: a stretch of cells that can
+// be walked between without going through a door. Kind is "room" when every
+// cell is inside the rooms, "corridors" when none are, and "mixed" when
+// something like a river has joined a room to the corridors outside it. Doors
+// counts the doorways leading out of it.
+type Region struct {
+	ID    int    `json:"id"`
+	Kind  string `json:"kind"`
+	Size  int    `json:"size"`
+	MinX  int    `json:"min_x"`
+	MinY  int    `json:"min_y"`
+	MaxX  int    `json:"max_x"`
+	MaxY  int    `json:"max_y"`
+	Doors int    `json:"doors"`
+}
+
+// Regions flood-fills the walkable cells into regions, labels every cell with
+// the ID of the region it is in, and returns them in ID order. IDs start at
+// 1; doorways and cells nothing can stand on are left in region 0.
+func (s *Stage) Regions() []Region {
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			s.setRegion(x, y, 0)
+		}
+	}
+
+	regions := make([]Region, 0)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if !s.inRegion(x, y) || s.at(x, y).region != 0 {
+				continue
+			}
+			regions = append(regions, s.fillRegion(x, y, len(regions)+1))
+		}
+	}
+	return regions
+}
+
+// fillRegion labels everything connected to x, y with id and measures it
+func (s *Stage) fillRegion(x, y, id int) Region {
+	r := Region{ID: id, MinX: x, MinY: y, MaxX: x, MaxY: y}
+	inRooms, outside := 0, 0
+	doors := map[int]bool{}
+	s.setRegion(x, y, id)
+	queue := []Tile{s.at(x, y)}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+
+		r.Size++
+		if t.x < r.MinX {
+			r.MinX = t.x
+		}
+		if t.x > r.MaxX {
+			r.MaxX = t.x
+		}
+		if t.y < r.MinY {
+			r.MinY = t.y
+		}
+		if t.y > r.MaxY {
+			r.MaxY = t.y
+		}
+		if _, ok := s.roomAt(t.x, t.y); ok {
+			inRooms++
+		} else {
+			outside++
+		}
+
+		for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			nx, ny := s.step(t.x, t.y, d[0], d[1])
+			if s.isDoor(nx, ny) && !doors[(ny-1)*s.width+nx-1] {
+				doors[(ny-1)*s.width+nx-1] = true
+				r.Doors++
+			}
+			if !s.inRegion(nx, ny) || s.at(nx, ny).region != 0 {
+				continue
+			}
+			s.setRegion(nx, ny, id)
+			queue = append(queue, s.at(nx, ny))
+		}
+	}
+
+	switch {
+	case outside == 0:
+		r.Kind = "room"
+	case inRooms == 0:
+		r.Kind = "corridors"
+	default:
+		r.Kind = "mixed"
+	}
+	return r
+}
+
+// inRegion reports if x, y belongs in a region: it can be walked on and isn't
+// a doorway
+func (s *Stage) inRegion(x, y int) bool {
+	return s.IsWalkable(x, y) && !s.isDoor(x, y)
+}
+
+// setRegion labels the cell at x, y with a region ID
+func (s *Stage) setRegion(x, y, id int) {
+	tmpTile := s.at(x, y)
+	tmpTile.region = int32(id)
+	s.set(x, y, tmpTile)
+}
+
+// RegionAt returns the ID of the region x, y was put in by the last call to
+// Regions, or 0 if it isn't in one
+func (s *Stage) RegionAt(x, y int) int {
+	if !s.cellExists(x, y) {
+		return 0
+	}
+	return int(s.at(x, y).region)
+}
+
+// MergeRegions joins region b onto region a by carving the shortest run of
+// wall between them, going around any other region so it isn't joined too.
+// Every cell of b and the carved cells are labeled a, and a's updated
+// metadata is returned. Labels are the ones from the last call to Regions.
+func (s *Stage) MergeRegions(a, b int) (Region, error) {
+	if a == b {
+		return Region{}, fmt.Errorf("can't merge region %d with itself", a)
+	}
+	seedX, seedY, ok := s.regionCell(a)
+	if !ok {
+		return Region{}, fmt.Errorf("no region %d", a)
+	}
+	if _, _, ok := s.regionCell(b); !ok {
+		return Region{}, fmt.Errorf("no region %d", b)
+	}
+
+	// breadth first through the walls from every cell of a, so the first wall
+	// found touching b ends the shortest connector
+	touches := func(x, y, id int) bool {
+		for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			if s.RegionAt(x+d[0], y+d[1]) == id {
+				return true
+			}
+		}
+		return false
+	}
+	digs := func(x, y int) bool {
+		if !s.cellExists(x, y) || s.isEdge(x, y) || s.at(x, y).kind != Wall {
+			return false
+		}
+		for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			if id := s.RegionAt(x+d[0], y+d[1]); id != 0 && id != a && id != b {
+				return false
+			}
+		}
+		return true
+	}
+	// from is the cell index, plus one, each wall was dug to from
+	from := make([]int, len(s.cell))
+	reached := func(x, y int) bool {
+		return from[(y-1)*s.width+x-1] != 0
+	}
+	queue := make([]Tile, 0)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if s.RegionAt(x, y) != a {
+				continue
+			}
+			for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+				nx, ny := x+d[0], y+d[1]
+				if !digs(nx, ny) || reached(nx, ny) {
+					continue
+				}
+				from[(ny-1)*s.width+nx-1] = (y-1)*s.width + x
+				queue = append(queue, s.at(nx, ny))
+			}
+		}
+	}
+	var end *Tile
+	for len(queue) > 0 && end == nil {
+		t := queue[0]
+		queue = queue[1:]
+		if touches(t.x, t.y, b) {
+			end = &t
+			break
+		}
+		for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			nx, ny := t.x+d[0], t.y+d[1]
+			if !digs(nx, ny) || reached(nx, ny) {
+				continue
+			}
+			from[(ny-1)*s.width+nx-1] = (t.y-1)*s.width + t.x
+			queue = append(queue, s.at(nx, ny))
+		}
+	}
+	if end == nil {
+		return Region{}, fmt.Errorf("no wall between regions %d and %d can be carved through", a, b)
+	}
+
+	for t := *end; t.kind == Wall; t = s.cell[from[(t.y-1)*s.width+t.x-1]-1] {
+		s.setKind(t.x, t.y, Floor)
+	}
+	s.regionsJoined(end.x, end.y)
+	s.relabel(a, b)
+	return s.fillRegion(seedX, seedY, a), nil
+}
+
+// SplitRegion walls up the chokepoint of region id that cuts it most evenly
+// in two (or more). The largest piece keeps id and the rest get new IDs after
+// the highest one in use; all of them are returned, largest first. Only bare
+// floor with nothing on it is walled up.
+func (s *Stage) SplitRegion(id int) ([]Region, error) {
+	if _, _, ok := s.regionCell(id); !ok {
+		return nil, fmt.Errorf("no region %d", id)
+	}
+
+	// walling up a chokepoint is tried on the labels alone, so nothing is
+	// carved, and no hooks are called, until the best one is picked
+	bestX, bestY, bestSmallest := 0, 0, 0
+	for i, smallest := range s.chokepoints(id) {
+		x, y := i%s.width+1, i/s.width+1
+		if smallest > bestSmallest && s.canWallUp(x, y) {
+			bestX, bestY, bestSmallest = x, y, smallest
+		}
+	}
+	if bestSmallest == 0 {
+		return nil, fmt.Errorf("region %d has no chokepoint to wall up", id)
+	}
+
+	s.setKind(bestX, bestY, Wall)
+	tmpTile := s.at(bestX, bestY)
+	tmpTile.ramp, tmpTile.ledge = false, false
+	s.set(bestX, bestY, tmpTile)
+
+	seeds, sizes := s.pieces(id)
+	largest := 0
+	for i, size := range sizes {
+		if size > sizes[largest] {
+			largest = i
+		}
+	}
+	next := s.highestRegion() + 1
+	s.relabel(id)
+	split := []Region{s.fillRegion(seeds[largest].x, seeds[largest].y, id)}
+	for i, seed := range seeds {
+		if i != largest {
+			split = append(split, s.fillRegion(seed.x, seed.y, next))
+			next++
+		}
+	}
+	return split, nil
+}
+
+// canWallUp reports if x, y is bare floor with nothing on it
+func (s *Stage) canWallUp(x, y int) bool {
+	return s.at(x, y).kind == Floor && s.at(x, y).feature == NoFeature && !s.isStairs(x, y) &&
+		(x != s.entranceX || y != s.entranceY) && s.monsterAt(x, y) == nil && s.itemAt(x, y) == nil &&
+		s.trapAt(x, y) == nil && s.decorationAt(x, y) == nil
+}
+
+// chokepoints finds the cells of region id that would cut it into pieces if
+// walled up, with a depth first search for its articulation points, and
+// returns the size of the smallest piece each would leave, indexed like the
+// stage's cells. Cells that cut nothing off are left 0.
+func (s *Stage) chokepoints(id int) []int {
+	n := len(s.cell)
+	in := func(i int) bool {
+		x, y := i%s.width+1, i/s.width+1
+		return s.RegionAt(x, y) == id && s.inRegion(x, y)
+	}
+	// order is when each cell was reached, from 1; low is the earliest cell
+	// reachable from its subtree without going back through its parent
+	order, low, size := make([]int, n), make([]int, n), make([]int, n)
+	parent := make([]int, n)
+	// cut and cutSmallest are how many cells are cut off below each cell,
+	// and the smallest subtree that is
+	cut, cutSmallest, pieces := make([]int, n), make([]int, n), make([]int, n)
+	smallest := make([]int, n)
+	neighbors := func(i int) []int {
+		x, y := i%s.width+1, i/s.width+1
+		var out []int
+		for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			if nx, ny := x+d[0], y+d[1]; s.cellExists(nx, ny) {
+				if j := (ny-1)*s.width + nx - 1; in(j) {
+					out = append(out, j)
+				}
+			}
+		}
+		return out
+	}
+
+	type frame struct {
+		i    int
+		next []int
+	}
+	count := 0
+	for root := 0; root < n; root++ {
+		if order[root] != 0 || !in(root) {
+			continue
+		}
+		var reached []int
+		visit := func(i, from int) frame {
+			count++
+			order[i], low[i], size[i], parent[i] = count, count, 1, from
+			reached = append(reached, i)
+			return frame{i, neighbors(i)}
+		}
+		stack := []frame{visit(root, -1)}
+		for len(stack) > 0 {
+			f := &stack[len(stack)-1]
+			if len(f.next) > 0 {
+				j := f.next[0]
+				f.next = f.next[1:]
+				if order[j] == 0 {
+					stack = append(stack, visit(j, f.i))
+				} else if j != parent[f.i] && order[j] < low[f.i] {
+					low[f.i] = order[j]
+				}
+				continue
+			}
+			stack = stack[:len(stack)-1]
+			i, p := f.i, parent[f.i]
+			if p < 0 {
+				continue
+			}
+			if low[i] < low[p] {
+				low[p] = low[i]
+			}
+			size[p] += size[i]
+			if low[i] >= order[p] {
+				cut[p] += size[i]
+				pieces[p]++
+				if cutSmallest[p] == 0 || size[i] < cutSmallest[p] {
+					cutSmallest[p] = size[i]
+				}
+			}
+		}
+
+		// every subtree below the root is cut off from the others, and
+		// below any other cell from the rest of the region above it
+		total := size[root]
+		for _, i := range reached {
+			switch {
+			case i == root && pieces[i] >= 2:
+				smallest[i] = cutSmallest[i]
+			case i != root && pieces[i] >= 1:
+				smallest[i] = cutSmallest[i]
+				if rest := total - 1 - cut[i]; rest < smallest[i] {
+					smallest[i] = rest
+				}
+			}
+		}
+	}
+	return smallest
+}
+
+// pieces flood-fills the walkable cells labeled id without relabeling them,
+// returning a cell from each connected piece and how many cells it has
+func (s *Stage) pieces(id int) (seeds []Tile, sizes []int) {
+	seen := make([]bool, len(s.cell))
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if seen[(y-1)*s.width+x-1] || s.RegionAt(x, y) != id || !s.inRegion(x, y) {
+				continue
+			}
+			seeds = append(seeds, s.at(x, y))
+			size := 0
+			queue := []Tile{s.at(x, y)}
+			seen[(y-1)*s.width+x-1] = true
+			for len(queue) > 0 {
+				t := queue[0]
+				queue = queue[1:]
+				size++
+				for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+					nx, ny := t.x+d[0], t.y+d[1]
+					if s.RegionAt(nx, ny) != id || !s.inRegion(nx, ny) || seen[(ny-1)*s.width+nx-1] {
+						continue
+					}
+					seen[(ny-1)*s.width+nx-1] = true
+					queue = append(queue, s.at(nx, ny))
+				}
+			}
+			sizes = append(sizes, size)
+		}
+	}
+	return seeds, sizes
+}
+
+// regionCell returns the first cell labeled id, reading left to right and
+// top to bottom
+func (s *Stage) regionCell(id int) (x, y int, ok bool) {
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if id != 0 && s.RegionAt(x, y) == id {
+				return x, y, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// highestRegion returns the largest region ID any cell is labeled with
+func (s *Stage) highestRegion() int {
+	highest := 0
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if s.RegionAt(x, y) > highest {
+				highest = s.RegionAt(x, y)
+			}
+		}
+	}
+	return highest
+}
+
+// relabel takes every cell labeled with one of ids out of its region
+func (s *Stage) relabel(ids ...int) {
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			for _, id := range ids {
+				if s.RegionAt(x, y) == id {
+					s.setRegion(x, y, 0)
+				}
+			}
+		}
+	}
+}
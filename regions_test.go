@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestSplitRegion(t *testing.T) {
+	carved := 0
+	s, err := New(WithSeed(1), WithHooks(Hooks{OnCellCarved: func(*Stage, int, int) { carved++ }}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := s.Regions()
+	carved = 0
+	for _, r := range regions {
+		split, err := s.SplitRegion(r.ID)
+		if err != nil {
+			continue
+		}
+		if carved != 0 {
+			t.Errorf("region %d: %d cells carved while splitting", r.ID, carved)
+		}
+		if len(split) < 2 {
+			t.Fatalf("region %d split into %d pieces", r.ID, len(split))
+		}
+		if split[0].ID != r.ID {
+			t.Errorf("largest piece is region %d, want %d", split[0].ID, r.ID)
+		}
+		size := 0
+		for i, piece := range split {
+			size += piece.Size
+			if i > 0 && piece.Size > split[0].Size {
+				t.Errorf("piece %d has %d cells, more than the largest's %d", piece.ID, piece.Size, split[0].Size)
+			}
+		}
+		if size != r.Size-1 {
+			t.Errorf("pieces have %d cells, want %d", size, r.Size-1)
+		}
+		return
+	}
+	t.Fatal("no region had a chokepoint")
+}
+
+func TestSplitRegionErrors(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Regions()
+	if _, err := s.SplitRegion(0); err == nil {
+		t.Error("split region 0")
+	}
+	if _, err := s.SplitRegion(s.highestRegion() + 1); err == nil {
+		t.Error("split a region that doesn't exist")
+	}
+}
+
+func TestMergeRegions(t *testing.T) {
+	s, err := New(WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := s.Regions()
+	if len(regions) < 2 {
+		t.Fatalf("only %d regions", len(regions))
+	}
+	a, b := regions[0], regions[1]
+	merged, err := s.MergeRegions(a.ID, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.ID != a.ID {
+		t.Errorf("merged into region %d, want %d", merged.ID, a.ID)
+	}
+	if merged.Size <= a.Size+b.Size {
+		t.Errorf("merged region has %d cells, want more than %d", merged.Size, a.Size+b.Size)
+	}
+	if _, _, ok := s.regionCell(b.ID); ok {
+		t.Errorf("region %d still labeled after merging", b.ID)
+	}
+	if _, err := s.MergeRegions(a.ID, a.ID); err == nil {
+		t.Error("merged a region with itself")
+	}
+}
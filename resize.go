@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// resizeKey is what a keyboard reads when the terminal changes size, so a
+// screen waiting on a key draws itself again laid out for the new size
+const resizeKey = "resize"
+
+// keyboard reads keypresses off the terminal on a goroutine of its own, so
+// waiting for one can be cut short when the terminal is resized. keys is
+// closed when there are no more to read, and done once the keyboard is.
+type keyboard struct {
+	keys    chan string
+	resized <-chan os.Signal
+	stop    func()
+	done    chan struct{}
+}
+
+// newKeyboard starts reading keypresses from r
+func newKeyboard(r io.Reader) *keyboard {
+	resized, stop := watchResize()
+	return newKeyboardOn(r, resized, stop)
+}
+
+// newKeyboardOn starts reading keypresses from a terminal other than this
+// process's own, r, which says it was resized on resized; stop is called
+// when it's closed
+func newKeyboardOn(r io.Reader, resized <-chan os.Signal, stop func()) *keyboard {
+	k := &keyboard{keys: make(chan string), resized: resized, stop: stop, done: make(chan struct{})}
+	go func() {
+		keys := bufio.NewReader(r)
+		for {
+			key, err := readKey(keys)
+			if err != nil {
+				close(k.keys)
+				return
+			}
+			select {
+			case k.keys <- key:
+			case <-k.done:
+				// nothing's reading keys anymore
+				return
+			}
+		}
+	}()
+	return k
+}
+
+// close stops watching for the terminal to be resized, and passing on keys
+func (k *keyboard) close() {
+	k.stop()
+	close(k.done)
+}
+
+// read waits for the next keypress, returning resizeKey if the terminal is
+// resized first
+func (k *keyboard) read() (string, error) {
+	select {
+	case key, ok := <-k.keys:
+		if !ok {
+			return "", io.EOF
+		}
+		return key, nil
+	case <-k.resized:
+		return resizeKey, nil
+	}
+}
+
+// poll returns a key pressed, or resizeKey if the terminal was resized,
+// without waiting for one; ok is false if there's none
+func (k *keyboard) poll() (key string, ok bool, err error) {
+	select {
+	case key, open := <-k.keys:
+		if !open {
+			return "", false, io.EOF
+		}
+		return key, true, nil
+	case <-k.resized:
+		return resizeKey, true, nil
+	default:
+		return "", false, nil
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import "os"
+
+// watchResize returns a channel that never gets a value, since there's no
+// signal for the terminal changing size here, and a func that does nothing
+func watchResize() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
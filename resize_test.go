@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestKeyboard(t *testing.T) {
+	k := newKeyboard(strings.NewReader("q\x1b[A"))
+	for _, want := range []string{"q", "\x1b[A"} {
+		if key, err := k.read(); err != nil || key != want {
+			t.Errorf("read %q, %v, want %q", key, err, want)
+		}
+	}
+	if _, err := k.read(); err == nil {
+		t.Error("read past the end of the keys")
+	}
+
+	// a resize cuts waiting short
+	resized := make(chan os.Signal, 1)
+	resized <- os.Interrupt
+	k = &keyboard{keys: make(chan string), resized: resized}
+	if key, err := k.read(); err != nil || key != resizeKey {
+		t.Errorf("read %q, %v, want a resize", key, err)
+	}
+}
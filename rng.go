@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// rngBackends are the generators a source can draw from. go is the standard
+// library's; pcg and xoshiro are faster, with better statistical quality.
+var rngBackends = map[string]func(seed int64) rand.Source64{
+	"go": func(seed int64) rand.Source64 {
+		return rand.NewSource(seed).(rand.Source64)
+	},
+	"pcg": func(seed int64) rand.Source64 {
+		p := &pcgSource{}
+		p.Seed(seed)
+		return p
+	},
+	"xoshiro": func(seed int64) rand.Source64 {
+		x := &xoshiroSource{}
+		x.Seed(seed)
+		return x
+	},
+}
+
+// NewSource returns the source a stage generated from seed draws from, using
+// the named backend. It counts how many values it hands out so a play session
+// can be saved and resumed; any other rand.Source works for generating, but
+// can't be saved.
+func NewSource(backend string, seed int64) (rand.Source, error) {
+	if _, ok := rngBackends[backend]; !ok {
+		names := make([]string, 0, len(rngBackends))
+		for n := range rngBackends {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown random number generator %q, want one of %v", backend, names)
+	}
+	return newCountingSource(backend, seed), nil
+}
+
+// The random streams a stage draws from, one for each phase of generating
+// it and one for playing it. Each is seeded from the stage's source up front,
+// so a change to how much one phase draws, like stocking more monsters,
+// leaves what every other phase makes from the same seed alone.
+const (
+	roomStream = iota
+	mazeStream
+	connectStream
+	stairStream
+	terrainStream
+	stockStream
+	playStream
+	customStream
+	streamCount
+)
+
+// seedStreams seeds every stream from src. A source from NewSource seeds
+// streams from the same backend; any other seeds the standard library's.
+func (s *Stage) seedStreams(src rand.Source) {
+	r := rand.New(src)
+	c, counting := src.(*countingSource)
+	for i := range s.streams {
+		seed := r.Int63()
+		if counting {
+			s.streams[i] = newCountingSource(c.backend, seed)
+		} else {
+			s.streams[i] = rand.NewSource(seed)
+		}
+	}
+	s.useStream(playStream)
+}
+
+// useStream makes the stage's random choices draw from stream i
+func (s *Stage) useStream(i int) {
+	s.rng = rand.New(s.streams[i])
+}
+
+// countingSource remembers its backend, its seed, and how many values it has
+// handed out. Replaying that many values from the same seed brings a new
+// source to the exact same state, which is how play sessions are saved and
+// resumed.
+type countingSource struct {
+	backend string
+	seed    int64
+	draws   uint64
+	src     rand.Source64
+}
+
+func newCountingSource(backend string, seed int64) *countingSource {
+	return &countingSource{backend: backend, seed: seed, src: rngBackends[backend](seed)}
+}
+
+func (c *countingSource) Int63() int64 {
+	c.draws++
+	return c.src.Int63()
+}
+
+func (c *countingSource) Uint64() uint64 {
+	c.draws++
+	return c.src.Uint64()
+}
+
+func (c *countingSource) Seed(seed int64) {
+	c.seed, c.draws = seed, 0
+	c.src.Seed(seed)
+}
+
+// restoreSource returns seed's source from backend with draws values already
+// handed out
+func restoreSource(backend string, seed int64, draws uint64) (*countingSource, error) {
+	if _, ok := rngBackends[backend]; !ok {
+		return nil, fmt.Errorf("unknown random number generator %q", backend)
+	}
+	c := newCountingSource(backend, seed)
+	for c.draws < draws {
+		c.Int63()
+	}
+	return c, nil
+}
+
+// splitMix64 steps state and returns the next value. It spreads a single
+// seed out over the larger states of the other generators.
+func splitMix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// pcgSource is a 128 bit PCG generator with the DXSM output function
+type pcgSource struct {
+	hi, lo uint64
+}
+
+func (p *pcgSource) Seed(seed int64) {
+	state := uint64(seed)
+	p.hi, p.lo = splitMix64(&state), splitMix64(&state)
+}
+
+func (p *pcgSource) Uint64() uint64 {
+	const (
+		mulHi = 2549297995355413924
+		mulLo = 4865540595714422341
+		incHi = 6364136223846793005
+		incLo = 1442695040888963407
+	)
+	// state = state * mul + inc
+	hi, lo := bits.Mul64(p.lo, mulLo)
+	hi += p.hi*mulLo + p.lo*mulHi
+	lo, c := bits.Add64(lo, incLo, 0)
+	hi, _ = bits.Add64(hi, incHi, c)
+	p.hi, p.lo = hi, lo
+
+	hi ^= hi >> 32
+	hi *= 0xda942042e4dd58b5
+	hi ^= hi >> 48
+	return hi * (lo | 1)
+}
+
+func (p *pcgSource) Int63() int64 {
+	return int64(p.Uint64() >> 1)
+}
+
+// xoshiroSource is a xoshiro256** generator
+type xoshiroSource struct {
+	s [4]uint64
+}
+
+func (x *xoshiroSource) Seed(seed int64) {
+	state := uint64(seed)
+	for i := range x.s {
+		x.s[i] = splitMix64(&state)
+	}
+}
+
+func (x *xoshiroSource) Uint64() uint64 {
+	s := &x.s
+	out := bits.RotateLeft64(s[1]*5, 7) * 9
+	t := s[1] << 17
+	s[2] ^= s[0]
+	s[3] ^= s[1]
+	s[1] ^= s[2]
+	s[0] ^= s[3]
+	s[2] ^= t
+	s[3] = bits.RotateLeft64(s[3], 45)
+	return out
+}
+
+func (x *xoshiroSource) Int63() int64 {
+	return int64(x.Uint64() >> 1)
+}
+
+// seedFlag is the -seed flag. A number is used as the seed as is; anything
+// else is hashed into one, so seeds can have memorable names.
+type seedFlag struct {
+	seed *int64
+	name *string
+}
+
+func (f seedFlag) String() string {
+	if f.name == nil {
+		return "0"
+	}
+	if *f.name != "" {
+		return *f.name
+	}
+	return strconv.FormatInt(*f.seed, 10)
+}
+
+func (f seedFlag) Set(value string) error {
+	*f.seed, *f.name = ParseSeed(value), ""
+	if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+		*f.name = value
+	}
+	return nil
+}
+
+// ParseSeed returns the seed a -seed value stands for: the number itself, or
+// the FNV-1a hash of anything that isn't one
+func ParseSeed(value string) int64 {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	return int64(h.Sum64())
+}
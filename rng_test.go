@@ -0,0 +1,152 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSourcesAreDeterministic(t *testing.T) {
+	for backend := range rngBackends {
+		a, err := NewSource(backend, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := NewSource(backend, 42)
+		c, _ := NewSource(backend, 43)
+		same := true
+		for i := 0; i < 100; i++ {
+			x, y, z := a.Int63(), b.Int63(), c.Int63()
+			if x != y {
+				t.Fatalf("%s: draw %d is %d then %d from the same seed", backend, i, x, y)
+			}
+			same = same && x == z
+		}
+		if same {
+			t.Errorf("%s: seeds 42 and 43 drew the same values", backend)
+		}
+	}
+}
+
+func TestSourceCountsDraws(t *testing.T) {
+	for backend := range rngBackends {
+		src, _ := NewSource(backend, 7)
+		c := src.(*countingSource)
+		for i := 0; i < 10; i++ {
+			c.Int63()
+		}
+		for i := 0; i < 5; i++ {
+			c.Uint64()
+		}
+		if c.draws != 15 {
+			t.Errorf("%s: counted %d draws, want 15", backend, c.draws)
+		}
+
+		restored, err := restoreSource(backend, 7, c.draws)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			if got, want := restored.Int63(), c.Int63(); got != want {
+				t.Fatalf("%s: draw %d after restoring is %d, want %d", backend, i, got, want)
+			}
+		}
+	}
+}
+
+func TestNewSourceRejectsUnknownBackend(t *testing.T) {
+	if _, err := NewSource("mersenne", 1); err == nil {
+		t.Error("made a source from an unknown backend")
+	}
+	if _, err := restoreSource("mersenne", 1, 0); err == nil {
+		t.Error("restored a source from an unknown backend")
+	}
+}
+
+func TestParseSeed(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  int64
+	}{
+		{"0", 0},
+		{"42", 42},
+		{"-7", -7},
+		{"9223372036854775807", 9223372036854775807},
+		// FNV-1a of the empty string and of "a"
+		{"", -3750763034362895579},
+		{"a", -5808556873153909620},
+	} {
+		if got := ParseSeed(tt.value); got != tt.want {
+			t.Errorf("ParseSeed(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+	if ParseSeed("dragon") != ParseSeed("dragon") || ParseSeed("dragon") == ParseSeed("wyrm") {
+		t.Error("named seeds don't hash consistently")
+	}
+}
+
+func TestNewIsDeterministic(t *testing.T) {
+	for backend := range rngBackends {
+		a, err := New(WithSeed(11), WithRNG(backend))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := New(WithSeed(11), WithRNG(backend))
+		if a.String() != b.String() {
+			t.Errorf("%s: seed 11 made two different stages", backend)
+		}
+	}
+	a, _ := New(WithSource(rand.NewSource(11)))
+	b, _ := New(WithSource(rand.NewSource(11)))
+	if a.String() != b.String() {
+		t.Error("the same source made two different stages")
+	}
+}
+
+func TestConcurrentGenerationsDontCrossTalk(t *testing.T) {
+	want := make([]string, 8)
+	for i := range want {
+		s, _ := New(WithSeed(int64(i+1)), WithTheme(themes["crypt"]))
+		want[i] = s.String()
+	}
+	got := make([]string, len(want))
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, _ := New(WithSeed(int64(i+1)), WithTheme(themes["crypt"]))
+			got[i] = s.String()
+		}(i)
+	}
+	wg.Wait()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("seed %d came out different generated alongside others", i+1)
+		}
+	}
+}
+
+func TestStockingLeavesLayoutAlone(t *testing.T) {
+	layout := func(s *Stage) string {
+		b := make([]byte, 0, len(s.cell))
+		for _, c := range s.cell {
+			if c.kind == Wall {
+				b = append(b, '#')
+			} else {
+				b = append(b, '.')
+			}
+		}
+		return string(b)
+	}
+	for seed := int64(1); seed <= 5; seed++ {
+		few, _ := New(WithSeed(seed), WithStocking(1, 1, 1))
+		many, _ := New(WithSeed(seed), WithStocking(10, 5, 10))
+		if layout(few) != layout(many) {
+			t.Errorf("seed %d: stocking more changed the layout", seed)
+		}
+		if len(few.monsters) >= len(many.monsters) {
+			t.Errorf("seed %d: %d monsters stocking few, %d stocking many", seed, len(few.monsters), len(many.monsters))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// roll20Square is how many pixels across a square of a Roll20 page is
+const roll20Square = 70
+
+// Roll20Page is what it takes to set up the stage on a Roll20 page Width by
+// Height squares: the Image to put on the map layer, drawn by WritePNG at
+// roll20Square pixels a square, and the walls and doors for dynamic lighting,
+// in pixels from the page's top left corner, to be made with the API's
+// createObj.
+type Roll20Page struct {
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Image  string       `json:"image"`
+	Walls  []Roll20Path `json:"walls"`
+	Doors  []Roll20Door `json:"doors"`
+}
+
+// Roll20Path is a path on the walls layer, centered at Left, Top in a box
+// Width by Height, with Path its points from the box's top left corner as
+// Roll20 writes them
+type Roll20Path struct {
+	Layer  string `json:"layer"`
+	Left   int    `json:"left"`
+	Top    int    `json:"top"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Path   string `json:"path"`
+}
+
+// Roll20Door is a door centered at X, Y, running between its handles, each
+// from the center
+type Roll20Door struct {
+	X        int           `json:"x"`
+	Y        int           `json:"y"`
+	IsOpen   bool          `json:"isOpen"`
+	IsLocked bool          `json:"isLocked"`
+	Path     Roll20Handles `json:"path"`
+}
+
+type Roll20Handles struct {
+	Handle0 PointJSON `json:"handle0"`
+	Handle1 PointJSON `json:"handle1"`
+}
+
+// Roll20 returns the stage set up for a Roll20 page, over the image at image
+func (s *Stage) Roll20(image string) Roll20Page {
+	page := Roll20Page{
+		Width:  s.width,
+		Height: s.height,
+		Image:  image,
+		Walls:  make([]Roll20Path, 0),
+		Doors:  make([]Roll20Door, 0, len(s.doors)),
+	}
+	for _, run := range s.wallRuns() {
+		x0, y0, x1, y1 := run[0]*roll20Square, run[1]*roll20Square, run[2]*roll20Square, run[3]*roll20Square
+		page.Walls = append(page.Walls, Roll20Path{
+			Layer:  "walls",
+			Left:   (x0 + x1) / 2,
+			Top:    (y0 + y1) / 2,
+			Width:  x1 - x0,
+			Height: y1 - y0,
+			Path:   fmt.Sprintf(`[["M",0,0],["L",%d,%d]]`, x1-x0, y1-y0),
+		})
+	}
+	for _, d := range s.doors {
+		line := s.doorway(d.x, d.y)
+		x, y := (d.x-1)*roll20Square+roll20Square/2, (d.y-1)*roll20Square+roll20Square/2
+		half := PointJSON{X: roll20Square / 2}
+		if line[0] == line[2] {
+			half = PointJSON{Y: roll20Square / 2}
+		}
+		page.Doors = append(page.Doors, Roll20Door{
+			X:        x,
+			Y:        y,
+			IsLocked: s.at(d.x, d.y).kind == LockedDoor,
+			Path:     Roll20Handles{Handle0: PointJSON{X: -half.X, Y: -half.Y}, Handle1: half},
+		})
+	}
+	return page
+}
+
+// WriteRoll20 writes the stage set up for a Roll20 page as indented JSON
+func (s *Stage) WriteRoll20(w io.Writer, image string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.Roll20(image))
+}
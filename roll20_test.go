@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRoll20(t *testing.T) {
+	s, err := New(WithSize(41, 21), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := s.doors[0]
+	locked.kind = LockedDoor
+	s.set(locked.x, locked.y, locked)
+
+	var b strings.Builder
+	if err := s.WriteRoll20(&b, "dungeon.png"); err != nil {
+		t.Fatal(err)
+	}
+	var page Roll20Page
+	if err := json.Unmarshal([]byte(b.String()), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Width != 41 || page.Height != 21 || page.Image != "dungeon.png" {
+		t.Errorf("page is %d by %d squares under %q", page.Width, page.Height, page.Image)
+	}
+
+	runs := s.wallRuns()
+	if len(page.Walls) != len(runs) {
+		t.Fatalf("%d walls, want %d", len(page.Walls), len(runs))
+	}
+	for i, w := range page.Walls {
+		r := runs[i]
+		if w.Left-w.Width/2 != r[0]*roll20Square || w.Top-w.Height/2 != r[1]*roll20Square {
+			t.Errorf("wall %+v doesn't start at %d, %d", w, r[0], r[1])
+		}
+		if want := fmt.Sprintf(`[["M",0,0],["L",%d,%d]]`, (r[2]-r[0])*roll20Square, (r[3]-r[1])*roll20Square); w.Path != want || w.Layer != "walls" {
+			t.Errorf("wall %+v, want path %s", w, want)
+		}
+	}
+
+	if len(page.Doors) != len(s.doors) {
+		t.Fatalf("%d doors, want %d", len(page.Doors), len(s.doors))
+	}
+	for i, d := range page.Doors {
+		door := s.doors[i]
+		if d.X != door.x*roll20Square-roll20Square/2 || d.Y != door.y*roll20Square-roll20Square/2 {
+			t.Errorf("door %+v isn't centered on %d, %d", d, door.x, door.y)
+		}
+		h0, h1 := d.Path.Handle0, d.Path.Handle1
+		if h0.X != -h1.X || h0.Y != -h1.Y || h1.X+h1.Y != roll20Square/2 {
+			t.Errorf("door %+v isn't a square across", d)
+		}
+		if d.IsLocked != (i == 0) {
+			t.Errorf("door %d locked is %v", i, d.IsLocked)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// saveVersion is bumped whenever the save file layout changes. Version 1
+// saves, which wrote rows out in full, still load.
+const saveVersion = 2
+
+// saveFile is everything needed to resume a play session. Cells holds the
+// map row by row with ' ' for floor and doorways, and otherwise the ASCII
+// glyph of the feature on the cell or its tile type, run-length encoded by
+// packRow. Elevation rows are encoded the same way, with levels written as
+// letters from 'a' so they can't be taken for run lengths. Theme is the theme's
+// name. Wrap is set on a stage whose opposite edges are joined. Rooms keep
+// their internal width and height (one less than the number of cells they
+// span). RNG, Seed, and Draws are where the stage's play
+// stream had got to.
+type saveFile struct {
+	Version    int            `json:"version"`
+	Theme      string         `json:"theme"`
+	Width      int            `json:"width"`
+	Height     int            `json:"height"`
+	Wrap       bool           `json:"wrap,omitempty"`
+	Cells      []string       `json:"cells"`
+	Rooms      []savedRoom    `json:"rooms"`
+	Doors      []PointJSON    `json:"doors"`
+	Entrance   PointJSON      `json:"entrance"`
+	StairsUp   PointJSON      `json:"stairs_up"`
+	StairsDown PointJSON      `json:"stairs_down"`
+	Monsters   []savedMonster `json:"monsters"`
+	Items      []savedItem    `json:"items"`
+	Traps      []savedTrap    `json:"traps"`
+
+	Decorations []savedDecoration `json:"decorations"`
+	Elevation   []string          `json:"elevation,omitempty"`
+	Ramps       []PointJSON       `json:"ramps,omitempty"`
+	Ledges      []PointJSON       `json:"ledges,omitempty"`
+	Player      *savedPlayer      `json:"player,omitempty"`
+	RNG         string            `json:"rng,omitempty"`
+	Seed        int64             `json:"seed"`
+	Draws       uint64            `json:"draws"`
+}
+
+type savedRoom struct {
+	X, Y, Width, Height int
+}
+
+type savedMonster struct {
+	MonsterKind
+	X, Y, HP int
+}
+
+type savedItem struct {
+	ItemKind
+	X, Y int
+}
+
+type savedTrap struct {
+	TrapKind
+	X, Y  int
+	Found bool
+}
+
+type savedDecoration struct {
+	DecorationKind
+	X, Y int
+}
+
+type savedPlayer struct {
+	X, Y, HP, MaxHP, Attack int
+	Inventory               []savedItem
+	// index into Inventory, or -1 when nothing is wielded or worn
+	Weapon, Armor int
+}
+
+// Save writes the stage, everything in it, the player, and the random
+// generator's position so the session can be picked up again with Load. With
+// no player only the stage is saved, to store a generated map.
+func (s *Stage) Save(w io.Writer, p *Player) error {
+	src, ok := s.streams[playStream].(*countingSource)
+	if !ok {
+		return fmt.Errorf("can't save a stage whose random source didn't come from NewSource")
+	}
+	out := saveFile{
+		Version:    saveVersion,
+		Theme:      s.theme.Name,
+		Width:      s.width,
+		Height:     s.height,
+		Wrap:       s.opts.Wrap,
+		Entrance:   PointJSON{X: s.entranceX, Y: s.entranceY},
+		StairsUp:   PointJSON{X: s.upX, Y: s.upY},
+		StairsDown: PointJSON{X: s.downX, Y: s.downY},
+		RNG:        src.backend,
+		Seed:       src.seed,
+		Draws:      src.draws,
+	}
+	for y := 1; y <= s.height; y++ {
+		row := make([]byte, 0, s.width)
+		for x := 1; x <= s.width; x++ {
+			switch k := s.at(x, y).kind.Kind(); {
+			case s.at(x, y).feature != NoFeature:
+				row = append(row, s.at(x, y).feature.Kind().ASCII)
+			case k.ASCII != 0:
+				row = append(row, k.ASCII)
+			default:
+				row = append(row, ' ')
+			}
+		}
+		out.Cells = append(out.Cells, packRow(row))
+	}
+	for _, room := range s.rooms {
+		out.Rooms = append(out.Rooms, savedRoom{X: room.x, Y: room.y, Width: room.width, Height: room.height})
+	}
+	for _, d := range s.doors {
+		out.Doors = append(out.Doors, PointJSON{X: d.x, Y: d.y})
+	}
+	for _, m := range s.monsters {
+		out.Monsters = append(out.Monsters, savedMonster{MonsterKind: m.MonsterKind, X: m.x, Y: m.y, HP: m.hp})
+	}
+	for _, item := range s.items {
+		out.Items = append(out.Items, savedItem{ItemKind: item.ItemKind, X: item.x, Y: item.y})
+	}
+	for _, t := range s.traps {
+		out.Traps = append(out.Traps, savedTrap{TrapKind: t.TrapKind, X: t.x, Y: t.y, Found: t.found})
+	}
+	for _, d := range s.decorations {
+		out.Decorations = append(out.Decorations, savedDecoration{DecorationKind: d.DecorationKind, X: d.x, Y: d.y})
+	}
+	for _, row := range s.elevationRows() {
+		levels := []byte(row)
+		for i := range levels {
+			levels[i] += 'a' - '0'
+		}
+		out.Elevation = append(out.Elevation, packRow(levels))
+	}
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if s.at(x, y).ramp {
+				out.Ramps = append(out.Ramps, PointJSON{X: x, Y: y})
+			}
+			if s.at(x, y).ledge {
+				out.Ledges = append(out.Ledges, PointJSON{X: x, Y: y})
+			}
+		}
+	}
+
+	if p == nil {
+		return json.NewEncoder(w).Encode(out)
+	}
+	out.Player = &savedPlayer{X: p.x, Y: p.y, HP: p.hp, MaxHP: p.maxHP, Attack: p.attack, Weapon: -1, Armor: -1}
+	for i, item := range p.inventory {
+		out.Player.Inventory = append(out.Player.Inventory, savedItem{ItemKind: item.ItemKind})
+		if item == p.weapon {
+			out.Player.Weapon = i
+		}
+		if item == p.armor {
+			out.Player.Armor = i
+		}
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
+
+// Load reads a session written by Save, restoring the random generator to
+// where it was when the session was saved. The player is nil if only the
+// stage was saved.
+func Load(r io.Reader) (*Stage, *Player, error) {
+	var in saveFile
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, nil, err
+	}
+	if in.Version < 1 || in.Version > saveVersion {
+		return nil, nil, fmt.Errorf("unsupported save version %d", in.Version)
+	}
+	if len(in.Cells) != in.Height {
+		return nil, nil, fmt.Errorf("save has %d rows, expected %d", len(in.Cells), in.Height)
+	}
+
+	// the other streams are only drawn from while generating, so any seed
+	// will do for them
+	s := NewStage(in.Width, in.Height, rand.NewSource(in.Seed))
+	s.opts.Wrap = in.Wrap
+	if in.Theme != "" {
+		theme, err := LookupTheme(in.Theme)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.theme = theme
+	}
+	for y, row := range in.Cells {
+		if in.Version > 1 {
+			var err error
+			if row, err = unpackRow(row); err != nil {
+				return nil, nil, fmt.Errorf("save row %d: %v", y+1, err)
+			}
+		}
+		if len(row) != in.Width {
+			return nil, nil, fmt.Errorf("save row %d has %d cells, expected %d", y+1, len(row), in.Width)
+		}
+		for x, c := range []byte(row) {
+			tmpTile := s.at(x+1, y+1)
+			tmpTile.kind = Floor
+			for t, k := range tileKinds {
+				if k.ASCII != 0 && c == k.ASCII {
+					tmpTile.kind = TileType(t)
+				}
+			}
+			for f, k := range featureKinds {
+				if k.ASCII != 0 && c == k.ASCII {
+					tmpTile.feature = Feature(f)
+				}
+			}
+			tmpTile.flags = tileFlags(tmpTile.kind, tmpTile.feature)
+			s.set(x+1, y+1, tmpTile)
+		}
+	}
+	for _, room := range in.Rooms {
+		s.rooms = append(s.rooms, Room{x: room.X, y: room.Y, width: room.Width, height: room.Height})
+	}
+	for _, d := range in.Doors {
+		if s.at(d.X, d.Y).kind == Floor {
+			s.setKind(d.X, d.Y, Door)
+		}
+		s.doors = append(s.doors, s.at(d.X, d.Y))
+	}
+	s.entranceX, s.entranceY = in.Entrance.X, in.Entrance.Y
+	s.upX, s.upY = in.StairsUp.X, in.StairsUp.Y
+	s.downX, s.downY = in.StairsDown.X, in.StairsDown.Y
+	for _, m := range in.Monsters {
+		s.monsters = append(s.monsters, &Monster{MonsterKind: m.MonsterKind, x: m.X, y: m.Y, hp: m.HP})
+	}
+	for _, item := range in.Items {
+		s.items = append(s.items, &Item{ItemKind: item.ItemKind, x: item.X, y: item.Y})
+	}
+	for _, t := range in.Traps {
+		s.traps = append(s.traps, &Trap{TrapKind: t.TrapKind, x: t.X, y: t.Y, found: t.Found})
+	}
+	for _, d := range in.Decorations {
+		s.decorations = append(s.decorations, &Decoration{DecorationKind: d.DecorationKind, x: d.X, y: d.Y})
+	}
+	if len(in.Elevation) > 0 {
+		if len(in.Elevation) != in.Height {
+			return nil, nil, fmt.Errorf("save has %d elevation rows, expected %d", len(in.Elevation), in.Height)
+		}
+		for y, row := range in.Elevation {
+			zero := byte('0')
+			if in.Version > 1 {
+				var err error
+				if row, err = unpackRow(row); err != nil {
+					return nil, nil, fmt.Errorf("save elevation row %d: %v", y+1, err)
+				}
+				zero = 'a'
+			}
+			for x, c := range []byte(row) {
+				if c < zero || c > zero+9 {
+					return nil, nil, fmt.Errorf("save elevation row %d has %q at column %d", y+1, c, x+1)
+				}
+				tmpTile := s.at(x+1, y+1)
+				tmpTile.elevation = int8(c - zero)
+				s.set(x+1, y+1, tmpTile)
+				if int(tmpTile.elevation)+1 > s.elevationLevels {
+					s.elevationLevels = int(tmpTile.elevation) + 1
+				}
+			}
+		}
+	}
+	for _, r := range in.Ramps {
+		tmpTile := s.at(r.X, r.Y)
+		tmpTile.ramp = true
+		s.set(r.X, r.Y, tmpTile)
+	}
+	for _, l := range in.Ledges {
+		tmpTile := s.at(l.X, l.Y)
+		tmpTile.ledge = true
+		s.set(l.X, l.Y, tmpTile)
+	}
+
+	var p *Player
+	if in.Player != nil {
+		p = &Player{x: in.Player.X, y: in.Player.Y, hp: in.Player.HP, maxHP: in.Player.MaxHP, attack: in.Player.Attack}
+		for i, item := range in.Player.Inventory {
+			p.inventory = append(p.inventory, &Item{ItemKind: item.ItemKind})
+			if i == in.Player.Weapon {
+				p.weapon = p.inventory[i]
+			}
+			if i == in.Player.Armor {
+				p.armor = p.inventory[i]
+			}
+		}
+	}
+
+	if in.RNG == "" {
+		in.RNG = "go"
+	}
+	src, err := restoreSource(in.RNG, in.Seed, in.Draws)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.streams[playStream] = src
+	s.useStream(playStream)
+	return s, p, nil
+}
+
+// packRow run-length encodes row: a run of more than one of the same byte is
+// written as its length followed by the byte, and a single byte as itself.
+// Rows must not hold digits.
+func packRow(row []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(row); {
+		j := i + 1
+		for j < len(row) && row[j] == row[i] {
+			j++
+		}
+		if j-i > 1 {
+			b.WriteString(strconv.Itoa(j - i))
+		}
+		b.WriteByte(row[i])
+		i = j
+	}
+	return b.String()
+}
+
+// unpackRow reverses packRow
+func unpackRow(packed string) (string, error) {
+	var b strings.Builder
+	n, counted := 0, false
+	for i := 0; i < len(packed); i++ {
+		c := packed[i]
+		if c >= '0' && c <= '9' {
+			if n, counted = n*10+int(c-'0'), true; n > 1<<20 {
+				return "", fmt.Errorf("run too long")
+			}
+			continue
+		}
+		if !counted {
+			n = 1
+		} else if n == 0 {
+			return "", fmt.Errorf("empty run of %q", c)
+		}
+		b.WriteString(strings.Repeat(string(c), n))
+		n, counted = 0, false
+	}
+	if counted {
+		return "", fmt.Errorf("run of %d with nothing after it", n)
+	}
+	return b.String(), nil
+}
+
+// saveSession writes the session to SaveFile and reports how it went
+func (s *Stage) saveSession(p *Player) string {
+	f, err := os.Create(SaveFile)
+	if err != nil {
+		return fmt.Sprintf("Could not save: %v ", err)
+	}
+	defer f.Close()
+	if err := s.Save(f, p); err != nil {
+		return fmt.Sprintf("Could not save: %v ", err)
+	}
+	return fmt.Sprintf("Saved to %s. ", SaveFile)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	for _, theme := range []string{"classic", "crypt"} {
+		s, err := New(WithSeed(3), WithTheme(themes[theme]), WithElevationLevels(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := NewPlayer(s.entranceX, s.entranceY)
+		p.hp = 7
+		if len(s.items) > 0 {
+			p.inventory = append(p.inventory, s.items[0])
+			p.weapon = s.items[0]
+		}
+		// play a few turns' worth first so the saved position isn't the start
+		s.useStream(playStream)
+		for i := 0; i < 5; i++ {
+			s.rng.Int63()
+		}
+
+		var buf bytes.Buffer
+		if err := s.Save(&buf, p); err != nil {
+			t.Fatal(err)
+		}
+		loaded, lp, err := Load(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := loaded.String(), s.String(); got != want {
+			t.Errorf("%s: loaded stage differs\n got:\n%s\nwant:\n%s", theme, got, want)
+		}
+		if loaded.theme != s.theme {
+			t.Errorf("%s: loaded theme %s", theme, loaded.theme.Name)
+		}
+		if len(loaded.monsters) != len(s.monsters) || len(loaded.items) != len(s.items) || len(loaded.traps) != len(s.traps) {
+			t.Errorf("%s: loaded %d monsters, %d items, %d traps, want %d, %d, %d", theme,
+				len(loaded.monsters), len(loaded.items), len(loaded.traps), len(s.monsters), len(s.items), len(s.traps))
+		}
+		if lp.x != p.x || lp.y != p.y || lp.hp != p.hp || lp.maxHP != p.maxHP || len(lp.inventory) != len(p.inventory) {
+			t.Errorf("%s: loaded player %+v, want %+v", theme, *lp, *p)
+		}
+		if p.weapon != nil && (lp.weapon == nil || lp.weapon.Name != p.weapon.Name) {
+			t.Errorf("%s: loaded player isn't wielding the %s", theme, p.weapon.Name)
+		}
+		for i := 0; i < 10; i++ {
+			if got, want := loaded.rng.Int63(), s.rng.Int63(); got != want {
+				t.Fatalf("%s: draw %d after loading is %d, want %d", theme, i, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	for _, tt := range []struct {
+		name, save string
+	}{
+		{"not json", "dungeon"},
+		{"wrong version", `{"version": 999}`},
+		{"missing rows", `{"version": 1, "width": 3, "height": 2, "cells": ["###"]}`},
+		{"short row", `{"version": 2, "width": 3, "height": 1, "cells": ["2#"]}`},
+		{"dangling run", `{"version": 2, "width": 3, "height": 1, "cells": ["3"]}`},
+		{"empty run", `{"version": 2, "width": 3, "height": 1, "cells": ["0#3#"]}`},
+		{"bad elevation", `{"version": 2, "width": 3, "height": 1, "cells": ["3#"], "elevation": ["3z"]}`},
+	} {
+		if _, _, err := Load(strings.NewReader(tt.save)); err == nil {
+			t.Errorf("%s: loaded", tt.name)
+		}
+	}
+}
+
+func TestSaveStageOnly(t *testing.T) {
+	s, err := New(WithSeed(5), WithElevationLevels(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := s.Save(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	var saved saveFile
+	if err := json.Unmarshal(buf.Bytes(), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(strings.Join(saved.Cells, "")); n*2 > s.width*s.height {
+		t.Errorf("saved %d bytes of rows for %d cells", n, s.width*s.height)
+	}
+	loaded, p, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != nil {
+		t.Errorf("loaded a player from a stage saved without one")
+	}
+	if got, want := loaded.String(), s.String(); got != want {
+		t.Errorf("loaded stage differs\n got:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := loaded.elevationRows(), s.elevationRows(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("loaded elevation %v, want %v", got, want)
+	}
+}
+
+func TestLoadVersion1(t *testing.T) {
+	save := `{"version": 1, "width": 5, "height": 3, "cells": ["#####", "#  >#", "#####"],
+		"elevation": ["00000", "00110", "00000"], "entrance": {"x": 2, "y": 2}}`
+	s, _, err := Load(strings.NewReader(save))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.at(4, 2).kind != StairsDown || s.at(2, 2).kind != Floor || s.at(4, 2).elevation != 1 {
+		t.Errorf("version 1 save loaded as\n%s", s.ASCII())
+	}
+}
+
+func TestPackRow(t *testing.T) {
+	for _, row := range []string{"", "#", "##########  #~~~~~~~~~~~~~~~~~~~#", "a b c", "aaaaaaaaaaaaa"} {
+		packed := packRow([]byte(row))
+		got, err := unpackRow(packed)
+		if err != nil || got != row {
+			t.Errorf("unpackRow(%q) = %q, %v, want %q", packed, got, err, row)
+		}
+	}
+	if got := packRow([]byte("####  #")); got != "4#2 #" {
+		t.Errorf("packRow = %q, want %q", got, "4#2 #")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Criterion is one thing a searched for stage has to satisfy: a comparison
+// of one of its Stats, named as in the analyze output, against a value, like
+// rooms>=8
+type Criterion struct {
+	Stat  string
+	Op    string
+	Value float64
+}
+
+// criterionOps are the comparisons a criterion can make, longest first so
+// ">=" isn't read as ">"
+var criterionOps = []string{">=", "<=", "==", ">", "<", "="}
+
+// ParseCriteria reads a comma separated list of criteria like
+// "rooms>=8,path_length>=200"
+func ParseCriteria(list string) ([]Criterion, error) {
+	known := statValues(Stats{})
+	criteria := make([]Criterion, 0)
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		c := Criterion{}
+		for _, op := range criterionOps {
+			if i := strings.Index(part, op); i > 0 {
+				c.Stat, c.Op = strings.TrimSpace(part[:i]), op
+				v, err := strconv.ParseFloat(strings.TrimSpace(part[i+len(op):]), 64)
+				if err != nil {
+					return nil, fmt.Errorf("bad value in %q: %v", part, err)
+				}
+				c.Value = v
+				break
+			}
+		}
+		if c.Op == "" {
+			return nil, fmt.Errorf("no comparison in %q", part)
+		}
+		if _, ok := known[c.Stat]; !ok {
+			return nil, fmt.Errorf("unknown stat %q in %q", c.Stat, part)
+		}
+		criteria = append(criteria, c)
+	}
+	return criteria, nil
+}
+
+// Match reports if the stat the criterion names compares as it asks
+func (c Criterion) Match(values map[string]float64) bool {
+	v := values[c.Stat]
+	switch c.Op {
+	case ">=":
+		return v >= c.Value
+	case "<=":
+		return v <= c.Value
+	case ">":
+		return v > c.Value
+	case "<":
+		return v < c.Value
+	}
+	return v == c.Value
+}
+
+// statValues returns the stats keyed by their names in the analyze output
+func statValues(st Stats) map[string]float64 {
+	values := map[string]float64{}
+	b, _ := json.Marshal(st)
+	json.Unmarshal(b, &values)
+	return values
+}
+
+// ParseRoomSize reads a room size like "10x10"
+func ParseRoomSize(size string) (w, h int, err error) {
+	parts := strings.Split(size, "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("room size %q isn't WIDTHxHEIGHT", size)
+	}
+	if w, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, fmt.Errorf("room size %q: %v", size, err)
+	}
+	if h, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0, fmt.Errorf("room size %q: %v", size, err)
+	}
+	return w, h, nil
+}
+
+// hasRoom reports if the stage has a room spanning at least w by h cells
+func (s *Stage) hasRoom(w, h int) bool {
+	for _, room := range s.rooms {
+		// rooms span x through x+width inclusive
+		if room.width+1 >= w && room.height+1 >= h {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchSeeds generates a stage with opts from each seed starting at start
+// until one meets every criterion and has a room at least roomW by roomH
+// cells. It gives up after limit seeds, or once ctx is cancelled.
+func SearchSeeds(ctx context.Context, opts Options, start int64, limit int, criteria []Criterion, roomW, roomH int) (seed int64, s *Stage, err error) {
+	for seed = start; seed < start+int64(limit); seed++ {
+		levels, err := GenerateLevels(ctx, opts.seeded(seed), 1, []float64{1})
+		if err != nil {
+			return 0, nil, err
+		}
+		s = levels[0]
+		if !s.hasRoom(roomW, roomH) {
+			continue
+		}
+		values := statValues(s.Stats())
+		matched := true
+		for _, c := range criteria {
+			if !c.Match(values) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return seed, s, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("no seed from %d to %d matched", start, start+int64(limit)-1)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCriteria(t *testing.T) {
+	for _, tt := range []struct {
+		list string
+		want []Criterion
+		err  bool
+	}{
+		{"", []Criterion{}, false},
+		{"rooms>=8", []Criterion{{"rooms", ">=", 8}}, false},
+		{" rooms >= 8 , path_length<200.5 ,", []Criterion{{"rooms", ">=", 8}, {"path_length", "<", 200.5}}, false},
+		{"dead_ends=3,junctions==2,diameter<=40,open_tiles>10", []Criterion{
+			{"dead_ends", "=", 3}, {"junctions", "==", 2}, {"diameter", "<=", 40}, {"open_tiles", ">", 10},
+		}, false},
+		{"rooms", nil, true},
+		{"rooms>=many", nil, true},
+		{"towers>=2", nil, true},
+		{">=2", nil, true},
+	} {
+		got, err := ParseCriteria(tt.list)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseCriteria(%q) error %v", tt.list, err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCriteria(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestCriterionMatch(t *testing.T) {
+	values := map[string]float64{"rooms": 8}
+	for _, tt := range []struct {
+		c    Criterion
+		want bool
+	}{
+		{Criterion{"rooms", ">=", 8}, true},
+		{Criterion{"rooms", ">", 8}, false},
+		{Criterion{"rooms", "<=", 7}, false},
+		{Criterion{"rooms", "<", 9}, true},
+		{Criterion{"rooms", "=", 8}, true},
+		{Criterion{"rooms", "==", 7}, false},
+	} {
+		if got := tt.c.Match(values); got != tt.want {
+			t.Errorf("%v matched %v", tt.c, got)
+		}
+	}
+}
+
+func TestParseRoomSize(t *testing.T) {
+	for _, tt := range []struct {
+		size string
+		w, h int
+		err  bool
+	}{
+		{"10x10", 10, 10, false},
+		{"3x7", 3, 7, false},
+		{"10", 0, 0, true},
+		{"10x", 0, 0, true},
+		{"axb", 0, 0, true},
+		{"1x2x3", 0, 0, true},
+	} {
+		w, h, err := ParseRoomSize(tt.size)
+		if (err != nil) != tt.err || w != tt.w || h != tt.h {
+			t.Errorf("ParseRoomSize(%q) = %d, %d, %v", tt.size, w, h, err)
+		}
+	}
+}
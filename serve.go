@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxServeCells is the most cells a stage served over HTTP can have, so one
+// request can't tie the server up for long
+const maxServeCells = 500 * 500
+
+// NewServer returns a handler serving stages generated from opts on request
+// at GET /dungeon, each query changing the width, height, seed, and format:
+// json, png with scale pixels to a cell, text, ascii, markdown, emoji, a
+// Graphviz dot graph, or donjon's JSON. With no seed one is picked from the
+// clock; either way it's sent back in the X-Seed header, so the same stage
+// can be asked for again. GET /dungeon/events takes the same query but the
+// format, and streams the steps in generating the stage as server-sent
+// events, and GET /play plays it with a client over a WebSocket. GET / is a
+// web page drawing them, and GET /metrics has the metrics of every stage
+// generated to serve, over any protocol, for Prometheus.
+func NewServer(opts Options) http.Handler {
+	opts.Hooks, opts.Animate = Hooks{}, nil
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dungeon", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		serveDungeon(w, r, opts)
+	}))
+	mux.HandleFunc("/dungeon/events", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		serveEvents(w, r, opts)
+	}))
+	mux.HandleFunc("/play", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		servePlay(w, r, opts)
+	}))
+	mux.Handle("/metrics", served)
+	mux.HandleFunc("/", getOnly(func(w http.ResponseWriter, r *http.Request) {
+		serveIndex(w, r, opts)
+	}))
+	return mux
+}
+
+// getOnly returns a handler turning away anything but GET requests, and
+// passing those on to h
+func getOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// dungeonOptions returns opts changed by the width, height, and seed in q,
+// and the scale, checked they can be generated with. The seed is left 0
+// when q has none.
+func dungeonOptions(opts Options, q url.Values) (Options, int, error) {
+	scale := 8
+	for _, p := range []struct {
+		name string
+		n    *int
+	}{{"width", &opts.Width}, {"height", &opts.Height}, {"scale", &scale}} {
+		if v := q.Get(p.name); v != "" {
+			var err error
+			if *p.n, err = strconv.Atoi(v); err != nil {
+				return opts, 0, fmt.Errorf("%s %q isn't a number", p.name, v)
+			}
+		}
+	}
+	// the maze lines up on odd sizes, as with -width and -height
+	opts.Width, opts.Height = roundUpToEven(opts.Width)-1, roundUpToEven(opts.Height)-1
+	opts.Seed = 0
+	if v := q.Get("seed"); v != "" {
+		opts.Seed = ParseSeed(v)
+	}
+	switch {
+	case opts.Width*opts.Height > maxServeCells:
+		return opts, 0, fmt.Errorf("stage can be at most %d cells, got %dx%d", maxServeCells, opts.Width, opts.Height)
+	case scale < 1 || scale > 32:
+		return opts, 0, fmt.Errorf("scale must be from 1 to 32, got %d", scale)
+	}
+	return opts, scale, opts.check()
+}
+
+// serveDungeon generates the stage r asks for and writes it to w
+func serveDungeon(w http.ResponseWriter, r *http.Request, opts Options) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	opts, scale, err := dungeonOptions(opts, q)
+	if err == nil && format != "json" && format != "png" && format != "text" && format != "ascii" && format != "markdown" && format != "emoji" && format != "dot" && format != "donjon" {
+		err = fmt.Errorf("unknown format %q, want json, png, text, ascii, markdown, emoji, dot, or donjon", format)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	s, err := served.generate(r.Context(), opts.seeded(opts.Seed), "dungeon")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Seed", strconv.FormatInt(opts.Seed, 10))
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = s.WriteJSON(w)
+	case "png":
+		w.Header().Set("Content-Type", "image/png")
+		err = s.WritePNG(w, scale)
+	case "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		err = s.WriteMarkdown(w)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		err = s.WriteDOT(w)
+	case "donjon":
+		w.Header().Set("Content-Type", "application/json")
+		err = s.WriteDonjon(w)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = s.Write(w, format)
+	}
+	if err != nil {
+		// the response has started, so all that's left is to say so here
+		log.Printf("serving %s: %v", r.URL, err)
+	}
+}
+
+// serveEvents generates the stage r asks for, streaming every step in
+// generating it to w as server-sent events, each an Event as JSON, so a
+// browser can animate it being carved as it happens
+func serveEvents(w http.ResponseWriter, r *http.Request, opts Options) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+	opts, _, err := dungeonOptions(opts, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Seed", strconv.FormatInt(opts.Seed, 10))
+	events := newEventLog(func(e Event) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	opts.Hooks = events.hooks()
+	s, err := served.generate(r.Context(), opts.seeded(opts.Seed), "events")
+	if err != nil {
+		// a browser only sees the error if it's still listening
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+		return
+	}
+	// a browser would otherwise reconnect once the stream ends, and start
+	// it all over
+	events.write(s, Event{Event: "done"})
+	if err := events.err(); err != nil {
+		log.Printf("serving %s: %v", r.URL, err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	srv := httptest.NewServer(NewServer(DefaultOptions()))
+	defer srv.Close()
+
+	get := func(query string) *http.Response {
+		t.Helper()
+		res, err := http.Get(srv.URL + "/dungeon?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := get("width=31&height=15&seed=7")
+	var got StageJSON
+	err := json.NewDecoder(res.Body).Decode(&got)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width != 31 || got.Height != 15 || res.Header.Get("X-Seed") != "7" {
+		t.Errorf("got a %dx%d stage seeded %s, want 31x15 seeded 7", got.Width, got.Height, res.Header.Get("X-Seed"))
+	}
+
+	// the same seed makes the same stage as New does
+	want, err := New(WithSize(31, 15), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = get("width=32&height=16&seed=7&format=text")
+	text, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != want.String() {
+		t.Errorf("text is\n%s\nwant\n%s", text, want)
+	}
+
+	res = get("width=31&height=15&format=png&scale=2")
+	img, err := png.Decode(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 62 || res.Header.Get("X-Seed") == "" {
+		t.Errorf("png is %d wide, seeded %q", img.Bounds().Dx(), res.Header.Get("X-Seed"))
+	}
+
+	for _, query := range []string{"format=gif", "width=x", "width=1", "width=5000&height=5000", "scale=0"} {
+		if res := get(query); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s got %s", query, res.Status)
+		}
+	}
+	res, err = http.Post(srv.URL+"/dungeon", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST got %s", res.Status)
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	srv := httptest.NewServer(NewServer(DefaultOptions()))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/dungeon/events?width=31&height=15&seed=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type %q", ct)
+	}
+	var events []Event
+	lines := bufio.NewScanner(res.Body)
+	for lines.Scan() {
+		if lines.Text() == "" {
+			continue
+		}
+		data := strings.TrimPrefix(lines.Text(), "data: ")
+		if data == lines.Text() {
+			t.Fatalf("line %q isn't data", lines.Text())
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("event %s: %v", data, err)
+		}
+		events = append(events, e)
+	}
+	if len(events) < 3 || events[0].Event != "stage" || events[0].Width != 31 {
+		t.Fatalf("events start %v", events)
+	}
+	if last := events[len(events)-1]; last.Event != "done" || last.Stage != 1 {
+		t.Errorf("last event is %v, want done for stage 1", last)
+	}
+
+	res, err = http.Get(srv.URL + "/dungeon/events?width=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad width got %s", res.Status)
+	}
+}
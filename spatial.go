@@ -0,0 +1,134 @@
+package main
+
+import (
+	"image"
+	"sort"
+)
+
+// roomBucketSize is how many cells across and down each square of the stage
+// the rooms are bucketed by is
+const roomBucketSize = 16
+
+// bucketsAcross returns how many buckets there are in a row of the stage
+func (s *Stage) bucketsAcross() int {
+	return (s.width + roomBucketSize - 1) / roomBucketSize
+}
+
+// bucketsDown returns how many rows of buckets there are
+func (s *Stage) bucketsDown() int {
+	return (s.height + roomBucketSize - 1) / roomBucketSize
+}
+
+// bucketOf returns the bucket x, y is in, counting from 0, 0
+func bucketOf(x, y int) (int, int) {
+	return (x - 1) / roomBucketSize, (y - 1) / roomBucketSize
+}
+
+// bucketRoom adds room, numbered n, to every bucket it overlaps
+func (s *Stage) bucketRoom(room Room, n int32) {
+	b := room.Bounds().Intersect(image.Rect(1, 1, s.width+1, s.height+1))
+	if b.Empty() {
+		return
+	}
+	x0, y0 := bucketOf(b.Min.X, b.Min.Y)
+	x1, y1 := bucketOf(b.Max.X-1, b.Max.Y-1)
+	for by := y0; by <= y1; by++ {
+		for bx := x0; bx <= x1; bx++ {
+			i := by*s.bucketsAcross() + bx
+			s.roomBuckets[i] = append(s.roomBuckets[i], n)
+		}
+	}
+}
+
+// RoomsIn returns the rooms overlapping rect, in the stage's own coordinates
+// with Max left out, in the order the stage has them
+func (s *Stage) RoomsIn(rect image.Rectangle) []Room {
+	s.indexRooms()
+	rect = rect.Intersect(image.Rect(1, 1, s.width+1, s.height+1))
+	rooms := make([]Room, 0)
+	if rect.Empty() {
+		return rooms
+	}
+	seen := make(map[int32]bool)
+	var found []int
+	x0, y0 := bucketOf(rect.Min.X, rect.Min.Y)
+	x1, y1 := bucketOf(rect.Max.X-1, rect.Max.Y-1)
+	for by := y0; by <= y1; by++ {
+		for bx := x0; bx <= x1; bx++ {
+			for _, n := range s.roomBuckets[by*s.bucketsAcross()+bx] {
+				if !seen[n] && s.rooms[n-1].Bounds().Overlaps(rect) {
+					found = append(found, int(n-1))
+				}
+				seen[n] = true
+			}
+		}
+	}
+	sort.Ints(found)
+	for _, i := range found {
+		rooms = append(rooms, s.rooms[i])
+	}
+	return rooms
+}
+
+// NearestRoom returns the room closest to x, y, the first in the stage's
+// order if more than one is as close, or the room x, y is in. Only the
+// buckets around x, y are looked in, going further out until no room in
+// them could be closer than one already found.
+func (s *Stage) NearestRoom(x, y int) (Room, bool) {
+	s.indexRooms()
+	if len(s.rooms) == 0 || !s.cellExists(x, y) {
+		return Room{}, false
+	}
+	bx, by := bucketOf(x, y)
+	// the furthest ring out that has any buckets in it
+	rings := 0
+	for _, r := range []int{bx, by, s.bucketsAcross() - 1 - bx, s.bucketsDown() - 1 - by} {
+		if r > rings {
+			rings = r
+		}
+	}
+	best, bestDist := int32(0), 0
+	for ring := 0; ring <= rings; ring++ {
+		for ry := by - ring; ry <= by+ring; ry++ {
+			for rx := bx - ring; rx <= bx+ring; rx++ {
+				onRing := ry == by-ring || ry == by+ring || rx == bx-ring || rx == bx+ring
+				if !onRing || rx < 0 || ry < 0 || rx >= s.bucketsAcross() || ry >= s.bucketsDown() {
+					continue
+				}
+				for _, n := range s.roomBuckets[ry*s.bucketsAcross()+rx] {
+					d := distanceTo(s.rooms[n-1].Bounds(), x, y)
+					if best == 0 || d < bestDist || (d == bestDist && n < best) {
+						best, bestDist = n, d
+					}
+				}
+			}
+		}
+		// everything in the next ring out is at least this far away
+		if next := ring*roomBucketSize + 1; best != 0 && bestDist < next*next {
+			break
+		}
+	}
+	if best == 0 {
+		return Room{}, false
+	}
+	return s.rooms[best-1], true
+}
+
+// distanceTo returns the squared distance from x, y to the nearest cell in
+// rect, 0 if it's in it
+func distanceTo(rect image.Rectangle, x, y int) int {
+	dx, dy := 0, 0
+	switch {
+	case x < rect.Min.X:
+		dx = rect.Min.X - x
+	case x >= rect.Max.X:
+		dx = x - rect.Max.X + 1
+	}
+	switch {
+	case y < rect.Min.Y:
+		dy = rect.Min.Y - y
+	case y >= rect.Max.Y:
+		dy = y - rect.Max.Y + 1
+	}
+	return dx*dx + dy*dy
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"image"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRoomsIn(t *testing.T) {
+	s, err := New(WithSize(101, 61), WithSeed(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		x, y := rng.Intn(s.width+10)-5, rng.Intn(s.height+10)-5
+		rect := image.Rect(x, y, x+rng.Intn(40), y+rng.Intn(30))
+		want := make([]Room, 0)
+		for _, room := range s.rooms {
+			if room.Bounds().Overlaps(rect) {
+				want = append(want, room)
+			}
+		}
+		if got := s.RoomsIn(rect); !reflect.DeepEqual(got, want) {
+			t.Fatalf("rooms in %v are %v, want %v", rect, got, want)
+		}
+	}
+}
+
+func TestNearestRoom(t *testing.T) {
+	s, err := New(WithSize(101, 61), WithSeed(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func() {
+		t.Helper()
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				var want Room
+				best := -1
+				for _, room := range s.rooms {
+					if d := distanceTo(room.Bounds(), x, y); best < 0 || d < best {
+						want, best = room, d
+					}
+				}
+				got, ok := s.NearestRoom(x, y)
+				if ok != (best >= 0) || got != want {
+					t.Fatalf("nearest room to %d, %d is %v, want %v", x, y, got, want)
+				}
+			}
+		}
+	}
+	check()
+
+	// the index follows rooms edited away
+	var room Room
+	for _, room = range s.rooms {
+		// the entrance and stairs can't be walled up
+		if s.FillRect(room.Bounds()) == nil {
+			break
+		}
+	}
+	for _, r := range s.RoomsIn(room.Bounds()) {
+		if r == room {
+			t.Fatal("a filled room is still indexed")
+		}
+	}
+	check()
+
+	if _, ok := s.NearestRoom(0, 0); ok {
+		t.Error("there's a room nearest a point off the stage")
+	}
+}
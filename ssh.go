@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sessionGenerateTimeout is how long a stage to play over the network has
+// to generate
+const sessionGenerateTimeout = 10 * time.Second
+
+// ServeSSH plays a freshly generated stage from opts with everyone who
+// connects over SSH to l, in their own terminal, one stage a session. Anyone
+// can connect, and sessions can't save. The host key is read from the PEM
+// file hostKey, or made up for the run when it's "".
+func ServeSSH(l net.Listener, opts Options, hostKey string) error {
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	signer, err := sshHostKey(hostKey)
+	if err != nil {
+		return err
+	}
+	config.AddHostKey(signer)
+	opts.Hooks, opts.Animate = Hooks{}, nil
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveSSHConn(conn, config, opts)
+	}
+}
+
+// sshHostKey reads the host key from the PEM file path, or makes one up
+// when path is ""
+func sshHostKey(path string) (ssh.Signer, error) {
+	if path == "" {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.NewSignerFromKey(key)
+		if err == nil {
+			log.Printf("made up an SSH host key for this run, %s", ssh.FingerprintSHA256(signer.PublicKey()))
+		}
+		return signer, err
+	}
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(pem)
+}
+
+// serveSSHConn runs the sessions opened on a connection
+func serveSSHConn(conn net.Conn, config *ssh.ServerConfig, opts Options) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, reqs, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go serveSSHSession(ch, reqs, opts)
+	}
+}
+
+// windowChanged is what an SSH session's terminal says when it's resized,
+// standing in for the signal a local one gets
+type windowChanged struct{}
+
+func (windowChanged) String() string { return "window changed" }
+func (windowChanged) Signal()        {}
+
+// sshSession is a session's terminal as its client has described it
+type sshSession struct {
+	mu         sync.Mutex
+	rows, cols int
+	resized    chan os.Signal
+}
+
+// size returns how big the client says its terminal is
+func (t *sshSession) size() (rows, cols int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rows, t.cols
+}
+
+// resize takes the size from a pty-req or window-change request's payload,
+// which starts with the columns and rows
+func (t *sshSession) resize(payload []byte) bool {
+	var size struct {
+		Cols, Rows uint32
+		Rest       []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(payload, &size); err != nil {
+		return false
+	}
+	t.mu.Lock()
+	t.rows, t.cols = int(size.Rows), int(size.Cols)
+	t.mu.Unlock()
+	select {
+	case t.resized <- windowChanged{}:
+	default:
+	}
+	return true
+}
+
+// serveSSHSession plays a game on a session once its client asks for a
+// shell, with the terminal it asked for before that
+func serveSSHSession(ch ssh.Channel, reqs <-chan *ssh.Request, opts Options) {
+	defer ch.Close()
+	t := &sshSession{resized: make(chan os.Signal, 1)}
+	started, gone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(gone)
+		shell := false
+		for req := range reqs {
+			ok := false
+			switch req.Type {
+			case "pty-req":
+				// the terminal type comes first
+				var term struct {
+					Term string
+					Rest []byte `ssh:"rest"`
+				}
+				ok = ssh.Unmarshal(req.Payload, &term) == nil && t.resize(term.Rest)
+			case "window-change":
+				ok = t.resize(req.Payload)
+			case "shell":
+				if ok = !shell; ok {
+					shell = true
+					close(started)
+				}
+			}
+			if req.WantReply {
+				req.Reply(ok, nil)
+			}
+		}
+	}()
+	select {
+	case <-started:
+	case <-gone:
+		return
+	case <-time.After(time.Minute):
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionGenerateTimeout)
+	s, err := served.generate(ctx, opts.seeded(time.Now().UnixNano()), "ssh")
+	cancel()
+	if err != nil {
+		fmt.Fprintf(ch, "Couldn't generate a dungeon: %v\r\n", err)
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{1}))
+		return
+	}
+	keys := newKeyboardOn(ch, t.resized, func() {})
+	defer keys.close()
+	s.play(&terminal{out: ch, keys: keys, size: t.size}, NewPlayer(s.entranceX, s.entranceY))
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+}
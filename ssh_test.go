@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServeSSH(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go ServeSSH(l, DefaultOptions(), "")
+
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "player",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.RequestPty("xterm", 30, 100, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	in, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the game is drawn in the client's terminal, and quits when asked
+	screen := bufio.NewReader(out)
+	for {
+		line, err := screen.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no status line drawn: %v", err)
+		}
+		if strings.Contains(line, "HP 20/20") {
+			break
+		}
+	}
+	if _, err := in.Write([]byte("S")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		line, err := screen.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no message about saving: %v", err)
+		}
+		if strings.Contains(line, "Saving isn't available here.") {
+			break
+		}
+	}
+	in.Write([]byte("q"))
+	if err := session.Wait(); err != nil {
+		t.Errorf("session ended with %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+)
+
+// Stats are measurements of a generated stage. OpenRatio is the fraction of
+// all cells that can be walked on. Corridor cells are the walkable cells
+// outside the rooms and doorways; a dead end is a corridor cell with one way
+// out, a junction one with three or more. Diameter is the most steps it takes
+// to walk between two cells that can reach each other.
+//
+// The rest describe the texture of the corridors, to compare how different
+// settings carve them. RiverFactor is how long the dead end side passages run
+// on average before they meet a junction, room, or doorway: long winding
+// passages score high, many short stubs low. Straightness is the share of
+// corridor cells with two ways out that run straight through rather than
+// turn. BranchFactor is the share of corridor cells that are junctions.
+//
+// PathLength is the steps from the entrance to the stairs down, or to the
+// farthest cell if there are none. MonsterBudget adds up the hit points times
+// attack of every monster. TrapDensity is traps per open tile, and
+// DeadEndRatio dead ends per corridor cell. DifficultyScore weighs them up.
+type Stats struct {
+	Width           int     `json:"width"`
+	Height          int     `json:"height"`
+	OpenTiles       int     `json:"open_tiles"`
+	OpenRatio       float64 `json:"open_ratio"`
+	Rooms           int     `json:"rooms"`
+	AverageRoomSize float64 `json:"average_room_size"`
+	CorridorLength  int     `json:"corridor_length"`
+	DeadEnds        int     `json:"dead_ends"`
+	Junctions       int     `json:"junctions"`
+	Diameter        int     `json:"diameter"`
+	RiverFactor     float64 `json:"river_factor"`
+	Straightness    float64 `json:"straightness"`
+	BranchFactor    float64 `json:"branch_factor"`
+	PathLength      int     `json:"path_length"`
+	MonsterBudget   int     `json:"monster_budget"`
+	TrapDensity     float64 `json:"trap_density"`
+	DeadEndRatio    float64 `json:"dead_end_ratio"`
+	DifficultyScore float64 `json:"difficulty_score"`
+}
+
+// Stats measures the stage
+func (s *Stage) Stats() Stats {
+	st := Stats{Width: s.width, Height: s.height, Rooms: len(s.rooms)}
+	for _, room := range s.rooms {
+		// rooms span x through x+width inclusive
+		st.AverageRoomSize += float64((room.width + 1) * (room.height + 1))
+	}
+	if len(s.rooms) > 0 {
+		st.AverageRoomSize /= float64(len(s.rooms))
+	}
+
+	passages, straight, branchLength := 0, 0, 0
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if !s.IsWalkable(x, y) {
+				continue
+			}
+			st.OpenTiles++
+			if !s.isCorridor(x, y) {
+				continue
+			}
+			st.CorridorLength++
+			switch exits := s.openNeighbors(x, y); {
+			case len(exits) == 1:
+				st.DeadEnds++
+				branchLength += s.branchLength(x, y)
+			case len(exits) == 2:
+				passages++
+				if exits[0].x == exits[1].x || exits[0].y == exits[1].y {
+					straight++
+				}
+			case len(exits) >= 3:
+				st.Junctions++
+			}
+		}
+	}
+	st.OpenRatio = float64(st.OpenTiles) / float64(s.width*s.height)
+	st.Diameter = s.diameter()
+	if st.DeadEnds > 0 {
+		st.RiverFactor = float64(branchLength) / float64(st.DeadEnds)
+	}
+	if passages > 0 {
+		st.Straightness = float64(straight) / float64(passages)
+	}
+	if st.CorridorLength > 0 {
+		st.BranchFactor = float64(st.Junctions) / float64(st.CorridorLength)
+	}
+	st.PathLength, st.MonsterBudget, st.TrapDensity, st.DeadEndRatio = s.pathLength(), s.monsterBudget(), s.trapDensity(), s.deadEndRatio()
+	st.DifficultyScore = s.DifficultyScore()
+	return st
+}
+
+// DifficultyScore rates how hard the stage is to get through from 0 to 100.
+// The walk from the entrance to the way down is worth up to 30 points, full
+// at the width plus the height of the stage; the monster budget up to 30,
+// full at one point per open tile; traps up to 20, full at one per twenty open
+// tiles; and dead ends up to 20, full at one per five corridor cells.
+func (s *Stage) DifficultyScore() float64 {
+	score := 30*math.Min(1, float64(s.pathLength())/float64(s.width+s.height)) +
+		20*math.Min(1, 20*s.trapDensity()) +
+		20*math.Min(1, 5*s.deadEndRatio())
+	if open := s.openCount(); open > 0 {
+		score += 30 * math.Min(1, float64(s.monsterBudget())/float64(open))
+	}
+	return score
+}
+
+// pathLength returns the steps from the entrance to the stairs down, or to
+// the farthest cell that can be reached if there are no stairs down
+func (s *Stage) pathLength() int {
+	dist := s.DistanceMap(s.entranceX, s.entranceY)
+	if d, ok := dist.At(s.downX, s.downY); ok && s.downX != 0 {
+		return d
+	}
+	_, farthest := reach(dist)
+	return farthest
+}
+
+// monsterBudget adds up hit points times attack for every monster
+func (s *Stage) monsterBudget() int {
+	budget := 0
+	for _, m := range s.monsters {
+		budget += m.HP * m.Attack
+	}
+	return budget
+}
+
+// trapDensity returns traps per open tile
+func (s *Stage) trapDensity() float64 {
+	open := s.openCount()
+	if open == 0 {
+		return 0
+	}
+	return float64(len(s.traps)) / float64(open)
+}
+
+// deadEndRatio returns dead ends per corridor cell
+func (s *Stage) deadEndRatio() float64 {
+	corridor, deadEnds := 0, 0
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if !s.isCorridor(x, y) {
+				continue
+			}
+			corridor++
+			if len(s.openNeighbors(x, y)) == 1 {
+				deadEnds++
+			}
+		}
+	}
+	if corridor == 0 {
+		return 0
+	}
+	return float64(deadEnds) / float64(corridor)
+}
+
+// diameter returns the most steps between two walkable cells that can reach
+// each other, by a double sweep of every connected area: a breadth first walk
+// from any cell finds the farthest one, and a second walk from there finds the
+// cell farthest from it. That is exact where the passages never loop back, as
+// in a perfect maze, and a close lower bound where they do. The walks work on
+// a flat slice rather than the cell map and visit every cell about three
+// times, so the cost grows with the stage's area rather than its square.
+func (s *Stage) diameter() int {
+	// pad by a cell on every side so neighbors never fall off the slice
+	w := s.width + 2
+	walkable := make([]bool, w*(s.height+2))
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			walkable[y*w+x] = s.IsWalkable(x, y)
+		}
+	}
+	steps := []int{-w, 1, w, -1}
+	dist := make([]int, len(walkable))
+	for i := range dist {
+		dist[i] = -1
+	}
+	queue := make([]int, 0, len(walkable))
+	// sweep walks out from start over the cells not yet walked in the sweep
+	// before, marked with dist, returning the last cell reached and its steps
+	sweep := func(start, from int) (int, int) {
+		dist[start] = 0
+		queue = append(queue[:0], start)
+		for head := 0; head < len(queue); head++ {
+			c := queue[head]
+			for _, step := range steps {
+				if n := c + step; walkable[n] && dist[n] == from {
+					dist[n] = dist[c] + 1
+					queue = append(queue, n)
+				}
+			}
+		}
+		last := queue[len(queue)-1]
+		return last, dist[last]
+	}
+
+	longest := 0
+	for start, ok := range walkable {
+		if !ok || dist[start] != -1 {
+			continue
+		}
+		far, _ := sweep(start, -1)
+		// the second sweep walks the same area again, so mark it -2 first
+		for _, c := range queue {
+			dist[c] = -2
+		}
+		if _, d := sweep(far, -2); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// isCorridor reports if x, y is walkable and outside the rooms and doorways
+func (s *Stage) isCorridor(x, y int) bool {
+	_, inRoom := s.roomAt(x, y)
+	return s.IsWalkable(x, y) && !inRoom && !s.isDoor(x, y)
+}
+
+// branchLength walks from the dead end at x, y until it reaches a junction or
+// leaves the corridors, returning how many cells it passed through
+func (s *Stage) branchLength(x, y int) int {
+	length := 0
+	prevX, prevY := 0, 0
+	for s.isCorridor(x, y) {
+		exits := s.openNeighbors(x, y)
+		if len(exits) > 2 {
+			break
+		}
+		length++
+		moved := false
+		for _, n := range exits {
+			if n.x != prevX || n.y != prevY {
+				prevX, prevY, x, y = x, y, n.x, n.y
+				moved = true
+				break
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+	return length
+}
+
+// WriteJSON writes the stats as indented JSON
+func (st Stats) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(st)
+}
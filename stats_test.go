@@ -0,0 +1,27 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDiameter(t *testing.T) {
+	s := NewStage(21, 9, rand.NewSource(1))
+	// two corridors that never meet: the longer one sets the diameter
+	for x := 2; x <= 20; x++ {
+		s.setKind(x, 2, Floor)
+	}
+	for x := 2; x <= 6; x++ {
+		s.setKind(x, 6, Floor)
+	}
+	// with a loop at the longer one's end, whose far corner is 20 steps away
+	// either way round
+	for y := 2; y <= 4; y++ {
+		s.setKind(18, y, Floor)
+		s.setKind(20, y, Floor)
+	}
+	s.setKind(19, 4, Floor)
+	if d := s.diameter(); d != 20 {
+		t.Errorf("diameter %d, want 20", d)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"image"
+)
+
+// Stitch lays generated stages out edge to edge in rows, like the chunks of
+// a big stage: neighbors share the wall between them, so every stage in a row
+// must be as tall as the others, and every stage in a column as wide. One or
+// two passages are opened through each shared wall, and anything left cut off
+// is joined up after. The stitched stage keeps the entrance and stairs of the
+// first stage; the others' stairs are floor.
+func Stitch(rows [][]*Stage) (*Stage, error) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return nil, fmt.Errorf("nothing to stitch")
+	}
+	// where each column and row starts, less one
+	xs, ys := []int{0}, []int{0}
+	for i, piece := range rows[0] {
+		xs = append(xs, xs[i]+piece.width-1)
+	}
+	for j, row := range rows {
+		if len(row) != len(rows[0]) {
+			return nil, fmt.Errorf("row %d has %d stages, expected %d", j+1, len(row), len(rows[0]))
+		}
+		ys = append(ys, ys[j]+row[0].height-1)
+		for i, piece := range row {
+			if piece.width != rows[0][i].width || piece.height != row[0].height {
+				return nil, fmt.Errorf("stage %d of row %d is %dx%d, expected %dx%d", i+1, j+1, piece.width, piece.height, rows[0][i].width, row[0].height)
+			}
+			if piece.width%2 == 0 || piece.height%2 == 0 {
+				return nil, fmt.Errorf("stage %d of row %d is %dx%d, but only odd sizes line up", i+1, j+1, piece.width, piece.height)
+			}
+		}
+	}
+
+	first := rows[0][0]
+	src, _ := NewSource(first.opts.RNG, first.opts.Seed)
+	s := NewStage(xs[len(xs)-1]+1, ys[len(ys)-1]+1, src)
+	s.opts = first.opts
+	s.opts.Width, s.opts.Height, s.opts.Source, s.opts.Wrap = s.width, s.height, src, false
+	s.theme, s.difficulty = first.theme, first.difficulty
+	s.entranceX, s.entranceY = first.entranceX, first.entranceY
+	s.upX, s.upY, s.downX, s.downY = first.upX, first.upY, first.downX, first.downY
+	for j, row := range rows {
+		for i, piece := range row {
+			s.place(piece, xs[i], ys[j])
+		}
+	}
+
+	s.useStream(connectStream)
+	for j, row := range rows {
+		for i, piece := range row {
+			ox, oy := xs[i], ys[j]
+			if i > 0 {
+				var spots [][2]int
+				for y := oy + 2; y < oy+piece.height; y += 2 {
+					spots = append(spots, [2]int{ox + 1, y})
+				}
+				s.openSeam(s.rng, spots, 1, 0)
+			}
+			if j > 0 {
+				var spots [][2]int
+				for x := ox + 2; x < ox+piece.width; x += 2 {
+					spots = append(spots, [2]int{x, oy + 1})
+				}
+				s.openSeam(s.rng, spots, 0, 1)
+			}
+		}
+	}
+	s.joinPockets()
+	return s, nil
+}
+
+// Paste lays piece over s with its top left corner at x, y, which must both
+// be odd so its maze lines up with the stage's. Whatever of s it covers is
+// replaced: rooms it lands on are cut down to the strips of them left
+// uncovered, and doorways it closes off are walled up. One or two passages
+// are opened through each side of it, and anything left cut off is joined up
+// after. The stage keeps its own entrance and stairs unless piece covers
+// them, when it takes piece's; piece's other stairs are floor.
+func (s *Stage) Paste(piece *Stage, x, y int) error {
+	if x%2 == 0 || y%2 == 0 {
+		return fmt.Errorf("can't paste at (%d, %d), which isn't odd", x, y)
+	}
+	if x < 1 || y < 1 || x+piece.width-1 > s.width || y+piece.height-1 > s.height {
+		return fmt.Errorf("a %dx%d stage doesn't fit at (%d, %d) of a %dx%d one", piece.width, piece.height, x, y, s.width, s.height)
+	}
+	ox, oy := x-1, y-1
+	s.place(piece, ox, oy)
+
+	s.useStream(connectStream)
+	var left, right, top, bottom [][2]int
+	for y := oy + 2; y < oy+piece.height; y += 2 {
+		left = append(left, [2]int{ox + 1, y})
+		right = append(right, [2]int{ox + piece.width, y})
+	}
+	for x := ox + 2; x < ox+piece.width; x += 2 {
+		top = append(top, [2]int{x, oy + 1})
+		bottom = append(bottom, [2]int{x, oy + piece.height})
+	}
+	s.openSeam(s.rng, left, 1, 0)
+	s.openSeam(s.rng, right, 1, 0)
+	s.openSeam(s.rng, top, 0, 1)
+	s.openSeam(s.rng, bottom, 0, 1)
+	s.joinPockets()
+	return nil
+}
+
+// place copies piece over s, its cell x, y landing on x+ox, y+oy, along with
+// everything on it, and clears out whatever of s was there
+func (s *Stage) place(piece *Stage, ox, oy int) {
+	rect := image.Rect(ox+1, oy+1, ox+piece.width+1, oy+piece.height+1)
+	in := func(x, y int) bool { return image.Pt(x, y).In(rect) }
+	at := func(x, y int) (int, int) { return x + ox, y + oy }
+
+	s.cutRooms(rect)
+	var doors []Tile
+	for _, d := range s.doors {
+		if !in(d.x, d.y) {
+			doors = append(doors, d)
+		}
+	}
+	s.doors = doors
+	var monsters []*Monster
+	for _, m := range s.monsters {
+		if !in(m.x, m.y) {
+			monsters = append(monsters, m)
+		}
+	}
+	s.monsters = monsters
+	var items []*Item
+	for _, it := range s.items {
+		if !in(it.x, it.y) {
+			items = append(items, it)
+		}
+	}
+	s.items = items
+	var traps []*Trap
+	for _, t := range s.traps {
+		if !in(t.x, t.y) {
+			traps = append(traps, t)
+		}
+	}
+	s.traps = traps
+	var decorations []*Decoration
+	for _, d := range s.decorations {
+		if !in(d.x, d.y) {
+			decorations = append(decorations, d)
+		}
+	}
+	s.decorations = decorations
+	var bridges []*Bridge
+	for _, b := range s.bridges {
+		span := image.Rect(b.x, b.y, b.x+(b.length-1)*b.dx, b.y+(b.length-1)*b.dy)
+		span.Max = span.Max.Add(image.Pt(1, 1))
+		if !span.Overlaps(rect) {
+			bridges = append(bridges, b)
+		}
+	}
+	s.bridges = bridges
+
+	for y := 1; y <= piece.height; y++ {
+		for x := 1; x <= piece.width; x++ {
+			t := piece.at(x, y)
+			t.x, t.y = at(x, y)
+			if t.kind == StairsUp || t.kind == StairsDown {
+				t.kind = Floor
+			}
+			s.set(t.x, t.y, t)
+		}
+	}
+	if piece.outside != nil && s.outside == nil {
+		s.outside = make([]bool, len(s.cell))
+	}
+	if s.outside != nil {
+		for y := 1; y <= piece.height; y++ {
+			for x := 1; x <= piece.width; x++ {
+				sx, sy := at(x, y)
+				s.outside[(sy-1)*s.width+sx-1] = piece.outside != nil && piece.outside[(y-1)*piece.width+x-1]
+			}
+		}
+	}
+	if piece.elevationLevels > s.elevationLevels {
+		s.elevationLevels = piece.elevationLevels
+	}
+
+	for _, room := range piece.rooms {
+		s.rooms = append(s.rooms, room.moved(at))
+	}
+	for _, d := range piece.doors {
+		s.doors = append(s.doors, s.at(at(d.x, d.y)))
+	}
+	for _, m := range piece.monsters {
+		moved := *m
+		moved.x, moved.y = at(m.x, m.y)
+		s.monsters = append(s.monsters, &moved)
+	}
+	for _, it := range piece.items {
+		moved := *it
+		moved.x, moved.y = at(it.x, it.y)
+		s.items = append(s.items, &moved)
+	}
+	for _, t := range piece.traps {
+		moved := *t
+		moved.x, moved.y = at(t.x, t.y)
+		s.traps = append(s.traps, &moved)
+	}
+	for _, d := range piece.decorations {
+		moved := *d
+		moved.x, moved.y = at(d.x, d.y)
+		s.decorations = append(s.decorations, &moved)
+	}
+	for _, b := range piece.bridges {
+		moved := *b
+		moved.x, moved.y = at(b.x, b.y)
+		s.bridges = append(s.bridges, &moved)
+	}
+
+	// the stage's own entrance and stairs stay, unless they were covered
+	for _, p := range [][4]*int{
+		{&s.entranceX, &s.entranceY, &piece.entranceX, &piece.entranceY},
+		{&s.upX, &s.upY, &piece.upX, &piece.upY},
+		{&s.downX, &s.downY, &piece.downX, &piece.downY},
+	} {
+		if *p[0] != 0 && in(*p[0], *p[1]) {
+			*p[0], *p[1] = 0, 0
+			if *p[2] != 0 {
+				*p[0], *p[1] = at(*p[2], *p[3])
+			}
+		}
+	}
+	if s.upX != 0 {
+		s.setKind(s.upX, s.upY, StairsUp)
+	}
+	if s.downX != 0 {
+		s.setKind(s.downX, s.downY, StairsDown)
+	}
+
+	// doorways of the stage's that open onto the piece's wall lead nowhere
+	// now
+	doors = s.doors[:0]
+	for _, d := range s.doors {
+		open := 0
+		for _, n := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			if s.isOpen(d.x+n[0], d.y+n[1]) {
+				open++
+			}
+		}
+		if open < 2 && !in(d.x, d.y) {
+			s.setKind(d.x, d.y, Wall)
+			continue
+		}
+		doors = append(doors, s.at(d.x, d.y))
+	}
+	s.doors = doors
+
+	s.roomsMoved()
+	s.doorIndex, s.doorsIndexed = nil, 0
+}
+
+// cutRooms cuts the rooms rect lands on down to the strips of them it leaves
+// uncovered. The strips beside, above, and below rect don't overlap and cover
+// all of a room rect doesn't.
+func (s *Stage) cutRooms(rect image.Rectangle) {
+	var rooms []Room
+	for _, room := range s.rooms {
+		r := image.Rect(room.x, room.y, room.x+room.width+1, room.y+room.height+1)
+		if !r.Overlaps(rect) {
+			rooms = append(rooms, room)
+			continue
+		}
+		for _, strip := range []image.Rectangle{
+			image.Rect(r.Min.X, r.Min.Y, rect.Min.X, r.Max.Y),
+			image.Rect(rect.Max.X, r.Min.Y, r.Max.X, r.Max.Y),
+			image.Rect(rect.Min.X, r.Min.Y, rect.Max.X, rect.Min.Y),
+			image.Rect(rect.Min.X, rect.Max.Y, rect.Max.X, r.Max.Y),
+		} {
+			if strip = strip.Intersect(r); !strip.Empty() {
+				rooms = append(rooms, Room{x: strip.Min.X, y: strip.Min.Y, width: strip.Dx() - 1, height: strip.Dy() - 1})
+			}
+		}
+	}
+	s.rooms = rooms
+}
@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestStitch(t *testing.T) {
+	var rows [][]*Stage
+	for j, h := range []int{11, 15} {
+		var row []*Stage
+		for i, w := range []int{21, 17, 25} {
+			piece, err := New(WithSize(w, h), WithSeed(int64(10*j+i+1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			row = append(row, piece)
+		}
+		rows = append(rows, row)
+	}
+	s, err := Stitch(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.width != 61 || s.height != 25 {
+		t.Fatalf("stitched stage is %dx%d, want 61x25", s.width, s.height)
+	}
+	// the middle of the bottom right piece is where it was, moved over
+	piece := rows[1][2]
+	for y := 2; y < piece.height; y++ {
+		for x := 2; x < piece.width; x++ {
+			if got, want := s.at(x+36, y+10).kind, piece.at(x, y).kind; got != want && want != StairsUp && want != StairsDown {
+				t.Fatalf("(%d, %d) of the last piece is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	rooms := 0
+	for _, row := range rows {
+		for _, piece := range row {
+			rooms += len(piece.rooms)
+		}
+	}
+	if len(s.rooms) != rooms {
+		t.Errorf("stitched stage has %d rooms, want %d", len(s.rooms), rooms)
+	}
+	if report := s.Validate(); !report.Valid {
+		t.Errorf("stitched stage: %v", report.Failures)
+	}
+
+	if _, err := Stitch([][]*Stage{{rows[0][0]}, {rows[0][1]}}); err == nil {
+		t.Error("stitching stages of different widths into a column should fail")
+	}
+}
+
+func TestPaste(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		s, err := New(WithSize(61, 31), WithSeed(seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		piece, err := New(WithSize(15, 11), WithSeed(seed+100), WithRoomFillRate(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Paste(piece, 21, 9); err != nil {
+			t.Fatal(err)
+		}
+		for y := 2; y < piece.height; y++ {
+			for x := 2; x < piece.width; x++ {
+				if got, want := s.at(x+20, y+8).kind, piece.at(x, y).kind; got != want && want != StairsUp {
+					t.Fatalf("seed %d: (%d, %d) of the piece is %v, want %v", seed, x, y, got, want)
+				}
+			}
+		}
+		if report := s.Validate(); !report.Valid {
+			t.Errorf("seed %d: %v", seed, report.Failures)
+		}
+	}
+	s, _ := New(WithSize(61, 31), WithSeed(1))
+	piece, _ := New(WithSize(15, 11), WithSeed(2))
+	if err := s.Paste(piece, 20, 9); err == nil {
+		t.Error("pasting at an even x should fail")
+	}
+	if err := s.Paste(piece, 51, 9); err == nil {
+		t.Error("pasting past the right edge should fail")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Symmetry carves rooms and a maze in one part of the stage and copies them
+// over the rest, turned or flipped as Mode asks, for arena maps where every
+// side gets the same ground. "mirror" carves the left half and flips it onto
+// the right; "rotate2" turns the left half halfway round onto the right; and
+// "rotate4" carves the top left quarter of a square stage and turns it a
+// quarter at a time onto the other three. The copies are then joined across
+// the seams between them, in the same places on every copy.
+type Symmetry struct {
+	Mode string
+}
+
+// symmetries are the symmetry modes, each with what it copies the carved
+// part of a w by h stage onto: where cell x, y lands on each copy, the
+// carved part itself first
+var symmetries = map[string]func(w, h int) []func(x, y int) (int, int){
+	"mirror": func(w, h int) []func(x, y int) (int, int) {
+		return []func(x, y int) (int, int){
+			func(x, y int) (int, int) { return x, y },
+			func(x, y int) (int, int) { return w + 1 - x, y },
+		}
+	},
+	"rotate2": func(w, h int) []func(x, y int) (int, int) {
+		return []func(x, y int) (int, int){
+			func(x, y int) (int, int) { return x, y },
+			func(x, y int) (int, int) { return w + 1 - x, h + 1 - y },
+		}
+	},
+	"rotate4": func(w, h int) []func(x, y int) (int, int) {
+		return []func(x, y int) (int, int){
+			func(x, y int) (int, int) { return x, y },
+			func(x, y int) (int, int) { return w + 1 - y, x },
+			func(x, y int) (int, int) { return w + 1 - x, h + 1 - y },
+			func(x, y int) (int, int) { return y, h + 1 - x },
+		}
+	},
+}
+
+func (g Symmetry) Carve(s *Stage, rng *rand.Rand) error {
+	copies := symmetries[g.Mode](s.width, s.height)
+	// the carved part has a wall of its own down its right side, which lands
+	// on its copy's when the stage is 1 more than a multiple of 4 wide, or
+	// leaves a column between them when it isn't
+	w := (s.width + 1) / 2
+	if w%2 == 0 {
+		w--
+	}
+	h := s.height
+	if g.Mode == "rotate4" {
+		h = w
+	}
+	if w < 3 {
+		return fmt.Errorf("stage is too small for %s symmetry", g.Mode)
+	}
+
+	// carve the part the way a chunk is carved, keeping clear of any cell
+	// outside the stage's outline on any copy
+	opts := s.opts
+	opts.Width, opts.Height = w, h
+	opts.Source, _ = NewSource(opts.RNG, rng.Int63())
+	opts.Pipeline, opts.Hooks, opts.Animate = nil, Hooks{}, nil
+	sub := newStage(s.ctx, opts, s.difficulty)
+	sub.chunk = true
+	if s.outside != nil {
+		sub.outside = make([]bool, len(sub.cell))
+		for y := 1; y <= h; y++ {
+			for x := 1; x <= w; x++ {
+				for _, at := range copies {
+					if cx, cy := at(x, y); s.outside[(cy-1)*s.width+cx-1] {
+						sub.outside[(y-1)*w+x-1] = true
+					}
+				}
+			}
+		}
+	}
+	sub.useStream(roomStream)
+	sub.AddRooms()
+	sub.useStream(mazeStream)
+	sub.FillMaze()
+	sub.useStream(connectStream)
+	sub.ConnectRooms()
+	if s.cancelled() {
+		return nil
+	}
+
+	for _, at := range copies {
+		for y := 1; y <= h; y++ {
+			for x := 1; x <= w; x++ {
+				if kind := sub.at(x, y).kind; kind != Wall {
+					cx, cy := at(x, y)
+					s.setKind(cx, cy, kind)
+				}
+			}
+		}
+		for _, door := range sub.doors {
+			s.doors = append(s.doors, s.at(at(door.x, door.y)))
+		}
+		for _, room := range sub.rooms {
+			room = room.moved(at)
+			s.rooms = append(s.rooms, room)
+			s.roomPlaced(room)
+		}
+	}
+
+	// Rooms keep off the part's edges, so the maze runs along its right side
+	// and a passage straight across to the copy beside it never meets a
+	// room. Each passage is copied the way the part was, joining every copy
+	// to the next.
+	var spots []int
+	for y := 2; y < h; y += 2 {
+		if s.isOpen(w-1, y) && s.isOpen(s.width+2-w, y) && s.crossable(w, s.width+1-w, y) {
+			spots = append(spots, y)
+		}
+	}
+	for i := rng.Intn(2) + 1; i > 0 && len(spots) > 0; i-- {
+		j := rng.Intn(len(spots))
+		y := spots[j]
+		spots = append(spots[:j], spots[j+1:]...)
+		for x := w; x <= s.width+1-w; x++ {
+			for _, at := range copies {
+				cx, cy := at(x, y)
+				s.setKind(cx, cy, Floor)
+				s.regionsJoined(cx, cy)
+			}
+		}
+	}
+	return nil
+}
+
+// crossable reports if row y is solid wall inside the stage's outline from
+// x1 to x2
+func (s *Stage) crossable(x1, x2, y int) bool {
+	for x := x1; x <= x2; x++ {
+		if s.isEdge(x, y) || s.at(x, y).kind != Wall {
+			return false
+		}
+	}
+	return true
+}
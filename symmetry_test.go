@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestSymmetricLayouts(t *testing.T) {
+	for _, mode := range []string{"mirror", "rotate2", "rotate4"} {
+		for _, size := range [][2]int{{41, 41}, {39, 39}} {
+			for seed := int64(1); seed <= 5; seed++ {
+				s, err := New(WithSize(size[0], size[1]), WithSeed(seed), WithSymmetry(mode), WithPipeline(Pipeline{{Name: "symmetry", Layout: true, Generator: Symmetry{Mode: mode}}}))
+				if err != nil {
+					t.Fatalf("%s seed %d: %v", mode, seed, err)
+				}
+				for _, at := range symmetries[mode](s.width, s.height) {
+					for y := 1; y <= s.height; y++ {
+						for x := 1; x <= s.width; x++ {
+							if cx, cy := at(x, y); s.at(x, y).kind != s.at(cx, cy).kind {
+								t.Fatalf("%s %dx%d seed %d: (%d, %d) is %v but its copy (%d, %d) is %v", mode, size[0], size[1], seed, x, y, s.at(x, y).kind, cx, cy, s.at(cx, cy).kind)
+							}
+						}
+					}
+				}
+				if report := s.Validate(); !report.Valid {
+					t.Errorf("%s %dx%d seed %d: %v", mode, size[0], size[1], seed, report.Failures)
+				}
+				if len(s.rooms)%len(symmetries[mode](1, 1)) != 0 {
+					t.Errorf("%s seed %d: %d rooms don't split evenly between the copies", mode, seed, len(s.rooms))
+				}
+			}
+		}
+	}
+}
+
+func TestSymmetricStagesAreValid(t *testing.T) {
+	for _, mode := range []string{"mirror", "rotate2"} {
+		for seed := int64(1); seed <= 10; seed++ {
+			s, err := New(WithSeed(seed), WithSymmetry(mode))
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", mode, seed, err)
+			}
+			if report := s.Validate(); !report.Valid {
+				t.Errorf("%s seed %d: %v", mode, seed, report.Failures)
+			}
+		}
+	}
+	if _, err := New(WithSymmetry("rotate4")); err == nil {
+		t.Error("rotate4 on a stage that isn't square should fail")
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Telnet commands and the options negotiated, from RFC 854 and on
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetEcho = 1
+	telnetSGA  = 3
+	telnetNAWS = 31
+)
+
+// ServeTelnet generates a stage from opts and lets everyone who connects
+// over telnet to l walk it together, each seeing where the others are as
+// they move. Monsters take their turn after every move anyone makes,
+// going after whoever made it.
+func ServeTelnet(l net.Listener, opts Options) error {
+	opts.Hooks, opts.Animate = Hooks{}, nil
+	ctx, cancel := context.WithTimeout(context.Background(), sessionGenerateTimeout)
+	s, err := served.generate(ctx, opts.seeded(time.Now().UnixNano()), "telnet")
+	cancel()
+	if err != nil {
+		return err
+	}
+	s.useStream(playStream)
+	d := &sharedDungeon{s: s, players: make(map[*sharedPlayer]bool)}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go d.serve(conn)
+	}
+}
+
+// sharedDungeon is a stage walked by everyone connected at once. mu guards
+// the stage and everyone on it.
+type sharedDungeon struct {
+	mu      sync.Mutex
+	s       *Stage
+	players map[*sharedPlayer]bool
+	joined  int
+}
+
+// sharedPlayer is someone walking a shared dungeon, with what's happened
+// to them since their screen was last drawn. redraw gets a value when
+// their screen needs drawing again.
+type sharedPlayer struct {
+	name    string
+	p       *Player
+	message string
+	redraw  chan struct{}
+}
+
+// join puts a new player on the entrance, telling everyone else
+func (d *sharedDungeon) join() *sharedPlayer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.joined++
+	sp := &sharedPlayer{
+		name:    fmt.Sprintf("player %d", d.joined),
+		p:       NewPlayer(d.s.entranceX, d.s.entranceY),
+		redraw:  make(chan struct{}, 1),
+		message: fmt.Sprintf("Welcome, player %d. ", d.joined),
+	}
+	d.players[sp] = true
+	d.tell(sp, fmt.Sprintf("%s arrives. ", sp.name))
+	return sp
+}
+
+// leave takes a player off the stage, telling everyone else
+func (d *sharedDungeon) leave(sp *sharedPlayer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.players, sp)
+	d.tell(sp, fmt.Sprintf("%s leaves. ", sp.name))
+}
+
+// tell adds message to what's happened to everyone but from, and has their
+// screens drawn again
+func (d *sharedDungeon) tell(from *sharedPlayer, message string) {
+	for sp := range d.players {
+		if sp != from {
+			sp.message += message
+			select {
+			case sp.redraw <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// move takes sp's turn, moving dx, dy, or picking up what's there if pickUp
+func (d *sharedDungeon) move(sp *sharedPlayer, dx, dy int, pickUp bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, p := d.s, sp.p
+	x, y := s.step(p.x, p.y, dx, dy)
+	for other := range d.players {
+		if other != sp && other.p.x == x && other.p.y == y && (dx != 0 || dy != 0) {
+			sp.message += fmt.Sprintf("%s is in the way. ", other.name)
+			return
+		}
+	}
+	if pickUp {
+		sp.message += s.PickUp(p)
+	}
+	sp.message += s.takeTurn(p, dx, dy)
+	// everyone sees them move, and what the monsters did
+	d.tell(sp, "")
+}
+
+// frame draws the stage as sp sees it on a rows by cols screen, with them as
+// '@' and everyone else as '&'
+func (d *sharedDungeon) frame(sp *sharedPlayer, rows, cols int) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, p := d.s, sp.p
+	others := make(map[image.Point]bool)
+	for other := range d.players {
+		if other != sp {
+			others[image.Pt(other.p.x, other.p.y)] = true
+		}
+	}
+	var b strings.Builder
+	b.WriteString(beginFrame + clearScreen)
+	view := s.view(rows-2, cols, p.x, p.y)
+	glyph := s.glyphs(false)
+	for y := view.Min.Y; y < view.Max.Y; y++ {
+		for x := view.Min.X; x < view.Max.X; x++ {
+			r := glyph(x, y)
+			switch {
+			case x == p.x && y == p.y:
+				r = '@'
+			case others[image.Pt(x, y)]:
+				r = '&'
+			}
+			s.printCell(&b, x, y, r)
+		}
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "HP %d/%d  %d here  move or attack: arrows, wasd, or hjkl. pick up: g. quit: q\r\n", p.hp, p.maxHP, len(d.players))
+	b.WriteString(sp.message + "\r\n" + endFrame)
+	sp.message = ""
+	return b.String()
+}
+
+// serve plays the shared dungeon with whoever is on conn until they quit,
+// die, or hang up
+func (d *sharedDungeon) serve(conn net.Conn) {
+	defer conn.Close()
+	// with the server saying it echoes, the client doesn't, and it sends
+	// every key as it's pressed and says how big its window is
+	conn.Write([]byte{telnetIAC, telnetWILL, telnetEcho, telnetIAC, telnetWILL, telnetSGA, telnetIAC, telnetDO, telnetNAWS})
+	in := &telnetReader{r: bufio.NewReader(conn), resized: make(chan os.Signal, 1)}
+	keys := newKeyboardOn(in, nil, func() {})
+	defer keys.close()
+	io.WriteString(conn, altScreen)
+	defer io.WriteString(conn, mainScreen)
+
+	sp := d.join()
+	defer d.leave(sp)
+	for {
+		rows, cols := in.size()
+		if _, err := io.WriteString(conn, d.frame(sp, rows, cols)); err != nil {
+			return
+		}
+		d.mu.Lock()
+		dead := sp.p.hp <= 0
+		d.mu.Unlock()
+		if dead {
+			io.WriteString(conn, "You die...\r\n")
+			return
+		}
+
+		var key string
+		select {
+		case <-sp.redraw:
+			continue
+		case <-in.resized:
+			continue
+		case k, ok := <-keys.keys:
+			if !ok {
+				return
+			}
+			key = k
+		}
+		switch key {
+		case "q":
+			return
+		case "w", "k", "\x1b[A":
+			d.move(sp, 0, -1, false)
+		case "d", "l", "\x1b[C":
+			d.move(sp, 1, 0, false)
+		case "s", "j", "\x1b[B":
+			d.move(sp, 0, 1, false)
+		case "a", "h", "\x1b[D":
+			d.move(sp, -1, 0, false)
+		case "g", ",":
+			d.move(sp, 0, 0, true)
+		}
+	}
+}
+
+// telnetReader reads what's typed on a telnet connection, taking out the
+// telnet commands mixed in with it, and keeping the window size the client
+// says it has
+type telnetReader struct {
+	r          *bufio.Reader
+	mu         sync.Mutex
+	rows, cols int
+	resized    chan os.Signal
+}
+
+// size returns the window size the client last said it has, or 0, 0 if it
+// hasn't
+func (t *telnetReader) size() (rows, cols int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rows, t.cols
+}
+
+// Read reads what's typed, at least a byte of it
+func (t *telnetReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && (n == 0 || t.r.Buffered() > 0) {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		switch {
+		case b == telnetIAC:
+			if lit, err := t.command(); err != nil {
+				return n, err
+			} else if lit {
+				p[n] = telnetIAC
+				n++
+			}
+		// enter comes as "\r\0" or "\r\n", and only the "\r" is a key
+		case b == 0 || b == '\n':
+		default:
+			p[n] = b
+			n++
+		}
+	}
+	return n, nil
+}
+
+// command reads the rest of a telnet command after IAC, reporting if it was
+// an IAC standing for itself
+func (t *telnetReader) command() (bool, error) {
+	cmd, err := t.r.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	switch cmd {
+	case telnetIAC:
+		return true, nil
+	case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+		_, err = t.r.ReadByte()
+	case telnetSB:
+		var data []byte
+		if data, err = t.subnegotiation(); err == nil && len(data) == 5 && data[0] == telnetNAWS {
+			t.mu.Lock()
+			t.cols, t.rows = int(data[1])<<8|int(data[2]), int(data[3])<<8|int(data[4])
+			t.mu.Unlock()
+			select {
+			case t.resized <- windowChanged{}:
+			default:
+			}
+		}
+	}
+	return false, err
+}
+
+// subnegotiation reads the option and data of a telnet subnegotiation, up to
+// the IAC SE that ends it
+func (t *telnetReader) subnegotiation() ([]byte, error) {
+	var data []byte
+	for {
+		b, err := t.r.ReadByte()
+		if err == nil && b == telnetIAC {
+			if b, err = t.r.ReadByte(); err == nil && b == telnetSE {
+				return data, nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b)
+	}
+}
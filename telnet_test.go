@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTelnetReader(t *testing.T) {
+	in := []byte{'a', telnetIAC, telnetDO, telnetEcho, 'b', telnetIAC, telnetIAC, '\r', 0,
+		telnetIAC, telnetSB, telnetNAWS, 0, 100, 0, 30, telnetIAC, telnetSE, 'c'}
+	r := &telnetReader{r: bufio.NewReader(bytes.NewReader(in)), resized: make(chan os.Signal, 1)}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ab\xff\rc" {
+		t.Errorf("read %q", got)
+	}
+	if rows, cols := r.size(); rows != 30 || cols != 100 {
+		t.Errorf("window is %dx%d, want 100x30", cols, rows)
+	}
+	select {
+	case <-r.resized:
+	default:
+		t.Error("no resize for the window size")
+	}
+}
+
+// waitFor reads from conn until it has sent want, returning what it read
+func waitFor(t *testing.T, conn net.Conn, want string) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var seen strings.Builder
+	buf := make([]byte, 4096)
+	for !strings.Contains(seen.String(), want) {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("never got %q: %v", want, err)
+		}
+		seen.Write(buf[:n])
+	}
+	return seen.String()
+}
+
+func TestServeTelnet(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go ServeTelnet(l, DefaultOptions())
+
+	first, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	waitFor(t, first, "Welcome, player 1.")
+
+	// everyone there sees who comes and goes
+	second, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	waitFor(t, second, "2 here")
+	waitFor(t, first, "player 2 arrives.")
+	second.Write([]byte("q"))
+	if seen := waitFor(t, first, "player 2 leaves."); !strings.Contains(seen[strings.LastIndex(seen, clearScreen):], "1 here") {
+		t.Error("player 2 is still counted after leaving")
+	}
+}
+
+func TestSharedDungeon(t *testing.T) {
+	s, err := New(WithSeed(1), WithStocking(0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &sharedDungeon{s: s, players: make(map[*sharedPlayer]bool)}
+	a, b := d.join(), d.join()
+	<-a.redraw
+	for _, dir := range directions {
+		x, y := s.entranceX+dir[0], s.entranceY+dir[1]
+		if !s.IsWalkable(x, y) {
+			continue
+		}
+		d.move(a, dir[0], dir[1], false)
+		select {
+		case <-b.redraw:
+		default:
+			t.Fatal("moving didn't redraw everyone else")
+		}
+		// b sees a where they moved to, and a sees b still on the entrance
+		if frame := d.frame(b, 0, 0); !strings.Contains(frame, "&") || !strings.Contains(frame, "@") {
+			t.Errorf("b's frame doesn't show both players:\n%s", frame)
+		}
+		if a.p.x != x || a.p.y != y {
+			t.Errorf("a is at %d, %d, want %d, %d", a.p.x, a.p.y, x, y)
+		}
+
+		// nobody walks through anybody else
+		d.move(b, dir[0], dir[1], false)
+		if b.p.x != s.entranceX || b.p.y != s.entranceY || !strings.Contains(b.message, "player 1 is in the way.") {
+			t.Errorf("b walked into a: at %d, %d, told %q", b.p.x, b.p.y, b.message)
+		}
+		return
+	}
+	t.Fatal("nowhere to move from the entrance")
+}
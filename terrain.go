@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TerrainFeature is one terrain pass a theme runs. A "pool" fills the middle
+// of Rate percent of the rooms; a "vein" winds across the stage from west to
+// east, and Rate of them are laid down; a "river" is carved from north to
+// south through walls and all, Rate times.
+type TerrainFeature struct {
+	Terrain TileType
+	Shape   string
+	Rate    int
+}
+
+// AddTerrain runs the theme's terrain passes. Pools keep a ring of floor
+// around them so a room can always be walked around, and veins only cover
+// cells that are already open, so neither one cuts the stage apart. Rivers
+// do, so bridges are laid across them afterwards.
+func (s *Stage) AddTerrain() error {
+	for _, f := range s.theme.Terrain {
+		switch f.Shape {
+		case "pool":
+			for _, room := range s.rooms {
+				if s.rng.Intn(100) < f.Rate {
+					s.addPool(room, f.Terrain)
+				}
+			}
+		case "vein":
+			for i := 0; i < f.Rate; i++ {
+				s.addVein(f.Terrain)
+			}
+		case "river":
+			for i := 0; i < f.Rate; i++ {
+				s.carveRiver(f.Terrain)
+			}
+		}
+	}
+	return s.AddBridges()
+}
+
+// addPool fills an oval in the middle of room with terrain, leaving rooms
+// with the entrance or stairs in them alone
+func (s *Stage) addPool(room Room, terrain TileType) {
+	if s.inRoom(room, s.entranceX, s.entranceY) || s.inRoom(room, s.upX, s.upY) || s.inRoom(room, s.downX, s.downY) {
+		return
+	}
+	rx, ry := room.width/2-1, room.height/2-1
+	if rx < 1 || ry < 1 {
+		return
+	}
+	cx, cy := room.x+room.width/2, room.y+room.height/2
+	for y := cy - ry; y <= cy+ry; y++ {
+		for x := cx - rx; x <= cx+rx; x++ {
+			dx, dy := x-cx, y-cy
+			if dx*dx*ry*ry+dy*dy*rx*rx <= rx*rx*ry*ry && s.isOpen(x, y) {
+				s.setKind(x, y, terrain)
+			}
+		}
+	}
+}
+
+// addVein wanders from the west edge to the east edge, starting somewhere in
+// the middle half of the stage and drifting up or down a row at a time, and
+// covers the open cells it passes over with terrain
+func (s *Stage) addVein(terrain TileType) {
+	y := s.height/4 + 1 + s.rng.Intn(s.height/2)
+	for x := 1; x <= s.width; x++ {
+		y += s.rng.Intn(3) - 1
+		if y < 2 {
+			y = 2
+		}
+		if y > s.height-1 {
+			y = s.height - 1
+		}
+		if !s.isOpen(x, y) || s.isStairs(x, y) || s.isDoor(x, y) || (x == s.entranceX && y == s.entranceY) {
+			continue
+		}
+		s.setKind(x, y, terrain)
+	}
+}
+
+// carveRiver cuts a river two cells wide from the north wall to the south
+// wall, meandering a column at a time. The entrance and stairs are left dry,
+// and so are doorways and the cells around them, so every doorway still
+// opens onto exactly the two cells it joins.
+func (s *Stage) carveRiver(terrain TileType) {
+	x := s.width/4 + 1 + s.rng.Intn(s.width/2)
+	for y := 2; y < s.height; y++ {
+		x += s.rng.Intn(3) - 1
+		if x < 2 {
+			x = 2
+		}
+		if x > s.width-2 {
+			x = s.width - 2
+		}
+		for rx := x; rx <= x+1; rx++ {
+			if s.isStairs(rx, y) || (rx == s.entranceX && y == s.entranceY) || s.nearDoor(rx, y) || s.isEdge(rx, y) {
+				continue
+			}
+			s.setKind(rx, y, terrain)
+		}
+	}
+}
+
+// Bridge is a way across a strip of terrain nothing can cross: a bridge, or
+// a ford where deep water is narrow enough to wade. It starts on x, y and
+// runs length cells in the direction dx, dy.
+type Bridge struct {
+	x, y, dx, dy, length int
+	over                 TileType
+	ford                 bool
+}
+
+// JSON returns the bridge's ends and what it crosses
+func (b *Bridge) JSON() BridgeJSON {
+	kind := "bridge"
+	if b.ford {
+		kind = "ford"
+	}
+	return BridgeJSON{
+		Kind:   kind,
+		Over:   b.over.Kind().Name,
+		From:   PointJSON{X: b.x, Y: b.y},
+		To:     PointJSON{X: b.x + (b.length-1)*b.dx, Y: b.y + (b.length-1)*b.dy},
+		Length: b.length,
+	}
+}
+
+// nearDoor reports if x, y is a doorway or right beside one
+func (s *Stage) nearDoor(x, y int) bool {
+	if s.isDoor(x, y) {
+		return true
+	}
+	for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+		if s.isDoor(x+d[0], y+d[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddBridges joins every part of the stage that impassable terrain has cut
+// off from the entrance back onto it, across the fewest hazard cells it can,
+// until everything that could be stood on can be reached again. Deep water
+// two cells wide or less is forded instead of bridged. It fails if some part
+// can't be reached across the terrain at all.
+func (s *Stage) AddBridges() error {
+	for !s.cancelled() {
+		reached := s.reachable(s.entranceX, s.entranceY)
+		x, y, ok := s.unreached(reached)
+		if !ok {
+			return nil
+		}
+		path := s.crossing(s.reachable(x, y), reached)
+		if path == nil {
+			return fmt.Errorf("nothing can be bridged to (%d, %d)", x, y)
+		}
+		s.bridge(path)
+	}
+	return nil
+}
+
+// reachable returns which cells can be walked to from x, y, indexed like the
+// stage's cells
+func (s *Stage) reachable(x, y int) []bool {
+	reached := make([]bool, len(s.cell))
+	if !s.IsWalkable(x, y) {
+		return reached
+	}
+	reached[(y-1)*s.width+x-1] = true
+	queue := []Tile{s.at(x, y)}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		for _, n := range s.openNeighbors(t.x, t.y) {
+			if i := (n.y-1)*s.width + n.x - 1; !reached[i] {
+				reached[i] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	return reached
+}
+
+// unreached returns the first cell that could be stood on but isn't reached,
+// reading left to right and top to bottom
+func (s *Stage) unreached(reached []bool) (x, y int, ok bool) {
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if s.IsWalkable(x, y) && !reached[(y-1)*s.width+x-1] {
+				return x, y, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// crossing returns the hazard cells on the way from the cells in from to the
+// cells in to that crosses the fewest of them, in order, or nil if there is
+// no way across. Walkable cells are free to pass through and walls can't be
+// crossed at all.
+func (s *Stage) crossing(from, to []bool) []Tile {
+	const unseen = -1
+	cost := make([]int, len(s.cell))
+	prev := make([]int, len(s.cell))
+	for i := range cost {
+		cost[i], prev[i] = unseen, unseen
+	}
+	// zero-one breadth first: free steps go on the front of the deque, hazard
+	// steps on the back
+	var deque []int
+	for i, ok := range from {
+		if ok {
+			cost[i] = 0
+			deque = append(deque, i)
+		}
+	}
+	for len(deque) > 0 {
+		i := deque[0]
+		deque = deque[1:]
+		if to[i] {
+			var path []Tile
+			for ; !from[i]; i = prev[i] {
+				if t := s.cell[i]; !t.flags.Has(Walkable) {
+					path = append([]Tile{t}, path...)
+				}
+			}
+			return path
+		}
+		x, y := i%s.width+1, i/s.width+1
+		for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			nx, ny := x+d[0], y+d[1]
+			if !s.cellExists(nx, ny) {
+				continue
+			}
+			j := (ny-1)*s.width + nx - 1
+			step := 0
+			switch t := s.cell[j]; {
+			case t.flags.Has(Walkable):
+			case t.kind.Kind().Terrain:
+				step = 1
+			default:
+				continue
+			}
+			if cost[j] != unseen && cost[j] <= cost[i]+step {
+				continue
+			}
+			cost[j], prev[j] = cost[i]+step, i
+			if step == 0 {
+				deque = append([]int{j}, deque...)
+			} else {
+				deque = append(deque, j)
+			}
+		}
+	}
+	return nil
+}
+
+// bridge lays a bridge over every straight run of hazard cells in path, or
+// fords deep water two cells wide or less
+func (s *Stage) bridge(path []Tile) {
+	for start := 0; start < len(path); {
+		b := Bridge{x: path[start].x, y: path[start].y, length: 1, over: path[start].kind}
+		for end := start + 1; end < len(path); end++ {
+			dx, dy := path[end].x-path[end-1].x, path[end].y-path[end-1].y
+			if b.length == 1 && dx*dx+dy*dy == 1 {
+				b.dx, b.dy = dx, dy
+			}
+			if path[end].kind != b.over || dx != b.dx || dy != b.dy || dx*dx+dy*dy != 1 {
+				break
+			}
+			b.length++
+		}
+		b.ford = b.over == DeepWater && b.length <= 2
+		for i := 0; i < b.length; i++ {
+			if b.ford {
+				s.setKind(b.x+i*b.dx, b.y+i*b.dy, Water)
+			} else {
+				s.setKind(b.x+i*b.dx, b.y+i*b.dy, BridgeDeck)
+			}
+		}
+		s.bridges = append(s.bridges, &b)
+		start += b.length
+	}
+}
+
+// onGround reports if x, y is open with no terrain or feature on it
+func (s *Stage) onGround(x, y int) bool {
+	return s.isOpen(x, y) && !s.at(x, y).kind.Kind().Terrain && s.at(x, y).feature == NoFeature
+}
+
+// terrainNames returns the sorted names of the terrain found in room
+func (s *Stage) terrainNames(room Room) []string {
+	found := map[string]bool{}
+	for x := room.x; x <= room.x+room.width; x++ {
+		for y := room.y; y <= room.y+room.height; y++ {
+			if t := s.at(x, y).kind; t.Kind().Terrain {
+				found[t.Kind().Name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
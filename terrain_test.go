@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestRiverThemesStayConnected(t *testing.T) {
+	for _, theme := range []string{"crypt", "sewer", "ice"} {
+		for seed := int64(1); seed <= 40; seed++ {
+			s, err := New(WithSeed(seed), WithTheme(themes[theme]))
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", theme, seed, err)
+			}
+			if report := s.Validate(); !report.Valid {
+				t.Errorf("%s seed %d: %v", theme, seed, report.Failures)
+			}
+		}
+	}
+}
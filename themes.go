@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Theme dresses a stage: which glyph open floor is drawn with, what color
+// walls are in the terminal, what terrain is laid down, which decorations
+// are scattered around, and which monsters and items show up
+type Theme struct {
+	Name        string
+	Floor       rune
+	WallColor   int // ANSI foreground color code, 0 for the terminal default
+	Terrain     []TerrainFeature
+	Decorations []DecorationKind
+	Monsters    []MonsterKind
+	Items       []ItemKind
+}
+
+// DecorationKind is scenery with no effect on play. Where is "room",
+// "corridor", or "wall" (open cells in rooms that touch a wall); Rate is the
+// percent of those cells it is placed on.
+type DecorationKind struct {
+	Name  string
+	Glyph rune
+	Where string
+	Rate  int
+}
+
+type Decoration struct {
+	DecorationKind
+	x, y int
+}
+
+var themes = map[string]*Theme{
+	"classic": {
+		Name:     "classic",
+		Floor:    ' ',
+		Terrain:  []TerrainFeature{{Terrain: Water, Shape: "pool", Rate: 15}},
+		Monsters: monsterTable,
+		Items:    itemTable,
+	},
+	"crypt": {
+		Name:      "crypt",
+		Floor:     '.',
+		WallColor: 90,
+		Terrain: []TerrainFeature{
+			{Terrain: Chasm, Shape: "pool", Rate: 15},
+			{Terrain: Chasm, Shape: "river", Rate: 1},
+		},
+		Decorations: []DecorationKind{
+			{Name: "bones", Glyph: '%', Where: "wall", Rate: 10},
+			{Name: "cobwebs", Glyph: '"', Where: "corridor", Rate: 3},
+		},
+		Monsters: []MonsterKind{
+			{Name: "skeleton", Glyph: 's', Weight: 10, Depth: 0, Sight: 5, HP: 4, Attack: 2},
+			{Name: "zombie", Glyph: 'z', Weight: 8, Depth: 20, Sight: 4, HP: 8, Attack: 2},
+			{Name: "ghost", Glyph: 'G', Weight: 4, Depth: 40, Sight: 10, HP: 6, Attack: 3},
+			{Name: "lich", Glyph: 'L', Weight: 1, Depth: 80, Sight: 12, HP: 20, Attack: 6},
+		},
+		Items: append([]ItemKind{
+			{Name: "silver amulet", Class: "treasure", Glyph: '"', Weight: 3, Depth: 40},
+		}, itemTable...),
+	},
+	"sewer": {
+		Name:      "sewer",
+		Floor:     '.',
+		WallColor: 32,
+		Terrain: []TerrainFeature{
+			{Terrain: Water, Shape: "pool", Rate: 40},
+			{Terrain: Water, Shape: "vein", Rate: 2},
+			{Terrain: DeepWater, Shape: "river", Rate: 1},
+		},
+		Decorations: []DecorationKind{
+			{Name: "puddle", Glyph: '_', Where: "corridor", Rate: 12},
+			{Name: "grate", Glyph: '#', Where: "room", Rate: 2},
+		},
+		Monsters: []MonsterKind{
+			{Name: "rat", Glyph: 'r', Weight: 12, Depth: 0, Sight: 4, HP: 3, Attack: 1},
+			{Name: "giant rat", Glyph: 'R', Weight: 6, Depth: 20, Sight: 6, HP: 6, Attack: 2},
+			{Name: "slime", Glyph: 'j', Weight: 5, Depth: 30, Sight: 3, HP: 10, Attack: 2},
+			{Name: "crocodile", Glyph: 'C', Weight: 2, Depth: 70, Sight: 8, HP: 18, Attack: 5},
+		},
+		Items: itemTable,
+	},
+	"mine": {
+		Name:      "mine",
+		Floor:     '.',
+		WallColor: 33,
+		Terrain: []TerrainFeature{
+			{Terrain: Lava, Shape: "pool", Rate: 10},
+			{Terrain: Lava, Shape: "vein", Rate: 2},
+		},
+		Decorations: []DecorationKind{
+			{Name: "support beam", Glyph: '=', Where: "corridor", Rate: 6},
+			{Name: "ore cart", Glyph: '&', Where: "room", Rate: 2},
+		},
+		Monsters: []MonsterKind{
+			{Name: "kobold", Glyph: 'k', Weight: 10, Depth: 0, Sight: 5, HP: 4, Attack: 2},
+			{Name: "cave spider", Glyph: 'S', Weight: 6, Depth: 20, Sight: 6, HP: 5, Attack: 3},
+			{Name: "dwarf", Glyph: 'h', Weight: 4, Depth: 40, Sight: 8, HP: 12, Attack: 4},
+			{Name: "earth elemental", Glyph: 'E', Weight: 1, Depth: 75, Sight: 6, HP: 25, Attack: 6},
+		},
+		Items: append([]ItemKind{
+			{Name: "pickaxe", Class: "equipment", Glyph: ')', Weight: 4, Depth: 0, Effect: "wield", Power: 3},
+			{Name: "gold nugget", Class: "treasure", Glyph: '*', Weight: 6, Depth: 20},
+		}, itemTable...),
+	},
+	"ice": {
+		Name:      "ice",
+		Floor:     '·',
+		WallColor: 36,
+		Terrain: []TerrainFeature{
+			{Terrain: Water, Shape: "pool", Rate: 20},
+			{Terrain: DeepWater, Shape: "river", Rate: 1},
+		},
+		Decorations: []DecorationKind{
+			{Name: "icicles", Glyph: '\'', Where: "wall", Rate: 8},
+			{Name: "snowdrift", Glyph: '∴', Where: "room", Rate: 4},
+		},
+		Monsters: []MonsterKind{
+			{Name: "ice bat", Glyph: 'b', Weight: 10, Depth: 0, Sight: 8, HP: 3, Attack: 1},
+			{Name: "frost wolf", Glyph: 'w', Weight: 7, Depth: 20, Sight: 10, HP: 8, Attack: 3},
+			{Name: "yeti", Glyph: 'Y', Weight: 3, Depth: 50, Sight: 8, HP: 16, Attack: 5},
+			{Name: "ice wyrm", Glyph: 'W', Weight: 1, Depth: 80, Sight: 12, HP: 30, Attack: 7},
+		},
+		Items: append([]ItemKind{
+			{Name: "fur cloak", Class: "equipment", Glyph: '[', Weight: 3, Depth: 10, Effect: "wear", Power: 5},
+		}, itemTable...),
+	},
+}
+
+// LookupTheme returns the theme with the given name
+func LookupTheme(name string) (*Theme, error) {
+	if t, ok := themes[name]; ok {
+		return t, nil
+	}
+	names := make([]string, 0, len(themes))
+	for n := range themes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown theme %q, want one of %v", name, names)
+}
+
+// AddDecorations scatters the theme's decorations. They never go where
+// something is already standing or lying, or on stairs or doorways.
+func (s *Stage) AddDecorations() {
+	for _, kind := range s.theme.Decorations {
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				if !s.onGround(x, y) || s.isStairs(x, y) || s.isDoor(x, y) || s.decorationAt(x, y) != nil {
+					continue
+				}
+				_, inRoom := s.roomAt(x, y)
+				switch kind.Where {
+				case "room":
+					if !inRoom {
+						continue
+					}
+				case "corridor":
+					if inRoom {
+						continue
+					}
+				case "wall":
+					if !inRoom || len(s.openNeighbors(x, y)) == 4 {
+						continue
+					}
+				}
+				if s.rng.Intn(100) < kind.Rate {
+					s.decorations = append(s.decorations, &Decoration{DecorationKind: kind, x: x, y: y})
+				}
+			}
+		}
+	}
+}
+
+// decorationAt returns the decoration at x, y, or nil
+func (s *Stage) decorationAt(x, y int) *Decoration {
+	for _, d := range s.decorations {
+		if d.x == x && d.y == y {
+			return d
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+// TileType is what a cell is: solid wall, plain floor, a doorway or stairs,
+// or floor covered by terrain
+type TileType uint8
+
+const (
+	Wall TileType = iota
+	Floor
+	Door
+	LockedDoor
+	StairsUp
+	StairsDown
+	Water
+	Lava
+	Chasm
+	DeepWater
+	BridgeDeck
+)
+
+// TileFlags are the properties of a cell that movement, sight, and gameplay
+// ask about
+type TileFlags uint8
+
+const (
+	// Walkable cells can be stepped onto
+	Walkable TileFlags = 1 << iota
+	// Transparent cells can be seen through
+	Transparent
+	// Hazardous cells hurt whoever steps onto them
+	Hazardous
+)
+
+// Has reports if every flag in want is set
+func (f TileFlags) Has(want TileFlags) bool {
+	return f&want == want
+}
+
+// TileKind describes a tile type. ASCII is drawn in place of Glyph where
+// only ASCII will do; Color is the ANSI foreground color used in play mode.
+// Damage is dealt to the player every time they step onto a Hazardous tile.
+// Cost is how much effort stepping onto a Walkable tile takes, for
+// pathfinding. Terrain is set for the types terrain passes lay over the floor.
+type TileKind struct {
+	Name    string
+	Glyph   rune
+	ASCII   byte
+	Color   int
+	Flags   TileFlags
+	Damage  int
+	Cost    int
+	Terrain bool
+}
+
+var tileKinds = [...]TileKind{
+	Wall:       {Name: "wall", ASCII: '#'},
+	Floor:      {Name: "floor", Flags: Walkable | Transparent, Cost: 1},
+	Door:       {Name: "doorway", Flags: Walkable | Transparent, Cost: 1},
+	LockedDoor: {Name: "locked door", Glyph: lockedDoorGlyph, ASCII: lockedDoorGlyph},
+	StairsUp:   {Name: "stairs up", Glyph: stairsUpGlyph, ASCII: stairsUpGlyph, Flags: Walkable | Transparent, Cost: 1},
+	StairsDown: {Name: "stairs down", Glyph: stairsDownGlyph, ASCII: stairsDownGlyph, Flags: Walkable | Transparent, Cost: 1},
+
+	Water:      {Name: "water", Glyph: '~', ASCII: '~', Color: 34, Flags: Walkable | Transparent, Cost: 3, Terrain: true},
+	Lava:       {Name: "lava", Glyph: '≈', ASCII: '&', Color: 31, Flags: Walkable | Transparent | Hazardous, Damage: 3, Cost: 10, Terrain: true},
+	Chasm:      {Name: "chasm", Glyph: '░', ASCII: ':', Color: 90, Flags: Transparent, Terrain: true},
+	DeepWater:  {Name: "deep water", Glyph: '≋', ASCII: 'W', Color: 94, Flags: Transparent, Terrain: true},
+	BridgeDeck: {Name: "bridge", Glyph: '═', ASCII: '=', Color: 33, Flags: Walkable | Transparent, Cost: 1, Terrain: true},
+}
+
+// Kind returns the description of the tile type
+func (t TileType) Kind() TileKind {
+	return tileKinds[t]
+}
+
+// tileFlags derives a cell's flags from its type, less whatever the feature
+// standing on it blocks
+func tileFlags(kind TileType, f Feature) TileFlags {
+	return kind.Kind().Flags & (f.Kind().Flags | Hazardous)
+}
+
+// setKind changes what the cell at x, y is
+func (s *Stage) setKind(x, y int, kind TileType) {
+	tmpTile := s.at(x, y)
+	carved := tmpTile.kind == Wall && kind != Wall
+	if tmpTile.kind != Wall && kind == Wall {
+		s.progress.carved--
+	}
+	tmpTile.kind = kind
+	tmpTile.flags = tileFlags(kind, tmpTile.feature)
+	s.set(x, y, tmpTile)
+	if carved {
+		s.cellCarved(x, y)
+	}
+}
+
+// setFeature puts f on the cell at x, y
+func (s *Stage) setFeature(x, y int, f Feature) {
+	tmpTile := s.at(x, y)
+	tmpTile.feature = f
+	tmpTile.flags = tileFlags(tmpTile.kind, f)
+	s.set(x, y, tmpTile)
+}
+
+// IsWalkable reports if something can step onto x, y
+func (s *Stage) IsWalkable(x, y int) bool {
+	return s.cellExists(x, y) && s.at(x, y).flags.Has(Walkable)
+}
+
+// IsTransparent reports if x, y can be seen through
+func (s *Stage) IsTransparent(x, y int) bool {
+	return s.cellExists(x, y) && s.at(x, y).flags.Has(Transparent)
+}
+
+// MoveCost returns the effort it takes to step onto x, y: the tile's cost
+// plus whatever the feature on it adds
+func (s *Stage) MoveCost(x, y int) int {
+	return s.at(x, y).kind.Kind().Cost + s.at(x, y).feature.Kind().Cost
+}
+
+// IsHazardous reports if stepping onto x, y does damage
+func (s *Stage) IsHazardous(x, y int) bool {
+	return s.cellExists(x, y) && s.at(x, y).flags.Has(Hazardous)
+}
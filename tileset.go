@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// Tileset redraws a stage in a game's own glyphs and colors. Tiles are
+// keyed by the name of a tile type or feature, like "floor", "doorway",
+// "stairs down", "lava", or "column", or "ramp". Walls, when given, are the
+// 16 ways a wall can be drawn, indexed by its cellMask, over "wall" in
+// Tiles. Glyphs restyles anything else drawn, like monsters, items, and the
+// player, by the glyph it's normally drawn with. A glyph can be any string,
+// though the stage only lines up in play with ones a column wide.
+type Tileset struct {
+	Tiles  map[string]TileStyle `json:"tiles"`
+	Walls  []TileStyle          `json:"walls"`
+	Glyphs map[string]TileStyle `json:"glyphs"`
+}
+
+// TileStyle is what a tile is drawn as: Glyph, in the ANSI foreground Color
+// where the stage is drawn in color. Either left empty is drawn as usual.
+type TileStyle struct {
+	Glyph string `json:"glyph"`
+	Color int    `json:"color"`
+}
+
+// or returns the style with whatever it leaves empty taken from other
+func (t TileStyle) or(other TileStyle) TileStyle {
+	if t.Glyph == "" {
+		t.Glyph = other.Glyph
+	}
+	if t.Color == 0 {
+		t.Color = other.Color
+	}
+	return t
+}
+
+// ReadTileset reads a tileset written as JSON from r
+func ReadTileset(r io.Reader) (*Tileset, error) {
+	var t Tileset
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&t); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, k := range tileKinds {
+		names[k.Name] = true
+	}
+	for _, k := range featureKinds {
+		names[k.Name] = true
+	}
+	names["ramp"] = true
+	for name := range t.Tiles {
+		if !names[name] {
+			return nil, fmt.Errorf("unknown tile %q", name)
+		}
+	}
+	if len(t.Walls) != 0 && len(t.Walls) != len(wallRunes) {
+		return nil, fmt.Errorf("walls has %d glyphs, want one for each of the %d ways a wall is drawn", len(t.Walls), len(wallRunes))
+	}
+	for glyph := range t.Glyphs {
+		if utf8.RuneCountInString(glyph) != 1 {
+			return nil, fmt.Errorf("glyphs are keyed by one character, got %q", glyph)
+		}
+	}
+	return &t, nil
+}
+
+// ReadTilesetFile reads the tileset in the JSON file at path
+func ReadTilesetFile(path string) (*Tileset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t, err := ReadTileset(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return t, nil
+}
+
+// style returns the tileset's style for r drawn at x, y: the cell's own, if
+// r is what the cell itself is drawn as, or else the style for r
+func (t *Tileset) style(s *Stage, x, y int, r rune) TileStyle {
+	cell := s.at(x, y)
+	if r == s.unicodeRune(x, y) {
+		switch {
+		case cell.kind == Wall:
+			var wall TileStyle
+			if len(t.Walls) != 0 {
+				wall = t.Walls[s.cellMask(x, y)]
+			}
+			return wall.or(t.Tiles["wall"])
+		case cell.feature != NoFeature:
+			return t.Tiles[cell.feature.Kind().Name]
+		case cell.ramp && !cell.kind.Kind().Terrain:
+			return t.Tiles["ramp"]
+		}
+		return t.Tiles[cell.kind.Kind().Name]
+	}
+	// stairs and locked doors are drawn over the cell
+	if r == cell.kind.Kind().Glyph {
+		return t.Tiles[cell.kind.Kind().Name]
+	}
+	return t.Glyphs[string(r)]
+}
+
+// tile returns what to draw for r at x, y, and the ANSI foreground color to
+// draw it in, 0 for the terminal default: the color of the wall or terrain
+// it is, restyled by the stage's tileset if it has one
+func (s *Stage) tile(x, y int, r rune) (string, int) {
+	color := 0
+	switch k := s.at(x, y).kind.Kind(); {
+	case s.at(x, y).kind == Wall:
+		color = s.theme.WallColor
+	case r == k.Glyph:
+		color = k.Color
+	}
+	if s.opts.Tileset == nil {
+		return string(r), color
+	}
+	style := s.opts.Tileset.style(s, x, y, r).or(TileStyle{string(r), color})
+	return style.Glyph, style.Color
+}
+
+// tileGap returns the gap between x, y and the cell to its right in a wide
+// stage, with a wall running through it in the tileset's glyph for one
+func (s *Stage) tileGap(x, y int, left, right rune) string {
+	gap := s.gap(x, y, left, right)
+	if gap == ' ' {
+		return " "
+	}
+	var wall TileStyle
+	if t := s.opts.Tileset; len(t.Walls) != 0 {
+		wall = t.Walls[wallLeft|wallRight]
+	}
+	return wall.or(s.opts.Tileset.Tiles["wall"]).or(TileStyle{Glyph: string(gap)}).Glyph
+}
+
+// writeTiles writes the stage to w as writeRows does, in the glyphs of its
+// tileset
+func (s *Stage) writeTiles(w io.Writer, glyph func(x, y int) rune) error {
+	b := bufio.NewWriterSize(w, 64<<10)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			r := glyph(x, y)
+			if s.opts.Wide && x > 1 {
+				b.WriteString(s.tileGap(x-1, y, glyph(x-1, y), r))
+			}
+			tile, _ := s.tile(x, y, r)
+			b.WriteString(tile)
+		}
+		b.WriteByte('\n')
+	}
+	return b.Flush()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTileset(t *testing.T) {
+	ts, err := ReadTileset(strings.NewReader(`{
+		"tiles": {"floor": {"glyph": "."}, "wall": {"glyph": "#", "color": 90}, "doorway": {"glyph": "+"}},
+		"glyphs": {"@": {"glyph": "you", "color": 33}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(WithSize(31, 15), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := s.String()
+	s.opts.Tileset = ts
+	var b strings.Builder
+	if err := s.Write(&b, "unicode"); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(b.String(), "\n")
+	for y, row := range strings.Split(plain, "\n")[:s.height] {
+		want := []rune(row)
+		for x, r := range []rune(got[y]) {
+			switch cell := s.at(x+1, y+1); {
+			case cell.kind == Wall && r != '#':
+				t.Errorf("wall at %d, %d drawn as %c", x+1, y+1, r)
+			case cell.kind == Door && want[x] == ' ' && r != '+':
+				t.Errorf("doorway at %d, %d drawn as %c", x+1, y+1, r)
+			case want[x] == ' ' && cell.kind == Floor && r != '.':
+				t.Errorf("floor at %d, %d drawn as %c", x+1, y+1, r)
+			case cell.kind != Wall && want[x] != ' ' && r != want[x]:
+				t.Errorf("%c at %d, %d drawn as %c", want[x], x+1, y+1, r)
+			}
+		}
+	}
+
+	var cell strings.Builder
+	s.printCell(&cell, s.entranceX, s.entranceY, '@')
+	s.printCell(&cell, 1, 1, '┏')
+	if want := "\x1b[33myou\x1b[0m\x1b[90m#\x1b[0m"; cell.String() != want {
+		t.Errorf("cells drawn as %q, want %q", cell.String(), want)
+	}
+}
+
+func TestReadTilesetErrors(t *testing.T) {
+	for _, tc := range []struct{ json, err string }{
+		{`{"tiles": {"flor": {"glyph": "."}}}`, `unknown tile "flor"`},
+		{`{"walls": [{"glyph": "#"}]}`, "walls has 1 glyphs"},
+		{`{"glyphs": {"rat": {"glyph": "r"}}}`, "keyed by one character"},
+		{`{"colors": {}}`, "unknown field"},
+	} {
+		if _, err := ReadTileset(strings.NewReader(tc.json)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("reading %s: got error %v, want %s", tc.json, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"image"
+)
+
+// Rotate90 turns the stage a quarter turn clockwise, swapping its width and
+// height. Everything on it turns with it.
+func (s *Stage) Rotate90() {
+	h := s.height
+	s.transform(s.height, s.width, func(x, y int) (int, int) { return h + 1 - y, x })
+}
+
+// FlipH mirrors the stage left to right
+func (s *Stage) FlipH() {
+	w := s.width
+	s.transform(s.width, s.height, func(x, y int) (int, int) { return w + 1 - x, y })
+}
+
+// FlipV mirrors the stage top to bottom
+func (s *Stage) FlipV() {
+	h := s.height
+	s.transform(s.width, s.height, func(x, y int) (int, int) { return x, h + 1 - y })
+}
+
+// transform moves every cell of the stage to where at takes it on a w by h
+// stage, along with the rooms, doorways, monsters, items, traps, decorations,
+// bridges, entrance, and stairs on it
+func (s *Stage) transform(w, h int, at func(x, y int) (int, int)) {
+	cell := make([]Tile, len(s.cell))
+	for _, t := range s.cell {
+		t.x, t.y = at(t.x, t.y)
+		cell[(t.y-1)*w+t.x-1] = t
+	}
+	if s.outside != nil {
+		outside := make([]bool, len(s.outside))
+		for i, out := range s.outside {
+			x, y := at(i%s.width+1, i/s.width+1)
+			outside[(y-1)*w+x-1] = out
+		}
+		s.outside = outside
+	}
+	s.cell, s.width, s.height = cell, w, h
+	s.opts.Width, s.opts.Height = w, h
+
+	for i, room := range s.rooms {
+		s.rooms[i] = room.moved(at)
+	}
+	for i, d := range s.doors {
+		s.doors[i] = s.at(at(d.x, d.y))
+	}
+	for _, m := range s.monsters {
+		m.x, m.y = at(m.x, m.y)
+	}
+	for _, it := range s.items {
+		it.x, it.y = at(it.x, it.y)
+	}
+	for _, t := range s.traps {
+		t.x, t.y = at(t.x, t.y)
+	}
+	for _, d := range s.decorations {
+		d.x, d.y = at(d.x, d.y)
+	}
+	for _, b := range s.bridges {
+		nextX, nextY := at(b.x+b.dx, b.y+b.dy)
+		b.x, b.y = at(b.x, b.y)
+		b.dx, b.dy = nextX-b.x, nextY-b.y
+	}
+	// an unplaced staircase is at 0, 0, which stays put
+	for _, p := range [][2]*int{{&s.entranceX, &s.entranceY}, {&s.upX, &s.upY}, {&s.downX, &s.downY}} {
+		if *p[0] != 0 {
+			*p[0], *p[1] = at(*p[0], *p[1])
+		}
+	}
+
+	s.roomsMoved()
+	s.doorIndex, s.doorsIndexed = nil, 0
+	s.drawn, s.dirty = nil, nil
+}
+
+// moved returns the room where at takes it, which may turn or flip it
+func (r Room) moved(at func(x, y int) (int, int)) Room {
+	x1, y1 := at(r.x, r.y)
+	x2, y2 := at(r.x+r.width, r.y+r.height)
+	out := Room{x: x1, y: y1, width: abs(x2 - x1), height: abs(y2 - y1)}
+	if x2 < x1 {
+		out.x = x2
+	}
+	if y2 < y1 {
+		out.y = y2
+	}
+	return out
+}
+
+// Crop returns a new stage of just the cells of s inside rect, in the stage's
+// own coordinates with Max left out, so image.Rect(1, 1, w+1, h+1) is the
+// whole of a w by h stage. Cell x, y of s is at x-rect.Min.X+1,
+// y-rect.Min.Y+1 of the new one. Rooms partly inside are cut down to the part
+// that is; doorways, monsters, items, traps, decorations, bridges, the
+// entrance, and stairs outside it are left out.
+func (s *Stage) Crop(rect image.Rectangle) (*Stage, error) {
+	rect = rect.Intersect(image.Rect(1, 1, s.width+1, s.height+1))
+	if rect.Empty() {
+		return nil, fmt.Errorf("crop is outside the %dx%d stage", s.width, s.height)
+	}
+	in := func(x, y int) bool { return image.Pt(x, y).In(rect) }
+	dx, dy := rect.Min.X-1, rect.Min.Y-1
+
+	src, _ := NewSource(s.opts.RNG, s.opts.Seed)
+	c := NewStage(rect.Dx(), rect.Dy(), src)
+	c.opts = s.opts
+	c.opts.Width, c.opts.Height, c.opts.Source, c.opts.Wrap = c.width, c.height, src, false
+	c.theme, c.difficulty, c.elevationLevels = s.theme, s.difficulty, s.elevationLevels
+	for y := 1; y <= c.height; y++ {
+		for x := 1; x <= c.width; x++ {
+			t := s.at(x+dx, y+dy)
+			t.x, t.y = x, y
+			c.set(x, y, t)
+		}
+	}
+	if s.outside != nil {
+		c.outside = make([]bool, len(c.cell))
+		for y := 1; y <= c.height; y++ {
+			for x := 1; x <= c.width; x++ {
+				c.outside[(y-1)*c.width+x-1] = s.outside[(y+dy-1)*s.width+x+dx-1]
+			}
+		}
+	}
+
+	for _, room := range s.rooms {
+		r := image.Rect(room.x, room.y, room.x+room.width+1, room.y+room.height+1).Intersect(rect)
+		if !r.Empty() {
+			c.rooms = append(c.rooms, Room{x: r.Min.X - dx, y: r.Min.Y - dy, width: r.Dx() - 1, height: r.Dy() - 1})
+		}
+	}
+	for _, d := range s.doors {
+		if in(d.x, d.y) {
+			c.doors = append(c.doors, c.at(d.x-dx, d.y-dy))
+		}
+	}
+	for _, m := range s.monsters {
+		if in(m.x, m.y) {
+			moved := *m
+			moved.x, moved.y = m.x-dx, m.y-dy
+			c.monsters = append(c.monsters, &moved)
+		}
+	}
+	for _, it := range s.items {
+		if in(it.x, it.y) {
+			moved := *it
+			moved.x, moved.y = it.x-dx, it.y-dy
+			c.items = append(c.items, &moved)
+		}
+	}
+	for _, t := range s.traps {
+		if in(t.x, t.y) {
+			moved := *t
+			moved.x, moved.y = t.x-dx, t.y-dy
+			c.traps = append(c.traps, &moved)
+		}
+	}
+	for _, d := range s.decorations {
+		if in(d.x, d.y) {
+			moved := *d
+			moved.x, moved.y = d.x-dx, d.y-dy
+			c.decorations = append(c.decorations, &moved)
+		}
+	}
+	// a bridge is kept only whole
+	for _, b := range s.bridges {
+		if in(b.x, b.y) && in(b.x+(b.length-1)*b.dx, b.y+(b.length-1)*b.dy) {
+			moved := *b
+			moved.x, moved.y = b.x-dx, b.y-dy
+			c.bridges = append(c.bridges, &moved)
+		}
+	}
+	for _, p := range [][4]*int{
+		{&s.entranceX, &s.entranceY, &c.entranceX, &c.entranceY},
+		{&s.upX, &s.upY, &c.upX, &c.upY},
+		{&s.downX, &s.downY, &c.downX, &c.downY},
+	} {
+		if *p[0] != 0 && in(*p[0], *p[1]) {
+			*p[2], *p[3] = *p[0]-dx, *p[1]-dy
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	s, err := New(WithSize(41, 21), WithSeed(6), WithTheme(themes["mine"]), WithStocking(5, 5, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := s.String()
+	rows := strings.Split(strings.TrimSuffix(s.ASCII(), "\n"), "\n")
+	rooms, doors := len(s.rooms), len(s.doors)
+
+	s.Rotate90()
+	if s.width != 21 || s.height != 41 {
+		t.Fatalf("rotated stage is %dx%d, want 21x41", s.width, s.height)
+	}
+	// row y of the turned stage is column y of the old one, read bottom up
+	turned := strings.Split(strings.TrimSuffix(s.ASCII(), "\n"), "\n")
+	for y := range turned {
+		for x := range turned[y] {
+			if want := rows[len(rows)-1-x][y]; turned[y][x] != want {
+				t.Fatalf("turned (%d, %d) is %q, want %q", x+1, y+1, turned[y][x], want)
+			}
+		}
+	}
+	for _, d := range s.doors {
+		if !s.isDoor(d.x, d.y) || s.at(d.x, d.y).kind == Wall {
+			t.Errorf("door moved to (%d, %d), which isn't one", d.x, d.y)
+		}
+	}
+	for _, room := range s.rooms {
+		if r, ok := s.roomAt(room.x+room.width/2, room.y+room.height/2); !ok || r != room {
+			t.Errorf("room %+v isn't found in its own middle", room)
+		}
+	}
+	for _, m := range s.monsters {
+		if !s.isOpen(m.x, m.y) {
+			t.Errorf("monster moved into the wall at (%d, %d)", m.x, m.y)
+		}
+	}
+	if !s.isOpen(s.entranceX, s.entranceY) {
+		t.Errorf("entrance moved into the wall at (%d, %d)", s.entranceX, s.entranceY)
+	}
+	if report := s.Validate(); !report.Valid {
+		t.Errorf("turned stage: %v", report.Failures)
+	}
+
+	// four turns, or two flips either way, are back where it started
+	s.Rotate90()
+	s.Rotate90()
+	s.Rotate90()
+	s.FlipH()
+	s.FlipV()
+	s.FlipV()
+	s.FlipH()
+	if after := s.String(); after != before {
+		t.Errorf("stage changed after turning all the way round:\n%s\nwant\n%s", after, before)
+	}
+	if len(s.rooms) != rooms || len(s.doors) != doors {
+		t.Errorf("ended up with %d rooms and %d doors, want %d and %d", len(s.rooms), len(s.doors), rooms, doors)
+	}
+}
+
+func TestCrop(t *testing.T) {
+	s, err := New(WithSize(61, 31), WithSeed(2), WithStocking(5, 5, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, err := s.Crop(image.Rect(-5, -5, 100, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if whole.String() != s.String() || len(whole.rooms) != len(s.rooms) || len(whole.doors) != len(s.doors) {
+		t.Errorf("cropping to the whole stage changed it")
+	}
+
+	window := image.Rect(11, 6, 41, 21)
+	c, err := s.Crop(window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.width != 30 || c.height != 15 {
+		t.Fatalf("cropped stage is %dx%d, want 30x15", c.width, c.height)
+	}
+	for y := 1; y <= c.height; y++ {
+		for x := 1; x <= c.width; x++ {
+			if got, want := c.at(x, y).kind, s.at(x+10, y+5).kind; got != want {
+				t.Fatalf("cropped (%d, %d) is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	for _, room := range c.rooms {
+		if room.x < 1 || room.y < 1 || room.x+room.width > c.width || room.y+room.height > c.height {
+			t.Errorf("room %+v sticks out of the crop", room)
+		}
+		if _, ok := s.roomAt(room.x+10, room.y+5); !ok {
+			t.Errorf("room %+v wasn't a room before cropping", room)
+		}
+	}
+	want := 0
+	for _, d := range s.doors {
+		if image.Pt(d.x, d.y).In(window) {
+			want++
+		}
+	}
+	if len(c.doors) != want {
+		t.Errorf("crop has %d doors, want %d", len(c.doors), want)
+	}
+	for _, d := range c.doors {
+		if !c.isDoor(d.x, d.y) || !s.isDoor(d.x+10, d.y+5) {
+			t.Errorf("door at (%d, %d) of the crop isn't one", d.x, d.y)
+		}
+	}
+	for _, m := range c.monsters {
+		if s.monsterAt(m.x+10, m.y+5) == nil {
+			t.Errorf("monster at (%d, %d) of the crop wasn't there before", m.x, m.y)
+		}
+	}
+
+	if _, err := s.Crop(image.Rect(70, 1, 80, 10)); err == nil {
+		t.Error("cropping outside the stage should fail")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import "math/rand"
+
+// trapGlyph is how a trap is drawn once it is known about
+const trapGlyph = '^'
+
+// TrapKind describes a type of trap: what sets it off and what it does
+type TrapKind struct {
+	Name    string
+	Trigger string // step or pressure
+	Effect  string // fall, dart, or alarm
+	Damage  int
+	Weight  int // relative chance of being picked
+}
+
+type Trap struct {
+	TrapKind
+	x, y  int
+	found bool
+}
+
+var trapTable = []TrapKind{
+	{Name: "pit", Trigger: "step", Effect: "fall", Damage: 3, Weight: 4},
+	{Name: "dart trap", Trigger: "step", Effect: "dart", Damage: 2, Weight: 5},
+	{Name: "pressure plate", Trigger: "pressure", Effect: "alarm", Damage: 0, Weight: 3},
+}
+
+// AddTraps hides traps in corridors and on room thresholds. Doorways are
+// favored, since everyone has to walk through them.
+func (s *Stage) AddTraps() {
+	dist := s.DistanceMap(s.entranceX, s.entranceY)
+
+	candidates := make([]Tile, 0)
+	weights := make([]int, 0)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			// keep the way in safe
+			if d, ok := dist.At(x, y); !ok || d < 3 || s.isStairs(x, y) || !s.onGround(x, y) {
+				continue
+			}
+			if _, ok := s.roomAt(x, y); ok {
+				continue
+			}
+			w := 1
+			if s.isDoor(x, y) {
+				w = 5
+			}
+			candidates = append(candidates, s.at(x, y))
+			weights = append(weights, w)
+		}
+	}
+
+	bag := newWeightedBag(weights)
+	for count := s.scaledPercent(len(candidates), s.opts.TrapRate); count > 0 && bag.left > 0; count-- {
+		t := candidates[bag.pick(s.rng)]
+		s.traps = append(s.traps, &Trap{TrapKind: pickTrapKind(s.rng), x: t.x, y: t.y})
+	}
+}
+
+func pickTrapKind(rng *rand.Rand) TrapKind {
+	weights := make([]int, len(trapTable))
+	for i, k := range trapTable {
+		weights[i] = k.Weight
+	}
+	return trapTable[pickWeighted(rng, weights)]
+}
+
+// trapAt returns the trap at x, y, or nil
+func (s *Stage) trapAt(x, y int) *Trap {
+	for _, t := range s.traps {
+		if t.x == x && t.y == y {
+			return t
+		}
+	}
+	return nil
+}
+
+// isDoor reports if x, y is an opening carved into the side of a room
+func (s *Stage) isDoor(x, y int) bool {
+	_, ok := s.doorAt(x, y)
+	return ok
+}
+
+// doorAt returns where in the stage's doors the door at x, y is. The doors
+// appended since it last ran are indexed first.
+func (s *Stage) doorAt(x, y int) (int, bool) {
+	if s.doorIndex == nil || len(s.doors) < s.doorsIndexed {
+		s.doorIndex, s.doorsIndexed = make(map[int]int), 0
+	}
+	for ; s.doorsIndexed < len(s.doors); s.doorsIndexed++ {
+		d := s.doors[s.doorsIndexed]
+		if i := (d.y-1)*s.width + d.x - 1; s.doorIndex[i] == 0 {
+			s.doorIndex[i] = s.doorsIndexed + 1
+		}
+	}
+	if !s.cellExists(x, y) {
+		return 0, false
+	}
+	i := s.doorIndex[(y-1)*s.width+x-1]
+	return i - 1, i > 0
+}
+
+// searchTraps gives a one in three chance to spot each hidden trap next to x, y
+func (s *Stage) searchTraps(x, y int) []*Trap {
+	found := make([]*Trap, 0)
+	for _, t := range s.traps {
+		if t.found || abs(t.x-x) > 1 || abs(t.y-y) > 1 {
+			continue
+		}
+		if s.rng.Intn(3) == 0 {
+			t.found = true
+			found = append(found, t)
+		}
+	}
+	return found
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+)
+
+// UVTT is a map in the Universal VTT format, a .dd2vtt file: the stage drawn
+// as a PNG on a grid of Resolution.PixelsPerGrid pixel squares, with its
+// walls as lines of sight, a portal in every doorway, and a light over every
+// pool of lava. Positions are in grid squares from the top left corner.
+type UVTT struct {
+	Format             float64       `json:"format"`
+	Resolution         UVTTGrid      `json:"resolution"`
+	LineOfSight        [][]UVTTPoint `json:"line_of_sight"`
+	ObjectsLineOfSight [][]UVTTPoint `json:"objects_line_of_sight"`
+	Portals            []UVTTPortal  `json:"portals"`
+	Environment        UVTTLighting  `json:"environment"`
+	Lights             []UVTTLight   `json:"lights"`
+	Image              string        `json:"image"`
+}
+
+type UVTTPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type UVTTGrid struct {
+	MapOrigin     UVTTPoint `json:"map_origin"`
+	MapSize       UVTTPoint `json:"map_size"`
+	PixelsPerGrid int       `json:"pixels_per_grid"`
+}
+
+// UVTTPortal is a door, closed across Bounds, turned Rotation radians
+type UVTTPortal struct {
+	Position     UVTTPoint   `json:"position"`
+	Bounds       []UVTTPoint `json:"bounds"`
+	Rotation     float64     `json:"rotation"`
+	Closed       bool        `json:"closed"`
+	Freestanding bool        `json:"freestanding"`
+}
+
+type UVTTLighting struct {
+	BakedLighting bool   `json:"baked_lighting"`
+	AmbientLight  string `json:"ambient_light"`
+}
+
+// UVTTLight is a light Range grid squares across, in an ARGB hex Color
+type UVTTLight struct {
+	Position  UVTTPoint `json:"position"`
+	Range     float64   `json:"range"`
+	Intensity float64   `json:"intensity"`
+	Color     string    `json:"color"`
+	Shadows   bool      `json:"shadows"`
+}
+
+// uvttLavaColor is the color lava lights the stage in
+const uvttLavaColor = "ffff6a00"
+
+// UVTT returns the stage as a Universal VTT map, each cell size pixels across
+func (s *Stage) UVTT(size int) (UVTT, error) {
+	var img bytes.Buffer
+	if err := s.WritePNG(&img, size); err != nil {
+		return UVTT{}, err
+	}
+	m := UVTT{
+		Format: 0.3,
+		Resolution: UVTTGrid{
+			MapSize:       UVTTPoint{float64(s.width), float64(s.height)},
+			PixelsPerGrid: size,
+		},
+		LineOfSight:        make([][]UVTTPoint, 0),
+		ObjectsLineOfSight: make([][]UVTTPoint, 0),
+		Portals:            make([]UVTTPortal, 0, len(s.doors)),
+		Environment:        UVTTLighting{AmbientLight: "ffffffff"},
+		Lights:             make([]UVTTLight, 0),
+		Image:              base64.StdEncoding.EncodeToString(img.Bytes()),
+	}
+	for _, run := range s.wallRuns() {
+		m.LineOfSight = append(m.LineOfSight, []UVTTPoint{
+			{float64(run[0]), float64(run[1])},
+			{float64(run[2]), float64(run[3])},
+		})
+	}
+	for _, d := range s.doors {
+		line := s.doorway(d.x, d.y)
+		p := UVTTPortal{
+			Position: UVTTPoint{float64(d.x) - 0.5, float64(d.y) - 0.5},
+			Bounds:   []UVTTPoint{{line[0], line[1]}, {line[2], line[3]}},
+			Closed:   true,
+		}
+		if line[0] == line[2] {
+			p.Rotation = math.Pi / 2
+		}
+		m.Portals = append(m.Portals, p)
+	}
+	for _, pool := range s.lavaPools() {
+		var cx, cy float64
+		for _, t := range pool {
+			cx += float64(t.x) - 0.5
+			cy += float64(t.y) - 0.5
+		}
+		n := float64(len(pool))
+		m.Lights = append(m.Lights, UVTTLight{
+			Position:  UVTTPoint{cx / n, cy / n},
+			Range:     2 + math.Sqrt(n),
+			Intensity: 1,
+			Color:     uvttLavaColor,
+			Shadows:   true,
+		})
+	}
+	return m, nil
+}
+
+// WriteUVTT writes the stage as a Universal VTT map, for a .dd2vtt file
+func (s *Stage) WriteUVTT(w io.Writer, size int) error {
+	m, err := s.UVTT(size)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(m)
+}
+
+// lavaPools returns the cells of each stretch of lava on the stage, in the
+// order their first cells are read across the rows
+func (s *Stage) lavaPools() [][]Tile {
+	seen := make([]bool, len(s.cell))
+	pools := make([][]Tile, 0)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if s.at(x, y).kind != Lava || seen[(y-1)*s.width+x-1] {
+				continue
+			}
+			seen[(y-1)*s.width+x-1] = true
+			pool := []Tile{s.at(x, y)}
+			for i := 0; i < len(pool); i++ {
+				for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+					nx, ny := pool[i].x+d[0], pool[i].y+d[1]
+					if s.cellExists(nx, ny) && s.at(nx, ny).kind == Lava && !seen[(ny-1)*s.width+nx-1] {
+						seen[(ny-1)*s.width+nx-1] = true
+						pool = append(pool, s.at(nx, ny))
+					}
+				}
+			}
+			pools = append(pools, pool)
+		}
+	}
+	return pools
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func TestUVTT(t *testing.T) {
+	s, err := New(WithSize(61, 31), WithSeed(2), WithTheme(themes["mine"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := s.WriteUVTT(&b, 20); err != nil {
+		t.Fatal(err)
+	}
+	var m UVTT
+	if err := json.Unmarshal(b.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Resolution.MapSize != (UVTTPoint{61, 31}) || m.Resolution.PixelsPerGrid != 20 {
+		t.Errorf("map is %v at %d pixels a square", m.Resolution.MapSize, m.Resolution.PixelsPerGrid)
+	}
+	data, err := base64.StdEncoding.DecodeString(m.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 61*20 || size.Y != 31*20 {
+		t.Errorf("image is %v", size)
+	}
+
+	if len(m.LineOfSight) != len(s.wallRuns()) {
+		t.Errorf("%d lines of sight, want %d", len(m.LineOfSight), len(s.wallRuns()))
+	}
+	if len(m.Portals) != len(s.doors) {
+		t.Fatalf("%d portals, want one for each of %d doors", len(m.Portals), len(s.doors))
+	}
+	for i, p := range m.Portals {
+		d := s.doors[i]
+		mid := UVTTPoint{(p.Bounds[0].X + p.Bounds[1].X) / 2, (p.Bounds[0].Y + p.Bounds[1].Y) / 2}
+		if mid != p.Position || p.Position != (UVTTPoint{float64(d.x) - 0.5, float64(d.y) - 0.5}) {
+			t.Errorf("portal %+v isn't across the door at %d, %d", p, d.x, d.y)
+		}
+		if across := p.Bounds[0].X == p.Bounds[1].X; across != (p.Rotation == math.Pi/2) {
+			t.Errorf("portal %+v is turned the wrong way", p)
+		}
+	}
+
+	if len(m.Lights) == 0 || len(m.Lights) != len(s.lavaPools()) {
+		t.Errorf("%d lights, want one for each of %d pools of lava", len(m.Lights), len(s.lavaPools()))
+	}
+	lava := 0
+	for _, pool := range s.lavaPools() {
+		lava += len(pool)
+	}
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if s.at(x, y).kind == Lava {
+				lava--
+			}
+		}
+	}
+	if lava != 0 {
+		t.Errorf("pools of lava are %d cells off", lava)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ValidationReport lists every invariant a stage breaks. Valid is set when
+// there are no failures.
+type ValidationReport struct {
+	Valid    bool     `json:"valid"`
+	Failures []string `json:"failures"`
+}
+
+// Validate checks the invariants a finished stage should hold: every open
+// cell can be reached from the entrance (locked doors count as open, since
+// the key is somewhere), the outer border is solid wall, no corridor has a
+// 2x2 block of open floor in it, and every doorway opens onto exactly two
+// cells.
+func (s *Stage) Validate() ValidationReport {
+	report := ValidationReport{Failures: make([]string, 0)}
+	fail := func(format string, args ...interface{}) {
+		report.Failures = append(report.Failures, fmt.Sprintf(format, args...))
+	}
+
+	reached := s.connected(s.entranceX, s.entranceY)
+	unreached, firstX, firstY := 0, 0, 0
+	border, blobs, doors := 0, 0, 0
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if s.traversable(x, y) && !reached[(y-1)*s.width+x-1] {
+				if unreached == 0 {
+					firstX, firstY = x, y
+				}
+				unreached++
+			}
+			if s.isEdge(x, y) && s.at(x, y).kind != Wall {
+				if border == 0 {
+					fail("the outer border is open at (%d, %d)", x, y)
+				}
+				border++
+			}
+			if s.corridorFloor(x, y) && s.corridorFloor(x+1, y) && s.corridorFloor(x, y+1) && s.corridorFloor(x+1, y+1) {
+				if blobs == 0 {
+					fail("a corridor opens into a 2x2 block at (%d, %d)", x, y)
+				}
+				blobs++
+			}
+		}
+	}
+	if unreached > 0 {
+		fail("%d open cells can't be reached from the entrance, the first at (%d, %d)", unreached, firstX, firstY)
+	}
+	if border > 1 {
+		fail("%d border cells are open in all", border)
+	}
+	if blobs > 1 {
+		fail("%d 2x2 blocks are open in the corridors in all", blobs)
+	}
+
+	for _, d := range s.doors {
+		open := 0
+		for _, n := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			if s.isOpen(s.step(d.x, d.y, n[0], n[1])) {
+				open++
+			}
+		}
+		if open != 2 {
+			if doors == 0 {
+				fail("the doorway at (%d, %d) has %d open neighbors instead of 2", d.x, d.y, open)
+			}
+			doors++
+		}
+	}
+	if doors > 1 {
+		fail("%d doorways don't open onto exactly 2 cells in all", doors)
+	}
+
+	report.Valid = len(report.Failures) == 0
+	return report
+}
+
+// traversable reports if x, y can be walked onto once any locked door on it
+// is opened
+func (s *Stage) traversable(x, y int) bool {
+	return s.IsWalkable(x, y) || (s.cellExists(x, y) && s.at(x, y).kind == LockedDoor)
+}
+
+// connected flood-fills the traversable cells that can be reached from x, y,
+// marking them in a slice laid out like the stage's cells
+func (s *Stage) connected(x, y int) []bool {
+	reached := make([]bool, len(s.cell))
+	if !s.cellExists(x, y) {
+		return reached
+	}
+	queue := []int{(y-1)*s.width + x - 1}
+	reached[queue[0]] = true
+	for head := 0; head < len(queue); head++ {
+		tx, ty := queue[head]%s.width+1, queue[head]/s.width+1
+		for _, d := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			nx, ny := s.step(tx, ty, d[0], d[1])
+			if !s.traversable(nx, ny) || reached[(ny-1)*s.width+nx-1] {
+				continue
+			}
+			reached[(ny-1)*s.width+nx-1] = true
+			queue = append(queue, (ny-1)*s.width+nx-1)
+		}
+	}
+	return reached
+}
+
+// corridorFloor reports if x, y is a corridor cell with no terrain on it.
+// Terrain is left out since rivers cut wide channels on purpose.
+func (s *Stage) corridorFloor(x, y int) bool {
+	return s.cellExists(x, y) && s.isCorridor(x, y) && !s.at(x, y).kind.Kind().Terrain
+}
+
+// WriteJSON writes the report as indented JSON
+func (r ValidationReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestGeneratedStagesAreValid(t *testing.T) {
+	for _, theme := range []string{"classic", "mine"} {
+		for seed := int64(1); seed <= 40; seed++ {
+			s, err := New(WithSeed(seed), WithTheme(themes[theme]))
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", theme, seed, err)
+			}
+			if report := s.Validate(); !report.Valid {
+				t.Errorf("%s seed %d: %v", theme, seed, report.Failures)
+			}
+		}
+	}
+}
+
+func TestWrapAroundStagesAreValid(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		s, err := New(WithSeed(seed), WithSize(40, 20), WithWrap())
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if report := s.Validate(); !report.Valid {
+			t.Errorf("seed %d: %v", seed, report.Failures)
+		}
+		// some passage crosses an edge, and walking it the short way round
+		// is as far as the distance map says
+		crossed := false
+		for y := 1; y <= s.height; y++ {
+			if s.IsWalkable(1, y) && s.IsWalkable(s.width, y) {
+				crossed = true
+				dist := s.DistanceMap(1, y)
+				if d, ok := dist.At(s.width, y); !ok || d != 1 {
+					t.Errorf("seed %d: (%d, %d) is %d steps from (1, %d), want 1", seed, s.width, y, d, y)
+				}
+				if path, _, ok := s.FindPath(1, y, s.width, y); !ok || len(path) != 2 {
+					t.Errorf("seed %d: path across the edge at row %d is %v", seed, y, path)
+				}
+			}
+		}
+		for x := 1; x <= s.width; x++ {
+			crossed = crossed || s.IsWalkable(x, 1) && s.IsWalkable(x, s.height)
+		}
+		if !crossed {
+			t.Errorf("seed %d: nothing crosses an edge", seed)
+		}
+	}
+	if _, err := New(WithSize(41, 20), WithWrap()); err == nil {
+		t.Error("wrapping an odd width should fail")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+)
+
+// terminalSize returns how many rows and columns the terminal has, or 0, 0
+// when it can't tell, as when the output isn't going to one
+func terminalSize() (rows, cols int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, 0
+	}
+	if n, _ := fmt.Sscan(string(out), &rows, &cols); n != 2 || rows <= 0 || cols <= 0 {
+		return 0, 0
+	}
+	return rows, cols
+}
+
+// view returns the part of the stage that fits in a rows by cols screen, as
+// a rectangle of cells with Max left out like Crop, centered on x, y as far
+// as the stage's edges allow. A stage that fits is shown whole, as it is
+// when rows or cols isn't more than 0.
+func (s *Stage) view(rows, cols, x, y int) image.Rectangle {
+	if rows <= 0 || cols <= 0 {
+		return image.Rect(1, 1, s.width+1, s.height+1)
+	}
+	x0, y0 := viewStart(s.width, cols, x), viewStart(s.height, rows, y)
+	return image.Rect(x0, y0, x0+cols, y0+rows).Intersect(image.Rect(1, 1, s.width+1, s.height+1))
+}
+
+// viewStart returns the first of size cells to show n of, centered on at
+// without running past either end
+func viewStart(size, n, at int) int {
+	start := at - n/2
+	if start > size-n+1 {
+		start = size - n + 1
+	}
+	if start < 1 {
+		start = 1
+	}
+	return start
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"image"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	s := &Stage{width: 79, height: 21}
+	for _, c := range []struct {
+		rows, cols, x, y int
+		want             image.Rectangle
+	}{
+		// a stage that fits is shown whole, wherever the middle is
+		{24, 80, 1, 1, image.Rect(1, 1, 80, 22)},
+		{24, 80, 70, 20, image.Rect(1, 1, 80, 22)},
+		// one that doesn't is centered, up against the edges near them
+		{10, 40, 40, 11, image.Rect(20, 6, 60, 16)},
+		{10, 40, 2, 2, image.Rect(1, 1, 41, 11)},
+		{10, 40, 79, 21, image.Rect(40, 12, 80, 22)},
+	} {
+		if got := s.view(c.rows, c.cols, c.x, c.y); got != c.want {
+			t.Errorf("%dx%d view around (%d, %d) is %v, want %v", c.cols, c.rows, c.x, c.y, got, c.want)
+		}
+	}
+}
+
+func TestPreviewPan(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Seed = 1
+	p := &preview{opts: opts}
+	if err := p.regenerate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.x != 40 || p.y != 11 {
+		t.Errorf("preview starts at (%d, %d), want the middle", p.x, p.y)
+	}
+	for i := 0; i < 20; i++ {
+		p.key(context.Background(), "\x1b[D")
+	}
+	if p.x != 1 {
+		t.Errorf("panned left to %d, past the stage's edge", p.x)
+	}
+}
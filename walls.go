@@ -0,0 +1,115 @@
+package main
+
+import "strings"
+
+// The box drawing characters each -style draws walls with, indexed by
+// cellMask like wallRunes, the heavy ones. Light lines have half lines for
+// walls that end; double lines don't, so those run on to the next cell.
+var (
+	singleWallRunes = [16]rune{
+		0:                                 '┼',
+		wallLeft:                          '╴',
+		wallBelow:                         '╷',
+		wallBelow | wallLeft:              '┐',
+		wallRight:                         '╶',
+		wallRight | wallLeft:              '─',
+		wallRight | wallBelow:             '┌',
+		wallRight | wallBelow | wallLeft:  '┬',
+		wallAbove:                         '╵',
+		wallAbove | wallLeft:              '┘',
+		wallAbove | wallBelow:             '│',
+		wallAbove | wallBelow | wallLeft:  '┤',
+		wallAbove | wallRight:             '└',
+		wallAbove | wallRight | wallLeft:  '┴',
+		wallAbove | wallRight | wallBelow: '├',
+		wallAbove | wallRight | wallBelow | wallLeft: '┼',
+	}
+	roundedWallRunes = [16]rune{
+		0:                                 '┼',
+		wallLeft:                          '╴',
+		wallBelow:                         '╷',
+		wallBelow | wallLeft:              '╮',
+		wallRight:                         '╶',
+		wallRight | wallLeft:              '─',
+		wallRight | wallBelow:             '╭',
+		wallRight | wallBelow | wallLeft:  '┬',
+		wallAbove:                         '╵',
+		wallAbove | wallLeft:              '╯',
+		wallAbove | wallBelow:             '│',
+		wallAbove | wallBelow | wallLeft:  '┤',
+		wallAbove | wallRight:             '╰',
+		wallAbove | wallRight | wallLeft:  '┴',
+		wallAbove | wallRight | wallBelow: '├',
+		wallAbove | wallRight | wallBelow | wallLeft: '┼',
+	}
+	doubleWallRunes = [16]rune{
+		0:                                 '╬',
+		wallLeft:                          '═',
+		wallBelow:                         '║',
+		wallBelow | wallLeft:              '╗',
+		wallRight:                         '═',
+		wallRight | wallLeft:              '═',
+		wallRight | wallBelow:             '╔',
+		wallRight | wallBelow | wallLeft:  '╦',
+		wallAbove:                         '║',
+		wallAbove | wallLeft:              '╝',
+		wallAbove | wallBelow:             '║',
+		wallAbove | wallBelow | wallLeft:  '╣',
+		wallAbove | wallRight:             '╚',
+		wallAbove | wallRight | wallLeft:  '╩',
+		wallAbove | wallRight | wallBelow: '╠',
+		wallAbove | wallRight | wallBelow | wallLeft: '╬',
+	}
+)
+
+// blockWallRunes draw walls as solid blocks, shaded darker deep in the rock
+// where there's wall all around, for fonts that draw lines poorly
+var blockWallRunes = [16]rune{
+	'█', '█', '█', '█', '█', '█', '█', '█',
+	'█', '█', '█', '█', '█', '█', '█', '▓',
+}
+
+// blockFloorGlyph is what floor is drawn as between block walls, when the
+// theme leaves it blank
+const blockFloorGlyph = '·'
+
+// wallStyles are the ways walls can be drawn, by -style name
+var wallStyles = map[string]*[16]rune{
+	"heavy":   &wallRunes,
+	"single":  &singleWallRunes,
+	"rounded": &roundedWallRunes,
+	"double":  &doubleWallRunes,
+	"block":   &blockWallRunes,
+}
+
+// walls returns the box drawing characters the stage's walls are drawn with,
+// heavy ones unless its options say otherwise
+func (s *Stage) walls() *[16]rune {
+	if walls := wallStyles[s.opts.WallStyle]; walls != nil {
+		return walls
+	}
+	return &wallRunes
+}
+
+// gap returns what's drawn between x, y, drawn as left, and the cell to its
+// right, drawn as right, on a wide stage: blank, unless a wall runs through
+// it. Solid block walls and ones drawn in ASCII run on as themselves.
+func (s *Stage) gap(x, y int, left, right rune) rune {
+	if s.at(x, y).kind != Wall || s.at(x+1, y).kind != Wall {
+		return ' '
+	}
+	walls := s.walls()
+	if s.opts.WallStyle == "block" && left == right || !strings.ContainsRune(string(walls[:]), left) {
+		return left
+	}
+	return walls[wallLeft|wallRight]
+}
+
+// floor returns the glyph open floor is drawn with: the theme's, or with
+// block walls dots if the theme's is blank
+func (s *Stage) floor() rune {
+	if s.theme.Floor == ' ' && s.opts.WallStyle == "block" {
+		return blockFloorGlyph
+	}
+	return s.theme.Floor
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWallStyles(t *testing.T) {
+	for style, walls := range wallStyles {
+		s, err := New(WithSize(31, 15), WithSeed(7), WithWallStyle(style))
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := s.String()
+		for _, r := range text {
+			if r == '\n' || r == ' ' || strings.ContainsRune(string(walls[:]), r) {
+				continue
+			}
+			for other, runes := range wallStyles {
+				if other != style && strings.ContainsRune(string(runes[:]), r) && !strings.ContainsRune(string(walls[:]), r) {
+					t.Errorf("%s walls drawn with %c from %s", style, r, other)
+				}
+			}
+		}
+
+		// every style reads back as the same walls
+		back, err := NewStageFromString(text, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", style, err)
+		}
+		for y := 1; y <= s.height; y++ {
+			for x := 1; x <= s.width; x++ {
+				if (s.at(x, y).kind == Wall) != (back.at(x, y).kind == Wall) {
+					t.Errorf("%s: %d, %d read back as %s, want %s", style, x, y, back.at(x, y).kind.Kind().Name, s.at(x, y).kind.Kind().Name)
+				}
+			}
+		}
+	}
+
+	if _, err := New(WithWallStyle("dotted")); err == nil || !strings.Contains(err.Error(), "unknown wall style") {
+		t.Errorf("got error %v for an unknown wall style", err)
+	}
+}
+
+func TestBlockWalls(t *testing.T) {
+	src, _ := NewSource("go", 1)
+	s := NewStage(5, 3, src)
+	s.opts.WallStyle = "block"
+	s.setKind(2, 2, Floor)
+	if got, want := s.String(), "█████\n█·█▓█\n█████\n"; got != want {
+		t.Errorf("block walls drawn as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWide(t *testing.T) {
+	src, _ := NewSource("go", 1)
+	s := NewStage(5, 3, src)
+	s.opts.Wide = true
+	for x := 2; x <= 4; x++ {
+		s.setKind(x, 2, Floor)
+	}
+	if got, want := s.String(), "┏━━━━━━━┓\n┃       ┃\n┗━━━━━━━┛\n"; got != want {
+		t.Errorf("wide stage drawn as\n%s\nwant\n%s", got, want)
+	}
+	if got, want := s.ASCII(), "#########\n#       #\n#########\n"; got != want {
+		t.Errorf("wide stage drawn in ascii as\n%s\nwant\n%s", got, want)
+	}
+	s.opts.WallStyle = "block"
+	s.setKind(3, 2, Wall)
+	if got, want := s.String(), "█████████\n█ · █ · █\n█████████\n"; got != want {
+		t.Errorf("wide block walls drawn as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseBridgesAndDoubleWalls(t *testing.T) {
+	// with heavy walls ═ is a bridge, and with double ones a wall
+	s, err := NewStageFromString("┏━━━┓\n┃~═~┃\n┗━━━┛\n", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.at(3, 2).kind; got != BridgeDeck {
+		t.Errorf("═ with heavy walls read as %s", got.Kind().Name)
+	}
+	s, err = NewStageFromString("╔═══╗\n║ ═ ║\n╚═══╝\n", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.at(3, 2).kind; got != Wall {
+		t.Errorf("═ with double walls read as %s", got.Kind().Name)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// generateJSON generates a stage from DefaultOptions, as the same JSON
+// /dungeon serves when asked for that seed, width, and height
+func generateJSON(seed string, width, height int) (string, error) {
+	opts, _, err := dungeonOptions(DefaultOptions(), url.Values{
+		"width":  {strconv.Itoa(width)},
+		"height": {strconv.Itoa(height)},
+		"seed":   {seed},
+	})
+	if err != nil {
+		return "", err
+	}
+	if opts.Seed == 0 {
+		return "", errors.New("seed can't be 0")
+	}
+	s, _, err := GenerateStage(context.Background(), opts.seeded(opts.Seed))
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = s.WriteJSON(&b)
+	return b.String(), err
+}
@@ -0,0 +1,34 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"strconv"
+	"syscall/js"
+)
+
+// runWASM sets generate(seed, width, height) as a global function for the
+// page running the WebAssembly build, returning a stage as JSON, or an Error
+// saying why it couldn't be generated. The seed is a number or, for ones
+// too big for a JavaScript number, a string, as -seed takes it. It keeps the
+// program running to be called, never returning. Build it with
+// GOOS=js GOARCH=wasm go build -o dungeon_maze.wasm, and run it with the
+// wasm_exec.js that comes with Go.
+func runWASM() bool {
+	js.Global().Set("generate", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 3 {
+			return js.Global().Get("Error").New("generate takes a seed, a width, and a height")
+		}
+		seed := args[0].String()
+		if args[0].Type() == js.TypeNumber {
+			seed = strconv.FormatFloat(args[0].Float(), 'f', -1, 64)
+		}
+		data, err := generateJSON(seed, args[1].Int(), args[2].Int())
+		if err != nil {
+			return js.Global().Get("Error").New(err.Error())
+		}
+		return data
+	}))
+	select {}
+}
@@ -0,0 +1,10 @@
+//go:build !(js && wasm)
+// +build !js !wasm
+
+package main
+
+// runWASM reports false, since only the WebAssembly build is called from
+// JavaScript instead of run from the command line
+func runWASM() bool {
+	return false
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGenerateJSON(t *testing.T) {
+	srv := httptest.NewServer(NewServer(DefaultOptions()))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/dungeon?width=32&height=15&seed=cellar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// what browsers generate is what the server does
+	got, err := generateJSON("cellar", 32, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("generated\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := generateJSON("7", 5000, 5000); err == nil {
+		t.Error("generated a stage too big to serve")
+	}
+	if _, err := generateJSON("0", 31, 15); err == nil {
+		t.Error("generated a stage seeded 0")
+	}
+}
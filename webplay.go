@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// PlayMessage is what the server sends a client playing over a WebSocket.
+// Type "map" comes first, with the whole stage a row to a string; after
+// each action the client sends comes a "delta" with just the cells whose
+// glyphs changed, and "error" says why an action couldn't be taken. The
+// player isn't drawn on the map, but sent with each message, and Dead is
+// set once they're out of hit points and the game is over.
+type PlayMessage struct {
+	Type    string      `json:"type"`
+	Width   int         `json:"width,omitempty"`
+	Height  int         `json:"height,omitempty"`
+	Rows    []string    `json:"rows,omitempty"`
+	Cells   []GlyphJSON `json:"cells,omitempty"`
+	Player  *PlayerJSON `json:"player,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Dead    bool        `json:"dead,omitempty"`
+}
+
+// GlyphJSON is a cell and the glyph now drawn on it
+type GlyphJSON struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Glyph string `json:"glyph"`
+}
+
+// PlayerJSON is where the player is, their hit points, and the names of
+// what they carry
+type PlayerJSON struct {
+	X         int      `json:"x"`
+	Y         int      `json:"y"`
+	HP        int      `json:"hp"`
+	MaxHP     int      `json:"max_hp"`
+	Inventory []string `json:"inventory"`
+}
+
+// PlayAction is what a client playing over a WebSocket sends to take a
+// turn: "move" a Dir of up, down, left, or right, "wait", "pick_up", or
+// "use" the Item at that index in the inventory
+type PlayAction struct {
+	Action string `json:"action"`
+	Dir    string `json:"dir,omitempty"`
+	Item   int    `json:"item,omitempty"`
+}
+
+// directions are the steps a move action can take
+var directions = map[string][2]int{
+	"up":    {0, -1},
+	"down":  {0, 1},
+	"left":  {-1, 0},
+	"right": {1, 0},
+}
+
+// servePlay generates the stage r asks for and plays it with a client over
+// a WebSocket, a turn for every action it sends, until the player dies or
+// the client goes away
+func servePlay(w http.ResponseWriter, r *http.Request, opts Options) {
+	opts, _, err := dungeonOptions(opts, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	s, err := served.generate(r.Context(), opts.seeded(opts.Seed), "play")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.close()
+
+	s.useStream(playStream)
+	game := newPlaySession(s, NewPlayer(s.entranceX, s.entranceY))
+	send := func(m PlayMessage) bool {
+		data, err := json.Marshal(m)
+		if err == nil {
+			err = ws.write(data)
+		}
+		if err != nil {
+			log.Printf("playing %s: %v", r.URL, err)
+			return false
+		}
+		return true
+	}
+	if !send(game.start()) {
+		return
+	}
+	for {
+		data, err := ws.read()
+		if err != nil {
+			return
+		}
+		var a PlayAction
+		if err := json.Unmarshal(data, &a); err != nil {
+			if !send(PlayMessage{Type: "error", Message: err.Error()}) {
+				return
+			}
+			continue
+		}
+		m := game.act(a)
+		if !send(m) || m.Dead {
+			return
+		}
+	}
+}
+
+// playSession is a game played over a WebSocket, with the glyphs last sent
+// for every cell, to send only the ones that change
+type playSession struct {
+	s     *Stage
+	p     *Player
+	shown []rune
+}
+
+// newPlaySession starts a game of p on s
+func newPlaySession(s *Stage, p *Player) *playSession {
+	return &playSession{s: s, p: p, shown: make([]rune, s.width*s.height)}
+}
+
+// start returns the "map" message the game starts with
+func (g *playSession) start() PlayMessage {
+	s := g.s
+	glyph := s.glyphs(false)
+	rows := make([]string, s.height)
+	for y := 1; y <= s.height; y++ {
+		row := make([]rune, s.width)
+		for x := 1; x <= s.width; x++ {
+			row[x-1] = glyph(x, y)
+			g.shown[(y-1)*s.width+x-1] = row[x-1]
+		}
+		rows[y-1] = string(row)
+	}
+	return PlayMessage{Type: "map", Width: s.width, Height: s.height, Rows: rows, Player: g.player()}
+}
+
+// act takes the turn a asks for, returning the "delta" message saying what
+// changed, or an "error" one if it can't be taken
+func (g *playSession) act(a PlayAction) PlayMessage {
+	s, p := g.s, g.p
+	if p.hp <= 0 {
+		return PlayMessage{Type: "error", Message: "The game is over. ", Player: g.player(), Dead: true}
+	}
+	dx, dy, message := 0, 0, ""
+	switch a.Action {
+	case "move":
+		d, ok := directions[a.Dir]
+		if !ok {
+			return PlayMessage{Type: "error", Message: fmt.Sprintf("unknown direction %q, want up, down, left, or right", a.Dir)}
+		}
+		dx, dy = d[0], d[1]
+	case "wait":
+	case "pick_up":
+		message = s.PickUp(p)
+	case "use":
+		if a.Item < 0 || a.Item >= len(p.inventory) {
+			return PlayMessage{Type: "error", Message: fmt.Sprintf("no item %d in an inventory of %d", a.Item, len(p.inventory))}
+		}
+		message = p.Use(a.Item)
+	default:
+		return PlayMessage{Type: "error", Message: fmt.Sprintf("unknown action %q, want move, wait, pick_up, or use", a.Action)}
+	}
+	message += s.takeTurn(p, dx, dy)
+
+	m := PlayMessage{Type: "delta", Player: g.player(), Message: message, Dead: p.hp <= 0}
+	glyph := s.glyphs(false)
+	for y := 1; y <= s.height; y++ {
+		for x := 1; x <= s.width; x++ {
+			if r, i := glyph(x, y), (y-1)*s.width+x-1; r != g.shown[i] {
+				g.shown[i] = r
+				m.Cells = append(m.Cells, GlyphJSON{x, y, string(r)})
+			}
+		}
+	}
+	return m
+}
+
+// player returns the player as sent to the client
+func (g *playSession) player() *PlayerJSON {
+	p := &PlayerJSON{X: g.p.x, Y: g.p.y, HP: g.p.hp, MaxHP: g.p.maxHP, Inventory: []string{}}
+	for _, item := range g.p.inventory {
+		p.Inventory = append(p.Inventory, item.Name)
+	}
+	return p
+}
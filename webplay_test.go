@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dialPlay opens a WebSocket to srv's /play, returning the connection and a
+// reader of what the server sends
+func dialPlay(t *testing.T, srv *httptest.Server, query string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := "GET /play?" + query + " HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the accept key for the sample nonce in RFC 6455
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake got %s, accept %q", res.Status, res.Header.Get("Sec-WebSocket-Accept"))
+	}
+	return conn, r
+}
+
+// sendFrame writes a masked text frame to conn, as clients have to
+func sendFrame(t *testing.T, conn net.Conn, data string) {
+	t.Helper()
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x81, 0x80 | byte(len(data))}, mask...)
+	for i := 0; i < len(data); i++ {
+		frame = append(frame, data[i]^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readPlayMessage reads a frame from the server as a PlayMessage
+func readPlayMessage(t *testing.T, r *bufio.Reader) PlayMessage {
+	t.Helper()
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	n := int(head[1] & 0x7f)
+	if n == 126 {
+		hi, _ := r.ReadByte()
+		lo, _ := r.ReadByte()
+		n = int(hi)<<8 | int(lo)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		t.Fatal(err)
+	}
+	var m PlayMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("message %q: %v", data, err)
+	}
+	return m
+}
+
+func TestWebSocketPlay(t *testing.T) {
+	srv := httptest.NewServer(NewServer(DefaultOptions()))
+	defer srv.Close()
+	conn, r := dialPlay(t, srv, "width=31&height=15&seed=7")
+	defer conn.Close()
+
+	m := readPlayMessage(t, r)
+	want, err := New(WithSize(31, 15), WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != "map" || len(m.Rows) != 15 || m.Player == nil || m.Player.X != want.entranceX || m.Player.Y != want.entranceY {
+		t.Fatalf("first message is %+v", m)
+	}
+
+	sendFrame(t, conn, `{"action":"dance"}`)
+	if m := readPlayMessage(t, r); m.Type != "error" {
+		t.Errorf("unknown action got %+v", m)
+	}
+	sendFrame(t, conn, `{"action":"wait"}`)
+	if m := readPlayMessage(t, r); m.Type != "delta" || m.Player == nil || m.Player.HP <= 0 {
+		t.Errorf("waiting got %+v", m)
+	}
+}
+
+func TestPlaySession(t *testing.T) {
+	s, err := New(WithSeed(1), WithStocking(0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newPlaySession(s, NewPlayer(s.entranceX, s.entranceY))
+	// with no traps to hide, the map is drawn as the stage prints
+	if start := g.start(); strings.Join(start.Rows, "\n")+"\n" != s.String() {
+		t.Errorf("map is\n%s\nwant\n%s", strings.Join(start.Rows, "\n"), s)
+	}
+	for dir, d := range directions {
+		x, y := s.entranceX+d[0], s.entranceY+d[1]
+		if !s.IsWalkable(x, y) {
+			continue
+		}
+		m := g.act(PlayAction{Action: "move", Dir: dir})
+		if m.Type != "delta" || m.Player.X != x || m.Player.Y != y {
+			t.Fatalf("moving %s from the entrance got %+v", dir, m)
+		}
+		// with nothing on the stage to move, nothing is drawn differently
+		if len(m.Cells) != 0 {
+			t.Errorf("moving %s changed %v", dir, m.Cells)
+		}
+		return
+	}
+	t.Fatal("nowhere to move from the entrance")
+}
+
+func TestWebSocketHandshakeRefused(t *testing.T) {
+	srv := httptest.NewServer(NewServer(DefaultOptions()))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/play")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("plain GET got %s", res.Status)
+	}
+}
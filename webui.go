@@ -0,0 +1,28 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+//go:embed web/index.html
+var webFiles embed.FS
+
+// indexPage is the web UI, drawing stages from /dungeon on a canvas that
+// can be dragged to pan and zoomed with the wheel
+var indexPage = template.Must(template.ParseFS(webFiles, "web/index.html"))
+
+// serveIndex writes the web UI, starting out with the size opts has and
+// no seed, for a stage picked from the clock
+func serveIndex(w http.ResponseWriter, r *http.Request, opts Options) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexPage.Execute(w, opts); err != nil {
+		log.Printf("serving %s: %v", r.URL, err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeIndex(t *testing.T) {
+	srv := httptest.NewServer(NewServer(DefaultOptions()))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<canvas id="stage">`, `value="79"`, `value="21"`, `fetch("dungeon?"`, `id="reroll"`} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("page has no %s", want)
+		}
+	}
+
+	res, err = http.Get(srv.URL + "/nothing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("/nothing got %s", res.Status)
+	}
+}